@@ -0,0 +1,106 @@
+// Command covercheck reads a coverage profile written by go test
+// -coverprofile and fails if the total statement coverage is below a
+// threshold. It is run by make coverage.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	profile := flag.String("profile", "coverage.out", "coverage profile to read")
+	minPct := flag.Float64("min", 0, "minimum total coverage, in percent")
+	flag.Parse()
+
+	f, err := os.Open(*profile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	covered, total, err := parseProfile(f)
+	if err != nil {
+		log.Fatalf("%s: %v", *profile, err)
+	}
+	if total == 0 {
+		log.Fatalf("%s: no statements", *profile)
+	}
+
+	pct := 100 * float64(covered) / float64(total)
+	if pct < *minPct {
+		fmt.Printf("coverage %.1f%% is below the threshold of %.1f%%\n", pct, *minPct)
+		os.Exit(1)
+	}
+
+	fmt.Printf("coverage %.1f%% (threshold %.1f%%)\n", pct, *minPct)
+	// The threshold is a ratchet: raise it with the change that raises
+	// coverage, so that later changes cannot give the gain back.
+	if pct >= *minPct+1 {
+		fmt.Printf("raise COVERAGE_MIN in the Makefile to %.1f\n", float64(int(pct*10))/10)
+	}
+}
+
+// parseProfile returns the number of statements covered and the total in a
+// coverage profile. A block listed more than once, as it is when several
+// test binaries cover the same package, is counted once, and as covered if
+// any listing covers it.
+func parseProfile(r io.Reader) (covered, total int, err error) {
+	type block struct {
+		stmts   int
+		covered bool
+	}
+	blocks := make(map[string]*block)
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if n == 1 {
+			if !strings.HasPrefix(line, "mode: ") {
+				return 0, 0, fmt.Errorf("line 1: want a mode line, got %q", line)
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		// Each line is "file:start.col,end.col statements count".
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return 0, 0, fmt.Errorf("line %d: want position, statements and count, got %q", n, line)
+		}
+		stmts, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("line %d: %w", n, err)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return 0, 0, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		b, ok := blocks[fields[0]]
+		if !ok {
+			b = &block{stmts: stmts}
+			blocks[fields[0]] = b
+		}
+		b.covered = b.covered || count > 0
+	}
+	if err := sc.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, b := range blocks {
+		total += b.stmts
+		if b.covered {
+			covered += b.stmts
+		}
+	}
+	return covered, total, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProfile(t *testing.T) {
+	profile := `mode: set
+example.com/a/a.go:3.10,5.2 2 1
+example.com/a/a.go:7.10,9.2 3 0
+example.com/a/b.go:3.10,5.2 5 0
+example.com/a/b.go:3.10,5.2 5 1
+`
+	covered, total, err := parseProfile(strings.NewReader(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if covered != 7 || total != 10 {
+		t.Errorf("parseProfile = %d of %d; want 7 of 10", covered, total)
+	}
+}
+
+func TestParseProfileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		want    string
+	}{
+		{"no mode line", "example.com/a/a.go:3.10,5.2 2 1\n", "mode line"},
+		{"missing count", "mode: set\nexample.com/a/a.go:3.10,5.2 2\n", "line 2"},
+		{"bad statements", "mode: set\nexample.com/a/a.go:3.10,5.2 x 1\n", "line 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseProfile(strings.NewReader(tt.profile))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseProfile error = %v; want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
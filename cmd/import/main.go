@@ -0,0 +1,79 @@
+// Command import reads newline-delimited JSON snippets from stdin and stores
+// them. Each line is an object with "title", "content" and "expires" (1, 7
+// or 365 days) fields.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/storage"
+)
+
+func main() {
+	dsn := flag.String("dsn", "web:%s@/snippetbox?parseTime=true", "MySQL data source name")
+	userID := flag.Int("user", 0, "ID of the user the snippets belong to (0 for anonymous)")
+	contentStore := flag.String("content-store", "db", "where large snippet content is stored: db or fs")
+	contentDir := flag.String("content-dir", "./data/content", "directory of the fs content store")
+	contentExternal := flag.Int("content-external-threshold", 256<<10, "content longer than this many bytes is kept in the fs content store")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	password := os.Getenv("DB_PASSWORD")
+	if password == "" {
+		logger.Error("DB_PASSWORD environment variable not set")
+		os.Exit(1)
+	}
+
+	db, err := openDB(fmt.Sprintf(*dsn, password))
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	var store models.ContentStore
+	switch *contentStore {
+	case "db":
+		store = &models.DBContentStore{DB: db}
+	case "fs":
+		store = &storage.FSStore{Dir: *contentDir}
+	default:
+		logger.Error("invalid -content-store", "store", *contentStore)
+		os.Exit(1)
+	}
+
+	snippets := &models.SnippetModel{DB: db, Store: store, ExternalThreshold: *contentExternal}
+
+	imported, lineErrs, err := snippets.ImportNDJSON(context.Background(), os.Stdin, *userID)
+	for _, lineErr := range lineErrs {
+		logger.Warn("skipped invalid record", "error", lineErr.Error())
+	}
+	if err != nil {
+		logger.Error(err.Error(), "imported", imported)
+		os.Exit(1)
+	}
+
+	logger.Info("import complete", "imported", imported, "skipped", len(lineErrs))
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,88 @@
+// Command migrate applies pending schema migrations. The migrations are
+// compiled in from internal/models/migrations; run go generate
+// ./internal/models after adding one.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"snippet.robertgleason.ca/internal/models"
+)
+
+func main() {
+	dsn := flag.String("dsn", "web:%s@/snippetbox?parseTime=true", "MySQL data source name")
+	dryRun := flag.Bool("dry-run", false, "list pending migrations without applying them")
+	baseline := flag.Int("baseline", 0, "mark migrations up to this version as applied without running them, for databases set up by hand")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	password := os.Getenv("DB_PASSWORD")
+	if password == "" {
+		logger.Error("DB_PASSWORD environment variable not set")
+		os.Exit(1)
+	}
+
+	db, err := openDB(fmt.Sprintf(*dsn, password))
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if *baseline > 0 {
+		err = models.Baseline(ctx, db, *baseline)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		logger.Info("baseline recorded", "version", *baseline)
+	}
+
+	if *dryRun {
+		pending, err := models.PendingMigrations(ctx, db)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		for _, m := range pending {
+			logger.Info("pending migration", "version", m.Version, "name", m.Name, "statements", len(m.Statements))
+		}
+		logger.Info("migrate dry run", "pending", len(pending))
+		return
+	}
+
+	applied, err := models.Migrate(ctx, db)
+	for _, m := range applied {
+		logger.Info("applied migration", "version", m.Version, "name", m.Name)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	logger.Info("migrate complete", "applied", len(applied))
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,84 @@
+// Command vacuum removes snippets whose content duplicates a newer snippet.
+// With -sweep-orphans it instead reconciles the filesystem content store with
+// the database.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/storage"
+)
+
+func main() {
+	dsn := flag.String("dsn", "web:%s@/snippetbox?parseTime=true", "MySQL data source name")
+	dryRun := flag.Bool("dry-run", false, "report how many snippets would be deleted without deleting them")
+	sweepOrphans := flag.Bool("sweep-orphans", false, "delete content store files without a live snippet and report snippets missing their content")
+	contentDir := flag.String("content-dir", "./data/content", "directory of the fs content store")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	password := os.Getenv("DB_PASSWORD")
+	if password == "" {
+		logger.Error("DB_PASSWORD environment variable not set")
+		os.Exit(1)
+	}
+
+	db, err := openDB(fmt.Sprintf(*dsn, password))
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	snippets := &models.SnippetModel{DB: db}
+
+	if *sweepOrphans {
+		snippets.Store = &storage.FSStore{Dir: *contentDir}
+
+		removed, missing, err := snippets.SweepOrphans(context.Background())
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		logger.Info("orphan sweep complete", "removed", removed, "missing", len(missing))
+		for _, id := range missing {
+			logger.Warn("snippet content missing from store", "id", id)
+		}
+		return
+	}
+
+	count, err := snippets.Vacuum(context.Background(), *dryRun)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if *dryRun {
+		logger.Info("vacuum dry run", "would_delete", count)
+	} else {
+		logger.Info("vacuum complete", "deleted", count)
+	}
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
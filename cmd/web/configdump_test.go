@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/models/mock"
+)
+
+// secretWords are the words that mark a config field as secret-bearing.
+var secretWords = []string{"password", "secret", "key"}
+
+func secretBearing(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range secretWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestConfigDumpRedactsSecrets(t *testing.T) {
+	cfg := config{
+		addr:          ":4000",
+		dsn:           "web:hunter2@tcp(db.internal:3306)/snippetbox?parseTime=true&tls=true",
+		htmlTimeout:   5 * time.Second,
+		shareSecret:   []byte("share-signing-key"),
+		secretScan:    "block",
+		contentLimits: contentLimits{Soft: 10, Hard: 20},
+	}
+
+	js, err := json.Marshal(cfg.dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{"hunter2", "share-signing-key"} {
+		if strings.Contains(string(js), leak) {
+			t.Errorf("dump contains %q: %s", leak, js)
+		}
+	}
+
+	var got struct {
+		Config  map[string]any `json:"config"`
+		Derived configDerived  `json:"derived"`
+	}
+	err = json.Unmarshal(js, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, value := range got.Config {
+		if secretBearing(name) && value != redacted {
+			t.Errorf("%s = %v; want %q", name, value, redacted)
+		}
+	}
+
+	if got.Config["addr"] != ":4000" {
+		t.Errorf("addr = %v; want :4000", got.Config["addr"])
+	}
+	if got.Config["html_timeout"] != "5s" {
+		t.Errorf("html_timeout = %v; want 5s", got.Config["html_timeout"])
+	}
+	if got.Config["log_level"] != "INFO" {
+		t.Errorf("log_level = %v; want INFO", got.Config["log_level"])
+	}
+
+	want := configDerived{
+		DSNHost:              "db.internal:3306",
+		DSNDatabase:          "snippetbox",
+		DSNTLS:               true,
+		HomePageSize:         homePageSize,
+		UserSnippetsPageSize: userSnippetsPageSize,
+	}
+	if got.Derived != want {
+		t.Errorf("derived = %+v; want %+v", got.Derived, want)
+	}
+}
+
+func TestConfigDumpListsEveryField(t *testing.T) {
+	// Every field is either shown or redacted, so the dump has one entry
+	// per field. A new field fails this until it is added to dump.
+	cfg := config{dsn: "web:%s@/snippetbox?parseTime=true"}
+	dump := cfg.dump()
+
+	if n := reflect.TypeFor[config]().NumField(); len(dump.Config) != n {
+		t.Errorf("dump has %d fields; want %d", len(dump.Config), n)
+	}
+	if dump.Config["dsn"] != redacted {
+		t.Errorf("dsn = %v; want %q", dump.Config["dsn"], redacted)
+	}
+	if dump.Derived.DSNHost != "127.0.0.1:3306" || dump.Derived.DSNTLS {
+		t.Errorf("derived = %+v; want the default host without TLS", dump.Derived)
+	}
+}
+
+func TestDebugConfig(t *testing.T) {
+	app := newTestApp(t)
+	app.config.shareSecret = []byte("share-signing-key")
+
+	rr := app.testGet(t, "/debug/config")
+	assertStatus(t, rr, http.StatusSeeOther)
+	assertHeader(t, rr, "Location", "/user/login")
+
+	client := app.newTestClient(t)
+	client.login(app)
+	assertStatus(t, client.get("/debug/config"), http.StatusForbidden)
+
+	app.users.(*mock.MockUserModel).User = models.User{ID: 1, Name: "Admin", IsAdmin: true}
+	rr = client.get("/debug/config")
+
+	assertStatus(t, rr, http.StatusOK)
+	assertHeader(t, rr, "Content-Type", "application/json")
+	assertHeader(t, rr, "Cache-Control", "no-store")
+	if strings.Contains(rr.Body.String(), "share-signing-key") {
+		t.Errorf("response contains the share secret: %s", rr.Body)
+	}
+}
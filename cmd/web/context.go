@@ -2,4 +2,8 @@ package main
 
 type contextKey string
 
-const isAuthenticatedContextKey = contextKey("isAuthenticated")
+const (
+	isAuthenticatedContextKey  = contextKey("isAuthenticated")
+	rateLimitWarningContextKey = contextKey("rateLimitWarning")
+	impersonatorContextKey     = contextKey("impersonator")
+)
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// AppError is how a handler fails a request: Code is the response status,
+// Message the text shown to the user and Cause the underlying error, if
+// any. The cause is logged but never shown, so model and template errors
+// cannot leak into responses.
+type AppError struct {
+	Code    int
+	Message string
+	Cause   error
+}
+
+func (e *AppError) Error() string {
+	if e.Cause == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Cause.Error()
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Cause
+}
+
+// statusError returns an AppError for code with the standard status text as
+// its message.
+func statusError(code int, cause error) *AppError {
+	return &AppError{Code: code, Message: http.StatusText(code), Cause: cause}
+}
+
+// NotFound is a 404 for a missing or hidden resource, such as an unknown
+// snippet ID or another user's snippet.
+func NotFound(cause error) *AppError {
+	return statusError(http.StatusNotFound, cause)
+}
+
+// BadRequest is a 400 for malformed input. msg is shown to the user, so it
+// should say what was wrong without echoing the input.
+func BadRequest(msg string) *AppError {
+	return &AppError{Code: http.StatusBadRequest, Message: msg}
+}
+
+// Forbidden is a 403 for a request the user may not make.
+func Forbidden(cause error) *AppError {
+	return statusError(http.StatusForbidden, cause)
+}
+
+// Internal is a 500 for a failure that is not the user's fault.
+func Internal(cause error) *AppError {
+	return statusError(http.StatusInternalServerError, cause)
+}
+
+// Causes of client errors, logged to explain the response.
+var (
+	errInvalidFormToken = errors.New("form token missing, reused or invalid")
+	errNotAdmin         = errors.New("user is not an admin")
+	errNotOwner         = errors.New("snippet belongs to another user")
+	errImpersonating    = errors.New("not allowed while impersonating")
+)
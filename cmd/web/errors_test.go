@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"snippet.robertgleason.ca/internal/models"
+)
+
+func TestServerError(t *testing.T) {
+	cause := errors.New("snippets.Get: dial tcp: connection refused")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   string
+	}{
+		{"model error", cause, http.StatusInternalServerError, "Internal Server Error"},
+		{"wrapped app error", fmt.Errorf("loading: %w", NotFound(cause)), http.StatusNotFound, "Not Found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			logs := withLogBuffer(app)
+
+			rr := httptest.NewRecorder()
+			app.serverError(rr, httptest.NewRequest(http.MethodGet, "/snippet/view/1", nil), tt.err)
+
+			assertStatus(t, rr, tt.status)
+			if got := strings.TrimSpace(rr.Body.String()); got != tt.body {
+				t.Errorf("body = %q; want %q", got, tt.body)
+			}
+			if strings.Contains(rr.Body.String(), "connection refused") {
+				t.Error("response body contains the cause")
+			}
+			for _, want := range []string{"level=ERROR", "connection refused", fmt.Sprintf("status=%d", tt.status)} {
+				if !strings.Contains(logs.String(), want) {
+					t.Errorf("log %q does not contain %q", logs.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestClientError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    *AppError
+		status int
+		body   string
+		log    string
+	}{
+		{"bad request", BadRequest("Limit must be a number"), http.StatusBadRequest, "Limit must be a number", ""},
+		{"forbidden", Forbidden(errInvalidFormToken), http.StatusForbidden, "Forbidden", errInvalidFormToken.Error()},
+		{"not found", NotFound(errNotOwner), http.StatusNotFound, "Not Found", errNotOwner.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			var logs bytes.Buffer
+			app.httpLogger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			rr := httptest.NewRecorder()
+			app.clientError(rr, httptest.NewRequest(http.MethodPost, "/snippet/create", nil), tt.err)
+
+			assertStatus(t, rr, tt.status)
+			if got := strings.TrimSpace(rr.Body.String()); got != tt.body {
+				t.Errorf("body = %q; want %q", got, tt.body)
+			}
+
+			if tt.log == "" {
+				if logs.Len() > 0 {
+					t.Errorf("logged %q for an error without a cause", logs.String())
+				}
+				return
+			}
+			if !strings.Contains(logs.String(), "level=DEBUG") || !strings.Contains(logs.String(), tt.log) {
+				t.Errorf("log %q does not contain a debug entry with %q", logs.String(), tt.log)
+			}
+			if strings.Contains(rr.Body.String(), tt.log) {
+				t.Error("response body contains the cause")
+			}
+		})
+	}
+}
+
+func TestAppErrorUnwrap(t *testing.T) {
+	err := fmt.Errorf("handler: %w", Forbidden(errNotAdmin))
+
+	if !errors.Is(err, errNotAdmin) {
+		t.Error("errors.Is does not find the cause")
+	}
+
+	var appErr *AppError
+	if !errors.As(err, &appErr) || appErr.Code != http.StatusForbidden {
+		t.Errorf("errors.As = %v; want a 403 AppError", appErr)
+	}
+	if got, want := appErr.Error(), "Forbidden: user is not an admin"; got != want {
+		t.Errorf("Error() = %q; want %q", got, want)
+	}
+}
+
+// TestModelErrorChain runs the real snippet model against a stub database, so
+// that driver errors pass through the model's wrapping into the handlers'
+// errors.Is checks.
+func TestModelErrorChain(t *testing.T) {
+	t.Run("no row is a 404", func(t *testing.T) {
+		app := newTestApp(t)
+		app.snippets = &models.SnippetModel{DB: (&stubDB{}).open(), Logger: app.dbLogger}
+
+		rr := app.testGet(t, "/snippet/view/7")
+
+		assertStatus(t, rr, http.StatusNotFound)
+	})
+
+	t.Run("duplicate key is a field error", func(t *testing.T) {
+		app := newTestApp(t)
+		db := &stubDB{exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			return nil, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1-An old silent pond' for key 'snippets.snippets_uc_user_title'"}
+		}}
+		app.snippets = &models.SnippetModel{DB: db.open(), Logger: app.dbLogger}
+		client := app.newTestClient(t)
+		client.login(app)
+
+		form := client.formTokens("/snippet/create")
+		form.Set("title", "An old silent pond")
+		form.Set("content", "A haiku.")
+		form.Set("expires", "7")
+		rr := client.postForm("/snippet/create", form)
+
+		assertStatus(t, rr, http.StatusUnprocessableEntity)
+		assertBody(t, rr, "You already have a snippet with this title.")
+	})
+
+	t.Run("driver failure is a 500 naming the operation", func(t *testing.T) {
+		app := newTestApp(t)
+		var dbLogs bytes.Buffer
+		app.dbLogger = slog.New(slog.NewTextHandler(&dbLogs, nil))
+		logs := withLogBuffer(app)
+		db := &stubDB{query: func(string, []driver.NamedValue) ([]string, [][]driver.Value, error) {
+			return nil, nil, errors.New("connection refused")
+		}}
+		app.snippets = &models.SnippetModel{DB: db.open(), Logger: app.dbLogger}
+
+		rr := app.testGet(t, "/snippet/view/7")
+
+		assertStatus(t, rr, http.StatusInternalServerError)
+		for _, want := range []string{`msg="database operation failed"`, "op=snippets.Get", "error=\"connection refused\""} {
+			if !strings.Contains(dbLogs.String(), want) {
+				t.Errorf("db log %q does not contain %q", dbLogs.String(), want)
+			}
+		}
+		if want := "snippets.Get: connection refused"; !strings.Contains(logs.String(), want) {
+			t.Errorf("http log %q does not contain %q", logs.String(), want)
+		}
+	})
+}
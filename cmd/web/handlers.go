@@ -1,26 +1,151 @@
 package main
 
 import (
+	"archive/zip"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 
+	"snippet.robertgleason.ca/internal/events"
 	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/secrets"
+	"snippet.robertgleason.ca/internal/sharelink"
+	"snippet.robertgleason.ca/internal/spamfilter"
 	"snippet.robertgleason.ca/internal/validator"
+	"snippet.robertgleason.ca/ui"
 )
 
+// ping reports readiness. It returns 503 only when the database is
+// unreachable; stale background components are reported as "degraded" with a
+// 200 so monitoring can alert without the instance being pulled from rotation.
+func (app *application) ping(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	err := app.db.PingContext(r.Context())
+	if err != nil {
+		app.dbLogger.Error(err.Error(), "method", r.Method, "url", r.URL.RequestURI())
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("database unavailable\n"))
+		return
+	}
+
+	stale := app.health.Stale()
+	if len(stale) > 0 {
+		fmt.Fprintf(w, "degraded: %s\n", strings.Join(stale, ", "))
+		return
+	}
+
+	w.Write([]byte("OK\n"))
+}
+
+// Page sizes of the home page and the "My snippets" listing.
+const (
+	homePageSize         = 10
+	userSnippetsPageSize = 20
+)
+
+// latestTTL is how long the home page's default listing is cached.
+const latestTTL = 30 * time.Second
+
+// latestKey is the latestCache key of the home page's default listing: the
+// first page of snippets in every language, newest first.
+const latestKey = "latest"
+
+// latestSnippets is a cached home page listing and the total it paginates.
+type latestSnippets struct {
+	snippets []*models.Snippet
+	total    int
+}
+
+// homeSnippets lists the snippets for the home page. The default listing,
+// which most visits see, is served from latestCache for up to latestTTL.
+// Handlers that add or rename a snippet drop it so that the change shows at
+// once.
+func (app *application) homeSnippets(ctx context.Context, filters models.SnippetFilters) ([]*models.Snippet, int, error) {
+	latest := filters.Language == "" && filters.Sort == models.SortCreatedDesc && filters.Page == 1
+	if latest {
+		if l, ok := app.latestCache.Get(latestKey); ok {
+			return l.snippets, l.total, nil
+		}
+	}
+
+	snippets, total, err := app.snippets.List(ctx, filters)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if latest {
+		app.latestCache.Set(latestKey, latestSnippets{snippets: snippets, total: total})
+	}
+	return snippets, total, nil
+}
+
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-	snippets, err := app.snippets.Latest()
+	query := r.URL.Query()
+
+	languages, err := app.languageCounts(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	filters := models.SnippetFilters{
+		Language: knownLanguage(languages, query.Get("lang")),
+		Page:     1,
+		PageSize: homePageSize,
+	}
+	if !readSortAndPage(query, &filters) {
+		app.clientError(w, r, BadRequest("Invalid sort or page"))
+		return
+	}
+
+	snippets, total, err := app.homeSnippets(r.Context(), filters)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	// Page links carry the filters as applied, so an ignored lang is dropped.
+	linkQuery := url.Values{}
+	if filters.Language != "" {
+		linkQuery.Set("lang", filters.Language)
+	}
+	if filters.Sort != models.SortCreatedDesc {
+		linkQuery.Set("sort", filters.Sort)
+	}
+
 	data := app.newTemplateData(r)
 	data.Snippets = snippets
+	data.Filters = filters
+	data.Languages = languages
+	data.Pagination = newPagination(filters.Page, filters.PageSize, total, linkQuery)
+
+	w.Header().Add("Vary", "HX-Request")
+	if isHTMX(r) {
+		app.renderPartial(w, r, http.StatusOK, "home.tmpl", "snippet-list", data)
+		return
+	}
+
+	// The featured sidebar is outside the list that HTMX swaps, so it is
+	// only looked up for the full page.
+	data.FeaturedSnippets, err = app.snippets.ListFeatured(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
 	app.render(w, r, http.StatusOK, "home.tmpl", data)
 }
@@ -28,14 +153,14 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.NotFound(w, r)
+		app.clientError(w, r, NotFound(err))
 		return
 	}
 
-	snippet, err := app.snippets.Get(id)
+	snippet, err := app.snippets.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			http.NotFound(w, r)
+			app.clientError(w, r, NotFound(err))
 			return
 		} else {
 			app.serverError(w, r, err)
@@ -43,175 +168,2013 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Views by an impersonating admin stay out of the user's history.
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if app.isAuthenticated(r) && impersonatorID(r) == 0 {
+		err = app.snippets.RecordView(r.Context(), userID, snippet.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	data.IsOwner = snippet.UserID != 0 && snippet.UserID == userID
+	if data.IsOwner {
+		data.SupportedLanguages = app.config.languages
+
+		data.Versions, err = app.snippets.ListVersions(r.Context(), snippet.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	app.setMeta(&data,
+		"og:title", snippet.Title,
+		"og:description", excerpt(snippet.Content, 160),
+		"og:url", app.linkURL(r, fmt.Sprintf("/snippet/view/%d", snippet.ID)),
+		"og:type", "article",
+		"article:published_time", snippet.Created.UTC().Format(time.RFC3339),
+	)
 
 	app.render(w, r, http.StatusOK, "view.tmpl", data)
 }
 
-func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
+// snippetCopyText serves the raw content of a snippet as plain text for the
+// copy-to-clipboard button.
+func (app *application) snippetCopyText(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, NotFound(err))
+		return
+	}
 
-	data.Form = snippetCreateForm{
-		Expires: 365,
+	content, err := app.snippets.OpenContent(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
 	}
+	defer content.Close()
 
-	app.render(w, r, http.StatusOK, "create.tmpl", data)
+	// The embed script fetches this from other sites.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline")
+	io.Copy(w, content)
 }
 
-type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
-	validator.Validator `form:"-"`
+// embedScript is the snippet the embed script renders, in the call that
+// snippetEmbedScript appends to ui/static/js/embed.js.
+type embedScript struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	Language   string `json:"language"`
+	URL        string `json:"url"`
+	ContentURL string `json:"content_url"`
 }
 
-func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
-	var form snippetCreateForm
-
-	err := app.decodePostForm(r, &form)
+// snippetEmbedScript serves a script that renders the snippet on another
+// site where its <script> tag stands, fetching the content from
+// snippetCopyText. The script is ui/static/js/embed.js, a function
+// expression, called with the snippet's details as a JSON literal, so it
+// needs no eval and works under a strict Content-Security-Policy.
+func (app *application) snippetEmbedScript(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, NotFound(err))
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedValues(form.Expires, 1, 7, 365), "expires", "This field must be one of the following values: 1, 7, or 365")
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
 
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
+	script, err := ui.Files.ReadFile("static/js/embed.js")
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	// json.Marshal escapes <, > and &, so a title cannot close the host
+	// page's script element.
+	call, err := json.Marshal(embedScript{
+		ID:         snippet.ID,
+		Title:      snippet.Title,
+		Language:   snippet.Language,
+		URL:        app.linkURL(r, fmt.Sprintf("/snippet/view/%d", snippet.ID)),
+		ContentURL: app.linkURL(r, fmt.Sprintf("/snippet/view/%d/copy-text", snippet.ID)),
+	})
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(script)
+	fmt.Fprintf(w, "(%s);\n", call)
 }
 
-type userSignupForm struct {
-	Name                string `form:"name"`
-	Email               string `form:"email"`
-	Password            string `form:"password"`
-	validator.Validator `form:"-"`
+// maxSimilar is the most similar snippets snippetSimilar returns, and the
+// number it looks up and caches for each snippet.
+const maxSimilar = 5
+
+// similarTTL is how long a snippet's similar snippets are cached before
+// they are looked up again.
+const similarTTL = 10 * time.Minute
+
+// similarCache holds the similar snippets most recently looked up for each
+// snippet, by its ID.
+type similarCache struct {
+	mu      sync.Mutex
+	entries map[int]similarEntry
 }
 
-func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = userSignupForm{}
-	app.render(w, r, http.StatusOK, "signup.tmpl", data)
+type similarEntry struct {
+	snippets []*models.Snippet
+	fetched  time.Time
 }
 
-func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
-	var form userSignupForm
+// similarSnippets returns up to maxSimilar snippets like the one with the
+// given ID, looking them up at most once every similarTTL. Stale entries for
+// other snippets are dropped whenever one is stored.
+func (app *application) similarSnippets(ctx context.Context, id int) ([]*models.Snippet, error) {
+	now := app.clock.Now()
 
-	err := app.decodePostForm(r, &form)
+	app.similarCache.mu.Lock()
+	entry, ok := app.similarCache.entries[id]
+	app.similarCache.mu.Unlock()
+
+	if ok && now.Sub(entry.fetched) <= similarTTL {
+		return entry.snippets, nil
+	}
+
+	snippets, err := app.snippets.Similar(ctx, id, maxSimilar)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
+		return nil, err
 	}
 
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
-	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	app.similarCache.mu.Lock()
+	if app.similarCache.entries == nil {
+		app.similarCache.entries = make(map[int]similarEntry)
+	}
+	for cached, e := range app.similarCache.entries {
+		if now.Sub(e.fetched) > similarTTL {
+			delete(app.similarCache.entries, cached)
+		}
+	}
+	app.similarCache.entries[id] = similarEntry{snippets: snippets, fetched: now}
+	app.similarCache.mu.Unlock()
 
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
+	return snippets, nil
+}
+
+// snippetSimilar lists up to limit snippets with content like the snippet's,
+// most similar first, for the sidebar on its page. limit defaults to, and is
+// capped at, maxSimilar.
+func (app *application) snippetSimilar(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, NotFound(err))
 		return
 	}
 
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	limit := maxSimilar
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil {
+			app.clientError(w, r, BadRequest("Limit must be a number"))
+			return
+		}
+		limit = min(max(limit, 1), maxSimilar)
+	}
+
+	similar, err := app.similarSnippets(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.AddFieldError("email", "Email address is already in use")
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
 		} else {
 			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	snippets := make([]apiSnippetSummary, 0, limit)
+	for _, s := range similar[:min(len(similar), limit)] {
+		snippets = append(snippets, apiSnippetSummary{
+			ID:       s.ID,
+			Title:    s.Title,
+			URL:      app.linkURL(r, fmt.Sprintf("/snippet/view/%d", s.ID)),
+			Created:  s.Created,
+			Updated:  s.Updated,
+			Language: s.Language,
+			Excerpt:  excerpt(s.Content, 160),
+		})
+	}
+
+	app.renderJSON(w, r, http.StatusOK, snippets)
 }
 
-type userLoginForm struct {
-	Email               string `form:"email"`
-	Password            string `form:"password"`
+func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	form := snippetCreateForm{
+		Expires: models.DefaultExpiryDays,
+	}
+
+	draft, ok := app.sessionManager.Get(r.Context(), "draft").(snippetDraft)
+	if ok {
+		form.Title = draft.Title
+		form.Content = draft.Content
+		data.Notice = fmt.Sprintf("Restored your draft from %s.", timeAgo(app.clock.Now().Sub(draft.Saved)))
+	}
+
+	data.Form = form
+
+	app.render(w, r, http.StatusOK, "create.tmpl", data)
+}
+
+// maxDraftBytes caps the size of an autosaved draft request body.
+const maxDraftBytes = 64 << 10
+
+// snippetDraft is an unsaved snippet kept in the session so that it survives
+// the create page being closed. Drafts never touch the database.
+type snippetDraft struct {
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Language string    `json:"language"`
+	Saved    time.Time `json:"-"`
+}
+
+// snippetDraftPost stores the posted draft in the session, replacing any
+// previous one.
+func (app *application) snippetDraftPost(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDraftBytes)
+
+	var draft snippetDraft
+
+	err := app.readJSON(w, r, &draft)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.clientError(w, r, statusError(http.StatusRequestEntityTooLarge, err))
+		} else {
+			app.clientError(w, r, BadRequest("Invalid draft"))
+		}
+		return
+	}
+
+	draft.Saved = app.clock.Now()
+	app.sessionManager.Put(r.Context(), "draft", draft)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type snippetCreateForm struct {
+	Title               string `form:"title"`
+	Content             string `form:"content"`
+	Expires             int    `form:"expires"`
+	ConfirmSecrets      bool   `form:"confirm_secrets"`
+	SecretLines         []int  `form:"-"`
 	validator.Validator `form:"-"`
 }
 
-func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = userLoginForm{}
-	app.render(w, r, http.StatusOK, "login.tmpl", data)
+// ExpiresTime returns when a snippet created at now with this form would
+// expire. It takes now, rather than reading the time itself, so that pages
+// follow the application clock.
+func (f snippetCreateForm) ExpiresTime(now time.Time) time.Time {
+	return now.UTC().AddDate(0, 0, f.Expires)
 }
 
-func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
-	var form userLoginForm
+// SecretLinesText formats SecretLines as "line 3" or "lines 3, 7".
+func (f snippetCreateForm) SecretLinesText() string {
+	nums := make([]string, len(f.SecretLines))
+	for i, n := range f.SecretLines {
+		nums[i] = strconv.Itoa(n)
+	}
+	if len(nums) == 1 {
+		return "line " + nums[0]
+	}
+	return "lines " + strings.Join(nums, ", ")
+}
+
+// Validate checks every field of the form, recording failures on the embedded
+// Validator. A maxContentChars of zero means the content length is unlimited;
+// maxControlRatio is the proportion of control characters above which the
+// content is rejected as binary.
+func (f *snippetCreateForm) Validate(maxContentChars int, maxControlRatio float64) {
+	input := models.SnippetInput{Title: f.Title, Content: f.Content, Expires: f.Expires}
+	input.Check(&f.Validator, maxContentChars, maxControlRatio)
+}
+
+// checkContentSize records a content error if the form content is over the
+// hard limit. The message gives both sizes, so it is run before Validate to
+// take precedence over the character limit.
+func (app *application) checkContentSize(form *snippetCreateForm) {
+	limit := app.config.contentLimits.Hard
+	if limit == 0 || len(form.Content) <= limit {
+		return
+	}
+
+	size, maximum := humanBytes(len(form.Content)), humanBytes(limit)
+	if size == maximum {
+		size, maximum = pluralize(len(form.Content), "byte"), pluralize(limit, "byte")
+	}
+	form.AddFieldError("content", fmt.Sprintf("This snippet is %s, which is over the maximum of %s", size, maximum))
+}
+
+// checkSecrets scans the form content for likely credentials according to
+// the -secret-scan mode. In block mode a match is a content error; in warn mode
+// the matching lines are recorded so that the form asks the user to confirm.
+func (app *application) checkSecrets(form *snippetCreateForm) {
+	if app.config.secretScan == "off" {
+		return
+	}
+
+	findings := secrets.Scan(form.Content)
+	if len(findings) == 0 {
+		return
+	}
+
+	if app.config.secretScan == "block" {
+		form.SecretLines = secrets.Lines(findings)
+		form.AddFieldError("content", fmt.Sprintf("This looks like it contains a password or key on %s. Remove it before saving", form.SecretLinesText()))
+		return
+	}
+
+	form.SecretLines = secrets.Lines(findings)
+}
+
+// checkSpam runs the spam filter over the form. A snippet the filter rejects
+// is given a validation error; any other decision is returned so that it can
+// be recorded once the snippet is saved.
+func (app *application) checkSpam(r *http.Request, form *snippetCreateForm) spamfilter.Decision {
+	decision := app.spamFilter.Check(form.Title, form.Content)
+	if decision.Action != spamfilter.Reject {
+		return decision
+	}
+
+	events.SpamFiltered(r.Context(), app.logger, 0, decision.Action.String(), decision.Rule, decision.Detail)
+	if decision.Rule == "title-urls" {
+		form.AddFieldError("title", "This title has "+decision.Detail)
+	} else {
+		form.AddNonFieldError("This snippet looks like spam, so it can't be published")
+	}
+	return decision
+}
+
+func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
 
 	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, BadRequest("Invalid form submission"))
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	if !app.validateFormToken(r, r.PostForm.Get("form_token")) {
+		app.clientError(w, r, Forbidden(errInvalidFormToken))
+		return
+	}
 
-	if !form.Valid() {
+	app.checkContentSize(&form)
+	form.Validate(app.config.maxContentChars, app.config.maxControlRatio)
+	app.checkSecrets(&form)
+	spam := app.checkSpam(r, &form)
+
+	if !form.Valid() || (form.SecretLines != nil && !form.ConfirmSecrets) {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
 		return
 	}
 
-	userID, err := app.users.Authenticate(form.Email, form.Password)
+	allowed, resetAt, err := app.checkSnippetQuota(r)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddNonFieldError("email address or password is incorrect")
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
-		} else {
-			app.serverError(w, r, err)
-		}
+		app.serverError(w, r, err)
+		return
+	}
+	if !allowed {
+		form.AddNonFieldError(fmt.Sprintf("You have reached your daily snippet limit. You can create more snippets after %s UTC.", humanDate(resetAt)))
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "create.tmpl", data)
 		return
 	}
 
-	err = app.sessionManager.RenewToken(r.Context())
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	id, err := app.snippets.Insert(r.Context(), form.Title, form.Content, form.Expires, userID)
 	if err != nil {
-		app.serverError(w, r, err)
+		var invalid *models.InvalidInputError
+		switch {
+		case errors.As(err, &invalid):
+			form.AddFieldError(invalid.Field, invalid.Message)
+		case errors.Is(err, models.ErrDuplicateTitle):
+			form.AddFieldError("title", "You already have a snippet with this title.")
+		case errors.Is(err, models.ErrDuplicateContent):
+			form.AddFieldError("content", "You already have a snippet with this content.")
+		default:
+			app.serverError(w, r, err)
+			return
+		}
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", userID)
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	owner := events.OwnerAnonymous
+	if userID != 0 {
+		owner = events.OwnerUser
+	}
+	events.SnippetCreated(r.Context(), app.logger, id, len(form.Content), form.Expires, owner)
+
+	if spam.Matched() {
+		err = app.snippets.RecordSpamDecision(r.Context(), id, spam.Action.String(), spam.Rule+": "+spam.Detail, spam.Action == spamfilter.Shadow)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		events.SpamFiltered(r.Context(), app.logger, id, spam.Action.String(), spam.Rule, spam.Detail)
+	}
+	app.latestCache.Delete(latestKey)
+
+	app.sessionManager.Remove(r.Context(), "draft")
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
-func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	err := app.sessionManager.RenewToken(r.Context())
+func (app *application) userSnippets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filters := models.SnippetFilters{
+		UserID:   app.sessionManager.GetInt(r.Context(), "authenticatedUserID"),
+		Language: query.Get("lang"),
+		Tag:      query.Get("tag"),
+		Query:    query.Get("q"),
+		Page:     1,
+		PageSize: userSnippetsPageSize,
+	}
+	if !readSortAndPage(query, &filters) {
+		app.clientError(w, r, BadRequest("Invalid sort or page"))
+		return
+	}
+
+	snippets, total, err := app.snippets.List(r.Context(), filters)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
-	app.sessionManager.Put(r.Context(), "flash", "You have been logged out successfully.")
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Filters = filters
+	data.Pagination = newPagination(filters.Page, filters.PageSize, total, query)
+
+	w.Header().Add("Vary", "HX-Request")
+	if isHTMX(r) {
+		app.renderPartial(w, r, http.StatusOK, "user_snippets.tmpl", "snippet-results", data)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "user_snippets.tmpl", data)
+}
+
+// userSnippetsExport downloads all of the user's snippets as
+// newline-delimited JSON. The export is copied to the client as it is read
+// from the database, so the route is not wrapped by the buffering timeout.
+func (app *application) userSnippetsExport(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	export, err := app.snippets.FullExport(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	defer export.Close()
+
+	filename := "snippets-" + app.clock.Now().UTC().Format("20060102") + ".ndjson"
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "private, no-store")
+	app.extendWriteDeadline(w, r)
+
+	// Once the export has started, a failure can only be logged: the client
+	// sees a truncated download.
+	_, err = io.Copy(w, export)
+	if err != nil && r.Context().Err() == nil {
+		app.requestLogger(r).Error("snippet export failed", "user_id", userID, "error", err)
+	}
+}
+
+// leaderboardTTL is how long the leaderboard is cached before it is
+// recomputed.
+const leaderboardTTL = 10 * time.Minute
+
+// leaderboardCache holds the most recently computed leaderboard.
+type leaderboardCache struct {
+	mu      sync.RWMutex
+	entries []models.UserSnippetCount
+	fetched time.Time
+}
+
+// languageCountsTTL is how long the per-language snippet counts are cached
+// before they are recomputed.
+const languageCountsTTL = time.Minute
+
+// languageCountsCache holds the most recently computed language counts.
+type languageCountsCache struct {
+	mu      sync.RWMutex
+	counts  []models.LanguageCount
+	fetched time.Time
+}
+
+// languageCounts returns the number of listed snippets in each language,
+// recomputing them at most once every languageCountsTTL.
+func (app *application) languageCounts(ctx context.Context) ([]models.LanguageCount, error) {
+	now := app.clock.Now()
+
+	app.languageCountsCache.mu.RLock()
+	counts, fetched := app.languageCountsCache.counts, app.languageCountsCache.fetched
+	app.languageCountsCache.mu.RUnlock()
+
+	if !fetched.IsZero() && now.Sub(fetched) <= languageCountsTTL {
+		return counts, nil
+	}
+
+	counts, err := app.snippets.LanguageCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	app.languageCountsCache.mu.Lock()
+	app.languageCountsCache.counts = counts
+	app.languageCountsCache.fetched = now
+	app.languageCountsCache.mu.Unlock()
+
+	return counts, nil
+}
+
+func (app *application) leaderboard(w http.ResponseWriter, r *http.Request) {
+	now := app.clock.Now()
+
+	app.leaderboardCache.mu.RLock()
+	entries, fetched := app.leaderboardCache.entries, app.leaderboardCache.fetched
+	app.leaderboardCache.mu.RUnlock()
+
+	if fetched.IsZero() || now.Sub(fetched) > leaderboardTTL {
+		var err error
+		entries, err = app.snippets.TopContributors(r.Context(), 10)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.leaderboardCache.mu.Lock()
+		app.leaderboardCache.entries = entries
+		app.leaderboardCache.fetched = now
+		app.leaderboardCache.mu.Unlock()
+	}
+
+	data := app.newTemplateData(r)
+	data.Leaderboard = entries
+
+	app.render(w, r, http.StatusOK, "leaderboard.tmpl", data)
+}
+
+// discoverPerLanguage is the number of snippets in each section of
+// /discover.
+const discoverPerLanguage = 1
+
+// discoverSection is one language's part of the discover page.
+type discoverSection struct {
+	Language string
+	Snippets []*models.Snippet
+}
+
+// discover shows the most recent snippet in each of -discover-languages,
+// one section per language in the configured order.
+func (app *application) discover(w http.ResponseWriter, r *http.Request) {
+	languages := app.config.discoverLanguages
+
+	recent, err := app.snippets.MostRecentByLanguage(r.Context(), languages, discoverPerLanguage)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	for _, language := range languages {
+		data.Discover = append(data.Discover, discoverSection{Language: language, Snippets: recent[language]})
+	}
+
+	app.render(w, r, http.StatusOK, "discover.tmpl", data)
+}
+
+func (app *application) adminDashboard(w http.ResponseWriter, r *http.Request) {
+	counts, err := app.snippets.CountByLanguage(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	expired, err := app.snippets.CountExpired(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	size, err := app.snippets.StorageSizeBytes(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.LanguageChart = newBarChart(counts)
+	data.Storage = storageStats{Expired: expired, ContentBytes: int(size)}
+
+	app.render(w, r, http.StatusOK, "admin.tmpl", data)
+}
+
+// adminUsersPageSize is the number of users on each page of /admin/users.
+const adminUsersPageSize = 50
+
+// adminUsers lists registered users a page at a time, newest first.
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page := 1
+	if s := query.Get("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			app.clientError(w, r, BadRequest("Invalid page"))
+			return
+		}
+		page = n
+	}
+
+	users, total, err := app.users.ListActive(r.Context(), page, adminUsersPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Users = users
+	data.Pagination = newPagination(page, adminUsersPageSize, total, query)
+
+	app.render(w, r, http.StatusOK, "admin_users.tmpl", data)
+}
+
+// adminSnippetFeaturePost features the snippet on the home page.
+func (app *application) adminSnippetFeaturePost(w http.ResponseWriter, r *http.Request) {
+	app.setSnippetFeatured(w, r, true)
+}
+
+// adminSnippetUnfeaturePost takes the snippet off the home page.
+func (app *application) adminSnippetUnfeaturePost(w http.ResponseWriter, r *http.Request) {
+	app.setSnippetFeatured(w, r, false)
+}
+
+func (app *application) setSnippetFeatured(w http.ResponseWriter, r *http.Request, featured bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, NotFound(err))
+		return
+	}
+
+	err = app.snippets.SetFeatured(r.Context(), id, featured)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	adminID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if featured {
+		app.audit("snippet featured", "admin_id", adminID, "snippet_id", id)
+		app.sessionManager.Put(r.Context(), "flash", "Snippet featured on the home page.")
+	} else {
+		app.audit("snippet unfeatured", "admin_id", adminID, "snippet_id", id)
+		app.sessionManager.Put(r.Context(), "flash", "Snippet removed from the home page.")
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// adminImpersonatePost lets an admin see the site as another user does. The
+// admin's ID is kept in the session so that adminImpersonateStopPost can
+// restore it. Impersonation cannot be nested.
+func (app *application) adminImpersonatePost(w http.ResponseWriter, r *http.Request) {
+	if impersonatorID(r) != 0 {
+		app.clientError(w, r, Forbidden(errImpersonating))
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil || userID < 1 {
+		app.clientError(w, r, NotFound(err))
+		return
+	}
+
+	adminID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if userID == adminID {
+		app.clientError(w, r, BadRequest("You cannot impersonate yourself"))
+		return
+	}
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "impersonatorID", adminID)
+	app.sessionManager.Put(r.Context(), "impersonatedEmail", user.Email)
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", user.ID)
+	app.sessionManager.Put(r.Context(), "timezone", user.Timezone)
+	app.sessionManager.Remove(r.Context(), "session_seen")
+
+	app.audit("impersonation started", "admin_id", adminID, "user_id", user.ID)
+
+	http.Redirect(w, r, "/user/snippets", http.StatusSeeOther)
+}
+
+func (app *application) adminImpersonateStopPost(w http.ResponseWriter, r *http.Request) {
+	adminID := impersonatorID(r)
+	if adminID == 0 {
+		app.clientError(w, r, BadRequest("You are not impersonating anyone"))
+		return
+	}
+
+	admin, err := app.users.Get(adminID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	app.sessionManager.Remove(r.Context(), "impersonatorID")
+	app.sessionManager.Remove(r.Context(), "impersonatedEmail")
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", admin.ID)
+	app.sessionManager.Put(r.Context(), "timezone", admin.Timezone)
+
+	app.audit("impersonation stopped", "admin_id", admin.ID, "user_id", userID)
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// maxExpiringWithin caps the ?within= window of the expiring snippets page.
+const maxExpiringWithin = 30 * 24 * time.Hour
+
+func (app *application) adminExpiring(w http.ResponseWriter, r *http.Request) {
+	within := 24 * time.Hour
+
+	if v := r.URL.Query().Get("within"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			app.clientError(w, r, BadRequest("Invalid duration for within"))
+			return
+		}
+		within = min(d, maxExpiringWithin)
+	}
+
+	snippets, err := app.snippets.ListExpiringSoon(r.Context(), within)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.ExpiringWithin = within
+
+	app.render(w, r, http.StatusOK, "admin_expiring.tmpl", data)
+}
+
+func (app *application) consent(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	app.renderJSON(w, r, http.StatusOK, readConsent(r))
+}
+
+func (app *application) consentPost(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+
+	var input struct {
+		Analytics bool `json:"analytics"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.clientError(w, r, BadRequest("Invalid consent preferences"))
+		return
+	}
+
+	prefs := consentPreferences{Set: true, Analytics: input.Analytics, Functional: true}
+	writeConsent(w, prefs)
+
+	app.renderJSON(w, r, http.StatusOK, prefs)
+}
+
+type userSignupForm struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (f *userSignupForm) Validate() {
+	f.CheckField(validator.NotBlank(f.Name), "name", "This field cannot be blank")
+	f.CheckField(validator.NotBlank(f.Email), "email", "This field cannot be blank")
+	f.CheckField(validator.Matches(f.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	f.CheckField(validator.NotBlank(f.Password), "password", "This field cannot be blank")
+	f.CheckField(validator.MinChars(f.Password, 8), "password", "This field must be at least 8 characters long")
+	f.CheckField(validator.PasswordStrong(f.Password), "password", "Password is too weak")
+}
+
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userSignupForm{}
+	app.render(w, r, http.StatusOK, "signup.tmpl", data)
+}
+
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	var form userSignupForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, BadRequest("Invalid form submission"))
+		return
+	}
+
+	if !app.validateFormToken(r, r.PostForm.Get("form_token")) {
+		app.clientError(w, r, Forbidden(errInvalidFormToken))
+		return
+	}
+
+	form.Validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		return
+	}
+
+	err = app.users.Insert(form.Name, form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "Email address is already in use")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	events.UserSignedUp(r.Context(), app.logger)
+
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+type userLoginForm struct {
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (f *userLoginForm) Validate() {
+	f.CheckField(validator.NotBlank(f.Email), "email", "This field cannot be blank")
+	f.CheckField(validator.Matches(f.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	f.CheckField(validator.NotBlank(f.Password), "password", "This field cannot be blank")
+}
+
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginForm{}
+	app.render(w, r, http.StatusOK, "login.tmpl", data)
+}
+
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	var form userLoginForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, BadRequest("Invalid form submission"))
+		return
+	}
+
+	if !app.validateFormToken(r, r.PostForm.Get("form_token")) {
+		app.clientError(w, r, Forbidden(errInvalidFormToken))
+		return
+	}
+
+	form.Validate()
+
+	if !form.Valid() {
+		events.LoginFailed(r.Context(), app.logger, events.LoginInvalidInput, models.IPOwnerKey(clientIP(r)))
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
+		return
+	}
+
+	userID, err := app.users.Authenticate(form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			events.LoginFailed(r.Context(), app.logger, events.LoginInvalidCredentials, models.IPOwnerKey(clientIP(r)))
+			form.AddNonFieldError("email address or password is incorrect")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", userID)
+	app.sessionManager.Put(r.Context(), "timezone", user.Timezone)
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	if adminID := impersonatorID(r); adminID != 0 {
+		userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+		app.audit("impersonation stopped", "admin_id", adminID, "user_id", userID, "reason", "logout")
+		app.sessionManager.Remove(r.Context(), "impersonatorID")
+		app.sessionManager.Remove(r.Context(), "impersonatedEmail")
+	}
+
+	err := app.userSessions.Delete(r.Context(), app.sessionManager.Token(r.Context()))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Remove(r.Context(), "timezone")
+	app.sessionManager.Remove(r.Context(), "session_seen")
+	app.sessionManager.Put(r.Context(), "flash", "You have been logged out successfully.")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	sessions, err := app.userSessions.ListForUser(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.UserSessions = sessions
+	data.CurrentSessionID = models.SessionID(app.sessionManager.Token(r.Context()))
+
+	app.render(w, r, http.StatusOK, "account_sessions.tmpl", data)
+}
+
+// accountSessionRevokePost signs out one of the user's other sessions by
+// destroying its session data, so its next request is unauthenticated. The
+// {token} path value is the session's public ID, not the session token.
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("token")
+	if id == models.SessionID(app.sessionManager.Token(r.Context())) {
+		app.clientError(w, r, BadRequest("Use log out to end the current session"))
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	token, err := app.userSessions.Revoke(r.Context(), userID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.sessionManager.Store.Delete(token)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The session has been signed out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+func (app *application) accountSessionsRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	tokens, err := app.userSessions.RevokeOthers(r.Context(), userID, app.sessionManager.Token(r.Context()))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, token := range tokens {
+		err = app.sessionManager.Store.Delete(token)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "All other sessions have been signed out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// apiSnippetSummary is a snippet as listed by the public API. It never
+// carries the full content.
+type apiSnippetSummary struct {
+	ID       int       `json:"id" doc:"Snippet ID."`
+	Title    string    `json:"title" doc:"Snippet title."`
+	URL      string    `json:"url" doc:"Link to the snippet's page."`
+	Created  time.Time `json:"created" doc:"When the snippet was created."`
+	Updated  time.Time `json:"updated" doc:"When the snippet was last changed; equal to created if it never has been."`
+	Language string    `json:"language" doc:"Language of the content, or empty if unknown."`
+	Excerpt  string    `json:"excerpt" doc:"Start of the content, at most 160 characters."`
+}
+
+// apiSnippetList is the response of apiUserSnippets.
+type apiSnippetList struct {
+	Snippets []apiSnippetSummary `json:"snippets" doc:"Newest first."`
+}
+
+// apiUserSnippets lists a user's latest unexpired snippets for embedding on
+// other sites. The response is anonymous, so it may be cached publicly and
+// read from any origin. An unknown user gets an empty list rather than a 404,
+// so the endpoint cannot be used to discover which user IDs exist.
+func (app *application) apiUserSnippets(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, BadRequest("User ID must be a number"))
+		return
+	}
+
+	limit := 5
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil {
+			app.clientError(w, r, BadRequest("Limit must be a number"))
+			return
+		}
+		limit = min(max(limit, 1), 20)
+	}
+
+	languages, err := app.languageCounts(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	language := knownLanguage(languages, r.URL.Query().Get("lang"))
+
+	var summaries []models.SnippetSummary
+	if userID > 0 {
+		summaries, err = app.snippets.LatestByUser(r.Context(), userID, language, limit)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	snippets := make([]apiSnippetSummary, len(summaries))
+	for i, s := range summaries {
+		snippets[i] = apiSnippetSummary{
+			ID:       s.ID,
+			Title:    s.Title,
+			URL:      app.linkURL(r, fmt.Sprintf("/snippet/view/%d", s.ID)),
+			Created:  s.Created,
+			Updated:  s.Updated,
+			Language: s.Language,
+			Excerpt:  excerpt(s.Excerpt, 160),
+		}
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	app.renderCacheableJSON(w, r, apiSnippetList{Snippets: snippets})
+}
+
+// apiLimitsResponse is the response of apiLimits. MaxContentChars is the
+// -max-content-chars limit; zero in any field means no limit.
+type apiLimitsResponse struct {
+	contentLimits
+	MaxContentChars int `json:"max_content_chars" doc:"Maximum content length in characters; 0 for no limit."`
+	MaxTitleChars   int `json:"max_title_chars" doc:"Maximum title length in characters."`
+}
+
+// apiLimits reports the snippet content limits so that clients can check
+// content before submitting it.
+func (app *application) apiLimits(w http.ResponseWriter, r *http.Request) {
+	limits := apiLimitsResponse{app.config.contentLimits, app.config.maxContentChars, models.MaxTitleChars}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	app.renderCacheableJSON(w, r, limits)
+}
+
+// apiOpenAPI serves the OpenAPI document describing the JSON API.
+func (app *application) apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	app.renderCacheableJSON(w, r, app.openAPI)
+}
+
+// apiDocs renders the OpenAPI document as a page.
+func (app *application) apiDocs(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.APIDoc = app.openAPI
+	app.setMeta(&data, "og:title", "API documentation")
+
+	app.render(w, r, http.StatusOK, "api_docs.tmpl", data)
+}
+
+// shareTTLs are the lifetimes, in hours, offered for a share link.
+var shareTTLs = []int{1, 24, 168}
+
+type snippetShareForm struct {
+	TTL                 int `form:"ttl"`
+	validator.Validator `form:"-"`
+}
+
+// ownedSnippet returns the snippet named by the {id} path value if it
+// belongs to the authenticated user. Otherwise it writes a 404, so that
+// other users' snippet IDs are not confirmed, and ok is false.
+func (app *application) ownedSnippet(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, NotFound(err))
+		return models.Snippet{}, false
+	}
+
+	snippet, err = app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	if snippet.UserID != app.sessionManager.GetInt(r.Context(), "authenticatedUserID") {
+		app.clientError(w, r, NotFound(errNotOwner))
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// snippetShare shows the owner the outstanding share links for a snippet.
+func (app *application) snippetShare(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderSharePage(w, r, http.StatusOK, snippet, snippetShareForm{TTL: 24})
+}
+
+func (app *application) renderSharePage(w http.ResponseWriter, r *http.Request, status int, snippet models.Snippet, form snippetShareForm) {
+	shares, err := app.snippets.ListShares(r.Context(), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = form
+	for _, sh := range shares {
+		payload := sharelink.Sign(app.config.shareSecret, sharelink.Link{SnippetID: sh.SnippetID, Expires: sh.Expires}, sh.Generation)
+		data.Shares = append(data.Shares, shareLink{
+			URL:     app.linkURL(r, "/snippet/shared/"+payload),
+			Created: sh.Created,
+			Expires: sh.Expires,
+		})
+	}
+
+	app.render(w, r, status, "share.tmpl", data)
+}
+
+// snippetSharePost issues a new signed share link for the owner's snippet.
+func (app *application) snippetSharePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetShareForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, BadRequest("Invalid form submission"))
+		return
+	}
+
+	form.CheckField(validator.PermittedValues(form.TTL, shareTTLs...), "ttl", "This field must equal 1, 24 or 168")
+
+	if !form.Valid() {
+		app.renderSharePage(w, r, http.StatusUnprocessableEntity, snippet, form)
+		return
+	}
+
+	expires := app.clock.Now().Add(time.Duration(form.TTL) * time.Hour)
+
+	_, err = app.snippets.CreateShare(r.Context(), snippet.ID, expires)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("share link created", "snippet", snippet, "share_expires", expires)
+
+	app.sessionManager.Put(r.Context(), "flash", "Share link created.")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/share/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetShareRevokePost invalidates every outstanding share link for the
+// owner's snippet.
+func (app *application) snippetShareRevokePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.RevokeShares(r.Context(), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("share links revoked", "snippet", snippet)
+
+	app.sessionManager.Put(r.Context(), "flash", "All share links for this snippet have been revoked.")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/share/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// minRenameChars is the shortest title accepted by snippetRenamePost.
+const minRenameChars = 3
+
+// snippetRenamePost renames the owner's snippet from the inline rename on My
+// Snippets. The body is JSON, {"title": "..."}, and the response is the
+// new title as JSON or a 422 listing what is wrong with it.
+func (app *application) snippetRenamePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, NotFound(err))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+
+	var input struct {
+		Title string `json:"title"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.clientError(w, r, BadRequest("Invalid title"))
+		return
+	}
+
+	var v validator.Validator
+	v.CheckField(validator.NotBlank(input.Title), "title", "This field cannot be blank")
+	v.CheckField(validator.MinChars(input.Title, minRenameChars), "title", fmt.Sprintf("This field must be at least %d characters long", minRenameChars))
+	v.CheckField(validator.MaxChars(input.Title, models.MaxTitleChars), "title", fmt.Sprintf("This field cannot be more than %d characters long", models.MaxTitleChars))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, &v)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.snippets.Rename(r.Context(), id, userID, input.Title)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			app.clientError(w, r, NotFound(err))
+		case errors.Is(err, models.ErrDuplicateTitle):
+			v.AddFieldError("title", "You already have a snippet with this title.")
+			app.failedValidationResponse(w, r, &v)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.latestCache.Delete(latestKey)
+	app.renderJSON(w, r, http.StatusOK, map[string]string{"title": input.Title})
+}
+
+// snippetActionPost serves POST /snippet/{id}/{action}. ServeMux rejects a
+// /snippet/{id}/language pattern next to the /snippet/<action>/{id} routes,
+// as neither is more specific, so the {id}-first action is dispatched here;
+// every /snippet/<action>/{id} route outranks this pattern.
+func (app *application) snippetActionPost(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("action") {
+	case "language":
+		app.snippetLanguagePost(w, r)
+	default:
+		app.notFoundResponse(w, r, nil)
+	}
+}
+
+// snippetLanguagePost sets the language of the owner's snippet from the
+// dropdown on the view page. The language must be one of -languages, or
+// empty to clear it. A snippet that is not the user's, or is expired or
+// archived, is a JSON 404.
+func (app *application) snippetLanguagePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.notFoundResponse(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+
+	var input struct {
+		Language string `json:"language"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.clientError(w, r, BadRequest("Invalid language"))
+		return
+	}
+
+	var v validator.Validator
+	v.CheckField(input.Language == "" || validator.PermittedValues(input.Language, app.config.languages...), "language", "This language is not supported")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, &v)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.snippets.SetLanguage(r.Context(), id, userID, input.Language)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.renderJSON(w, r, http.StatusOK, map[string]string{"language": input.Language})
+}
+
+// snippetPinPost pins the owner's snippet so that it comes first in their
+// listings.
+func (app *application) snippetPinPost(w http.ResponseWriter, r *http.Request) {
+	app.setSnippetPinned(w, r, true)
+}
+
+// snippetUnpinPost reverses snippetPinPost.
+func (app *application) snippetUnpinPost(w http.ResponseWriter, r *http.Request) {
+	app.setSnippetPinned(w, r, false)
+}
+
+// setSnippetPinned pins or unpins the owner's snippet and redirects back to
+// it. The view page posts here with fetch, so there is no flash message to
+// show up on a later page.
+func (app *application) setSnippetPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	if pinned {
+		err = app.snippets.Pin(r.Context(), snippet.ID, snippet.UserID)
+	} else {
+		err = app.snippets.Unpin(r.Context(), snippet.ID, snippet.UserID)
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetVersionRestorePost rolls the owner's snippet back to an earlier
+// version. Update keeps the title and content being replaced as a version of
+// their own, so a restore can itself be undone.
+func (app *application) snippetVersionRestorePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	versionID, err := strconv.Atoi(r.PathValue("versionID"))
+	if err != nil {
+		app.clientError(w, r, NotFound(err))
+		return
+	}
+
+	version, err := app.snippets.GetVersion(r.Context(), snippet.ID, versionID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.snippets.Update(r.Context(), snippet.ID, version.Title, version.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateTitle):
+			app.clientError(w, r, &AppError{Code: http.StatusConflict, Message: "You already have another snippet with this version's title."})
+		case errors.Is(err, models.ErrDuplicateContent):
+			app.clientError(w, r, &AppError{Code: http.StatusConflict, Message: "You already have another snippet with this version's content."})
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.latestCache.Delete(latestKey)
+	app.sessionManager.Put(r.Context(), "flash", "Snippet restored to an earlier version.")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetArchivePost moves the owner's snippet to their archive, taking it
+// off the site until it is unarchived.
+func (app *application) snippetArchivePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Archive(r.Context(), snippet.ID, snippet.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.latestCache.Delete(latestKey)
+	app.sessionManager.Put(r.Context(), "flash", "Snippet archived.")
+	http.Redirect(w, r, "/user/archive", http.StatusSeeOther)
+}
+
+// snippetUnarchivePost returns the owner's archived snippet to the site.
+// Archived snippets cannot be looked up with Get, so ownership is checked by
+// Unarchive itself.
+func (app *application) snippetUnarchivePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, NotFound(err))
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.snippets.Unarchive(r.Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.latestCache.Delete(latestKey)
+	app.sessionManager.Put(r.Context(), "flash", "Snippet restored from the archive.")
+	http.Redirect(w, r, "/user/archive", http.StatusSeeOther)
+}
+
+// userArchive lists the user's archived snippets a page at a time, most
+// recently archived first.
+func (app *application) userArchive(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page := 1
+	if s := query.Get("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			app.clientError(w, r, BadRequest("Invalid page"))
+			return
+		}
+		page = n
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	snippets, total, err := app.snippets.ListArchived(r.Context(), userID, page, userSnippetsPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Pagination = newPagination(page, userSnippetsPageSize, total, query)
+
+	app.render(w, r, http.StatusOK, "user_archive.tmpl", data)
+}
+
+// snippetDuplicatePost saves a copy of a snippet, owned by the current user,
+// and redirects to it. The copy counts towards the user's daily quota.
+func (app *application) snippetDuplicatePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, NotFound(err))
+		return
+	}
+
+	allowed, resetAt, err := app.checkSnippetQuota(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.clientError(w, r, &AppError{
+			Code:    http.StatusTooManyRequests,
+			Message: fmt.Sprintf("You have reached your daily snippet limit. You can create more snippets after %s UTC.", humanDate(resetAt)),
+		})
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	newID, err := app.snippets.Duplicate(r.Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else if errors.Is(err, models.ErrDuplicateTitle) || errors.Is(err, models.ErrDuplicateContent) {
+			app.sessionManager.Put(r.Context(), "flash", "You already have a copy of this snippet.")
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("snippet duplicated", "snippet_id", newID, "from", id)
+	app.latestCache.Delete(latestKey)
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet duplicated.")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", newID), http.StatusSeeOther)
+}
+
+// snippetShared shows a snippet through a signed share link. Malformed,
+// tampered, revoked and expired links are all plain 404s.
+func (app *application) snippetShared(w http.ResponseWriter, r *http.Request) {
+	payload := r.PathValue("payload")
+
+	link, err := sharelink.Parse(payload)
+	if err != nil {
+		app.clientError(w, r, NotFound(err))
+		return
+	}
+
+	generation, err := app.snippets.ShareGeneration(r.Context(), link.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	link, err = sharelink.Verify(app.config.shareSecret, payload, generation, app.clock.Now())
+	if err != nil {
+		app.clientError(w, r, NotFound(err))
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), link.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The URL is the credential, so keep it out of shared caches.
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.SharedUntil = link.Expires
+
+	app.render(w, r, http.StatusOK, "view.tmpl", data)
+}
+
+// maxBundleSnippets caps the number of snippets in a bundle.
+const maxBundleSnippets = 50
+
+// bundleExpiries are the explicit lifetimes, in days, offered for a bundle.
+// Zero leaves the bundle to expire with the first of its snippets.
+var bundleExpiries = []int{0, 1, 7}
+
+type bundleCreateForm struct {
+	Title               string `form:"title"`
+	Snippets            string `form:"snippets"`
+	Expires             int    `form:"expires"`
+	validator.Validator `form:"-"`
+}
+
+// bundleMember is a snippet in a bundle as it stands when the bundle is
+// viewed. Snippet is only set when Available is true.
+type bundleMember struct {
+	ID        int
+	Snippet   models.Snippet
+	Available bool
+}
+
+// bundleCreate shows the form for bundling snippets under one link.
+func (app *application) bundleCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = bundleCreateForm{}
+
+	app.render(w, r, http.StatusOK, "bundle_create.tmpl", data)
+}
+
+// bundleCreatePost creates a bundle of the listed snippets and redirects to
+// its page.
+func (app *application) bundleCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form bundleCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, BadRequest("Invalid form submission"))
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.PermittedValues(form.Expires, bundleExpiries...), "expires", "This field must equal 0, 1 or 7")
+
+	ids, msg := parseSnippetIDs(form.Snippets, maxBundleSnippets)
+	if msg != "" {
+		form.AddFieldError("snippets", msg)
+	}
+
+	// Only snippets anyone could find can be bundled.
+	for _, id := range ids {
+		if !form.Valid() {
+			break
+		}
+		snippet, err := app.snippets.Get(r.Context(), id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		if err != nil || snippet.Unlisted {
+			form.AddFieldError("snippets", fmt.Sprintf("Snippet #%d doesn't exist or can't be shared", id))
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "bundle_create.tmpl", data)
+		return
+	}
+
+	var expires time.Time
+	if form.Expires > 0 {
+		expires = app.clock.Now().AddDate(0, 0, form.Expires)
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	bundle, err := app.snippets.CreateBundle(r.Context(), userID, form.Title, ids, expires)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("bundle created", "bundle_id", bundle.ID, "snippets", len(ids), "bundle_expires", bundle.Expires)
+
+	app.sessionManager.Put(r.Context(), "flash", "Bundle created.")
+	http.Redirect(w, r, "/bundle/"+bundle.Token, http.StatusSeeOther)
+}
+
+// parseSnippetIDs reads a list of snippet IDs separated by commas or spaces,
+// dropping repeats. It returns a message for the user if the list is empty,
+// longer than limit or has an entry that is not an ID.
+func parseSnippetIDs(s string, limit int) ([]int, string) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	var ids []int
+	for _, f := range fields {
+		id, err := strconv.Atoi(strings.TrimPrefix(f, "#"))
+		if err != nil || id < 1 {
+			return nil, "This field must list snippet IDs, such as 12, 15, 20"
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	switch {
+	case len(ids) == 0:
+		return nil, "This field cannot be blank"
+	case len(ids) > limit:
+		return nil, fmt.Sprintf("A bundle can hold at most %d snippets", limit)
+	}
+	return ids, ""
+}
+
+// bundleFromPath returns the bundle named by the {token} path value.
+// Unknown and expired tokens are a 404 and ok is false.
+func (app *application) bundleFromPath(w http.ResponseWriter, r *http.Request) (bundle models.Bundle, ok bool) {
+	bundle, err := app.snippets.GetBundle(r.Context(), r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, NotFound(err))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Bundle{}, false
+	}
+	return bundle, true
+}
+
+// bundleMembers looks up the bundle's snippets as they stand now. A snippet
+// that has expired, been deleted or been hidden from listings since the
+// bundle was made is unavailable rather than an error.
+func (app *application) bundleMembers(ctx context.Context, bundle models.Bundle) ([]bundleMember, error) {
+	members := make([]bundleMember, len(bundle.SnippetIDs))
+	for i, id := range bundle.SnippetIDs {
+		members[i].ID = id
+
+		snippet, err := app.snippets.Get(ctx, id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				continue
+			}
+			return nil, err
+		}
+		if !snippet.Unlisted {
+			members[i].Snippet = snippet
+			members[i].Available = true
+		}
+	}
+	return members, nil
+}
+
+// bundleView lists the snippets in a bundle, with a link to download them.
+func (app *application) bundleView(w http.ResponseWriter, r *http.Request) {
+	bundle, ok := app.bundleFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := app.bundleMembers(r.Context(), bundle)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The URL is the credential, so keep it out of shared caches.
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	data := app.newTemplateData(r)
+	data.Bundle = bundle
+	data.BundleMembers = members
+
+	app.render(w, r, http.StatusOK, "bundle.tmpl", data)
+}
+
+// bundleDownload streams the bundle's available snippets as a zip archive,
+// one file per snippet. Unavailable snippets are listed in a README.txt
+// inside the archive instead.
+func (app *application) bundleDownload(w http.ResponseWriter, r *http.Request) {
+	bundle, ok := app.bundleFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := app.bundleMembers(r.Context(), bundle)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", bundleFilename(bundle.Title, "bundle")+".zip"))
+	w.Header().Set("Cache-Control", "private, no-store")
+	app.extendWriteDeadline(w, r)
+
+	zw := zip.NewWriter(w)
+	names := map[string]bool{}
+	var unavailable []int
+
+	for _, m := range members {
+		if !m.Available {
+			unavailable = append(unavailable, m.ID)
+			continue
+		}
+
+		// Once the archive has started, a failure can only be logged: the
+		// client sees a truncated download.
+		err := app.writeBundleFile(r.Context(), zw, m.Snippet, names)
+		if errors.Is(err, models.ErrNoRecord) {
+			unavailable = append(unavailable, m.ID)
+			continue
+		}
+		if err != nil {
+			app.requestLogger(r).Error("bundle download failed", "bundle_id", bundle.ID, "error", err)
+			return
+		}
+	}
+
+	if len(unavailable) > 0 {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: "README.txt", Method: zip.Deflate, Modified: app.clock.Now()})
+		if err != nil {
+			app.requestLogger(r).Error("bundle download failed", "bundle_id", bundle.ID, "error", err)
+			return
+		}
+		fmt.Fprintf(f, "These snippets in %q are no longer available:\n\n", bundle.Title)
+		for _, id := range unavailable {
+			fmt.Fprintf(f, "  #%d\n", id)
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		app.requestLogger(r).Error("bundle download failed", "bundle_id", bundle.ID, "error", err)
+	}
+}
+
+// writeBundleFile adds the snippet's content to the archive under a name
+// made from its title and language, not yet in names. It returns
+// ErrNoRecord, before writing anything, if the snippet expired since it was
+// looked up.
+func (app *application) writeBundleFile(ctx context.Context, zw *zip.Writer, snippet models.Snippet, names map[string]bool) error {
+	content, err := app.snippets.OpenContent(ctx, snippet.ID)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	base := bundleFilename(snippet.Title, fmt.Sprintf("snippet-%d", snippet.ID))
+	ext := languageExtension(snippet.Language)
+	name := base + ext
+	if names[name] {
+		name = fmt.Sprintf("%s-%d%s", base, snippet.ID, ext)
+	}
+	names[name] = true
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: snippet.Created})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, content)
+	return err
+}
+
+// maxBundleFilename caps the length of a name made by bundleFilename.
+const maxBundleFilename = 60
+
+// bundleFilename makes a file name from a title, keeping letters, digits,
+// dots, hyphens and underscores and replacing runs of anything else with a
+// single hyphen. It returns fallback if nothing is left.
+func bundleFilename(title, fallback string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range title {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			b.WriteRune(r)
+			hyphen = false
+		case r == '.' || r == '-':
+			b.WriteRune(r)
+			hyphen = r == '-'
+		case !hyphen && b.Len() > 0:
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+
+	name := b.String()
+	if len(name) > maxBundleFilename {
+		name = strings.ToValidUTF8(name[:maxBundleFilename], "")
+	}
+	name = strings.Trim(name, ".-")
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// languageExtensions maps a snippet's language to the extension of its file
+// in a bundle download.
+var languageExtensions = map[string]string{
+	"bash":       ".sh",
+	"c":          ".c",
+	"cpp":        ".cpp",
+	"csharp":     ".cs",
+	"css":        ".css",
+	"go":         ".go",
+	"html":       ".html",
+	"java":       ".java",
+	"javascript": ".js",
+	"json":       ".json",
+	"kotlin":     ".kt",
+	"markdown":   ".md",
+	"php":        ".php",
+	"python":     ".py",
+	"ruby":       ".rb",
+	"rust":       ".rs",
+	"shell":      ".sh",
+	"sql":        ".sql",
+	"swift":      ".swift",
+	"typescript": ".ts",
+	"yaml":       ".yaml",
+}
+
+// defaultLanguages returns the languages in languageExtensions, sorted, for
+// when -languages is not set.
+func defaultLanguages() []string {
+	return slices.Sorted(maps.Keys(languageExtensions))
+}
+
+// languageExtension returns the file extension for language, or .txt for
+// an unknown or empty language.
+func languageExtension(language string) string {
+	if ext, ok := languageExtensions[strings.ToLower(language)]; ok {
+		return ext
+	}
+	return ".txt"
+}
@@ -0,0 +1,1666 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+	"snippet.robertgleason.ca/internal/clock"
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/models/mock"
+	"snippet.robertgleason.ca/internal/spamfilter"
+)
+
+func TestAPILimits(t *testing.T) {
+	app := newTestApp(t)
+	app.config.contentLimits = contentLimits{Soft: 64 << 10, Hard: 1 << 20}
+
+	rr := app.testGet(t, "/api/v1/limits")
+
+	assertStatus(t, rr, http.StatusOK)
+	assertHeader(t, rr, "Content-Type", "application/json")
+	assertBody(t, rr, `"content_soft_limit_bytes":65536`)
+	assertBody(t, rr, `"content_hard_limit_bytes":1048576`)
+	assertBody(t, rr, `"max_title_chars":100`)
+}
+
+func TestAPIUserSnippetsLanguage(t *testing.T) {
+	app := newTestApp(t)
+	snippets := app.snippets.(*mock.MockSnippetModel)
+
+	for i, lang := range []string{"go", "python", "go"} {
+		_, err := snippets.Insert(t.Context(), fmt.Sprintf("%s snippet %d", lang, i), fmt.Sprintf("A %s haiku, number %d.", lang, i), 7, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snippets.Snippets[len(snippets.Snippets)-1].Language = lang
+	}
+
+	tests := []struct {
+		target string
+		count  int
+	}{
+		{"/api/v1/users/1/snippets", 3},
+		{"/api/v1/users/1/snippets?lang=go", 2},
+		{"/api/v1/users/1/snippets?lang=python&limit=1", 1},
+		{"/api/v1/users/1/snippets?lang=cobol", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rr := app.testGet(t, tt.target)
+			assertStatus(t, rr, http.StatusOK)
+
+			if got := strings.Count(rr.Body.String(), `"id":`); got != tt.count {
+				t.Errorf("got %d snippets; want %d", got, tt.count)
+			}
+		})
+	}
+}
+
+func TestSnippetViewCollapsed(t *testing.T) {
+	app := newTestApp(t)
+	app.config.contentLimits = contentLimits{Soft: 16, Hard: 1 << 20}
+
+	short, err := app.snippets.Insert(t.Context(), "Short", "fits", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := app.snippets.Insert(t.Context(), "Long", strings.Repeat("x", 17), 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := app.testGet(t, fmt.Sprintf("/snippet/view/%d", long))
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, "This snippet is 17 B. Show full content")
+	assertBody(t, rr, "Content: 17 B")
+
+	rr = app.testGet(t, fmt.Sprintf("/snippet/view/%d", short))
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, "1 word · 1 line")
+	assertBody(t, rr, "Content: 4 B")
+	if strings.Contains(rr.Body.String(), "<details") {
+		t.Error("content under the soft limit is collapsed")
+	}
+}
+
+func TestCheckContentSize(t *testing.T) {
+	app := newTestApp(t)
+	app.config.contentLimits = contentLimits{Hard: 1 << 20}
+
+	tests := []struct {
+		size int
+		want string
+	}{
+		{1 << 20, ""},
+		{2 << 20, "This snippet is 2 MB, which is over the maximum of 1 MB"},
+		{1<<20 + 1, "This snippet is 1048577 bytes, which is over the maximum of 1048576 bytes"},
+	}
+
+	for _, tt := range tests {
+		form := snippetCreateForm{Content: strings.Repeat("a", tt.size)}
+		app.checkContentSize(&form)
+
+		if got := form.FieldErrors["content"]; got != tt.want {
+			t.Errorf("size %d: error = %q; want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestSnippetCreatePost_ValidationErrors(t *testing.T) {
+	const (
+		blank      = "This field cannot be blank"
+		titleLong  = "This field cannot be more than 100 characters long"
+		badExpires = "This field must be one of the following values: 1, 7, or 365"
+	)
+
+	tests := []struct {
+		name     string
+		title    string
+		content  string
+		expires  string
+		status   int
+		messages []string
+	}{
+		{"blank title", "", "A haiku.", "7", http.StatusUnprocessableEntity, []string{blank}},
+		{"title too long", strings.Repeat("a", 101), "A haiku.", "7", http.StatusUnprocessableEntity, []string{titleLong}},
+		{"blank content", "An old silent pond", "  ", "7", http.StatusUnprocessableEntity, []string{blank}},
+		{"expires zero", "An old silent pond", "A haiku.", "0", http.StatusUnprocessableEntity, []string{badExpires}},
+		{"expires 366", "An old silent pond", "A haiku.", "366", http.StatusUnprocessableEntity, []string{badExpires}},
+		// The form decoder rejects a non-numeric expires before validation.
+		{"expires not a number", "An old silent pond", "A haiku.", "abc", http.StatusBadRequest, nil},
+		{"valid", "An old silent pond", "A haiku.", "7", http.StatusSeeOther, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			client := app.newTestClient(t)
+			client.login(app)
+
+			form := client.formTokens("/snippet/create")
+			form.Set("title", tt.title)
+			form.Set("content", tt.content)
+			form.Set("expires", tt.expires)
+
+			rr := client.postForm("/snippet/create", form)
+
+			assertStatus(t, rr, tt.status)
+			for _, message := range tt.messages {
+				assertBody(t, rr, message)
+			}
+			if tt.status == http.StatusSeeOther {
+				assertHeader(t, rr, "Location", "/snippet/view/1")
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePost_DuplicateTitle(t *testing.T) {
+	app := newTestApp(t)
+	client := app.newTestClient(t)
+	client.login(app)
+
+	post := func(title string) *httptest.ResponseRecorder {
+		form := client.formTokens("/snippet/create")
+		form.Set("title", title)
+		form.Set("content", "A haiku.")
+		form.Set("expires", "7")
+		return client.postForm("/snippet/create", form)
+	}
+
+	assertStatus(t, post("An old silent pond"), http.StatusSeeOther)
+
+	rr := post("An Old Silent Pond")
+	assertStatus(t, rr, http.StatusUnprocessableEntity)
+	assertBody(t, rr, "You already have a snippet with this title.")
+
+	// The title is free again once the snippet belongs to someone else.
+	snippets := app.snippets.(*mock.MockSnippetModel).Snippets
+	snippets[len(snippets)-1].UserID = 2
+	assertStatus(t, post("An old silent pond"), http.StatusSeeOther)
+}
+
+func TestSnippetCreatePost_InvalidInput(t *testing.T) {
+	app := newTestApp(t)
+	client := app.newTestClient(t)
+	client.login(app)
+
+	// Input the model rejects is a 422 with the message by its field, not a
+	// server error.
+	app.snippets.(*mock.MockSnippetModel).Err = &models.InvalidInputError{Entity: "snippet", Field: "expires", Message: "expires must be positive"}
+
+	form := client.formTokens("/snippet/create")
+	form.Set("title", "An old silent pond")
+	form.Set("content", "A haiku.")
+	form.Set("expires", "7")
+	rr := client.postForm("/snippet/create", form)
+	assertStatus(t, rr, http.StatusUnprocessableEntity)
+	assertBody(t, rr, "expires must be positive")
+}
+
+func TestSnippetCreatePost_DuplicateContent(t *testing.T) {
+	app := newTestApp(t)
+	client := app.newTestClient(t)
+	client.login(app)
+
+	post := func(title string) *httptest.ResponseRecorder {
+		form := client.formTokens("/snippet/create")
+		form.Set("title", title)
+		form.Set("content", "An old silent pond...")
+		form.Set("expires", "7")
+		return client.postForm("/snippet/create", form)
+	}
+
+	assertStatus(t, post("First"), http.StatusSeeOther)
+
+	rr := post("Second")
+	assertStatus(t, rr, http.StatusUnprocessableEntity)
+	assertBody(t, rr, "You already have a snippet with this content.")
+
+	// Other users may hold the same content.
+	snippets := app.snippets.(*mock.MockSnippetModel).Snippets
+	snippets[len(snippets)-1].UserID = 2
+	assertStatus(t, post("Second"), http.StatusSeeOther)
+}
+
+func TestSnippetCreatePost_SpamFilter(t *testing.T) {
+	dir := t.TempDir()
+	rules := "title-urls reject 1\ncontent-urls flag 2\ndomains shadow domains.txt\nwords reject words.txt\n"
+	for name, content := range map[string]string{
+		"spam.rules":  rules,
+		"domains.txt": "casino.example\n",
+		"words.txt":   "viagra\n",
+	} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter, err := spamfilter.Load(filepath.Join(dir, "spam.rules"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		title      string
+		content    string
+		status     int
+		message    string
+		action     string
+		rule       string
+		unlisted   bool
+		onHomePage bool
+	}{
+		{
+			name:       "clean",
+			title:      "An old silent pond",
+			content:    "A haiku.",
+			status:     http.StatusSeeOther,
+			onHomePage: true,
+		},
+		{
+			name:    "reject links in title",
+			title:   "https://a.example https://b.example",
+			content: "A haiku.",
+			status:  http.StatusUnprocessableEntity,
+			message: "This title has more than 1 link",
+		},
+		{
+			name:    "reject blocked word",
+			title:   "An old silent pond",
+			content: "Buy viagra",
+			status:  http.StatusUnprocessableEntity,
+			message: "This snippet looks like spam, so it can&#39;t be published",
+		},
+		{
+			name:     "shadow blocked domain",
+			title:    "An old silent pond",
+			content:  "See https://www.casino.example/",
+			status:   http.StatusSeeOther,
+			action:   "shadow",
+			rule:     "domains: casino.example",
+			unlisted: true,
+		},
+		{
+			name:       "flag links in content",
+			title:      "An old silent pond",
+			content:    "https://a.example https://b.example https://c.example",
+			status:     http.StatusSeeOther,
+			action:     "flag",
+			rule:       "content-urls: more than 2 links",
+			onHomePage: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.spamFilter = filter
+			client := app.newTestClient(t)
+			client.login(app)
+
+			form := client.formTokens("/snippet/create")
+			form.Set("title", tt.title)
+			form.Set("content", tt.content)
+			form.Set("expires", "7")
+
+			rr := client.postForm("/snippet/create", form)
+
+			assertStatus(t, rr, tt.status)
+			if tt.message != "" {
+				assertBody(t, rr, tt.message)
+			}
+
+			snippets := app.snippets.(*mock.MockSnippetModel).Snippets
+			if tt.status != http.StatusSeeOther {
+				if len(snippets) != 0 {
+					t.Errorf("saved %d snippets; want none", len(snippets))
+				}
+				return
+			}
+			if len(snippets) != 1 {
+				t.Fatalf("saved %d snippets; want 1", len(snippets))
+			}
+
+			s := snippets[0]
+			if s.SpamAction != tt.action || s.SpamRule != tt.rule || s.Unlisted != tt.unlisted {
+				t.Errorf("got action %q, rule %q, unlisted %t; want %q, %q, %t", s.SpamAction, s.SpamRule, s.Unlisted, tt.action, tt.rule, tt.unlisted)
+			}
+
+			home := client.get("/")
+			if got := strings.Contains(home.Body.String(), `href="/snippet/view/1"`); got != tt.onHomePage {
+				t.Errorf("snippet on home page = %t; want %t", got, tt.onHomePage)
+			}
+		})
+	}
+}
+
+func TestSnippetShareRevokeLogsSnippet(t *testing.T) {
+	app := newTestApp(t)
+	var logs bytes.Buffer
+	app.logger = slog.New(slog.NewJSONHandler(&logs, nil))
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	id, err := app.snippets.Insert(t.Context(), "An old silent pond", "A haiku.", 7, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := fmt.Sprintf("/snippet/share/%d", id)
+	rr := client.postForm(target+"/revoke", client.formTokens(target))
+	assertStatus(t, rr, http.StatusSeeOther)
+
+	want := fmt.Sprintf(`"msg":"share links revoked","snippet":{"id":%d,"title":"An old silent pond","user_id":1,"created":"2025-06-01T12:00:00Z","expires":"2025-06-08T12:00:00Z"}`, id)
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("logs %q do not contain %q", logs.String(), want)
+	}
+}
+
+func TestSnippetViewMeta(t *testing.T) {
+	app := newTestApp(t)
+
+	content := strings.Repeat("word ", 50)
+	id, err := app.snippets.Insert(t.Context(), "An old silent pond", content, 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := app.testGet(t, fmt.Sprintf("/snippet/view/%d", id))
+	assertStatus(t, rr, http.StatusOK)
+
+	assertBody(t, rr, `<meta property="og:title" content="An old silent pond">`)
+	assertBody(t, rr, fmt.Sprintf(`<meta property="og:description" content="%s…">`, strings.TrimSpace(content[:160])))
+	assertBody(t, rr, fmt.Sprintf(`<meta property="og:url" content="https://example.com/snippet/view/%d">`, id))
+	assertBody(t, rr, `<meta property="article:published_time" content="2025-06-01T12:00:00Z">`)
+}
+
+func TestSnippetEmbedScript(t *testing.T) {
+	app := newTestApp(t)
+
+	id, err := app.snippets.Insert(t.Context(), "</script><b>pond</b>", "A frog jumps in.", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := app.testGet(t, fmt.Sprintf("/snippet/view/%d/embed.js", id))
+	assertStatus(t, rr, http.StatusOK)
+	assertHeader(t, rr, "Content-Type", "application/javascript; charset=utf-8")
+	assertHeader(t, rr, "Cache-Control", "public, max-age=3600")
+	assertBody(t, rr, "data-snipp-id")
+	assertBody(t, rr, fmt.Sprintf(`"content_url":"https://example.com/snippet/view/%d/copy-text"`, id))
+
+	// The title cannot end the host page's script element.
+	if strings.Contains(rr.Body.String(), "</script>") {
+		t.Error("embed script contains an unescaped title")
+	}
+
+	// The script fetches the content from the embedding site's origin.
+	rr = app.testGet(t, fmt.Sprintf("/snippet/view/%d/copy-text", id))
+	assertStatus(t, rr, http.StatusOK)
+	assertHeader(t, rr, "Access-Control-Allow-Origin", "*")
+	assertBody(t, rr, "A frog jumps in.")
+
+	assertStatus(t, app.testGet(t, "/snippet/view/99/embed.js"), http.StatusNotFound)
+}
+
+// createBundle submits the bundle form as a logged-in user and returns the
+// new bundle's page URL.
+func createBundle(t *testing.T, client *testClient, title, snippets, expires string) string {
+	t.Helper()
+
+	form := client.formTokens("/bundle/create")
+	form.Set("title", title)
+	form.Set("snippets", snippets)
+	form.Set("expires", expires)
+
+	rr := client.postForm("/bundle/create", form)
+	assertStatus(t, rr, http.StatusSeeOther)
+	return rr.Header().Get("Location")
+}
+
+func TestBundleMixedVisibility(t *testing.T) {
+	app := newTestApp(t)
+	snippets := app.snippets.(*mock.MockSnippetModel)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	visible, _ := snippets.Insert(t.Context(), "Reading a file", "os.ReadFile(name)", 7, 1)
+	unlisted, _ := snippets.Insert(t.Context(), "Cheap pills", "Buy now.", 7, 2)
+	deleted, _ := snippets.Insert(t.Context(), "Gone soon", "Bye.", 7, 2)
+	snippets.Snippets[visible-1].Language = "Go"
+
+	target := createBundle(t, client, "Go workshop", fmt.Sprintf("%d, %d %d", visible, unlisted, deleted), "0")
+
+	// Later one member is hidden as spam and another is deleted.
+	err := snippets.RecordSpamDecision(t.Context(), unlisted, "shadow", "domains", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippets.Snippets = snippets.Snippets[:deleted-1]
+
+	t.Run("page", func(t *testing.T) {
+		rr := client.get(target)
+		assertStatus(t, rr, http.StatusOK)
+		assertHeader(t, rr, "Cache-Control", "private, no-store")
+		assertBody(t, rr, fmt.Sprintf(`<a href="/snippet/view/%d">Reading a file</a>`, visible))
+		assertBody(t, rr, fmt.Sprintf("Snippet #%d is no longer available", unlisted))
+		assertBody(t, rr, fmt.Sprintf("Snippet #%d is no longer available", deleted))
+		if strings.Contains(rr.Body.String(), "Cheap pills") {
+			t.Error("page lists the title of a hidden snippet")
+		}
+	})
+
+	t.Run("download", func(t *testing.T) {
+		rr := client.get(target + "/download")
+		assertStatus(t, rr, http.StatusOK)
+		assertHeader(t, rr, "Content-Type", "application/zip")
+		assertHeader(t, rr, "Content-Disposition", `attachment; filename="Go-workshop.zip"`)
+
+		zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := map[string]string{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[f.Name] = string(b)
+		}
+
+		if len(files) != 2 {
+			t.Errorf("archive has %d files; want 2", len(files))
+		}
+		if got := files["Reading-a-file.go"]; got != "os.ReadFile(name)" {
+			t.Errorf("Reading-a-file.go = %q; want the snippet content", got)
+		}
+		readme := files["README.txt"]
+		for _, id := range []int{unlisted, deleted} {
+			if !strings.Contains(readme, fmt.Sprintf("#%d\n", id)) {
+				t.Errorf("README.txt %q does not list snippet #%d", readme, id)
+			}
+		}
+	})
+}
+
+func TestBundleExpiry(t *testing.T) {
+	app := newTestApp(t)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	week, _ := app.snippets.Insert(t.Context(), "A week", "7", 7, 1)
+	day, _ := app.snippets.Insert(t.Context(), "A day", "1", 1, 1)
+
+	tests := []struct {
+		name     string
+		snippets string
+		expires  string
+		want     time.Duration
+	}{
+		{"inherits the shortest member", fmt.Sprintf("%d,%d", week, day), "0", 24 * time.Hour},
+		{"explicit expiry is sooner", fmt.Sprint(week), "1", 24 * time.Hour},
+		{"member expires before explicit expiry", fmt.Sprint(day), "7", 24 * time.Hour},
+		{"inherits its only member", fmt.Sprint(week), "0", 7 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := createBundle(t, client, tt.name, tt.snippets, tt.expires)
+
+			bundle, err := app.snippets.GetBundle(t.Context(), strings.TrimPrefix(target, "/bundle/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bundle.Expires.Sub(app.clock.Now()); got != tt.want {
+				t.Errorf("bundle expires in %s; want %s", got, tt.want)
+			}
+		})
+	}
+
+	app.clock.(*clock.Fake).Advance(25 * time.Hour)
+
+	rr := client.get("/bundle/BUNDLE1")
+	assertStatus(t, rr, http.StatusNotFound)
+	rr = client.get("/bundle/BUNDLE1/download")
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestBundleCreatePost_ValidationErrors(t *testing.T) {
+	app := newTestApp(t)
+	snippets := app.snippets.(*mock.MockSnippetModel)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	id, _ := snippets.Insert(t.Context(), "An old silent pond", "A haiku.", 7, 1)
+	hidden, _ := snippets.Insert(t.Context(), "Cheap pills", "Buy now.", 7, 2)
+	err := snippets.RecordSpamDecision(t.Context(), hidden, "shadow", "domains", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		title    string
+		snippets string
+		expires  string
+		message  string
+	}{
+		{"blank title", "", fmt.Sprint(id), "0", "This field cannot be blank"},
+		{"blank snippets", "Workshop", " , ", "0", "This field cannot be blank"},
+		{"not an ID", "Workshop", "1, two", "0", "This field must list snippet IDs"},
+		{"too many", "Workshop", idList(maxBundleSnippets + 1), "0", "at most 50 snippets"},
+		{"unknown snippet", "Workshop", fmt.Sprintf("%d, 99", id), "0", "Snippet #99 doesn&#39;t exist or can&#39;t be shared"},
+		{"hidden snippet", "Workshop", fmt.Sprint(hidden), "0", fmt.Sprintf("Snippet #%d doesn&#39;t exist", hidden)},
+		{"bad expiry", "Workshop", fmt.Sprint(id), "30", "This field must equal 0, 1 or 7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := client.formTokens("/bundle/create")
+			form.Set("title", tt.title)
+			form.Set("snippets", tt.snippets)
+			form.Set("expires", tt.expires)
+
+			rr := client.postForm("/bundle/create", form)
+			assertStatus(t, rr, http.StatusUnprocessableEntity)
+			assertBody(t, rr, tt.message)
+		})
+	}
+}
+
+// idList returns the IDs 1 to n separated by commas.
+func idList(n int) string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i + 1)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestBundleFilename(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Reading a file", "Reading-a-file"},
+		{"  C++ / templates!! ", "C-templates"},
+		{"../../etc/passwd", "etc-passwd"},
+		{"main.go", "main.go"},
+		{"Ünïcode títle", "Ünïcode-títle"},
+		{"!!!", "fallback"},
+		{strings.Repeat("a", 100), strings.Repeat("a", maxBundleFilename)},
+	}
+
+	for _, tt := range tests {
+		if got := bundleFilename(tt.title, "fallback"); got != tt.want {
+			t.Errorf("bundleFilename(%q) = %q; want %q", tt.title, got, tt.want)
+		}
+	}
+
+	if got := languageExtension("Python"); got != ".py" {
+		t.Errorf("languageExtension(Python) = %q; want .py", got)
+	}
+	if got := languageExtension(""); got != ".txt" {
+		t.Errorf("languageExtension(\"\") = %q; want .txt", got)
+	}
+}
+
+// recentlyViewedLinks returns the links in the recently viewed sidebar of
+// the page in rr.
+func recentlyViewedLinks(t *testing.T, rr *httptest.ResponseRecorder) []string {
+	t.Helper()
+
+	doc, err := html.Parse(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var links []string
+	for _, aside := range findElements(doc, "aside") {
+		for _, a := range findElements(aside, "a") {
+			links = append(links, attr(a, "href"))
+		}
+	}
+	return links
+}
+
+func TestRecentlyViewed(t *testing.T) {
+	app := newTestApp(t)
+
+	var ids []int
+	for _, title := range []string{"First", "Second", "Expiring"} {
+		id, err := app.snippets.Insert(t.Context(), title, "A haiku.", 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	app.snippets.(*mock.MockSnippetModel).Snippets[2].Expires = app.clock.Now().Add(time.Hour)
+
+	anonymous := app.newTestClient(t)
+	anonymous.get(fmt.Sprintf("/snippet/view/%d", ids[0]))
+	if got := recentlyViewedLinks(t, anonymous.get("/")); len(got) != 0 {
+		t.Errorf("anonymous sidebar = %q; want none", got)
+	}
+
+	client := app.newTestClient(t)
+	client.login(app)
+	for _, id := range []int{ids[0], ids[2], ids[1], ids[0]} {
+		rr := client.get(fmt.Sprintf("/snippet/view/%d", id))
+		assertStatus(t, rr, http.StatusOK)
+	}
+
+	// Viewing a snippet again moves it to the top, and expired snippets
+	// drop out.
+	app.clock.(*clock.Fake).Advance(2 * time.Hour)
+
+	want := []string{fmt.Sprintf("/snippet/view/%d", ids[0]), fmt.Sprintf("/snippet/view/%d", ids[1])}
+	if got := recentlyViewedLinks(t, client.get("/")); !slices.Equal(got, want) {
+		t.Errorf("sidebar = %q; want %q", got, want)
+	}
+}
+
+func TestSnippetCreateFormExpiresTime(t *testing.T) {
+	now := time.Date(2025, 12, 31, 23, 30, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	tests := []struct {
+		expires int
+		want    time.Time
+	}{
+		{1, time.Date(2026, 1, 2, 4, 30, 0, 0, time.UTC)},
+		{7, time.Date(2026, 1, 8, 4, 30, 0, 0, time.UTC)},
+		{365, time.Date(2027, 1, 1, 4, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		got := snippetCreateForm{Expires: tt.expires}.ExpiresTime(now)
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("ExpiresTime with Expires %d = %s; want %s", tt.expires, got, tt.want)
+		}
+	}
+}
+
+func TestSnippetCreateExpiryPreview(t *testing.T) {
+	app := newTestApp(t)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	rr := client.get("/snippet/create")
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, "This snippet will expire on 01 Jun 2026 at 12:00.")
+	assertBody(t, rr, `value="7" data-expires-on="08 Jun 2025 at 12:00"`)
+}
+
+func TestSnippetViewUpdated(t *testing.T) {
+	app := newTestApp(t)
+
+	id, err := app.snippets.Insert(t.Context(), "An old silent pond", "A haiku.", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := fmt.Sprintf("/snippet/view/%d", id)
+
+	rr := app.testGet(t, target)
+	assertStatus(t, rr, http.StatusOK)
+	if strings.Contains(rr.Body.String(), "Updated:") {
+		t.Error("view shows an updated time for a snippet that was never edited")
+	}
+
+	// A change within a minute of creation is not shown as an edit.
+	app.clock.(*clock.Fake).Advance(30 * time.Second)
+	err = app.snippets.Update(t.Context(), id, "An old silent pond", "A haiku, fixed.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = app.testGet(t, target)
+	if strings.Contains(rr.Body.String(), "Updated:") {
+		t.Error("view shows an updated time for a change made straight after creation")
+	}
+
+	app.clock.(*clock.Fake).Advance(48 * time.Hour)
+	err = app.snippets.Update(t.Context(), id, "An old silent pond", "A haiku, edited.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = app.testGet(t, target)
+	assertBody(t, rr, "<time>Updated: 03 Jun 2025 at 12:00 (less than a minute ago)</time>")
+}
+
+func TestAPIUserSnippetsETagChangesOnEdit(t *testing.T) {
+	app := newTestApp(t)
+
+	id, err := app.snippets.Insert(t.Context(), "An old silent pond", "A haiku.", 7, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const target = "/api/v1/users/1/snippets"
+
+	rr := app.testGet(t, target)
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, `"updated":"2025-06-01T12:00:00Z"`)
+	etag := rr.Header().Get("ETag")
+
+	app.clock.(*clock.Fake).Advance(time.Hour)
+	err = app.snippets.Update(t.Context(), id, "An old silent pond", "A haiku, edited.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A client holding the old ETag gets the edited representation.
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, r)
+
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, `"updated":"2025-06-01T13:00:00Z"`)
+	if got := rr.Header().Get("ETag"); got == etag {
+		t.Errorf("ETag %s unchanged after an edit", got)
+	}
+}
+
+func TestSnippetPin(t *testing.T) {
+	app := newTestApp(t)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	older, _ := app.snippets.Insert(t.Context(), "Older", "An older haiku.", 7, 1)
+	newer, _ := app.snippets.Insert(t.Context(), "Newer", "A newer haiku.", 7, 1)
+	other, _ := app.snippets.Insert(t.Context(), "Someone else's", "A haiku.", 7, 2)
+
+	// listing returns the order of the snippet links on the user's page.
+	listing := func() []string {
+		t.Helper()
+
+		rr := client.get("/user/snippets")
+		assertStatus(t, rr, http.StatusOK)
+
+		doc, err := html.Parse(rr.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var links []string
+		for _, table := range findElements(doc, "table") {
+			for _, a := range findElements(table, "a") {
+				links = append(links, attr(a, "href"))
+			}
+		}
+		return links
+	}
+	view := func(id int) string { return fmt.Sprintf("/snippet/view/%d", id) }
+
+	if got, want := listing(), []string{view(newer), view(older)}; !slices.Equal(got, want) {
+		t.Fatalf("before pinning: listing = %q; want %q", got, want)
+	}
+
+	target := view(older)
+	assertBody(t, client.get(target), "Pin to my snippets")
+
+	rr := client.postForm(fmt.Sprintf("/snippet/pin/%d", older), client.formTokens(target))
+	assertStatus(t, rr, http.StatusSeeOther)
+	assertHeader(t, rr, "Location", target)
+
+	if got, want := listing(), []string{view(older), view(newer)}; !slices.Equal(got, want) {
+		t.Errorf("after pinning: listing = %q; want %q", got, want)
+	}
+	assertBody(t, client.get(target), fmt.Sprintf(`action="/snippet/unpin/%d"`, older))
+
+	rr = app.testGet(t, "/api/v1/users/1/snippets")
+	if i, j := strings.Index(rr.Body.String(), `"Older"`), strings.Index(rr.Body.String(), `"Newer"`); i < 0 || i > j {
+		t.Errorf("API does not list the pinned snippet first: %s", rr.Body)
+	}
+
+	rr = client.postForm(fmt.Sprintf("/snippet/unpin/%d", older), client.formTokens(target))
+	assertStatus(t, rr, http.StatusSeeOther)
+	if got, want := listing(), []string{view(newer), view(older)}; !slices.Equal(got, want) {
+		t.Errorf("after unpinning: listing = %q; want %q", got, want)
+	}
+
+	// Another user's snippet cannot be pinned, and its ID is not confirmed.
+	rr = client.postForm(fmt.Sprintf("/snippet/pin/%d", other), client.formTokens(target))
+	assertStatus(t, rr, http.StatusNotFound)
+	if s, _ := app.snippets.Get(t.Context(), other); s.Pinned {
+		t.Error("another user's snippet was pinned")
+	}
+}
+
+func TestSnippetDuplicate(t *testing.T) {
+	app := newTestApp(t)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	model := app.snippets.(*mock.MockSnippetModel)
+
+	original, _ := app.snippets.Insert(t.Context(), "Original", "A haiku.", 7, 2)
+	target := fmt.Sprintf("/snippet/view/%d", original)
+	assertBody(t, client.get(target), fmt.Sprintf(`action="/snippet/duplicate/%d"`, original))
+
+	rr := client.postForm(fmt.Sprintf("/snippet/duplicate/%d", original), client.formTokens(target))
+	assertStatus(t, rr, http.StatusSeeOther)
+
+	copied := model.Snippets[len(model.Snippets)-1]
+	assertHeader(t, rr, "Location", fmt.Sprintf("/snippet/view/%d", copied.ID))
+
+	if copied.ID == original || copied.Title != "Copy of Original" || copied.Content != "A haiku." || copied.UserID != 1 {
+		t.Errorf("copy = %+v", copied)
+	}
+	if want := app.clock.Now().UTC().AddDate(0, 0, models.DefaultExpiryDays); !copied.Expires.Equal(want) {
+		t.Errorf("copy expires %s; want %s", copied.Expires, want)
+	}
+
+	// A second copy would have the same title as the first.
+	count := len(model.Snippets)
+	rr = client.postForm(fmt.Sprintf("/snippet/duplicate/%d", original), client.formTokens("/user/snippets"))
+	assertHeader(t, rr, "Location", target)
+	if got := len(model.Snippets); got != count {
+		t.Errorf("second duplicate created a snippet")
+	}
+
+	rr = client.postForm("/snippet/duplicate/999", client.formTokens("/user/snippets"))
+	assertStatus(t, rr, http.StatusNotFound)
+
+	// The user's own snippets can be copied whatever their state, so an
+	// expired, archived one reaches the content check rather than a 404.
+	own, _ := app.snippets.Insert(t.Context(), "Own", "My haiku.", 1, 1)
+	archived, _ := app.snippets.Insert(t.Context(), "Archived", "Archived haiku.", 7, 2)
+	unlisted, _ := app.snippets.Insert(t.Context(), "Unlisted", "Unlisted haiku.", 7, 2)
+	expired, _ := app.snippets.Insert(t.Context(), "Expired", "Expired haiku.", 1, 2)
+	for i := range model.Snippets {
+		switch model.Snippets[i].ID {
+		case own, archived:
+			model.Snippets[i].Archived = true
+		case unlisted:
+			model.Snippets[i].Unlisted = true
+		}
+	}
+	app.clock.(*clock.Fake).Advance(48 * time.Hour)
+
+	rr = client.postForm(fmt.Sprintf("/snippet/duplicate/%d", own), client.formTokens("/user/snippets"))
+	assertHeader(t, rr, "Location", fmt.Sprintf("/snippet/view/%d", own))
+
+	// Another user's snippet can only be copied while the user could view
+	// it in a listing.
+	for _, id := range []int{archived, unlisted, expired} {
+		count := len(model.Snippets)
+		rr = client.postForm(fmt.Sprintf("/snippet/duplicate/%d", id), client.formTokens("/user/snippets"))
+		assertStatus(t, rr, http.StatusNotFound)
+		if got := len(model.Snippets); got != count {
+			t.Errorf("duplicate of another user's snippet %d created a snippet", id)
+		}
+	}
+
+	// Anonymous visitors are sent to log in.
+	anonymous := app.newTestClient(t)
+	count = len(model.Snippets)
+	rr = anonymous.postForm(fmt.Sprintf("/snippet/duplicate/%d", copied.ID), anonymous.formTokens("/user/login"))
+	assertHeader(t, rr, "Location", "/user/login")
+	if got := len(model.Snippets); got != count {
+		t.Errorf("anonymous duplicate created a snippet")
+	}
+}
+
+func TestSnippetSimilar(t *testing.T) {
+	app := newTestApp(t)
+
+	source, _ := app.snippets.Insert(t.Context(), "Goroutine leak", "A blocked goroutine leaks.", 7, 0)
+	weak, _ := app.snippets.Insert(t.Context(), "Channels", "A channel of goroutine values.", 7, 0)
+	strong, _ := app.snippets.Insert(t.Context(), "Another goroutine leak", "Every blocked goroutine leaks.", 7, 0)
+	app.snippets.Insert(t.Context(), "An old silent pond", "Splash! Silence again.", 7, 0)
+
+	similar := func(target string) []apiSnippetSummary {
+		t.Helper()
+		rr := app.testGet(t, target)
+		assertStatus(t, rr, http.StatusOK)
+		var got []apiSnippetSummary
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	ids := func(snippets []apiSnippetSummary) []int {
+		var ids []int
+		for _, s := range snippets {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	target := fmt.Sprintf("/snippet/view/%d/similar", source)
+	if got := ids(similar(target)); !slices.Equal(got, []int{strong, weak}) {
+		t.Errorf("similar = %v; want %v", got, []int{strong, weak})
+	}
+	if got := ids(similar(target + "?limit=1")); !slices.Equal(got, []int{strong}) {
+		t.Errorf("similar with limit 1 = %v; want %v", got, []int{strong})
+	}
+
+	// Results are cached for ten minutes.
+	newer, _ := app.snippets.Insert(t.Context(), "Goroutine leak again", "A blocked goroutine leaks.", 7, 0)
+	if got := similar(target); len(got) != 2 {
+		t.Errorf("similar within the TTL = %v; want the cached 2", ids(got))
+	}
+	app.clock.(*clock.Fake).Advance(similarTTL + time.Second)
+	if got := ids(similar(target)); len(got) != 3 || got[0] != newer {
+		t.Errorf("similar after the TTL = %v; want 3 starting with %d", got, newer)
+	}
+
+	// The limit is capped.
+	for range maxSimilar {
+		app.snippets.Insert(t.Context(), "Goroutine", "A goroutine.", 7, 0)
+	}
+	app.clock.(*clock.Fake).Advance(similarTTL + time.Second)
+	if got := similar(target + "?limit=50"); len(got) != maxSimilar {
+		t.Errorf("similar with limit 50 returned %d snippets; want %d", len(got), maxSimilar)
+	}
+
+	assertStatus(t, app.testGet(t, "/snippet/view/999/similar"), http.StatusNotFound)
+	assertStatus(t, app.testGet(t, target+"?limit=many"), http.StatusBadRequest)
+}
+
+func TestAdminDashboardStorage(t *testing.T) {
+	app := newTestApp(t)
+	app.users.(*mock.MockUserModel).User = models.User{ID: 1, Name: "Admin", IsAdmin: true}
+	snippets := app.snippets.(*mock.MockSnippetModel)
+
+	app.snippets.Insert(t.Context(), "Big", strings.Repeat("a", 2048), 7, 1)
+	app.snippets.Insert(t.Context(), "Small", strings.Repeat("b", 1024), 7, 1)
+	app.snippets.Insert(t.Context(), "Gone", "An expired haiku.", 7, 1)
+	snippets.Snippets[2].Expires = app.clock.Now().Add(-time.Hour)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	rr := client.get("/admin")
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, "<th>Expired snippets waiting to be purged</th>\n            <td>1</td>")
+	assertBody(t, rr, "<th>Content of unexpired snippets</th>\n            <td>3 KB</td>")
+}
+
+func TestDebugVarsRequiresAdmin(t *testing.T) {
+	app := newTestApp(t)
+
+	rr := app.testGet(t, "/debug/vars")
+	assertStatus(t, rr, http.StatusSeeOther)
+	assertHeader(t, rr, "Location", "/user/login")
+
+	client := app.newTestClient(t)
+	client.login(app)
+	assertStatus(t, client.get("/debug/vars"), http.StatusForbidden)
+
+	app.users.(*mock.MockUserModel).User = models.User{ID: 1, Name: "Admin", IsAdmin: true}
+	rr = client.get("/debug/vars")
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, `"memstats":`)
+}
+
+func TestAdminUsers(t *testing.T) {
+	app := newTestApp(t)
+	users := app.users.(*mock.MockUserModel)
+	for i := 130; i >= 1; i-- {
+		users.Users = append(users.Users, &models.User{ID: i, Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user%d@example.com", i)})
+	}
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	// Only admins may list users.
+	rr := client.get("/admin/users")
+	assertStatus(t, rr, http.StatusForbidden)
+
+	users.User = models.User{ID: 1, Name: "Admin", IsAdmin: true}
+
+	rr = client.get("/admin/users")
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, "user130@example.com")
+	assertBody(t, rr, `action="/admin/impersonate/130"`)
+	assertBody(t, rr, `<a href="?page=3">3</a>`)
+	if strings.Contains(rr.Body.String(), "user80@example.com") {
+		t.Error("page 1 lists a user from page 2")
+	}
+
+	rr = client.get("/admin/users?page=3")
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, "user1@example.com")
+	assertBody(t, rr, `<span aria-current="page">3</span>`)
+	if strings.Contains(rr.Body.String(), `action="/admin/impersonate/1"`) {
+		t.Error("the admin is offered to impersonate themselves")
+	}
+
+	assertStatus(t, client.get("/admin/users?page=0"), http.StatusBadRequest)
+}
+
+func TestPaginationRange(t *testing.T) {
+	tests := []struct {
+		page, total int
+		want        []int
+	}{
+		{1, 0, nil},
+		{1, 1, []int{1}},
+		{1, 5, []int{1, 2, 3, 4, 5}},
+		{1, 10, []int{1, 2, 3, 0, 10}},
+		{5, 10, []int{1, 2, 3, 4, 5, 6, 7, 0, 10}},
+		{6, 12, []int{1, 0, 4, 5, 6, 7, 8, 0, 12}},
+		{4, 10, []int{1, 2, 3, 4, 5, 6, 0, 10}},
+		{10, 10, []int{1, 0, 8, 9, 10}},
+	}
+
+	for _, tt := range tests {
+		if got := paginationRange(tt.page, tt.total); !slices.Equal(got, tt.want) {
+			t.Errorf("paginationRange(%d, %d) = %v; want %v", tt.page, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestSnippetRename(t *testing.T) {
+	app := newTestApp(t)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	id, _ := app.snippets.Insert(t.Context(), "Before", "A haiku.", 7, 1)
+	app.snippets.Insert(t.Context(), "Taken", "Another haiku.", 7, 1)
+	other, _ := app.snippets.Insert(t.Context(), "Someone else's", "A haiku.", 7, 2)
+	archived, _ := app.snippets.Insert(t.Context(), "Archived", "An archived haiku.", 7, 1)
+
+	rr := client.get("/user/snippets")
+	assertBody(t, rr, fmt.Sprintf(`data-rename-url="/snippet/rename/%d"`, id))
+	client.postForm(fmt.Sprintf("/snippet/archive/%d", archived), client.formTokens("/user/snippets"))
+	token := client.formTokens("/user/snippets").Get("csrf_token")
+
+	tests := []struct {
+		name   string
+		id     int
+		body   string
+		status int
+		want   string
+	}{
+		{"too short", id, `{"title": "ab"}`, http.StatusUnprocessableEntity, `"title":"This field must be at least 3 characters long"`},
+		{"too long", id, `{"title": "` + strings.Repeat("a", 101) + `"}`, http.StatusUnprocessableEntity, `"title":"This field cannot be more than 100 characters long"`},
+		{"taken", id, `{"title": "taken"}`, http.StatusUnprocessableEntity, `"title":"You already have a snippet with this title."`},
+		{"not JSON", id, `title=After`, http.StatusBadRequest, "Invalid title"},
+		{"another user's snippet", other, `{"title": "Mine now"}`, http.StatusNotFound, ""},
+		{"archived", archived, `{"title": "Unarchived"}`, http.StatusNotFound, ""},
+		{"valid", id, `{"title": "After"}`, http.StatusOK, `{"title":"After"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := client.postJSON(fmt.Sprintf("/snippet/rename/%d", tt.id), token, tt.body)
+			assertStatus(t, rr, tt.status)
+			assertBody(t, rr, tt.want)
+		})
+	}
+
+	if s, _ := app.snippets.Get(t.Context(), id); s.Title != "After" {
+		t.Errorf("title = %q; want After", s.Title)
+	}
+	if s, _ := app.snippets.Get(t.Context(), other); s.Title != "Someone else's" {
+		t.Errorf("another user's snippet was renamed to %q", s.Title)
+	}
+	for _, s := range app.snippets.(*mock.MockSnippetModel).Snippets {
+		if s.ID == archived && (s.Title != "Archived" || !s.Archived) {
+			t.Errorf("archived snippet = %+v; want it archived and not renamed", s)
+		}
+	}
+
+	// Without the CSRF token the request is refused.
+	rr = client.postJSON(fmt.Sprintf("/snippet/rename/%d", id), "", `{"title": "Forged"}`)
+	if rr.Code == http.StatusOK {
+		t.Error("rename without a CSRF token succeeded")
+	}
+}
+
+func TestUserSnippetsExport(t *testing.T) {
+	app := newTestApp(t)
+
+	rr := app.testGet(t, "/user/snippets/export")
+	assertStatus(t, rr, http.StatusSeeOther)
+	assertHeader(t, rr, "Location", "/user/login")
+
+	const n = 1000
+	for i := range n {
+		_, err := app.snippets.Insert(t.Context(), fmt.Sprintf("Snippet %d", i), fmt.Sprintf("Haiku %d.", i), 7, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.snippets.Insert(t.Context(), "Someone else's", "A haiku.", 7, 2)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	rr = client.get("/user/snippets/export")
+	assertStatus(t, rr, http.StatusOK)
+	assertHeader(t, rr, "Content-Type", "application/x-ndjson")
+	assertHeader(t, rr, "Content-Disposition", `attachment; filename="snippets-20250601.ndjson"`)
+
+	dec := json.NewDecoder(rr.Body)
+	var got []models.ExportedSnippet
+	for dec.More() {
+		var s models.ExportedSnippet
+		if err := dec.Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s)
+	}
+	if len(got) != n {
+		t.Fatalf("exported %d snippets; want %d", len(got), n)
+	}
+	if got[0].Title != "Snippet 0" || got[n-1].Title != fmt.Sprintf("Snippet %d", n-1) {
+		t.Errorf("exported %q to %q; want Snippet 0 to Snippet %d", got[0].Title, got[n-1].Title, n-1)
+	}
+}
+
+func TestUserSignupPost_PasswordStrength(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		status   int
+		message  string
+	}{
+		{"too short", "Pa5!", http.StatusUnprocessableEntity, "at least 8 characters long"},
+		{"long enough but weak", "pa55word", http.StatusUnprocessableEntity, "Password is too weak"},
+		{"strong enough", "Pa55word", http.StatusSeeOther, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			client := app.newTestClient(t)
+
+			form := client.formTokens("/user/signup")
+			form.Set("name", "Alice")
+			form.Set("email", "alice@example.com")
+			form.Set("password", tt.password)
+
+			rr := client.postForm("/user/signup", form)
+			assertStatus(t, rr, tt.status)
+			assertBody(t, rr, tt.message)
+		})
+	}
+}
+
+func TestAdminSnippetFeature(t *testing.T) {
+	app := newTestApp(t)
+	users := app.users.(*mock.MockUserModel)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	id, _ := app.snippets.Insert(t.Context(), "Worth a look", "A featured haiku.", 7, 2)
+	form := client.formTokens(fmt.Sprintf("/snippet/view/%d", id))
+
+	// Only admins may feature a snippet.
+	rr := client.postForm(fmt.Sprintf("/admin/snippets/%d/feature", id), form)
+	assertStatus(t, rr, http.StatusForbidden)
+
+	users.User = models.User{ID: 1, Name: "Admin", IsAdmin: true}
+
+	rr = client.get(fmt.Sprintf("/snippet/view/%d", id))
+	assertBody(t, rr, fmt.Sprintf(`action="/admin/snippets/%d/feature"`, id))
+
+	rr = client.postForm(fmt.Sprintf("/admin/snippets/%d/feature", id), form)
+	assertStatus(t, rr, http.StatusSeeOther)
+	assertHeader(t, rr, "Location", fmt.Sprintf("/snippet/view/%d", id))
+
+	rr = client.get("/")
+	assertBody(t, rr, `<aside class="featured">`)
+	assertBody(t, rr, fmt.Sprintf(`<li><a href="/snippet/view/%d">Worth a look</a></li>`, id))
+
+	rr = client.postForm(fmt.Sprintf("/admin/snippets/%d/unfeature", id), form)
+	assertStatus(t, rr, http.StatusSeeOther)
+
+	rr = client.get("/")
+	if strings.Contains(rr.Body.String(), `<aside class="featured">`) {
+		t.Error("home page still shows the unfeatured snippet")
+	}
+
+	assertStatus(t, client.postForm("/admin/snippets/999/feature", form), http.StatusNotFound)
+}
+
+func TestSnippetLanguage(t *testing.T) {
+	app := newTestApp(t)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	id, _ := app.snippets.Insert(t.Context(), "Hello", `print("hello")`, 7, 1)
+	other, _ := app.snippets.Insert(t.Context(), "Someone else's", `puts "hello"`, 7, 2)
+	archived, _ := app.snippets.Insert(t.Context(), "Archived", `echo "hello"`, 7, 1)
+	expired, _ := app.snippets.Insert(t.Context(), "Expired", `say "hello"`, 7, 1)
+	model := app.snippets.(*mock.MockSnippetModel)
+	for i := range model.Snippets {
+		switch model.Snippets[i].ID {
+		case archived:
+			model.Snippets[i].Archived = true
+		case expired:
+			model.Snippets[i].Expires = app.clock.Now().Add(-time.Hour)
+		}
+	}
+
+	rr := client.get(fmt.Sprintf("/snippet/view/%d", id))
+	assertBody(t, rr, fmt.Sprintf(`data-language-url="/snippet/%d/language"`, id))
+	assertBody(t, rr, `<option value="python" >python</option>`)
+	assertBody(t, rr, `<pre><code>print(`)
+	token := client.formTokens(fmt.Sprintf("/snippet/view/%d", id)).Get("csrf_token")
+
+	// Only the owner is offered the dropdown.
+	rr = client.get(fmt.Sprintf("/snippet/view/%d", other))
+	if strings.Contains(rr.Body.String(), "data-language-url") {
+		t.Error("another user's snippet offers the language dropdown")
+	}
+
+	tests := []struct {
+		name   string
+		id     int
+		body   string
+		status int
+		want   string
+	}{
+		{"unsupported", id, `{"language": "cobol"}`, http.StatusUnprocessableEntity, `"language":"This language is not supported"`},
+		{"not JSON", id, `language=python`, http.StatusBadRequest, "Invalid language"},
+		{"another user's snippet", other, `{"language": "ruby"}`, http.StatusNotFound, `{"error":"not found"}`},
+		{"archived", archived, `{"language": "bash"}`, http.StatusNotFound, `{"error":"not found"}`},
+		{"expired", expired, `{"language": "ruby"}`, http.StatusNotFound, `{"error":"not found"}`},
+		{"valid", id, `{"language": "python"}`, http.StatusOK, `{"language":"python"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := client.postJSON(fmt.Sprintf("/snippet/%d/language", tt.id), token, tt.body)
+			assertStatus(t, rr, tt.status)
+			assertBody(t, rr, tt.want)
+		})
+	}
+
+	// The {id}-first pattern serves no other action.
+	rr = client.postJSON(fmt.Sprintf("/snippet/%d/colour", id), token, `{"language": "python"}`)
+	assertStatus(t, rr, http.StatusNotFound)
+
+	rr = client.get(fmt.Sprintf("/snippet/view/%d", id))
+	assertBody(t, rr, `<pre><code class="language-python">print(`)
+	assertBody(t, rr, `<option value="python" selected>python</option>`)
+}
+
+func TestSnippetArchive(t *testing.T) {
+	app := newTestApp(t)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	id, _ := app.snippets.Insert(t.Context(), "Old news", "An archived haiku.", 7, 1)
+	other, _ := app.snippets.Insert(t.Context(), "Someone else's", "Not yours to archive.", 7, 2)
+
+	rr := client.get(fmt.Sprintf("/snippet/view/%d", id))
+	assertBody(t, rr, fmt.Sprintf(`action="/snippet/archive/%d"`, id))
+	form := client.formTokens(fmt.Sprintf("/snippet/view/%d", id))
+
+	assertStatus(t, client.postForm(fmt.Sprintf("/snippet/archive/%d", other), form), http.StatusNotFound)
+
+	rr = client.postForm(fmt.Sprintf("/snippet/archive/%d", id), form)
+	assertStatus(t, rr, http.StatusSeeOther)
+	assertHeader(t, rr, "Location", "/user/archive")
+
+	rr = client.get("/user/archive")
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, "Snippet archived.")
+	assertBody(t, rr, "<summary>Old news</summary>")
+	assertBody(t, rr, fmt.Sprintf(`action="/snippet/unarchive/%d"`, id))
+
+	// The snippet is gone from the rest of the site.
+	assertStatus(t, client.get(fmt.Sprintf("/snippet/view/%d", id)), http.StatusNotFound)
+	if strings.Contains(client.get("/user/snippets").Body.String(), "Old news") {
+		t.Error("My Snippets lists the archived snippet")
+	}
+
+	assertStatus(t, client.postForm(fmt.Sprintf("/snippet/unarchive/%d", other), form), http.StatusNotFound)
+
+	rr = client.postForm(fmt.Sprintf("/snippet/unarchive/%d", id), form)
+	assertStatus(t, rr, http.StatusSeeOther)
+	assertStatus(t, client.get(fmt.Sprintf("/snippet/view/%d", id)), http.StatusOK)
+	assertBody(t, client.get("/user/archive"), "You have no archived snippets")
+
+	assertStatus(t, client.get("/user/archive?page=0"), http.StatusBadRequest)
+}
+
+func TestSnippetVersionRestore(t *testing.T) {
+	app := newTestApp(t)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	id, _ := app.snippets.Insert(t.Context(), "An old silent pond", "A haiku.", 7, 1)
+	other, _ := app.snippets.Insert(t.Context(), "Someone else's", "Another haiku.", 7, 2)
+
+	err := app.snippets.Update(t.Context(), id, "A new silent pond", "A haiku, edited.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.snippets.Update(t.Context(), other, "Someone else's, edited", "Another haiku, edited.")
+
+	versions, err := app.snippets.ListVersions(t.Context(), id)
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("ListVersions = %v, %v; want one version", versions, err)
+	}
+	first := versions[0].ID
+	otherVersions, _ := app.snippets.ListVersions(t.Context(), other)
+
+	target := fmt.Sprintf("/snippet/view/%d", id)
+	rr := client.get(target)
+	assertBody(t, rr, fmt.Sprintf(`action="/snippet/%d/versions/%d/restore"`, id, first))
+	form := client.formTokens(target)
+
+	// A version must belong to the snippet, and the snippet to the user.
+	assertStatus(t, client.postForm(fmt.Sprintf("/snippet/%d/versions/%d/restore", id, otherVersions[0].ID), form), http.StatusNotFound)
+	assertStatus(t, client.postForm(fmt.Sprintf("/snippet/%d/versions/%d/restore", other, otherVersions[0].ID), form), http.StatusNotFound)
+	assertStatus(t, client.postForm(fmt.Sprintf("/snippet/%d/versions/999/restore", id), form), http.StatusNotFound)
+
+	rr = client.postForm(fmt.Sprintf("/snippet/%d/versions/%d/restore", id, first), form)
+	assertStatus(t, rr, http.StatusSeeOther)
+	assertHeader(t, rr, "Location", target)
+
+	s, _ := app.snippets.Get(t.Context(), id)
+	if s.Title != "An old silent pond" || s.Content != "A haiku." {
+		t.Errorf("after restore: %q, %q; want the original title and content", s.Title, s.Content)
+	}
+
+	// The edit that was rolled back is kept as a version of its own.
+	versions, _ = app.snippets.ListVersions(t.Context(), id)
+	if len(versions) != 2 || versions[0].Title != "A new silent pond" {
+		t.Errorf("versions after restore = %v; want the edited version first", versions)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	app := newTestApp(t)
+	snippets := app.snippets.(*mock.MockSnippetModel)
+
+	insert := func(title, language string) {
+		t.Helper()
+
+		app.snippets.Insert(t.Context(), title, title+" content.", 7, 1)
+		snippets.Snippets[len(snippets.Snippets)-1].Language = language
+		app.clock.(*clock.Fake).Advance(time.Minute)
+	}
+	insert("Old Go", "go")
+	insert("New Go", "go")
+	insert("Some Python", "python")
+	insert("Some Ruby", "ruby")
+
+	rr := app.testGet(t, "/discover")
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, `<div class="discover-grid">`)
+	assertBody(t, rr, "New Go</a>")
+	assertBody(t, rr, "Some Python</a>")
+	assertBody(t, rr, "No sql snippets yet")
+
+	body := rr.Body.String()
+	if strings.Contains(body, "Old Go") {
+		t.Error("discover shows more than the newest Go snippet")
+	}
+	if strings.Contains(body, "Some Ruby") {
+		t.Error("discover shows a language that is not configured")
+	}
+	// Sections follow the configured order.
+	if strings.Index(body, ">go</a>") > strings.Index(body, ">python</a>") {
+		t.Error("go section is not before python")
+	}
+}
+
+func TestPageMeta(t *testing.T) {
+	app := newTestApp(t)
+	// Pages only carry og:url with a base URL, which must match the
+	// test requests for canonicalHost to let them through.
+	app.config.baseURL = "http://example.com"
+	client := app.newTestClient(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		login  bool
+		wantOG string
+	}{
+		{"public page", "/", false, "http://example.com/"},
+		{"protected page", "/snippet/create", true, "http://example.com/snippet/create"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.login {
+				client.login(app)
+			}
+
+			rr := client.get(tt.path)
+			assertStatus(t, rr, http.StatusOK)
+
+			assertBody(t, rr, `<meta property="og:title" content="Snippetbox">`)
+			assertBody(t, rr, `<meta property="og:description" content="Create, share and view text snippets.">`)
+			assertBody(t, rr, `<meta property="og:type" content="website">`)
+			assertBody(t, rr, fmt.Sprintf(`<meta property="og:url" content="%s">`, tt.wantOG))
+			assertBody(t, rr, `<meta name="twitter:card" content="summary">`)
+			assertBody(t, rr, `<meta name="twitter:title" content="Snippetbox">`)
+		})
+	}
+}
+
+func TestUserSnippetsHTMX(t *testing.T) {
+	app := newTestApp(t)
+	client := app.newTestClient(t)
+	client.login(app)
+
+	if _, err := app.snippets.Insert(t.Context(), "An old silent pond", "A haiku.", 7, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		htmx         bool
+		wantFullPage bool
+	}{
+		{"full page", false, true},
+		{"HTMX request", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/user/snippets?q=pond", nil)
+			if tt.htmx {
+				r.Header.Set("HX-Request", "true")
+			}
+			rr := client.do(r)
+
+			assertStatus(t, rr, http.StatusOK)
+			if !slices.Contains(rr.Header().Values("Vary"), "HX-Request") {
+				t.Errorf("Vary = %q; want it to include HX-Request", rr.Header().Values("Vary"))
+			}
+
+			body := rr.Body.String()
+			assertBody(t, rr, `<table class="user-snippets"`)
+			assertBody(t, rr, "An old silent pond")
+			for _, outside := range []string{"<html", "<h2>My Snippets</h2>", `<div id="snippet-results">`, "<footer"} {
+				if strings.Contains(body, outside) != tt.wantFullPage {
+					t.Errorf("body contains %q: %t; want %t", outside, !tt.wantFullPage, tt.wantFullPage)
+				}
+			}
+		})
+	}
+}
+
+func TestSnippetDraft(t *testing.T) {
+	app := newTestApp(t)
+	client := app.newTestClient(t)
+	client.login(app)
+
+	csrfToken := client.formTokens("/snippet/create").Get("csrf_token")
+
+	// Save a draft, and find it restored on the create page later.
+	rr := client.postJSON("/snippet/draft", csrfToken, `{"title":"Draft title","content":"Draft content"}`)
+	assertStatus(t, rr, http.StatusNoContent)
+
+	app.clock.(*clock.Fake).Advance(5 * time.Minute)
+
+	rr = client.get("/snippet/create")
+	assertStatus(t, rr, http.StatusOK)
+	assertBody(t, rr, "Restored your draft from 5 minutes ago.")
+	assertBody(t, rr, "Draft title")
+	assertBody(t, rr, "Draft content")
+
+	// An oversized draft is refused and leaves the saved one alone.
+	big := fmt.Sprintf(`{"title":"Too big","content":%q}`, strings.Repeat("x", maxDraftBytes))
+	rr = client.postJSON("/snippet/draft", csrfToken, big)
+	assertStatus(t, rr, http.StatusRequestEntityTooLarge)
+
+	rr = client.get("/snippet/create")
+	assertBody(t, rr, "Draft title")
+
+	// Creating the snippet clears the draft.
+	form := client.formTokens("/snippet/create")
+	form.Set("title", "Final title")
+	form.Set("content", "Final content")
+	form.Set("expires", "7")
+	rr = client.postForm("/snippet/create", form)
+	assertStatus(t, rr, http.StatusSeeOther)
+
+	rr = client.get("/snippet/create")
+	assertStatus(t, rr, http.StatusOK)
+	for _, gone := range []string{"Restored your draft", "Draft title", "Draft content"} {
+		if strings.Contains(rr.Body.String(), gone) {
+			t.Errorf("create page still contains %q after the snippet was created", gone)
+		}
+	}
+}
+
+func TestFormTokenSeveralTabs(t *testing.T) {
+	app := newTestApp(t)
+	client := app.newTestClient(t)
+	client.login(app)
+
+	create := func(form url.Values, title string) *httptest.ResponseRecorder {
+		form.Set("title", title)
+		form.Set("content", title)
+		form.Set("expires", "7")
+		return client.postForm("/snippet/create", form)
+	}
+
+	// Two tabs open the create page, then submit in the opposite order.
+	first := client.formTokens("/snippet/create")
+	second := client.formTokens("/snippet/create")
+
+	assertStatus(t, create(second, "Second tab"), http.StatusSeeOther)
+	assertStatus(t, create(first, "First tab"), http.StatusSeeOther)
+
+	// Each token is only good once.
+	assertStatus(t, create(first, "Resubmitted"), http.StatusForbidden)
+
+	// Only the newest maxFormTokens forms can be submitted.
+	oldest := client.formTokens("/snippet/create")
+	var newest url.Values
+	for range maxFormTokens {
+		newest = client.formTokens("/snippet/create")
+	}
+	assertStatus(t, create(oldest, "Oldest tab"), http.StatusForbidden)
+	assertStatus(t, create(newest, "Newest tab"), http.StatusSeeOther)
+}
+
+// failingStore is a content store that is down.
+type failingStore struct{}
+
+var errStoreDown = errors.New("content store unavailable")
+
+func (failingStore) Put(context.Context, int, io.Reader) error       { return errStoreDown }
+func (failingStore) Get(context.Context, int) (io.ReadCloser, error) { return nil, errStoreDown }
+func (failingStore) Delete(context.Context, int) error               { return errStoreDown }
+
+func TestContentStoreFailure(t *testing.T) {
+	const threshold = 16
+
+	t.Run("put", func(t *testing.T) {
+		app := newTestApp(t)
+		logs := withLogBuffer(app)
+		db := &stubDB{exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			return insertResult(42), nil
+		}}
+		app.snippets = &models.SnippetModel{DB: db.open(), Store: failingStore{}, ExternalThreshold: threshold, Logger: app.dbLogger}
+		client := app.newTestClient(t)
+		client.login(app)
+
+		form := client.formTokens("/snippet/create")
+		form.Set("title", "An old silent pond")
+		form.Set("content", strings.Repeat("A frog jumps in. ", 4))
+		form.Set("expires", "7")
+		rr := client.postForm("/snippet/create", form)
+
+		assertStatus(t, rr, http.StatusInternalServerError)
+		if !strings.Contains(logs.String(), errStoreDown.Error()) {
+			t.Errorf("log %q does not contain the store error", logs.String())
+		}
+
+		// The row inserted before the content was stored is removed again.
+		execs := db.executed()
+		if len(execs) != 2 || !strings.HasPrefix(execs[0].query, "INSERT INTO snippets") ||
+			execs[1].query != "DELETE FROM snippets WHERE id = ?" || execs[1].args[0] != int64(42) {
+			t.Errorf("statements %+v; want the insert followed by deleting row 42", execs)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		db := &stubDB{query: func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+			if strings.HasPrefix(query, "SELECT content, content_external") {
+				return []string{"content", "content_external"}, [][]driver.Value{{"", true}}, nil
+			}
+			columns := make([]string, 17)
+			return columns, [][]driver.Value{{
+				int64(42), "An old silent pond", "", now, now, now.Add(7 * 24 * time.Hour), int64(0), "",
+				int64(0), false, false, true, false, "", "", false, nil,
+			}}, nil
+		}}
+
+		for _, path := range []string{"/snippet/view/42", "/snippet/view/42/copy-text"} {
+			app := newTestApp(t)
+			logs := withLogBuffer(app)
+			app.snippets = &models.SnippetModel{DB: db.open(), Store: failingStore{}, ExternalThreshold: threshold, Logger: app.dbLogger}
+
+			rr := app.testGet(t, path)
+
+			assertStatus(t, rr, http.StatusInternalServerError)
+			if !strings.Contains(logs.String(), errStoreDown.Error()) {
+				t.Errorf("%s: log %q does not contain the store error", path, logs.String())
+			}
+		}
+	})
+}
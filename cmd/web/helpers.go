@@ -2,62 +2,571 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"maps"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"snippet.robertgleason.ca/internal/events"
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/validator"
 )
 
+// serverError logs err and sends a response that shows only a generic
+// message. err is usually a model or template error and is answered as
+// Internal; an *AppError in its chain supplies the status and message
+// instead. The full error is logged, with any LogAttrs it provides.
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		appErr = Internal(err)
+	}
+
 	var (
 		method = r.Method
 		uri    = r.URL.RequestURI()
 	)
 
-	app.logger.Error(err.Error(), "method", method, "url", uri)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-}
+	args := []any{"method", method, "url", uri, "status", appErr.Code}
 
-func (app *application) clientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
+	var attrErr interface{ LogAttrs() []slog.Attr }
+	if errors.As(err, &attrErr) {
+		for _, attr := range attrErr.LogAttrs() {
+			args = append(args, attr)
+		}
+	}
+
+	app.requestLogger(r).Error(err.Error(), args...)
+	http.Error(w, appErr.Message, appErr.Code)
 }
 
-func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data templateData) {
-	ts, ok := app.templateCache[page]
-	if !ok {
-		err := fmt.Errorf("template %s not found", page)
+// clientError sends err's status and message. Its cause, if it has one, is
+// logged at debug level: client errors are expected, but the cause explains
+// a response that would otherwise be puzzling.
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, err *AppError) {
+	if err.Cause != nil {
+		app.requestLogger(r).Debug(err.Message, "method", r.Method, "url", r.URL.RequestURI(), "status", err.Code, "cause", err.Cause.Error())
+	}
+	http.Error(w, err.Message, err.Code)
+}
 
+// renderJSON encodes data as the JSON response body with the given status.
+// Nothing is written if data cannot be encoded, so the server error response
+// is still possible.
+func (app *application) renderJSON(w http.ResponseWriter, r *http.Request, status int, data any) {
+	js, err := json.Marshal(data)
+	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	buf := new(bytes.Buffer)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
 
-	err := ts.ExecuteTemplate(buf, "base", data)
+// renderCacheableJSON is renderJSON for public GET responses. It sets an ETag
+// derived from the body and answers a matching If-None-Match with 304 Not
+// Modified. Callers set Cache-Control themselves.
+func (app *application) renderCacheableJSON(w http.ResponseWriter, r *http.Request, data any) {
+	js, err := json.Marshal(data)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+	js = append(js, '\n')
+
+	sum := sha256.Sum256(js)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(js)
+}
+
+// etagMatches reports whether an If-None-Match header value lists etag,
+// using the weak comparison that RFC 9110 requires for this header.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// maxJSONBytes is the largest request body readJSON accepts. Handlers can
+// wrap r.Body in a smaller http.MaxBytesReader first.
+const maxJSONBytes = 1 << 20
+
+// readJSON decodes a single JSON value from the request body into dst.
+// Unknown fields, trailing data and bodies over maxJSONBytes are errors; the
+// last is reported as an *http.MaxBytesError.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		return err
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// jsonFieldNames maps validator field keys to the JSON keys API clients
+// send, where the two differ. Keys not listed are lowercased.
+var jsonFieldNames = map[string]string{}
+
+func jsonFieldName(key string) string {
+	if name, ok := jsonFieldNames[key]; ok {
+		return name
+	}
+	return strings.ToLower(key)
+}
+
+// failedValidationResponse is the API counterpart of re-rendering a form
+// with inline errors: a 422 listing every field and non-field error in v.
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	fields := make(map[string]string, len(v.FieldErrors))
+	for key, message := range v.FieldErrors {
+		fields[jsonFieldName(key)] = message
+	}
+
+	nonFieldErrors := v.NonFieldErrors
+	if nonFieldErrors == nil {
+		nonFieldErrors = []string{}
+	}
+
+	app.renderJSON(w, r, http.StatusUnprocessableEntity, map[string]any{
+		"error":            "validation failed",
+		"fields":           fields,
+		"non_field_errors": nonFieldErrors,
+	})
+}
+
+// notFoundResponse is the API counterpart of clientError with NotFound: a
+// 404 with a JSON body, for endpoints the page scripts call.
+func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request, cause error) {
+	if cause != nil {
+		app.requestLogger(r).Debug(http.StatusText(http.StatusNotFound), "method", r.Method, "url", r.URL.RequestURI(), "status", http.StatusNotFound, "cause", cause.Error())
+	}
+	app.renderJSON(w, r, http.StatusNotFound, map[string]string{"error": "not found"})
+}
+
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data templateData) {
+	ts, err := app.lookupTemplate(page)
+	if err != nil {
+		app.templateError(w, r, page, err)
+		return
+	}
+
+	if data.Form != nil {
+		data.FormToken = app.generateFormToken(r)
+	}
+
+	buf, err := app.executeTemplate(r, ts, page, "base", data)
+	if err != nil {
+		app.templateError(w, r, page, err)
+		return
+	}
+
+	w.WriteHeader(status)
+
+	buf.WriteTo(w)
+}
+
+// renderPartial executes a single named block from a page's template set
+// instead of the full "base" layout, for htmx-style fragment updates. Because
+// the layout (and its flash area) is not rendered, any flash message is sent
+// to the client in an HX-Trigger "showFlash" event instead.
+func (app *application) renderPartial(w http.ResponseWriter, r *http.Request, status int, page, block string, data templateData) {
+	ts, err := app.lookupTemplate(page)
+	if err != nil {
+		app.templateError(w, r, page, err)
+		return
+	}
+
+	buf, err := app.executeTemplate(r, ts, page, block, data)
+	if err != nil {
+		app.templateError(w, r, page, err)
+		return
+	}
+
+	if data.Flash != "" {
+		trigger, err := json.Marshal(map[string]string{"showFlash": data.Flash})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		w.Header().Set("HX-Trigger", string(trigger))
+	}
 
 	w.WriteHeader(status)
 
 	buf.WriteTo(w)
 }
 
+// lookupTemplate returns the template set for page. In -dev mode the
+// templates are re-parsed from disk on every call.
+func (app *application) lookupTemplate(page string) (*template.Template, error) {
+	cache := app.templateCache
+
+	if app.config.dev {
+		var err error
+		cache, err = parseTemplates(os.DirFS(app.config.uiDir), app.assets, app.clock)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ts, ok := cache[page]
+	if !ok {
+		return nil, &missingTemplateError{page: page, available: slices.Sorted(maps.Keys(cache))}
+	}
+
+	return ts, nil
+}
+
+// missingTemplateError reports a page that is not in the template cache,
+// which is a deployment or packaging bug rather than a problem with the
+// request. The cached page names are logged to help diagnose it.
+type missingTemplateError struct {
+	page      string
+	available []string
+}
+
+func (e *missingTemplateError) Error() string {
+	return fmt.Sprintf("template %s not found", e.page)
+}
+
+func (e *missingTemplateError) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("template", e.page), slog.Any("available", e.available)}
+}
+
+// templateExecError reports a page that failed to execute, which usually
+// means the data passed to it was bad.
+type templateExecError struct {
+	page     string
+	dataType string
+	err      error
+}
+
+func (e *templateExecError) Error() string {
+	return e.err.Error()
+}
+
+func (e *templateExecError) Unwrap() error {
+	return e.err
+}
+
+func (e *templateExecError) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("template", e.page), slog.String("data_type", e.dataType)}
+}
+
+// executeTemplate executes the named template of page into a buffer. With
+// -resilient-render, a failure on a page listing snippets is retried with
+// each snippet left out in turn, so that one bad row does not take down the
+// whole listing; the dropped snippet is logged.
+func (app *application) executeTemplate(r *http.Request, ts *template.Template, page, name string, data templateData) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+
+	err := ts.ExecuteTemplate(buf, name, data)
+	if err == nil {
+		return buf, nil
+	}
+	execErr := &templateExecError{page: page, dataType: fmt.Sprintf("%T", data), err: err}
+
+	if !app.config.resilientRender || len(data.Snippets) == 0 {
+		return nil, execErr
+	}
+
+	all := data.Snippets
+	for i := range all {
+		data.Snippets = slices.Delete(slices.Clone(all), i, i+1)
+
+		buf.Reset()
+		if ts.ExecuteTemplate(buf, name, data) == nil {
+			args := []any{"method", r.Method, "url", r.URL.RequestURI(), "template", page, "index", i, "error", err.Error()}
+			if all[i] != nil {
+				args = append(args, "snippet_id", all[i].ID)
+			}
+			app.requestLogger(r).Warn("rendered page without a snippet that failed to render", args...)
+			return buf, nil
+		}
+	}
+
+	return nil, execErr
+}
+
+// templateError reports a failure to parse or execute a template. In -dev
+// mode it responds with the error overlay; otherwise it is a normal server
+// error.
+func (app *application) templateError(w http.ResponseWriter, r *http.Request, page string, err error) {
+	if !app.config.dev {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.httpLogger.Error(err.Error(), "method", r.Method, "url", r.URL.RequestURI(), "template", page)
+	renderTemplateOverlay(w, os.DirFS(app.config.uiDir), page, err)
+}
+
+// isHTMX reports whether the request was made by htmx and so expects an HTML
+// fragment rather than a full page.
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// readSortAndPage sets filters.Sort, defaulting to newest first, and
+// filters.Page from the sort and page query parameters. It returns false if
+// either is invalid.
+func readSortAndPage(query url.Values, filters *models.SnippetFilters) bool {
+	filters.Sort = query.Get("sort")
+	if filters.Sort == "" {
+		filters.Sort = models.SortCreatedDesc
+	}
+	if !validator.PermittedValues(filters.Sort, models.SnippetSortValues...) {
+		return false
+	}
+
+	if page := query.Get("page"); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return false
+		}
+		filters.Page = n
+	}
+	return true
+}
+
+// knownLanguage returns lang if it is one of the languages counted in
+// languages, or "" so that an unknown language filter is ignored.
+func knownLanguage(languages []models.LanguageCount, lang string) string {
+	for _, l := range languages {
+		if l.Language == lang {
+			return lang
+		}
+	}
+	return ""
+}
+
+// recentlyViewedLimit is the number of snippets in the recently viewed
+// sidebar.
+const recentlyViewedLimit = 5
+
+// newTemplateData returns the data every page needs. The parts that depend
+// on the session and cookies are filled in by the steps below, in order, so
+// that each can be tested on its own.
 func (app *application) newTemplateData(r *http.Request) templateData {
-	return templateData{
-		CurrentYear:     time.Now().Year(),
-		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r),
+	data := templateData{
+		FormValues:       r.PostForm,
+		UserTZ:           app.sessionManager.GetString(r.Context(), "timezone"),
+		Consent:          readConsent(r),
+		Impersonating:    app.impersonatedEmail(r),
+		RateLimitWarning: rateLimitWarning(r),
+		AnalyticsSrc:     app.config.analyticsSrc,
+		ContentLimits:    app.config.contentLimits,
+		RecentlyViewed:   app.recentlyViewed(r),
+		Meta: pageMeta{
+			Title:       "Snippetbox",
+			Description: "Create, share and view text snippets.",
+			URL:         app.absoluteURL(r.URL.Path),
+			Type:        "website",
+			TwitterCard: "summary",
+		},
 	}
+
+	for _, step := range []func(*templateData, *http.Request){
+		app.addCurrentYear,
+		app.addFlash,
+		app.addAuthenticatedUser,
+		app.addCSRFToken,
+		app.addTheme,
+	} {
+		step(&data, r)
+	}
+	return data
 }
 
+func (app *application) addCurrentYear(data *templateData, r *http.Request) {
+	data.CurrentYear = app.clock.Now().Year()
+}
+
+// addFlash moves the flash message from the session to the page, so that it
+// is shown once.
+func (app *application) addFlash(data *templateData, r *http.Request) {
+	data.Flash = app.sessionManager.PopString(r.Context(), "flash")
+}
+
+// addAuthenticatedUser sets IsAuthenticated and, for a signed-in user, the
+// user's record. The page is still shown if the record cannot be loaded, so
+// errors are logged and leave AuthenticatedUser empty.
+func (app *application) addAuthenticatedUser(data *templateData, r *http.Request) {
+	data.IsAuthenticated = app.isAuthenticated(r)
+	if !data.IsAuthenticated {
+		return
+	}
+
+	user, err := app.users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.requestLogger(r).Error("loading authenticated user", "error", err)
+		return
+	}
+	data.AuthenticatedUser = user
+}
+
+func (app *application) addCSRFToken(data *templateData, r *http.Request) {
+	data.CSRFToken = nosurf.Token(r)
+}
+
+// addTheme sets the colour theme chosen in the theme cookie. An unknown
+// value is ignored, leaving the default.
+func (app *application) addTheme(data *templateData, r *http.Request) {
+	cookie, err := r.Cookie(themeCookieName)
+	if err != nil {
+		return
+	}
+	if validator.PermittedValues(cookie.Value, themes...) {
+		data.Theme = cookie.Value
+	}
+}
+
+// themeCookieName is the cookie holding the visitor's colour theme, one of
+// themes. Without it the stylesheet's default applies.
+const themeCookieName = "theme"
+
+var themes = []string{"light", "dark"}
+
+// recentlyViewed returns the authenticated user's recently viewed snippets
+// for the sidebar. The sidebar is not worth failing a page for, so errors
+// are logged and give an empty list.
+func (app *application) recentlyViewed(r *http.Request) []*models.Snippet {
+	if !app.isAuthenticated(r) {
+		return nil
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	snippets, err := app.snippets.RecentlyViewed(r.Context(), userID, recentlyViewedLimit)
+	if err != nil {
+		app.requestLogger(r).Error("loading recently viewed snippets", "error", err)
+		return nil
+	}
+	return snippets
+}
+
+// setMeta sets page metadata from property/content pairs, e.g.
+// app.setMeta(&data, "og:title", title, "og:url", url). The og:title,
+// og:description, og:url, og:type and twitter:card properties set the
+// matching pageMeta field, which also feeds the twitter:title and
+// twitter:description tags; any other property is rendered as given. An odd
+// number of arguments is a programming error and panics.
+func (app *application) setMeta(data *templateData, pairs ...string) {
+	if len(pairs)%2 != 0 {
+		panic(fmt.Sprintf("setMeta: odd number of arguments (%d)", len(pairs)))
+	}
+
+	for i := 0; i < len(pairs); i += 2 {
+		property, content := pairs[i], pairs[i+1]
+		switch property {
+		case "og:title":
+			data.Meta.Title = content
+		case "og:description":
+			data.Meta.Description = content
+		case "og:url":
+			data.Meta.URL = content
+		case "og:type":
+			data.Meta.Type = content
+		case "twitter:card":
+			data.Meta.TwitterCard = content
+		default:
+			if data.Meta.Extra == nil {
+				data.Meta.Extra = make(map[string]string)
+			}
+			data.Meta.Extra[property] = content
+		}
+	}
+}
+
+// absoluteURL joins path onto the configured base URL. It returns an empty
+// string when no base URL is configured.
+func (app *application) absoluteURL(path string) string {
+	if app.config.baseURL == "" {
+		return ""
+	}
+	return app.config.baseURL + path
+}
+
+// linkURL returns an absolute URL for path, for links that are used outside
+// the site. Without a configured base URL it uses the request's host.
+func (app *application) linkURL(r *http.Request, path string) string {
+	if u := app.absoluteURL(path); u != "" {
+		return u
+	}
+	return "https://" + r.Host + path
+}
+
+// excerpt collapses whitespace in s and truncates it to at most n runes,
+// breaking at the last word boundary and appending an ellipsis when cut.
+func excerpt(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// decodePostForm decodes the request's form body into dst. A
+// multipart/form-data body is parsed holding up to -max-multipart-memory
+// bytes of it in memory; larger file parts are written to temporary files,
+// which the server removes once the handler returns.
 func (app *application) decodePostForm(r *http.Request, dst any) error {
-	err := r.ParseForm()
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(app.config.maxMultipartMemory)
+	} else {
+		err = r.ParseForm()
+	}
 	if err != nil {
 		return err
 	}
@@ -81,3 +590,257 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	}
 	return isAuthenticated
 }
+
+// impersonatorID returns the ID of the admin impersonating the authenticated
+// user, or zero if the request is not impersonated.
+func impersonatorID(r *http.Request) int {
+	id, _ := r.Context().Value(impersonatorContextKey).(int)
+	return id
+}
+
+// requestLogger returns the http logger for messages about r. Under
+// impersonation every message carries the admin's ID.
+func (app *application) requestLogger(r *http.Request) *slog.Logger {
+	if id := impersonatorID(r); id != 0 {
+		return app.httpLogger.With("impersonator_id", id)
+	}
+	return app.httpLogger
+}
+
+// streamWriteTimeout is how long a streamed response, such as the snippet
+// export, has to be written. The server's WriteTimeout is sized for
+// buffered pages and would cut a large download short.
+const streamWriteTimeout = 10 * time.Minute
+
+// extendWriteDeadline gives the response to r streamWriteTimeout from now
+// to be written. Writers that cannot set a deadline, such as test
+// recorders, are left as they are.
+func (app *application) extendWriteDeadline(w http.ResponseWriter, r *http.Request) {
+	err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.requestLogger(r).Warn("could not extend the write deadline", "error", err.Error())
+	}
+}
+
+// audit records a security-relevant event in the log, marked with
+// audit=true so it can be filtered out of the general request logs.
+func (app *application) audit(event string, args ...any) {
+	app.logger.Info(event, append([]any{"audit", true}, args...)...)
+}
+
+// isAdmin reports whether the authenticated user is an administrator. It
+// returns false for anonymous requests.
+func (app *application) isAdmin(r *http.Request) (bool, error) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if userID == 0 {
+		return false, nil
+	}
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		return false, err
+	}
+	return user.IsAdmin, nil
+}
+
+// impersonatedEmail returns the email address of the user being
+// impersonated, for the impersonation banner, or "" if there is none.
+func (app *application) impersonatedEmail(r *http.Request) string {
+	if impersonatorID(r) == 0 {
+		return ""
+	}
+	return app.sessionManager.GetString(r.Context(), "impersonatedEmail")
+}
+
+// rateLimitWarning returns the banner set by the rateLimit middleware, if the
+// client is close to its limit.
+func rateLimitWarning(r *http.Request) string {
+	warning, _ := r.Context().Value(rateLimitWarningContextKey).(string)
+	return warning
+}
+
+// userAgentSummary reduces a User-Agent header to a short "Browser on OS"
+// description for the sessions page.
+func userAgentSummary(ua string) string {
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	platform := "unknown OS"
+	for _, o := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			platform = o.name
+			break
+		}
+	}
+
+	return browser + " on " + platform
+}
+
+// clientIP returns the IP address of the client, without the port.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// checkSnippetQuota reports whether the requester may create another snippet
+// today. Registered users are counted by user ID and anonymous clients by
+// hashed IP address; a limit of zero is unlimited and admins are exempt. When
+// the quota is exhausted it also returns the time at which it resets, which
+// is the next midnight UTC.
+func (app *application) checkSnippetQuota(r *http.Request) (bool, time.Time, error) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	limit, ownerKey := app.config.quotaAnonymous, models.IPOwnerKey(clientIP(r))
+	if userID != 0 {
+		limit, ownerKey = app.config.quotaRegistered, models.UserOwnerKey(userID)
+	}
+	if limit == 0 {
+		return true, time.Time{}, nil
+	}
+
+	admin, err := app.isAdmin(r)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	if admin {
+		return true, time.Time{}, nil
+	}
+
+	windowStart := app.clock.Now().UTC().Truncate(24 * time.Hour)
+
+	count, err := app.snippets.CountCreatedSince(r.Context(), ownerKey, windowStart)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	if count >= limit {
+		events.QuotaExceeded(r.Context(), app.logger, ownerKey, limit, count)
+		return false, windowStart.Add(24 * time.Hour), nil
+	}
+	return true, time.Time{}, nil
+}
+
+// timeAgo describes how long ago something happened in rough, human terms.
+func timeAgo(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "less than a minute ago"
+	case d < time.Hour:
+		return pluralize(int(d/time.Minute), "minute") + " ago"
+	case d < 24*time.Hour:
+		return pluralize(int(d/time.Hour), "hour") + " ago"
+	default:
+		return pluralize(int(d/(24*time.Hour)), "day") + " ago"
+	}
+}
+
+// maxFormTokens is how many form tokens a session keeps outstanding, which
+// is how many forms can be open at once, say in several tabs, and still be
+// submitted. Beyond it the oldest token is dropped.
+const maxFormTokens = 8
+
+// generateFormToken creates a random one-time token for a form submission and
+// adds it to the session's outstanding tokens.
+func (app *application) generateFormToken(r *http.Request) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	token := fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+
+	tokens, _ := app.sessionManager.Get(r.Context(), "form_tokens").([]string)
+	tokens = append(tokens, token)
+	if len(tokens) > maxFormTokens {
+		tokens = tokens[len(tokens)-maxFormTokens:]
+	}
+	app.sessionManager.Put(r.Context(), "form_tokens", tokens)
+	return token
+}
+
+// validateFormToken reports whether submitted is one of the session's
+// outstanding form tokens, and consumes it if so. A token can therefore only
+// be used once, while the tokens of other open forms stay valid.
+func (app *application) validateFormToken(r *http.Request, submitted string) bool {
+	if submitted == "" {
+		return false
+	}
+
+	tokens, _ := app.sessionManager.Get(r.Context(), "form_tokens").([]string)
+	for i, token := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(submitted)) == 1 {
+			app.sessionManager.Put(r.Context(), "form_tokens", slices.Delete(tokens, i, i+1))
+			return true
+		}
+	}
+	return false
+}
+
+// consentCookieName is the cookie holding the visitor's consent preferences,
+// encoded as URL query values, e.g. "analytics=false&functional=true".
+const consentCookieName = "consent"
+
+// consentPreferences records which optional cookies and scripts a visitor has
+// agreed to. Functional cookies are always required. Set is false when the
+// visitor has not made a choice yet.
+type consentPreferences struct {
+	Set        bool `json:"set"`
+	Analytics  bool `json:"analytics"`
+	Functional bool `json:"functional"`
+}
+
+func readConsent(r *http.Request) consentPreferences {
+	prefs := consentPreferences{Functional: true}
+
+	cookie, err := r.Cookie(consentCookieName)
+	if err != nil {
+		return prefs
+	}
+
+	values, err := url.ParseQuery(cookie.Value)
+	if err != nil {
+		return prefs
+	}
+
+	prefs.Set = true
+	prefs.Analytics = values.Get("analytics") == "true"
+	return prefs
+}
+
+func writeConsent(w http.ResponseWriter, prefs consentPreferences) {
+	values := url.Values{}
+	values.Set("analytics", strconv.FormatBool(prefs.Analytics))
+	values.Set("functional", "true")
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     consentCookieName,
+		Value:    values.Encode(),
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
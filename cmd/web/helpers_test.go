@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"golang.org/x/net/html"
+	"snippet.robertgleason.ca/internal/assets"
+	"snippet.robertgleason.ca/internal/clock"
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/models/mock"
+	"snippet.robertgleason.ca/internal/validator"
+)
+
+// withLogBuffer sends the application's http log entries to the returned
+// buffer.
+func withLogBuffer(app *application) *bytes.Buffer {
+	var buf bytes.Buffer
+	app.httpLogger = slog.New(slog.NewTextHandler(&buf, nil))
+	return &buf
+}
+
+func TestRenderMissingTemplate(t *testing.T) {
+	app := newTestApp(t)
+	logs := withLogBuffer(app)
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	app.render(rr, r, http.StatusOK, "missing.tmpl", templateData{})
+
+	assertStatus(t, rr, http.StatusInternalServerError)
+
+	for _, want := range []string{"level=ERROR", "template missing.tmpl not found", "template=missing.tmpl", "available=", "home.tmpl"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log %q does not contain %q", logs.String(), want)
+		}
+	}
+}
+
+func TestMustParseTemplatesPanics(t *testing.T) {
+	fsys := fstest.MapFS{
+		"html/base.tmpl":         {Data: []byte(`{{define "base"}}{{template "main" .}}{{end}}`)},
+		"html/partials/nav.tmpl": {Data: []byte(`{{define "nav"}}{{end}}`)},
+		"html/pages/good.tmpl":   {Data: []byte(`{{define "main"}}ok{{end}}`)},
+		"html/pages/broken.tmpl": {Data: []byte(`{{define "main"}}{{if}}{{end}}`)},
+	}
+	manifest, err := assets.NewManifest(fstest.MapFS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "broken.tmpl") {
+			t.Errorf("panic = %q; want it to name broken.tmpl", msg)
+		}
+	}()
+	mustParseTemplates(fsys, manifest, clock.Real{})
+	t.Error("mustParseTemplates did not panic")
+}
+
+func TestRenderExecError(t *testing.T) {
+	app := newTestApp(t)
+	logs := withLogBuffer(app)
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	data := templateData{Snippets: []*models.Snippet{{ID: 1, Title: "First"}, nil}}
+	app.render(rr, r, http.StatusOK, "home.tmpl", data)
+
+	assertStatus(t, rr, http.StatusInternalServerError)
+
+	for _, want := range []string{"level=ERROR", "nil pointer", "template=home.tmpl", "data_type=main.templateData"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log %q does not contain %q", logs.String(), want)
+		}
+	}
+}
+
+func TestRenderResilient(t *testing.T) {
+	app := newTestApp(t)
+	app.config.resilientRender = true
+	logs := withLogBuffer(app)
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	data := templateData{Snippets: []*models.Snippet{{ID: 1, Title: "First"}, nil, {ID: 3, Title: "Third"}}}
+	app.render(rr, r, http.StatusOK, "home.tmpl", data)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rr.Code, http.StatusOK)
+	}
+
+	assertBody(t, rr, "First")
+	assertBody(t, rr, "Third")
+
+	for _, want := range []string{"level=WARN", "index=1"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log %q does not contain %q", logs.String(), want)
+		}
+	}
+}
+
+func TestRenderResilientNoSingleCulprit(t *testing.T) {
+	app := newTestApp(t)
+	app.config.resilientRender = true
+	withLogBuffer(app)
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	data := templateData{Snippets: []*models.Snippet{nil, {ID: 2, Title: "Second"}, nil}}
+	app.render(rr, r, http.StatusOK, "home.tmpl", data)
+
+	assertStatus(t, rr, http.StatusInternalServerError)
+}
+
+// A field that templates render before the typed form grows it, such as a
+// future language picker, must survive a failed submission.
+func TestFormValueKeepsUnknownFields(t *testing.T) {
+	app := newTestApp(t)
+
+	body := url.Values{"title": {""}, "content": {"kept"}, "expires": {"7"}, "language": {"go"}}
+	r := httptest.NewRequest(http.MethodPost, "/snippet/create", strings.NewReader(body.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	ctx, err := app.sessionManager.Load(r.Context(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = r.WithContext(ctx)
+
+	var form snippetCreateForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+
+	ts := template.Must(template.New("form").Parse(`<input name="language" value="{{.FormValue "language"}}">`))
+
+	var buf bytes.Buffer
+	err = ts.Execute(&buf, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<input name="language" value="go">`; buf.String() != want {
+		t.Errorf("rendered %q; want %q", buf.String(), want)
+	}
+}
+
+func TestDecodePostFormMultipart(t *testing.T) {
+	app := newTestApp(t)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "An old silent pond")
+	mw.WriteField("content", "A frog jumps into the pond.")
+	mw.WriteField("expires", "7")
+	part, err := mw.CreateFormFile("attachment", "pond.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("splash"))
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/snippet/create", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var form snippetCreateForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Title != "An old silent pond" || form.Content != "A frog jumps into the pond." || form.Expires != 7 {
+		t.Errorf("decoded %+v; want the multipart fields", form)
+	}
+
+	// File parts are parsed too, ready for handlers that take uploads.
+	if files := r.MultipartForm.File["attachment"]; len(files) != 1 || files[0].Filename != "pond.txt" {
+		t.Errorf("attachment = %v; want pond.txt", files)
+	}
+}
+
+func TestExtendWriteDeadline(t *testing.T) {
+	app := newTestApp(t)
+
+	// A handler that outlasts the server's WriteTimeout still delivers its
+	// whole response once it has extended the deadline.
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("extend") {
+			app.extendWriteDeadline(w, r)
+		}
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("the whole export"))
+	}))
+	srv.Config.WriteTimeout = 20 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	get := func(target string) (string, error) {
+		res, err := srv.Client().Get(srv.URL + target)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		return string(body), err
+	}
+
+	if body, err := get("/"); err == nil && body == "the whole export" {
+		t.Fatal("response was delivered past the WriteTimeout without extending it")
+	}
+	body, err := get("/?extend")
+	if err != nil || body != "the whole export" {
+		t.Errorf("extended response = %q, %v; want the whole body", body, err)
+	}
+}
+
+func TestFormValueRerender(t *testing.T) {
+	app := newTestApp(t)
+
+	client := app.newTestClient(t)
+	client.login(app)
+
+	rr := client.get("/snippet/create")
+	assertStatus(t, rr, http.StatusOK)
+	if got := checkedValue(t, rr, "expires"); got != "365" {
+		t.Errorf("new form selects expires %q; want the default 365", got)
+	}
+
+	form := client.formTokens("/snippet/create")
+	form.Set("title", "")
+	form.Set("content", "Keep me")
+	form.Set("expires", "7")
+
+	rr = client.postForm("/snippet/create", form)
+	assertStatus(t, rr, http.StatusUnprocessableEntity)
+	assertBody(t, rr, `<textarea name="content">Keep me</textarea>`)
+	if got := checkedValue(t, rr, "expires"); got != "7" {
+		t.Errorf("re-rendered form selects expires %q; want the submitted 7", got)
+	}
+}
+
+// checkedValue returns the value of the checked radio button called name in
+// the page in rr, or "" if none is checked.
+func checkedValue(t *testing.T, rr *httptest.ResponseRecorder, name string) string {
+	t.Helper()
+
+	doc, err := html.Parse(strings.NewReader(rr.Body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range findElements(doc, "input") {
+		if attr(input, "name") != name {
+			continue
+		}
+		for _, a := range input.Attr {
+			if a.Key == "checked" {
+				return attr(input, "value")
+			}
+		}
+	}
+	return ""
+}
+
+func TestNewTemplateData(t *testing.T) {
+	app := newTestApp(t)
+	app.users.(*mock.MockUserModel).User = models.User{ID: 1, Name: "Alice"}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: themeCookieName, Value: "dark"})
+
+	ctx, err := app.sessionManager.Load(r.Context(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.sessionManager.Put(ctx, "flash", "Saved!")
+	app.sessionManager.Put(ctx, "authenticatedUserID", 1)
+	// As the authenticate middleware does for an existing user.
+	ctx = context.WithValue(ctx, isAuthenticatedContextKey, true)
+	r = r.WithContext(ctx)
+
+	// The CSRF token is only available inside the CSRF middleware.
+	var data templateData
+	preventCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data = app.newTemplateData(r)
+	})).ServeHTTP(httptest.NewRecorder(), r)
+
+	if data.CurrentYear != 2025 {
+		t.Errorf("CurrentYear = %d; want 2025", data.CurrentYear)
+	}
+	if data.Flash != "Saved!" {
+		t.Errorf("Flash = %q; want %q", data.Flash, "Saved!")
+	}
+	if got := app.sessionManager.GetString(ctx, "flash"); got != "" {
+		t.Errorf("flash left in session: %q", got)
+	}
+	if !data.IsAuthenticated || data.AuthenticatedUser.Name != "Alice" {
+		t.Errorf("IsAuthenticated = %t, AuthenticatedUser = %+v; want Alice", data.IsAuthenticated, data.AuthenticatedUser)
+	}
+	if data.CSRFToken == "" {
+		t.Error("CSRFToken is empty")
+	}
+	if data.Theme != "dark" {
+		t.Errorf("Theme = %q; want dark", data.Theme)
+	}
+}
+
+func TestAddTheme(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name   string
+		cookie string
+		want   string
+	}{
+		{"no cookie", "", ""},
+		{"light", "light", "light"},
+		{"dark", "dark", "dark"},
+		{"unknown", "neon", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: themeCookieName, Value: tt.cookie})
+			}
+
+			var data templateData
+			app.addTheme(&data, r)
+			if data.Theme != tt.want {
+				t.Errorf("Theme = %q; want %q", data.Theme, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddAuthenticatedUserAnonymous(t *testing.T) {
+	app := newTestApp(t)
+	users := app.users.(*mock.MockUserModel)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx, err := app.sessionManager.Load(r.Context(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data templateData
+	app.addAuthenticatedUser(&data, r.WithContext(ctx))
+	if data.IsAuthenticated || data.AuthenticatedUser.ID != 0 {
+		t.Errorf("anonymous request: %+v", data)
+	}
+	if n := users.Calls("Get"); n != 0 {
+		t.Errorf("users.Get called %d times for an anonymous request", n)
+	}
+}
+
+func TestCheckSnippetQuota(t *testing.T) {
+	const limit = 3
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	midnight := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		snippets  int
+		now       time.Time
+		wantOK    bool
+		wantReset time.Time
+	}{
+		{"one under the limit", limit - 1, created, true, time.Time{}},
+		{"exactly the limit", limit, created, false, midnight},
+		{"one over the limit", limit + 1, created, false, midnight},
+		{"last second before midnight", limit, midnight.Add(-time.Second), false, midnight},
+		{"midnight UTC", limit, midnight, true, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.config.quotaRegistered = limit
+			app.users.(*mock.MockUserModel).User = models.User{ID: 1, Name: "Alice"}
+			for i := range tt.snippets {
+				title := fmt.Sprintf("Snippet %d", i)
+				if _, err := app.snippets.Insert(t.Context(), title, title, 7, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			app.clock = clock.Fixed(tt.now)
+
+			r := httptest.NewRequest(http.MethodPost, "/snippet/create", nil)
+			ctx, err := app.sessionManager.Load(r.Context(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.sessionManager.Put(ctx, "authenticatedUserID", 1)
+
+			ok, reset, err := app.checkSnippetQuota(r.WithContext(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK || !reset.Equal(tt.wantReset) {
+				t.Errorf("checkSnippetQuota() = %t, %v; want %t, %v", ok, reset, tt.wantOK, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestFailedValidationResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		validator validator.Validator
+		want      string
+	}{
+		{
+			name: "several field and non-field errors",
+			validator: validator.Validator{
+				FieldErrors: map[string]string{
+					"title":   "This field cannot be blank",
+					"Content": "This field cannot be more than 10 characters long",
+					"expires": "This field must equal 1, 7 or 365",
+				},
+				NonFieldErrors: []string{"This snippet looks like spam", "You have reached your daily snippet limit"},
+			},
+			want: `{"error":"validation failed","fields":{"content":"This field cannot be more than 10 characters long","expires":"This field must equal 1, 7 or 365","title":"This field cannot be blank"},"non_field_errors":["This snippet looks like spam","You have reached your daily snippet limit"]}`,
+		},
+		{
+			name: "field errors only",
+			validator: validator.Validator{
+				FieldErrors: map[string]string{"title": "This field cannot be blank"},
+			},
+			want: `{"error":"validation failed","fields":{"title":"This field cannot be blank"},"non_field_errors":[]}`,
+		},
+		{
+			name: "non-field errors only",
+			validator: validator.Validator{
+				NonFieldErrors: []string{"email address or password is incorrect"},
+			},
+			want: `{"error":"validation failed","fields":{},"non_field_errors":["email address or password is incorrect"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+
+			rr := httptest.NewRecorder()
+			app.failedValidationResponse(rr, httptest.NewRequest(http.MethodPost, "/", nil), &tt.validator)
+
+			assertStatus(t, rr, http.StatusUnprocessableEntity)
+			assertHeader(t, rr, "Content-Type", "application/json")
+			if got := strings.TrimSpace(rr.Body.String()); got != tt.want {
+				t.Errorf("body = %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTemplatesReportsEveryBrokenPage(t *testing.T) {
+	fsys := fstest.MapFS{
+		"html/base.tmpl":              {Data: []byte(`{{define "base"}}{{template "main" .}}{{end}}`)},
+		"html/partials/nav.tmpl":      {Data: []byte(`{{define "nav"}}{{end}}`)},
+		"html/pages/a_syntax.tmpl":    {Data: []byte(`{{define "main"}}{{if}}{{end}}`)},
+		"html/pages/b_good.tmpl":      {Data: []byte(`{{define "main"}}ok{{end}}`)},
+		"html/pages/c_function.tmpl":  {Data: []byte(`{{define "main"}}{{nosuchfunc}}{{end}}`)},
+		"html/pages/d_asset.tmpl":     {Data: []byte(`{{define "main"}}{{asset "css/missing.css"}}{{end}}`)},
+		"html/pages/e_unclosed.tmpl":  {Data: []byte(`{{define "main"}}{{range .}}{{end}}`)},
+		"html/pages/f_also_good.tmpl": {Data: []byte(`{{define "main"}}fine{{end}}`)},
+	}
+	manifest, err := assets.NewManifest(fstest.MapFS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = parseTemplates(fsys, manifest, clock.Real{})
+	if err == nil {
+		t.Fatal("parseTemplates succeeded with broken pages")
+	}
+
+	// Every broken page is reported, in page order, and no good one is.
+	lines := strings.Split(err.Error(), "\n")
+	want := []string{"a_syntax.tmpl: ", "c_function.tmpl: ", "d_asset.tmpl: ", "e_unclosed.tmpl: "}
+	if len(lines) != len(want) {
+		t.Fatalf("error has %d lines; want %d:\n%s", len(lines), len(want), err)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = %q; want it to start with %q", i, lines[i], prefix)
+		}
+	}
+}
+
+func BenchmarkExecuteTemplate(b *testing.B) {
+	app := newTestApp(b)
+	ts, err := app.lookupTemplate("home.tmpl")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	now := app.clock.Now()
+	data := templateData{Pagination: newPagination(1, homePageSize, homePageSize, nil)}
+	for i := range homePageSize {
+		data.Snippets = append(data.Snippets, &models.Snippet{
+			ID:      i + 1,
+			Title:   fmt.Sprintf("Snippet %d", i),
+			Content: "An old silent pond...",
+			Created: now,
+			Expires: now.Add(7 * 24 * time.Hour),
+		})
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	for b.Loop() {
+		if _, err := app.executeTemplate(r, ts, "home.tmpl", "base", data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+	"snippet.robertgleason.ca/internal/clock"
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/models/mock"
+)
+
+func TestHome(t *testing.T) {
+	app := newTestApp(t)
+
+	titles := []string{"An old silent pond", "Over the wintry forest", "First autumn morning"}
+	for _, title := range titles {
+		_, err := app.snippets.Insert(t.Context(), title, "A haiku.", 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rr := app.testGet(t, "/")
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rr.Code, http.StatusOK)
+	}
+
+	doc, err := html.Parse(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := textContent(doc)
+	for _, title := range titles {
+		if !strings.Contains(text, title) {
+			t.Errorf("page does not contain snippet title %q", title)
+		}
+	}
+
+	pageTitles := findElements(doc, "title")
+	if len(pageTitles) == 0 {
+		t.Fatal("page has no <title>")
+	}
+	if got := textContent(pageTitles[0]); !strings.Contains(got, "Snipp") {
+		t.Errorf("<title> = %q; want it to contain %q", got, "Snipp")
+	}
+
+	if navs := findElements(doc, "nav"); len(navs) != 1 {
+		t.Errorf("page has %d <nav> elements; want 1", len(navs))
+	}
+}
+
+func TestHomeLanguageFilter(t *testing.T) {
+	app := newTestApp(t)
+	snippets := app.snippets.(*mock.MockSnippetModel)
+
+	// Inserted out of title order, so that sorting by title is visible.
+	for i := 12; i >= 1; i-- {
+		_, err := snippets.Insert(t.Context(), fmt.Sprintf("go-%02d", i), "package main", 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snippets.Snippets[len(snippets.Snippets)-1].Language = "go"
+	}
+	for i := 1; i <= 5; i++ {
+		_, err := snippets.Insert(t.Context(), fmt.Sprintf("py-%02d", i), "import os", 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snippets.Snippets[len(snippets.Snippets)-1].Language = "python"
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		titles []string
+		page   string
+		prev   string
+		next   string
+	}{
+		{
+			name:   "language, sort and page",
+			target: "/?lang=go&sort=title_asc&page=2",
+			titles: []string{"go-11", "go-12"},
+			page:   "Page 2 of 2",
+			prev:   "?lang=go&page=1&sort=title_asc",
+		},
+		{
+			name:   "language and sort",
+			target: "/?lang=python&sort=created_asc",
+			titles: []string{"py-01", "py-02", "py-03", "py-04", "py-05"},
+			page:   "Page 1 of 1",
+		},
+		{
+			name:   "unknown language is ignored",
+			target: "/?lang=cobol&sort=title_asc&page=1",
+			titles: []string{"go-01", "go-02", "go-03", "go-04", "go-05", "go-06", "go-07", "go-08", "go-09", "go-10"},
+			page:   "Page 1 of 2",
+			next:   "?page=2&sort=title_asc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := app.testGet(t, tt.target)
+			assertStatus(t, rr, http.StatusOK)
+
+			doc, err := html.Parse(rr.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var titles []string
+			var prev, next string
+			for _, a := range findElements(doc, "a") {
+				href := attr(a, "href")
+				switch {
+				case strings.HasPrefix(href, "/snippet/view/"):
+					titles = append(titles, textContent(a))
+				case strings.Contains(textContent(a), "Previous"):
+					prev = href
+				case strings.Contains(textContent(a), "Next"):
+					next = href
+				}
+			}
+			if !slices.Equal(titles, tt.titles) {
+				t.Errorf("titles = %q; want %q", titles, tt.titles)
+			}
+			if prev != tt.prev || next != tt.next {
+				t.Errorf("page links = %q, %q; want %q, %q", prev, next, tt.prev, tt.next)
+			}
+			if !strings.Contains(textContent(doc), tt.page) {
+				t.Errorf("page does not contain %q", tt.page)
+			}
+		})
+	}
+
+	t.Run("dropdown counts", func(t *testing.T) {
+		rr := app.testGet(t, "/?lang=python")
+		assertBody(t, rr, `<option value="go" >go (12)</option>`)
+		assertBody(t, rr, `<option value="python" selected>python (5)</option>`)
+	})
+
+	t.Run("invalid sort", func(t *testing.T) {
+		rr := app.testGet(t, "/?lang=go&sort=random")
+		assertStatus(t, rr, http.StatusBadRequest)
+	})
+}
+
+func TestLanguageCountsCached(t *testing.T) {
+	app := newTestApp(t)
+	snippets := app.snippets.(*mock.MockSnippetModel)
+
+	add := func() {
+		t.Helper()
+		_, err := snippets.Insert(t.Context(), "An old silent pond", "package main", 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snippets.Snippets[len(snippets.Snippets)-1].Language = "go"
+	}
+
+	add()
+	assertBody(t, app.testGet(t, "/"), "go (1)")
+
+	add()
+	assertBody(t, app.testGet(t, "/"), "go (1)")
+
+	app.clock.(*clock.Fake).Advance(languageCountsTTL + time.Second)
+	assertBody(t, app.testGet(t, "/"), "go (2)")
+}
+
+// attr returns the value of n's attribute named key, or "".
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// findElements returns the elements named tag within n, in document order.
+func findElements(n *html.Node, tag string) []*html.Node {
+	var found []*html.Node
+	for d := range n.Descendants() {
+		if d.Type == html.ElementNode && d.Data == tag {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// textContent returns the concatenated text of n and its descendants.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	for d := range n.Descendants() {
+		if d.Type == html.TextNode {
+			b.WriteString(d.Data)
+		}
+	}
+	return b.String()
+}
+
+func TestHomeLatestCache(t *testing.T) {
+	app := newTestApp(t)
+	app.snippets.Insert(t.Context(), "An old silent pond", "A haiku.", 7, 0)
+
+	assertBody(t, app.testGet(t, "/"), "An old silent pond")
+
+	// A snippet added behind the handlers' backs waits for the TTL.
+	app.snippets.Insert(t.Context(), "Over the wintry forest", "A haiku.", 7, 0)
+	if strings.Contains(app.testGet(t, "/").Body.String(), "Over the wintry forest") {
+		t.Error("home page was not served from the cache")
+	}
+	// Other listings are not cached.
+	assertBody(t, app.testGet(t, "/?sort=title_asc"), "Over the wintry forest")
+
+	app.clock.(*clock.Fake).Advance(latestTTL)
+	assertBody(t, app.testGet(t, "/"), "Over the wintry forest")
+
+	// Creating a snippet drops the cache at once.
+	client := app.newTestClient(t)
+	client.login(app)
+	form := client.formTokens("/snippet/create")
+	form.Set("title", "First autumn morning")
+	form.Set("content", "A haiku.")
+	form.Set("expires", "7")
+	assertStatus(t, client.postForm("/snippet/create", form), http.StatusSeeOther)
+
+	assertBody(t, app.testGet(t, "/"), "First autumn morning")
+}
+
+// slowSnippets adds a delay to List, standing in for a database round trip.
+type slowSnippets struct {
+	*mock.MockSnippetModel
+}
+
+func (m slowSnippets) List(ctx context.Context, filters models.SnippetFilters) ([]*models.Snippet, int, error) {
+	time.Sleep(time.Millisecond)
+	return m.MockSnippetModel.List(ctx, filters)
+}
+
+func BenchmarkHome(b *testing.B) {
+	app := newTestApp(b)
+	snippets := app.snippets.(*mock.MockSnippetModel)
+	for i := range homePageSize {
+		snippets.Insert(b.Context(), fmt.Sprintf("Snippet %d", i), "An old silent pond...", 7, 0)
+	}
+	app.snippets = slowSnippets{snippets}
+	handler := app.routes()
+
+	run := func(b *testing.B, cached bool) {
+		for b.Loop() {
+			if !cached {
+				app.latestCache.Delete(latestKey)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rr.Code != http.StatusOK {
+				b.Fatalf("status = %d", rr.Code)
+			}
+		}
+	}
+
+	b.Run("uncached", func(b *testing.B) { run(b, false) })
+	b.Run("cached", func(b *testing.B) { run(b, true) })
+}
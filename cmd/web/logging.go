@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// levelHandler discards records below its own level before passing the rest
+// to the wrapped handler, so that subsystem loggers sharing one output can be
+// made more or less verbose independently.
+type levelHandler struct {
+	level   slog.Leveler
+	handler slog.Handler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{level: h.level, handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{level: h.level, handler: h.handler.WithGroup(name)}
+}
+
+// newSubsystemLogger returns a logger writing to handler at level or above
+// whose entries carry group=name, so that production log streams can be
+// filtered by subsystem. An empty name returns the top-level logger.
+func newSubsystemLogger(handler slog.Handler, name string, level slog.Level) *slog.Logger {
+	logger := slog.New(&levelHandler{level: level, handler: handler})
+	if name == "" {
+		return logger
+	}
+	return logger.With("group", name)
+}
+
+// teeHandler passes each record to every handler that is enabled for it.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"snippet.robertgleason.ca/internal/querylog"
+)
+
+// decodeEntries returns the JSON log entries in buf.
+func decodeEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var entries []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var entry map[string]any
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestQueryLogGroup(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+
+	dbLogger := newSubsystemLogger(handler, "db", slog.LevelInfo)
+	db := openLoggedDB(t, querylog.Options{Logger: dbLogger})
+
+	_, err := db.ExecContext(t.Context(), "UPDATE users SET hashed_password = ? WHERE id = ?", "secret-hash", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 1 {
+		t.Fatalf("logged %d entries; want 1", len(entries))
+	}
+	entry := entries[0]
+
+	if entry["group"] != "db" {
+		t.Errorf("group = %v; want db", entry["group"])
+	}
+	if entry["sql"] != "UPDATE users SET hashed_password = ? WHERE id = ?" {
+		t.Errorf("sql = %v", entry["sql"])
+	}
+	if args, _ := json.Marshal(entry["args"]); string(args) != `["[REDACTED]","7"]` {
+		t.Errorf("args = %s; want the password redacted", args)
+	}
+	for _, key := range []string{"duration", "rows"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("entry %v has no %s", entry, key)
+		}
+	}
+}
+
+func TestQueryLogGroupLevel(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+
+	// Statements are logged at info, so raising the db group to warn hides
+	// them without affecting the http group.
+	dbLogger := newSubsystemLogger(handler, "db", slog.LevelWarn)
+	httpLogger := newSubsystemLogger(handler, "http", slog.LevelInfo)
+	db := openLoggedDB(t, querylog.Options{Logger: dbLogger})
+
+	if _, err := db.ExecContext(t.Context(), "DELETE FROM sessions WHERE expiry < UTC_TIMESTAMP(6)"); err != nil {
+		t.Fatal(err)
+	}
+	httpLogger.Info("received request")
+	dbLogger.Warn("slow query", "op", "snippets.Get")
+
+	entries := decodeEntries(t, &buf)
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry["group"].(string)+": "+entry["msg"].(string))
+	}
+	want := []string{"http: received request", "db: slow query"}
+	if !slices.Equal(got, want) {
+		t.Errorf("logged %q; want %q", got, want)
+	}
+}
+
+// openLoggedDB opens a database on a stubDB whose statements are logged
+// as opts says.
+func openLoggedDB(t *testing.T, opts querylog.Options) *sql.DB {
+	t.Helper()
+
+	db := sql.OpenDB(querylog.Wrap(&stubDB{}, opts))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -1,109 +1,558 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"database/sql"
+	"encoding/gob"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
 	"github.com/go-playground/form/v4"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"snippet.robertgleason.ca/internal/assets"
+	"snippet.robertgleason.ca/internal/cache"
+	"snippet.robertgleason.ca/internal/clock"
+	"snippet.robertgleason.ca/internal/events"
+	"snippet.robertgleason.ca/internal/health"
 	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/models/cached"
+	"snippet.robertgleason.ca/internal/querylog"
+	"snippet.robertgleason.ca/internal/spamfilter"
+	"snippet.robertgleason.ca/internal/storage"
+	"snippet.robertgleason.ca/internal/validator"
+	"snippet.robertgleason.ca/ui"
 )
 
+// config is the resolved command-line configuration. Fields are shown in
+// the /debug/config dump only once listed in config.dump.
+type config struct {
+	addr               string
+	dsn                string
+	htmlTimeout        time.Duration
+	maxContentChars    int
+	maxControlRatio    float64
+	baseURL            string
+	quotaAnonymous     int
+	quotaRegistered    int
+	trustedProxies     []netip.Prefix
+	hstsMaxAge         int
+	contentStore       string
+	contentDir         string
+	contentExternal    int
+	analyticsSrc       string
+	dev                bool
+	uiDir              string
+	missingCacheSize   int
+	missingCacheTTL    time.Duration
+	sessionStore       string
+	createSessionTable bool
+	secretScan         string
+	logLevel           slog.Level
+	logLevelHTTP       slog.Level
+	logLevelDB         slog.Level
+	slowQueryThreshold time.Duration
+	logEventsOnly      string
+	resilientRender    bool
+	shareSecret        []byte
+	logQueries         bool
+	contentLimits      contentLimits
+	selfCheck          bool
+	selfCheckTimeout   time.Duration
+	spamRules          string
+	languages          []string
+	discoverLanguages  []string
+	maxMultipartMemory int64
+	vacuumInterval     time.Duration
+}
+
 type application struct {
+	config         config
 	logger         *slog.Logger
-	snippets       *models.SnippetModel
-	users          *models.UserModel
+	httpLogger     *slog.Logger
+	dbLogger       *slog.Logger
+	clock          clock.Clock
+	db             *sql.DB
+	health         *health.Registry
+	snippets       models.SnippetModelInterface
+	users          models.UserModelInterface
+	userSessions   models.UserSessionModelInterface
+	assets         *assets.Manifest
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
+	openAPI        *openAPIDocument
+	spamFilter     *spamfilter.Filter
+
+	leaderboardCache    leaderboardCache
+	languageCountsCache languageCountsCache
+	similarCache        similarCache
+	latestCache         *cache.TTLCache[string, latestSnippets]
+
+	// workers are started by main and report to health.
+	workers []worker
 }
 
 func main() {
-	addr := flag.String("addr", ":8080", "http service address")
-	dsn := flag.String("dsn", "web:%s@/snippetbox?parseTime=true", "MySQL data source name")
+	var cfg config
+
+	flag.StringVar(&cfg.addr, "addr", ":8080", "http service address")
+	flag.StringVar(&cfg.dsn, "dsn", "web:%s@/snippetbox?parseTime=true", "MySQL data source name")
+	flag.DurationVar(&cfg.htmlTimeout, "html-timeout", 10*time.Second, "maximum handler execution time for HTML routes")
+	flag.IntVar(&cfg.maxContentChars, "max-content-chars", 0, "maximum snippet content length in characters (0 for unlimited)")
+	flag.Float64Var(&cfg.maxControlRatio, "max-control-ratio", validator.DefaultControlRatio, "proportion of control characters above which snippet content is rejected as binary")
+	flag.StringVar(&cfg.baseURL, "base-url", "", "canonical base URL of the site, e.g. https://snippets.example.com")
+	flag.IntVar(&cfg.quotaAnonymous, "quota-anonymous", 20, "snippets an anonymous client may create per day (0 for unlimited)")
+	flag.IntVar(&cfg.quotaRegistered, "quota-registered", 200, "snippets a registered user may create per day (0 for unlimited)")
+	flag.Func("trusted-proxies", "comma-separated IPs or CIDR ranges of proxies whose X-Forwarded-Proto is trusted", func(s string) error {
+		for _, field := range strings.Split(s, ",") {
+			field = strings.TrimSpace(field)
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(field)
+				if addrErr != nil {
+					return err
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			cfg.trustedProxies = append(cfg.trustedProxies, prefix)
+		}
+		return nil
+	})
+	flag.IntVar(&cfg.hstsMaxAge, "hsts-max-age", 31536000, "Strict-Transport-Security max-age in seconds for canonical HTTPS responses (0 to disable)")
+	flag.StringVar(&cfg.contentStore, "content-store", "db", "where large snippet content is stored: db or fs")
+	flag.StringVar(&cfg.contentDir, "content-dir", "./data/content", "directory for the fs content store")
+	flag.IntVar(&cfg.contentExternal, "content-external-threshold", 256<<10, "content size in bytes above which it is written to the content store")
+	flag.StringVar(&cfg.analyticsSrc, "analytics-src", "", "URL of an analytics script, loaded only for visitors who consent to analytics")
+	flag.BoolVar(&cfg.dev, "dev", false, "Development mode: reload templates from -ui-dir on every request and show template errors in the browser")
+	flag.StringVar(&cfg.uiDir, "ui-dir", "./ui", "Directory templates are reloaded from in -dev mode")
+	flag.IntVar(&cfg.missingCacheSize, "missing-cache-size", 1024, "Number of missing snippet IDs to remember (0 disables)")
+	flag.DurationVar(&cfg.missingCacheTTL, "missing-cache-ttl", 30*time.Second, "How long a missing snippet ID is remembered")
+	flag.StringVar(&cfg.sessionStore, "session-store", "mysql", "Session store: mysql, or memory for single-instance deployments (sessions are lost on restart and /account/sessions stays empty)")
+	flag.BoolVar(&cfg.createSessionTable, "create-session-table", false, "Create the MySQL sessions table at startup if it is missing")
+	flag.StringVar(&cfg.secretScan, "secret-scan", "warn", "Scan new snippets for credentials: off, warn (ask for confirmation) or block")
+	flag.TextVar(&cfg.logLevel, "log-level", slog.LevelInfo, "Minimum level for general log entries (DEBUG, INFO, WARN or ERROR)")
+	flag.TextVar(&cfg.logLevelHTTP, "log-level-http", slog.LevelInfo, "Minimum level for group=http log entries")
+	flag.TextVar(&cfg.logLevelDB, "log-level-db", slog.LevelInfo, "Minimum level for group=db log entries")
+	flag.DurationVar(&cfg.slowQueryThreshold, "slow-query-threshold", 200*time.Millisecond, "Log snippet queries slower than this (0 disables)")
+	flag.StringVar(&cfg.logEventsOnly, "log-events-only", "", "Also write business events, and nothing else, as JSON to this file (- for stderr)")
+	flag.BoolVar(&cfg.resilientRender, "resilient-render", false, "Retry a snippet listing that fails to render without the snippet at fault")
+	flag.BoolVar(&cfg.logQueries, "log-queries", false, "Log every SQL statement with its duration, row count and redacted arguments (db group)")
+	flag.IntVar(&cfg.contentLimits.Soft, "content-soft-limit", 64<<10, "content size in bytes above which a snippet is collapsed when viewed (0 disables)")
+	flag.IntVar(&cfg.contentLimits.Hard, "content-hard-limit", 1<<20, "maximum snippet content size in bytes (0 for unlimited)")
+	flag.BoolVar(&cfg.selfCheck, "selfcheck", false, "Check the configuration, database, migrations, templates and session table, print a summary and exit without serving")
+	flag.DurationVar(&cfg.selfCheckTimeout, "selfcheck-timeout", 10*time.Second, "Time allowed for each -selfcheck check")
+	flag.StringVar(&cfg.spamRules, "spam-rules", "", "File of spam filter rules checked against new snippets, reloaded on SIGHUP (empty disables)")
+	flag.Func("languages", "comma-separated languages a snippet owner can choose from (default: the languages bundle downloads have an extension for)", languageList(&cfg.languages))
+	flag.Func("discover-languages", "comma-separated languages given a section on /discover, in order (default: -languages)", languageList(&cfg.discoverLanguages))
+	flag.Int64Var(&cfg.maxMultipartMemory, "max-multipart-memory", 10<<20, "bytes of a multipart/form-data body held in memory; the rest of its file parts go to temporary files")
+	flag.DurationVar(&cfg.vacuumInterval, "vacuum-interval", 0, "how often to delete each user's duplicate snippets in the background (0 disables)")
 	flag.Parse()
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	// The shared handler accepts everything; each logger applies its own level.
+	logHandler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logger := newSubsystemLogger(logHandler, "", cfg.logLevel)
+	if cfg.logEventsOnly != "" {
+		eventsOut := os.Stderr
+		if cfg.logEventsOnly != "-" {
+			f, err := os.OpenFile(cfg.logEventsOnly, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			defer f.Close()
+			eventsOut = f
+		}
+		// Events bypass -log-level so the events output is always complete.
+		logger = slog.New(teeHandler{logger.Handler(), events.OnlyEvents(slog.NewJSONHandler(eventsOut, nil))})
+	}
+	loggers := appLoggers{
+		general: logger,
+		http:    newSubsystemLogger(logHandler, "http", cfg.logLevelHTTP),
+		db:      newSubsystemLogger(logHandler, "db", cfg.logLevelDB),
+	}
 
-	password := os.Getenv("DB_PASSWORD")
-	if password == "" {
-		logger.Error("DB_PASSWORD environment variable not set")
-		os.Exit(1)
+	if cfg.selfCheck {
+		ok := writeCheckResults(os.Stdout, runChecks(context.Background(), selfChecks(&cfg), cfg.selfCheckTimeout))
+		if !ok {
+			os.Exit(1)
+		}
+		return
 	}
-	finalDSN := fmt.Sprintf(*dsn, password)
 
-	db, err := openDB(finalDSN)
+	app, err := newApplication(context.Background(), cfg, loggers)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
-	defer db.Close()
+	defer app.db.Close()
+
+	if app.spamFilter != nil {
+		go app.reloadSpamRulesOnHangup()
+	}
+	app.startWorkers(context.Background())
+
+	expvar.Publish("health", expvar.Func(func() any {
+		return app.health.Snapshot()
+	}))
+	if snippets, ok := app.snippets.(*cached.SnippetModel); ok {
+		expvar.Publish("snippet_cache", expvar.Func(func() any {
+			return snippets.Metrics()
+		}))
+	}
+
+	tlsConfig := &tls.Config{
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	}
+
+	srv := &http.Server{
+		Addr:        app.config.addr,
+		Handler:     app.routes(),
+		ErrorLog:    slog.NewLogLogger(app.httpLogger.Handler(), slog.LevelError),
+		TLSConfig:   tlsConfig,
+		IdleTimeout: time.Minute,
+		ReadTimeout: 5 * time.Second,
+		// Leave room for the timeout middleware to write its 503 response
+		// before the server closes the connection. Streaming handlers,
+		// which skip that middleware, must call extendWriteDeadline or
+		// large responses are cut off here.
+		WriteTimeout: app.config.htmlTimeout + 5*time.Second,
+	}
+
+	logger.Info("starting on server", "addr", app.config.addr)
+	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
+	logger.Error(err.Error())
+	os.Exit(1)
+}
 
-	templateCache, err := newTemplateCache()
+// appLoggers are the loggers for general, HTTP and database log entries.
+type appLoggers struct {
+	general *slog.Logger
+	http    *slog.Logger
+	db      *slog.Logger
+}
+
+// newApplication validates cfg and builds the application and its
+// dependencies: the database connection, templates, session manager and
+// models. It does not start the server. The caller closes app.db.
+func newApplication(ctx context.Context, cfg config, loggers appLoggers) (app *application, err error) {
+	logger, dbLogger := loggers.general, loggers.db
+	clk := clock.Real{}
+
+	err = cfg.validate()
 	if err != nil {
-		logger.Error(err.Error())
-		os.Exit(1)
+		return nil, err
 	}
 
-	formDecoder := form.NewDecoder()
+	dsn, err := cfg.dsnWithPassword()
+	if err != nil {
+		return nil, err
+	}
 
-	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
-	sessionManager.Cookie.Secure = true
+	cfg.shareSecret = []byte(os.Getenv("SHARE_SECRET"))
+	if len(cfg.shareSecret) == 0 {
+		cfg.shareSecret = make([]byte, 32)
+		rand.Read(cfg.shareSecret)
+		logger.Warn("SHARE_SECRET environment variable not set; share links will stop working when the server restarts")
+	}
 
-	app := &application{
-		logger: logger,
-		snippets: &models.SnippetModel{
-			DB: db,
-		},
+	start := time.Now()
+	var queryLogger *slog.Logger
+	if cfg.logQueries {
+		queryLogger = dbLogger
+	}
+	db, err := openDB(ctx, dsn, queryLogger)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("startup phase complete", "phase", "db", "duration", time.Since(start))
+
+	// Close the connection if any later step fails.
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
+
+	start = time.Now()
+	pending, err := models.PendingMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > 0 {
+		logger.Warn("database schema is behind; run cmd/migrate", "pending", len(pending))
+	}
+	logger.Info("startup phase complete", "phase", "migrations", "duration", time.Since(start))
+
+	start = time.Now()
+	assetManifest, err := loadAssets()
+	if err != nil {
+		return nil, err
+	}
+	templateCache := mustTemplateCache(assetManifest, clk)
+	logger.Info("startup phase complete", "phase", "templates", "duration", time.Since(start), "pages", len(templateCache))
+
+	openAPI, err := buildOpenAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	registerSessionTypes()
+
+	sessionManager, err := newSessionManager(ctx, cfg, db, dbLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	var spamFilter *spamfilter.Filter
+	if cfg.spamRules != "" {
+		spamFilter, err = spamfilter.Load(cfg.spamRules)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("spam rules loaded", "file", cfg.spamRules, "rules", spamFilter.Rules())
+	}
+
+	var contentStore models.ContentStore
+	switch cfg.contentStore {
+	case "db":
+		contentStore = &models.DBContentStore{DB: db}
+	case "fs":
+		contentStore = &storage.FSStore{Dir: cfg.contentDir}
+	}
+
+	snippetModel := &models.SnippetModel{
+		DB:                 db,
+		Store:              contentStore,
+		ExternalThreshold:  cfg.contentExternal,
+		Logger:             dbLogger,
+		SlowQueryThreshold: cfg.slowQueryThreshold,
+	}
+	if cfg.slowQueryThreshold > 0 {
+		snippetModel.OnSlowQuery = func(op string, dur time.Duration) {
+			dbLogger.Warn("slow query", "op", op, "duration", dur)
+		}
+	}
+
+	app = &application{
+		config:     cfg,
+		logger:     logger,
+		httpLogger: loggers.http,
+		dbLogger:   dbLogger,
+		clock:      clk,
+		db:         db,
+		health:     health.Default,
+		snippets:   cached.NewSnippetModel(snippetModel, cfg.missingCacheSize, cfg.missingCacheTTL),
 		users: &models.UserModel{
-			DB: db,
+			DB:     db,
+			Logger: dbLogger,
+		},
+		userSessions: &models.UserSessionModel{
+			DB:     db,
+			Logger: dbLogger,
 		},
+		assets:         assetManifest,
 		templateCache:  templateCache,
-		formDecoder:    formDecoder,
+		formDecoder:    form.NewDecoder(),
 		sessionManager: sessionManager,
+		openAPI:        openAPI,
+		spamFilter:     spamFilter,
+		latestCache:    cache.New[string, latestSnippets](latestTTL, clk),
 	}
+	sessionManager.ErrorFunc = app.sessionErrorFunc
+	app.workers = app.newWorkers(cfg, db, snippetModel)
+	return app, nil
+}
 
-	tlsConfig := &tls.Config{
-		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+// validate checks the flag values that are not checked as they are parsed,
+// normalises -base-url and fills in the default -languages and
+// -discover-languages.
+func (cfg *config) validate() error {
+	cfg.baseURL = strings.TrimSuffix(cfg.baseURL, "/")
+	if cfg.baseURL != "" {
+		u, err := url.Parse(cfg.baseURL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid -base-url %q", cfg.baseURL)
+		}
 	}
 
-	srv := &http.Server{
-		Addr:         *addr,
-		Handler:      app.routes(),
-		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
-		TLSConfig:    tlsConfig,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	if !validator.PermittedValues(cfg.secretScan, "off", "warn", "block") {
+		return fmt.Errorf("invalid -secret-scan %q", cfg.secretScan)
 	}
 
-	logger.Info("starting on server", "addr", *addr)
-	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	logger.Error(err.Error())
-	os.Exit(1)
+	if cfg.contentLimits.Soft < 0 || cfg.contentLimits.Hard < 0 {
+		return fmt.Errorf("content limits cannot be negative (soft %d, hard %d)", cfg.contentLimits.Soft, cfg.contentLimits.Hard)
+	}
+
+	if !validator.PermittedValues(cfg.sessionStore, "mysql", "memory") {
+		return fmt.Errorf("invalid -session-store %q", cfg.sessionStore)
+	}
+
+	if cfg.vacuumInterval < 0 {
+		return fmt.Errorf("-vacuum-interval cannot be negative (%s)", cfg.vacuumInterval)
+	}
+
+	if cfg.maxMultipartMemory < 0 {
+		return fmt.Errorf("-max-multipart-memory cannot be negative (%d)", cfg.maxMultipartMemory)
+	}
+
+	if !validator.PermittedValues(cfg.contentStore, "db", "fs") {
+		return fmt.Errorf("invalid -content-store %q", cfg.contentStore)
+	}
+
+	// Content below the threshold is kept in the snippets.content column, as
+	// is all content with the db store or no threshold, so the column must
+	// be able to hold it.
+	if cfg.contentExternal < 0 || cfg.contentExternal >= models.ContentColumnBytes {
+		return fmt.Errorf("-content-external-threshold must be between 0 and %d bytes (%d)", models.ContentColumnBytes-1, cfg.contentExternal)
+	}
+	if (cfg.contentStore == "db" || cfg.contentExternal == 0) && (cfg.contentLimits.Hard == 0 || cfg.contentLimits.Hard > models.ContentColumnBytes) {
+		return fmt.Errorf("-content-hard-limit must be between 1 and %d bytes when content is stored in the database (%d)", models.ContentColumnBytes, cfg.contentLimits.Hard)
+	}
+
+	if len(cfg.languages) == 0 {
+		cfg.languages = defaultLanguages()
+	}
+	if len(cfg.discoverLanguages) == 0 {
+		cfg.discoverLanguages = cfg.languages
+	}
+	return nil
+}
+
+// languageList returns a flag.Func parser that appends each language in a
+// comma-separated list to dst, lower-cased.
+func languageList(dst *[]string) func(string) error {
+	return func(s string) error {
+		for _, field := range strings.Split(s, ",") {
+			field = strings.ToLower(strings.TrimSpace(field))
+			if field == "" {
+				continue
+			}
+			*dst = append(*dst, field)
+		}
+		return nil
+	}
+}
+
+// dsnWithPassword returns -dsn with the DB_PASSWORD environment variable
+// substituted into it.
+func (cfg *config) dsnWithPassword() (string, error) {
+	password := os.Getenv("DB_PASSWORD")
+	if password == "" {
+		return "", errors.New("DB_PASSWORD environment variable not set")
+	}
+	return fmt.Sprintf(cfg.dsn, password), nil
 }
 
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
+// loadAssets builds the static asset manifest from the embedded UI files.
+func loadAssets() (*assets.Manifest, error) {
+	staticFiles, err := fs.Sub(ui.Files, "static")
 	if err != nil {
 		return nil, err
 	}
+	return assets.NewManifest(staticFiles)
+}
 
-	err = db.Ping()
+// loadTemplates builds the static asset manifest and the template cache from
+// the embedded UI files, reporting a template that does not parse as an
+// error, for the self-check.
+func loadTemplates(clk clock.Clock) (*assets.Manifest, map[string]*template.Template, error) {
+	assetManifest, err := loadAssets()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	templateCache, err := newTemplateCache(assetManifest, clk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return assetManifest, templateCache, nil
+}
+
+// newSessionManager returns a session manager using the -session-store
+// store. For the mysql store it first checks that the sessions table exists.
+func newSessionManager(ctx context.Context, cfg config, db *sql.DB, dbLogger *slog.Logger) (*scs.SessionManager, error) {
+	sessionManager := scs.New()
+	switch cfg.sessionStore {
+	case "mysql":
+		err := checkSessionTable(ctx, db, cfg.createSessionTable)
+		if err != nil {
+			return nil, err
+		}
+		// Expired sessions are deleted by the session-cleanup worker.
+		sessionManager.Store = &degradingStore{Store: mysqlstore.NewWithCleanupInterval(db, 0), logger: dbLogger}
+	case "memory":
+		sessionManager.Store = memstore.New()
+	}
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Cookie.Secure = true
+	return sessionManager, nil
+}
+
+// openDB connects to MySQL. With a non-nil queryLogger every statement is
+// logged to it; otherwise the driver is used directly.
+func openDB(ctx context.Context, dsn string, queryLogger *slog.Logger) (*sql.DB, error) {
+	mysqlConfig, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := mysql.NewConnector(mysqlConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if queryLogger != nil {
+		connector = querylog.Wrap(connector, querylog.Options{Logger: queryLogger})
+	}
+
+	db := sql.OpenDB(connector)
+
+	err = db.PingContext(ctx)
 	if err != nil {
 		db.Close()
 		return nil, err
 	}
 	return db, nil
 }
+
+// registerSessionTypes registers the types stored in session values with gob,
+// which the session codec uses to encode them.
+func registerSessionTypes() {
+	gob.Register(snippetDraft{})
+	gob.Register(time.Time{})
+}
+
+// reloadSpamRulesOnHangup reloads the spam filter rules each time the process
+// receives SIGHUP. If the new rules cannot be loaded, the current ones stay in
+// place.
+func (app *application) reloadSpamRulesOnHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		err := app.spamFilter.Reload()
+		if err != nil {
+			app.logger.Error("spam rules not reloaded", "file", app.spamFilter.Path(), "error", err)
+			continue
+		}
+		app.logger.Info("spam rules reloaded", "file", app.spamFilter.Path(), "rules", app.spamFilter.Rules())
+	}
+}
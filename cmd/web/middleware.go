@@ -1,13 +1,55 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/justinas/nosurf"
 	"golang.org/x/net/context"
+	"snippet.robertgleason.ca/internal/clock"
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/ratelimit"
 )
 
+// Every middleware lives in this file and has the signature
+// func(http.Handler) http.Handler, or returns one when it takes settings
+// (timeout, rateLimit). routes and mux apply them in this order, outermost
+// first:
+//
+// Every request (routes):
+//  1. recoverPanic: outermost, so that a panic anywhere below is a 500.
+//  2. logRequest
+//  3. canonicalHost: redirects before any other work is done.
+//  4. commonHeaders: security headers on everything past the redirect.
+//
+// Page routes (the session chain in mux):
+//  5. timeout: left out for streamed responses, which it would buffer. The
+//     server's WriteTimeout still applies to those, so each streaming
+//     handler calls extendWriteDeadline before it starts writing.
+//  6. sessionManager.LoadAndSave
+//  7. preventCSRF
+//  8. authenticate: needs the session.
+//  9. trackSession: needs authenticate.
+//
+// Then, per route, any of:
+//  10. requireAuthentication
+//  11. rateLimit: needs authenticate to tell users from anonymous clients.
+//  12. requireAdmin or blockImpersonation: need requireAuthentication.
+//
+// Static files, the anonymous API, /ping, /debug and bundle downloads only
+// get 1–4.
+
+// commonHeaders sets the security headers sent with every response.
 func commonHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Security-Policy",
@@ -21,6 +63,7 @@ func commonHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// logRequest logs every request to the http group.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
@@ -29,24 +72,54 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 			method = r.Method
 			uri    = r.URL.RequestURI()
 		)
-		app.logger.Info("received request", "ip", ip, "proto", proto, "method", method, "uri", uri)
+		app.httpLogger.Info("received request", "ip", ip, "proto", proto, "method", method, "uri", uri)
 		next.ServeHTTP(w, r)
 	})
 }
 
+// panicError is a recovered panic. Its stack trace is logged by serverError
+// through LogAttrs.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+func (e *panicError) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("stack", string(e.stack))}
+}
+
+// recoverPanic turns a panic in a later handler into a logged 500 response
+// and closes the connection. It is the outermost middleware. Panics with
+// http.ErrAbortHandler are re-raised, as they deliberately abort the
+// response.
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			pv := recover()
 			if pv != nil {
+				if pv == http.ErrAbortHandler {
+					panic(pv)
+				}
 				w.Header().Set("Connection", "close")
-				app.serverError(w, r, fmt.Errorf("%v", pv))
+
+				err, ok := pv.(*panicError)
+				if !ok {
+					err = &panicError{value: pv, stack: debug.Stack()}
+				}
+				app.serverError(w, r, err)
 			}
 		}()
 		next.ServeHTTP(w, r)
 	})
 }
 
+// requireAuthentication redirects anonymous requests to the login page, and
+// stops authenticated pages from being cached. It must run after
+// authenticate.
 func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !app.isAuthenticated(r) {
@@ -58,6 +131,39 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// requireAdmin responds 403 Forbidden unless the authenticated user is an
+// admin. It must run after requireAuthentication.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin, err := app.isAdmin(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if !admin {
+			app.clientError(w, r, Forbidden(errNotAdmin))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// blockImpersonation responds 403 Forbidden to requests made by an admin
+// impersonating a user, for destructive account actions that only the user
+// themselves may take. It must run after authenticate.
+func (app *application) blockImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if impersonatorID(r) != 0 {
+			app.requestLogger(r).Warn("blocked account action while impersonating", "method", r.Method, "url", r.URL.RequestURI())
+			app.clientError(w, r, Forbidden(errImpersonating))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// preventCSRF checks the CSRF token on unsafe requests and sets the token
+// cookie. It must run after the session is loaded.
 func preventCSRF(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
@@ -68,6 +174,8 @@ func preventCSRF(next http.Handler) http.Handler {
 	return csrfHandler
 }
 
+// authenticate marks the request context as authenticated when the session
+// belongs to a user who still exists, and notes any impersonating admin.
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
@@ -85,8 +193,297 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// if a user is found
 		if exists {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+
+			// An admin impersonating the user; see adminImpersonatePost.
+			if adminID := app.sessionManager.GetInt(r.Context(), "impersonatorID"); adminID != 0 {
+				ctx = context.WithValue(ctx, impersonatorContextKey, adminID)
+			}
+			r = r.WithContext(ctx)
+
+			if impersonatorID(r) != 0 {
+				app.requestLogger(r).Info("impersonated request", "user_id", id, "method", r.Method, "url", r.URL.RequestURI())
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeLimit rate limits one group of routes, with separate limiters so that
+// signed-in users can be given higher limits than anonymous clients.
+type routeLimit struct {
+	anonymous     *ratelimit.Limiter
+	authenticated *ratelimit.Limiter
+	// activity completes the warning banner: "You're <activity> quickly".
+	activity string
+	// peekSafe makes GET and HEAD requests report the limit without
+	// spending from it, for form pages whose POST is what is limited.
+	peekSafe bool
+}
+
+// Per-route limits. Snippet creation is much stricter than viewing.
+var (
+	createLimitAnonymous     = ratelimit.Policy{Burst: 5, Every: 2 * time.Minute, Soft: 2}
+	createLimitAuthenticated = ratelimit.Policy{Burst: 20, Every: 30 * time.Second, Soft: 5}
+	viewLimitAnonymous       = ratelimit.Policy{Burst: 60, Every: time.Second, Soft: 15}
+	viewLimitAuthenticated   = ratelimit.Policy{Burst: 120, Every: 500 * time.Millisecond, Soft: 30}
+)
+
+func newRouteLimit(anonymous, authenticated ratelimit.Policy, activity string, peekSafe bool, clk clock.Clock) routeLimit {
+	return routeLimit{
+		anonymous:     ratelimit.New(anonymous, clk),
+		authenticated: ratelimit.New(authenticated, clk),
+		activity:      activity,
+		peekSafe:      peekSafe,
+	}
+}
+
+// rateLimit applies limit per user, or per client IP for anonymous requests.
+// Every response carries X-RateLimit-Remaining and X-RateLimit-Reset
+// (seconds until the limit is fully restored). Past the soft threshold a
+// warning banner is added to rendered pages; past the hard threshold the
+// request is refused with 429 Too Many Requests. It must run after
+// authenticate.
+func (app *application) rateLimit(limit routeLimit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter, key := limit.anonymous, models.IPOwnerKey(clientIP(r))
+			if app.isAuthenticated(r) {
+				userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+				limiter, key = limit.authenticated, models.UserOwnerKey(userID)
+			}
+
+			peek := limit.peekSafe && (r.Method == http.MethodGet || r.Method == http.MethodHead)
+
+			var res ratelimit.Result
+			if peek {
+				res = limiter.Peek(key)
+			} else {
+				res = limiter.Take(key)
+			}
+
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.Reset.Seconds()))))
+
+			if !peek && !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+				app.httpLogger.Warn("rate limit exceeded", "key", key, "url", r.URL.RequestURI())
+				app.clientError(w, r, statusError(http.StatusTooManyRequests, nil))
+				return
+			}
+
+			if res.Warn {
+				warning := fmt.Sprintf("You're %s quickly — please slow down.", limit.activity)
+				if !app.isAuthenticated(r) {
+					warning = fmt.Sprintf("You're %s quickly — slow down or log in for higher limits.", limit.activity)
+				}
+				r = r.WithContext(context.WithValue(r.Context(), rateLimitWarningContextKey, warning))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sessionTouchInterval is how often trackSession records that a session is
+// still in use.
+const sessionTouchInterval = 5 * time.Minute
+
+// trackSession keeps the user_sessions row for an authenticated session up
+// to date, writing at most once per sessionTouchInterval. It must run after
+// authenticate.
+func (app *application) trackSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Impersonation must not show up in the user's own session list.
+		if !app.isAuthenticated(r) || impersonatorID(r) != 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := app.clock.Now()
+		seen := app.sessionManager.GetTime(r.Context(), "session_seen")
+
+		if now.Sub(seen) >= sessionTouchInterval {
+			userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+			token := app.sessionManager.Token(r.Context())
+
+			err := app.userSessions.Touch(r.Context(), token, userID, userAgentSummary(r.UserAgent()), clientIP(r))
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			app.sessionManager.Put(r.Context(), "session_seen", now)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// timeout limits how long the wrapped handlers may run. The handler executes
+// against a buffered response with a deadline on r.Context(); if it has not
+// finished when the deadline passes, a rendered 503 page is sent instead and
+// anything the handler writes afterwards is discarded. Routes that stream
+// their response (exports, downloads) must not be wrapped, as their output
+// is buffered here; they extend the server's WriteTimeout themselves with
+// extendWriteDeadline instead.
+func (app *application) timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
 			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicChan := make(chan any, 1)
+
+			go func() {
+				defer func() {
+					if pv := recover(); pv != nil {
+						// Keep the handler goroutine's stack for
+						// recoverPanic; re-panicking loses it.
+						if pv != http.ErrAbortHandler {
+							pv = &panicError{value: pv, stack: debug.Stack()}
+						}
+						panicChan <- pv
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case pv := <-panicChan:
+				panic(pv)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for k, vv := range tw.header {
+					dst[k] = vv
+				}
+				if !tw.wroteHeader {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				app.httpLogger.Warn("request timed out", "method", r.Method, "uri", r.URL.RequestURI(), "timeout", d)
+				data := templateData{CurrentYear: app.clock.Now().Year()}
+				app.render(w, r, http.StatusServiceUnavailable, "timeout.tmpl", data)
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a handler's response so that it can be discarded if
+// the handler overruns its deadline.
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(status)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(status int) {
+	tw.wroteHeader = true
+	tw.status = status
+}
+
+// canonicalHost redirects GET and HEAD requests whose host or scheme differ
+// from the configured -base-url to the same path on the canonical origin.
+// Other methods get a 404 rather than a redirect, so that form submissions are
+// never replayed against another host. X-Forwarded-Proto is only honoured
+// from trusted proxies, /ping is exempt so health checks can use internal
+// hostnames, and canonical HTTPS responses carry an HSTS header. It is a
+// no-op when no base URL is configured.
+func (app *application) canonicalHost(next http.Handler) http.Handler {
+	if app.config.baseURL == "" {
+		return next
+	}
+
+	base, err := url.Parse(app.config.baseURL)
+	if err != nil {
+		panic(err)
+	}
+
+	hsts := fmt.Sprintf("max-age=%d; includeSubDomains", app.config.hstsMaxAge)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme := app.requestScheme(r)
+
+		if !strings.EqualFold(r.Host, base.Host) || scheme != base.Scheme {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				app.clientError(w, r, NotFound(nil))
+				return
+			}
+			target := base.Scheme + "://" + base.Host + r.URL.RequestURI()
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		if scheme == "https" && app.config.hstsMaxAge > 0 {
+			w.Header().Set("Strict-Transport-Security", hsts)
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requestScheme returns the scheme the client used, taking X-Forwarded-Proto
+// into account only when the request comes from a trusted proxy.
+func (app *application) requestScheme(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto"))
+	if proto != "http" && proto != "https" {
+		return scheme
+	}
+
+	ip, err := netip.ParseAddr(clientIP(r))
+	if err != nil {
+		return scheme
+	}
+	for _, prefix := range app.config.trustedProxies {
+		if prefix.Contains(ip.Unmap()) {
+			return proto
+		}
+	}
+	return scheme
+}
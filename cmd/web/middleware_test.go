@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/models/mock"
+)
+
+// panickySnippets panics in Get, standing in for a bug in a handler.
+type panickySnippets struct {
+	*mock.MockSnippetModel
+}
+
+func (m panickySnippets) Get(ctx context.Context, id int) (models.Snippet, error) {
+	panic("boom")
+}
+
+// TestMiddlewareOrder checks the order documented in middleware.go from the
+// headers each middleware leaves on the response.
+func TestMiddlewareOrder(t *testing.T) {
+	app := newTestApp(t)
+
+	t.Run("canonicalHost before commonHeaders", func(t *testing.T) {
+		// canonicalHost is a no-op without a base URL.
+		app.config.baseURL = "https://snippets.example.com"
+		app.config.hstsMaxAge = 60
+		t.Cleanup(func() { app.config.baseURL, app.config.hstsMaxAge = "", 0 })
+		handler := app.routes()
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://other.example.com/", nil))
+
+		assertStatus(t, rr, http.StatusMovedPermanently)
+		assertHeader(t, rr, "X-Frame-Options", "")
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://snippets.example.com/api/v1/openapi.json", nil))
+
+		assertStatus(t, rr, http.StatusOK)
+		assertHeader(t, rr, "Strict-Transport-Security", "max-age=60; includeSubDomains")
+		assertHeader(t, rr, "X-Frame-Options", "deny")
+	})
+
+	t.Run("requireAuthentication after preventCSRF", func(t *testing.T) {
+		rr := app.testGet(t, "/user/snippets")
+
+		assertStatus(t, rr, http.StatusSeeOther)
+		assertHeader(t, rr, "X-Frame-Options", "deny")
+		assertHeader(t, rr, "Vary", "Cookie")
+		assertHeader(t, rr, "Cache-Control", "")
+	})
+
+	t.Run("requireAdmin after requireAuthentication", func(t *testing.T) {
+		client := app.newTestClient(t)
+		client.login(app)
+
+		rr := client.get("/admin")
+		assertStatus(t, rr, http.StatusForbidden)
+		assertHeader(t, rr, "Cache-Control", "no-store")
+		assertHeader(t, rr, "X-Frame-Options", "deny")
+	})
+
+	t.Run("recoverPanic outermost", func(t *testing.T) {
+		snippets := app.snippets
+		app.snippets = panickySnippets{snippets.(*mock.MockSnippetModel)}
+		defer func() { app.snippets = snippets }()
+
+		rr := app.testGet(t, "/snippet/view/1")
+
+		assertStatus(t, rr, http.StatusInternalServerError)
+		assertHeader(t, rr, "Connection", "close")
+		assertHeader(t, rr, "X-Frame-Options", "deny")
+	})
+}
+
+func TestCanonicalHost(t *testing.T) {
+	app := newTestApp(t)
+	app.config.baseURL = "https://snippets.example.com"
+	app.config.hstsMaxAge = 60
+	app.config.trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	handler := app.canonicalHost(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		remoteAddr   string
+		proto        string
+		wantStatus   int
+		wantLocation string
+		wantHSTS     string
+	}{
+		{
+			name:       "canonical host over HTTPS",
+			method:     http.MethodGet,
+			target:     "https://snippets.example.com/snippet/view/1",
+			wantStatus: http.StatusOK,
+			wantHSTS:   "max-age=60; includeSubDomains",
+		},
+		{
+			name:         "GET for another host",
+			method:       http.MethodGet,
+			target:       "https://www.example.com/snippet/view/1?x=1",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://snippets.example.com/snippet/view/1?x=1",
+		},
+		{
+			name:         "HEAD for another host",
+			method:       http.MethodHead,
+			target:       "https://www.example.com/",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://snippets.example.com/",
+		},
+		{
+			name:       "POST for another host",
+			method:     http.MethodPost,
+			target:     "https://www.example.com/snippet/create",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:         "plain HTTP",
+			method:       http.MethodGet,
+			target:       "http://snippets.example.com/",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://snippets.example.com/",
+		},
+		{
+			name:       "HTTPS forwarded by a trusted proxy",
+			method:     http.MethodGet,
+			target:     "http://snippets.example.com/",
+			remoteAddr: "10.1.2.3:4321",
+			proto:      "https",
+			wantStatus: http.StatusOK,
+			wantHSTS:   "max-age=60; includeSubDomains",
+		},
+		{
+			name:         "HTTPS claimed by an untrusted client",
+			method:       http.MethodGet,
+			target:       "http://snippets.example.com/",
+			remoteAddr:   "203.0.113.7:4321",
+			proto:        "https",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://snippets.example.com/",
+		},
+		{
+			name:         "HTTP forwarded by a trusted proxy",
+			method:       http.MethodGet,
+			target:       "https://snippets.example.com/",
+			remoteAddr:   "10.1.2.3:4321",
+			proto:        "http",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://snippets.example.com/",
+		},
+		{
+			name:       "ping on any host",
+			method:     http.MethodGet,
+			target:     "http://10.0.0.5:4000/ping",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, r)
+
+			assertStatus(t, rr, tt.wantStatus)
+			assertHeader(t, rr, "Location", tt.wantLocation)
+			assertHeader(t, rr, "Strict-Transport-Security", tt.wantHSTS)
+		})
+	}
+}
+
+func TestRecoverPanic(t *testing.T) {
+	app := newTestApp(t)
+	logs := withLogBuffer(app)
+
+	handler := app.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/snippet/view/1", nil))
+
+	assertStatus(t, rr, http.StatusInternalServerError)
+	assertHeader(t, rr, "Connection", "close")
+	assertBody(t, rr, "Internal Server Error")
+	if strings.Contains(rr.Body.String(), "boom") {
+		t.Error("the panic value was sent to the client")
+	}
+
+	// The panicError's attributes carry the stack of the panicking handler.
+	for _, want := range []string{"level=ERROR", `msg="panic: boom"`, "url=/snippet/view/1", "stack=", "middleware_test.go"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log %q does not contain %q", logs.String(), want)
+		}
+	}
+}
+
+func TestRecoverPanicAbortHandler(t *testing.T) {
+	app := newTestApp(t)
+
+	handler := app.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if pv := recover(); pv != http.ErrAbortHandler {
+			t.Errorf("recovered %v; want http.ErrAbortHandler", pv)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Error("http.ErrAbortHandler was not re-raised")
+}
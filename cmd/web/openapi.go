@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// openAPIDocument is the subset of an OpenAPI 3.0 document needed to describe
+// the public JSON API. The paths are maintained by hand in openAPISkeleton;
+// the schemas are generated from the response structs by buildOpenAPI.
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Required    bool           `json:"required"`
+	Description string         `json:"description"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref         string                    `json:"$ref,omitempty"`
+	Type        string                    `json:"type,omitempty"`
+	Format      string                    `json:"format,omitempty"`
+	Description string                    `json:"description,omitempty"`
+	Properties  map[string]*openAPISchema `json:"properties,omitempty"`
+	Required    []string                  `json:"required,omitempty"`
+	Items       *openAPISchema            `json:"items,omitempty"`
+	Minimum     *int                      `json:"minimum,omitempty"`
+	Maximum     *int                      `json:"maximum,omitempty"`
+	Default     any                       `json:"default,omitempty"`
+}
+
+// TypeName describes the schema briefly for the docs page, e.g.
+// "SnippetSummary", "integer" or "array of SnippetSummary".
+func (s *openAPISchema) TypeName() string {
+	switch {
+	case s.Ref != "":
+		return strings.TrimPrefix(s.Ref, openAPISchemaPrefix)
+	case s.Type == "array" && s.Items != nil:
+		return "array of " + s.Items.TypeName()
+	case s.Format != "":
+		return s.Type + " (" + s.Format + ")"
+	}
+	return s.Type
+}
+
+const openAPISchemaPrefix = "#/components/schemas/"
+
+// openAPISchemaTypes are the structs whose schemas are generated into the
+// document's components, by component name.
+var openAPISchemaTypes = map[string]any{
+	"SnippetSummary": apiSnippetSummary{},
+	"SnippetList":    apiSnippetList{},
+	"Limits":         apiLimitsResponse{},
+}
+
+// openAPIUndocumented are the API routes that are deliberately left out of
+// the document.
+var openAPIUndocumented = []string{"GET /api/v1/docs"}
+
+func schemaRef(name string) *openAPISchema {
+	return &openAPISchema{Ref: openAPISchemaPrefix + name}
+}
+
+func jsonResponse(description, schema string) openAPIResponse {
+	return openAPIResponse{
+		Description: description,
+		Content:     map[string]openAPIMediaType{"application/json": {Schema: schemaRef(schema)}},
+	}
+}
+
+// errorResponse describes an error. Errors are sent as the plain text status
+// message, e.g. "Bad Request".
+func errorResponse(description string) openAPIResponse {
+	return openAPIResponse{
+		Description: description,
+		Content:     map[string]openAPIMediaType{"text/plain": {Schema: &openAPISchema{Type: "string"}}},
+	}
+}
+
+var notModified = openAPIResponse{Description: "The representation matches the If-None-Match ETag."}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// openAPISkeleton returns the hand-maintained part of the document: the
+// paths, their parameters and which schema each response uses.
+func openAPISkeleton() *openAPIDocument {
+	return &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:   "Snippetbox API",
+			Version: "1",
+			Description: "The public, read-only JSON API. It needs no authentication, allows requests from any origin " +
+				"and sends an ETag with each response.",
+		},
+		Paths: map[string]map[string]*openAPIOperation{
+			"/api/v1/users/{id}/snippets": {
+				"get": {
+					OperationID: "listUserSnippets",
+					Summary:     "List a user's latest snippets",
+					Description: "Returns the user's latest unexpired snippets, newest first, without their full " +
+						"content. An unknown user gets an empty list.",
+					Parameters: []openAPIParameter{
+						{Name: "id", In: "path", Required: true, Description: "User ID.", Schema: &openAPISchema{Type: "integer"}},
+						{Name: "limit", In: "query", Description: "Number of snippets to return; out of range values are clamped.",
+							Schema: &openAPISchema{Type: "integer", Minimum: intPtr(1), Maximum: intPtr(20), Default: 5}},
+						{Name: "lang", In: "query", Description: "Only return snippets in this language. A language with no " +
+							"listed snippets is ignored rather than rejected.", Schema: &openAPISchema{Type: "string"}},
+					},
+					Responses: map[string]openAPIResponse{
+						"200": jsonResponse("The user's snippets.", "SnippetList"),
+						"304": notModified,
+						"400": errorResponse("The user ID or limit is not a number."),
+					},
+				},
+			},
+			"/api/v1/limits": {
+				"get": {
+					OperationID: "getLimits",
+					Summary:     "Get the snippet size limits",
+					Description: "Returns the limits that snippet content and titles are validated against, so " +
+						"that clients can check content before submitting it.",
+					Responses: map[string]openAPIResponse{
+						"200": jsonResponse("The limits.", "Limits"),
+						"304": notModified,
+					},
+				},
+			},
+			"/api/v1/openapi.json": {
+				"get": {
+					OperationID: "getOpenAPI",
+					Summary:     "Get this document",
+					Responses: map[string]openAPIResponse{
+						"200": {
+							Description: "The OpenAPI document.",
+							Content:     map[string]openAPIMediaType{"application/json": {Schema: &openAPISchema{Type: "object"}}},
+						},
+						"304": notModified,
+					},
+				},
+			},
+		},
+	}
+}
+
+// buildOpenAPI completes the skeleton with the generated schemas and checks
+// that the document is consistent: every schema reference resolves and every
+// path parameter is declared. It is called at startup, so a broken document
+// stops the server from starting.
+func buildOpenAPI() (*openAPIDocument, error) {
+	doc := openAPISkeleton()
+	doc.Components.Schemas = make(map[string]*openAPISchema)
+
+	components := make(map[reflect.Type]string)
+	for name, v := range openAPISchemaTypes {
+		components[reflect.TypeOf(v)] = name
+	}
+
+	for name, v := range openAPISchemaTypes {
+		schema, err := structSchema(reflect.TypeOf(v), components)
+		if err != nil {
+			return nil, fmt.Errorf("openapi: schema %s: %w", name, err)
+		}
+		doc.Components.Schemas[name] = schema
+	}
+
+	err := doc.validate()
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+var pathParamRX = regexp.MustCompile(`\{([^}]+)\}`)
+
+func (doc *openAPIDocument) validate() error {
+	for path, operations := range doc.Paths {
+		var templated []string
+		for _, m := range pathParamRX.FindAllStringSubmatch(path, -1) {
+			templated = append(templated, m[1])
+		}
+
+		for method, op := range operations {
+			var declared []string
+			for _, p := range op.Parameters {
+				if p.In == "path" {
+					declared = append(declared, p.Name)
+				}
+				err := doc.checkRef(p.Schema)
+				if err != nil {
+					return fmt.Errorf("openapi: %s %s parameter %s: %w", method, path, p.Name, err)
+				}
+			}
+			slices.Sort(templated)
+			slices.Sort(declared)
+			if !slices.Equal(templated, declared) {
+				return fmt.Errorf("openapi: %s %s declares path parameters %v; the path has %v", method, path, declared, templated)
+			}
+
+			if len(op.Responses) == 0 {
+				return fmt.Errorf("openapi: %s %s has no responses", method, path)
+			}
+			for status, resp := range op.Responses {
+				for _, media := range resp.Content {
+					err := doc.checkRef(media.Schema)
+					if err != nil {
+						return fmt.Errorf("openapi: %s %s response %s: %w", method, path, status, err)
+					}
+				}
+			}
+		}
+	}
+
+	for name, schema := range doc.Components.Schemas {
+		err := doc.checkRef(schema)
+		if err != nil {
+			return fmt.Errorf("openapi: schema %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// checkRef reports a reference within s to a schema that is not defined.
+func (doc *openAPIDocument) checkRef(s *openAPISchema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		if _, ok := doc.Components.Schemas[strings.TrimPrefix(s.Ref, openAPISchemaPrefix)]; !ok {
+			return fmt.Errorf("undefined schema %s", s.Ref)
+		}
+	}
+	for _, prop := range s.Properties {
+		if err := doc.checkRef(prop); err != nil {
+			return err
+		}
+	}
+	return doc.checkRef(s.Items)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// structSchema describes struct type t from its fields' json and doc tags.
+// Embedded structs contribute their fields. Every field is required, as the
+// API always encodes zero values rather than omitting them. Struct types in
+// components are referred to by name.
+func structSchema(t reflect.Type, components map[reflect.Type]string) (*openAPISchema, error) {
+	schema := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+
+	for field := range fieldsOf(t) {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return nil, fmt.Errorf("field %s has no json name", field.Name)
+		}
+
+		prop, err := fieldSchema(field.Type, components)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		prop.Description = field.Tag.Get("doc")
+
+		schema.Properties[name] = prop
+		schema.Required = append(schema.Required, name)
+	}
+	return schema, nil
+}
+
+// fieldsOf yields the exported fields of struct type t, flattening embedded
+// structs as encoding/json does.
+func fieldsOf(t reflect.Type) func(yield func(reflect.StructField) bool) {
+	return func(yield func(reflect.StructField) bool) {
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+				for embedded := range fieldsOf(field.Type) {
+					if !yield(embedded) {
+						return
+					}
+				}
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if !yield(field) {
+				return
+			}
+		}
+	}
+}
+
+func fieldSchema(t reflect.Type, components map[reflect.Type]string) (*openAPISchema, error) {
+	if name, ok := components[t]; ok {
+		return schemaRef(name), nil
+	}
+	if t == timeType {
+		return &openAPISchema{Type: "string", Format: "date-time"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &openAPISchema{Type: "string"}, nil
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &openAPISchema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}, nil
+	case reflect.Slice:
+		items, err := fieldSchema(t.Elem(), components)
+		if err != nil {
+			return nil, err
+		}
+		return &openAPISchema{Type: "array", Items: items}, nil
+	case reflect.Struct:
+		return structSchema(t, components)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
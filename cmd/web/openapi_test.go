@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPICoversRoutes walks the route table and checks that every API
+// route is in the OpenAPI document, and that every documented operation is
+// routed.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	app := newTestApp(t)
+
+	routed := make(map[string]bool)
+	for _, pattern := range app.mux().patterns {
+		method, path, _ := strings.Cut(pattern, " ")
+		if !strings.HasPrefix(path, "/api/") || slices.Contains(openAPIUndocumented, pattern) {
+			continue
+		}
+		routed[pattern] = true
+
+		if _, ok := app.openAPI.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("route %q is not in the OpenAPI document", pattern)
+		}
+	}
+
+	for path, operations := range app.openAPI.Paths {
+		for method := range operations {
+			pattern := strings.ToUpper(method) + " " + path
+			if !routed[pattern] {
+				t.Errorf("OpenAPI operation %q has no route", pattern)
+			}
+		}
+	}
+}
+
+// TestOpenAPISchemasMatchResponses checks that the fields of real responses
+// are exactly those their schemas list.
+func TestOpenAPISchemasMatchResponses(t *testing.T) {
+	app := newTestApp(t)
+
+	if _, err := app.snippets.Insert(t.Context(), "An old silent pond", "A haiku.", 7, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		schema string
+		field  string
+	}{
+		{"/api/v1/limits", "Limits", ""},
+		{"/api/v1/users/1/snippets", "SnippetList", ""},
+		{"/api/v1/users/1/snippets", "SnippetSummary", "snippets"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			rr := app.testGet(t, tt.target)
+			assertStatus(t, rr, http.StatusOK)
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if tt.field != "" {
+				var items []map[string]json.RawMessage
+				if err := json.Unmarshal(body[tt.field], &items); err != nil || len(items) == 0 {
+					t.Fatalf("%s is not a non-empty list: %v", tt.field, err)
+				}
+				body = items[0]
+			}
+
+			schema := app.openAPI.Components.Schemas[tt.schema]
+			for name := range body {
+				if _, ok := schema.Properties[name]; !ok {
+					t.Errorf("response field %q is not in schema %s", name, tt.schema)
+				}
+			}
+			for name := range schema.Properties {
+				if _, ok := body[name]; !ok {
+					t.Errorf("schema %s field %q is not in the response", tt.schema, name)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildOpenAPIRejectsUndeclaredPathParameter(t *testing.T) {
+	doc, err := buildOpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc.Paths["/api/v1/snippets/{id}"] = map[string]*openAPIOperation{
+		"get": {Responses: map[string]openAPIResponse{"200": jsonResponse("A snippet.", "SnippetSummary")}},
+	}
+
+	err = doc.validate()
+	if err == nil || !strings.Contains(err.Error(), "path parameters") {
+		t.Errorf("validate() = %v; want a path parameter error", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+)
+
+// overlayContext is the number of source lines shown either side of the line
+// a template parse error points at.
+const overlayContext = 3
+
+// templateOverlay is the -dev error page. It is compiled in rather than
+// loaded from ui/html so that it still renders when the page templates are
+// broken.
+var templateOverlay = template.Must(template.New("overlay").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Template error: {{.Page}}</title>
+<style>
+body { margin: 0; padding: 2rem; background: #1e1e1e; color: #eee; font: 14px/1.5 ui-monospace, Menlo, Consolas, monospace; }
+h1 { margin-top: 0; color: #ff6b6b; font-size: 1.4rem; }
+.error { padding: 1rem; background: #2d2d2d; border-left: 4px solid #ff6b6b; white-space: pre-wrap; }
+.source { margin-top: 1.5rem; background: #2d2d2d; }
+.source div { padding: 0 1rem; white-space: pre; }
+.source .line { display: inline-block; width: 4em; color: #888; }
+.source .hl { background: #5a1e1e; }
+</style>
+</head>
+<body>
+<h1>Template error in {{.Page}}</h1>
+<div class="error">{{.Err}}</div>
+{{with .Source}}
+<div class="source">
+<div><span class="line"></span>{{$.File}}</div>
+{{range .}}<div{{if .Highlight}} class="hl"{{end}}><span class="line">{{.Number}}</span>{{.Text}}</div>
+{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+type overlayLine struct {
+	Number    int
+	Text      string
+	Highlight bool
+}
+
+// templateErrorLocation matches the "template: name:line:" prefix that
+// text/template puts on parse and execution errors.
+var templateErrorLocation = regexp.MustCompile(`template: ([^:\s]+\.tmpl):(\d+)`)
+
+// renderTemplateOverlay writes the -dev error page for err. When the error
+// names a template file and line, the surrounding source is read from fsys.
+func renderTemplateOverlay(w http.ResponseWriter, fsys fs.FS, page string, err error) {
+	data := struct {
+		Page   string
+		Err    string
+		File   string
+		Source []overlayLine
+	}{
+		Page: page,
+		Err:  err.Error(),
+	}
+
+	if m := templateErrorLocation.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		if file, ok := findTemplateFile(fsys, m[1]); ok {
+			data.File = file
+			data.Source = readSourceLines(fsys, file, line)
+		}
+	}
+
+	// The overlay's styles are inline, which the site-wide policy forbids.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusInternalServerError)
+
+	if err := templateOverlay.Execute(w, data); err != nil {
+		fmt.Fprintf(w, "template overlay: %s", err)
+	}
+}
+
+// findTemplateFile maps the base name used in template errors back to its
+// path under html/.
+func findTemplateFile(fsys fs.FS, name string) (string, bool) {
+	for _, dir := range []string{"html", "html/pages", "html/partials"} {
+		file := path.Join(dir, name)
+		if _, err := fs.Stat(fsys, file); err == nil {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+func readSourceLines(fsys fs.FS, file string, line int) []overlayLine {
+	f, err := fsys.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []overlayLine
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if n < line-overlayContext {
+			continue
+		}
+		if n > line+overlayContext {
+			break
+		}
+		lines = append(lines, overlayLine{Number: n, Text: scanner.Text(), Highlight: n == line})
+	}
+
+	return lines
+}
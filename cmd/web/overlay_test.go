@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/ui"
+)
+
+// newDevApp returns a test application in -dev mode, which reads its
+// templates from a copy of ui/ that the test may change.
+func newDevApp(t *testing.T) *application {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, ui.Files); err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp(t)
+	app.config.dev = true
+	app.config.uiDir = dir
+	return app
+}
+
+func TestTemplateOverlay(t *testing.T) {
+	brokenSnippets := templateData{Snippets: []*models.Snippet{{ID: 1, Title: "First"}, nil}}
+
+	t.Run("parse error", func(t *testing.T) {
+		app := newDevApp(t)
+		withLogBuffer(app)
+
+		page := "{{define \"title\"}}Home{{end}}\n\n{{define \"main\"}}\n    {{if}}\n{{end}}\n"
+		err := os.WriteFile(filepath.Join(app.config.uiDir, "html", "pages", "home.tmpl"), []byte(page), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		app.render(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "home.tmpl", templateData{})
+
+		assertStatus(t, rr, http.StatusInternalServerError)
+		assertHeader(t, rr, "Cache-Control", "no-store")
+		assertBody(t, rr, "<h1>Template error in home.tmpl</h1>")
+		assertBody(t, rr, "home.tmpl:4: missing value for if")
+		assertBody(t, rr, "html/pages/home.tmpl")
+		assertBody(t, rr, `<div class="hl"><span class="line">4</span>    {{if}}</div>`)
+	})
+
+	t.Run("exec error", func(t *testing.T) {
+		app := newDevApp(t)
+		withLogBuffer(app)
+
+		rr := httptest.NewRecorder()
+		app.render(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "home.tmpl", brokenSnippets)
+
+		assertStatus(t, rr, http.StatusInternalServerError)
+		assertBody(t, rr, "<h1>Template error in home.tmpl</h1>")
+		assertBody(t, rr, "nil pointer")
+		assertBody(t, rr, "html/pages/home.tmpl")
+		assertBody(t, rr, `<div class="hl">`)
+	})
+
+	t.Run("production", func(t *testing.T) {
+		app := newTestApp(t)
+		withLogBuffer(app)
+
+		rr := httptest.NewRecorder()
+		app.render(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "home.tmpl", brokenSnippets)
+
+		assertStatus(t, rr, http.StatusInternalServerError)
+		body := rr.Body.String()
+		for _, leak := range []string{"Template error", "nil pointer", "home.tmpl"} {
+			if strings.Contains(body, leak) {
+				t.Errorf("production error page contains %q", leak)
+			}
+		}
+	})
+}
@@ -1,20 +1,72 @@
 package main
 
 import (
+	"expvar"
 	"net/http"
 
 	"github.com/justinas/alice"
 )
 
 func (app *application) routes() http.Handler {
-	mux := http.NewServeMux()
-	fileServer := http.FileServer(http.Dir("./ui/static/"))
-	mux.Handle("GET /static/", http.StripPrefix("/static/", fileServer))
+	standard := alice.New(app.recoverPanic, app.logRequest, app.canonicalHost, commonHeaders)
 
-	dynamic := alice.New(app.sessionManager.LoadAndSave, preventCSRF, app.authenticate)
+	return standard.Then(app.mux())
+}
+
+// routeTable is a ServeMux that remembers the patterns registered with it,
+// so that tests can walk the routes.
+type routeTable struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (rt *routeTable) Handle(pattern string, handler http.Handler) {
+	rt.patterns = append(rt.patterns, pattern)
+	rt.ServeMux.Handle(pattern, handler)
+}
+
+func (rt *routeTable) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	rt.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// mux registers every route. It is separate from routes so that tests can
+// ask the mux which pattern a request matches.
+func (app *application) mux() *routeTable {
+	mux := &routeTable{ServeMux: http.NewServeMux()}
+	mux.Handle("GET /static/", http.StripPrefix("/static/", app.assets))
+
+	mux.HandleFunc("GET /ping", app.ping)
+
+	// The public API is anonymous: no session, CSRF cookie or timeout page.
+	mux.HandleFunc("GET /api/v1/users/{id}/snippets", app.apiUserSnippets)
+	mux.HandleFunc("GET /api/v1/limits", app.apiLimits)
+	mux.HandleFunc("GET /api/v1/openapi.json", app.apiOpenAPI)
+
+	// Embed scripts are loaded anonymously by other sites.
+	mux.HandleFunc("GET /snippet/view/{id}/embed.js", app.snippetEmbedScript)
+
+	// Bundle downloads are streamed, so they skip the buffering timeout and
+	// extend their own write deadline.
+	mux.HandleFunc("GET /bundle/{token}/download", app.bundleDownload)
+
+	createLimit := app.rateLimit(newRouteLimit(createLimitAnonymous, createLimitAuthenticated, "creating snippets", true, app.clock))
+	viewLimit := app.rateLimit(newRouteLimit(viewLimitAnonymous, viewLimitAuthenticated, "viewing snippets", false, app.clock))
+
+	// The order of each chain is documented at the top of middleware.go.
+	session := alice.New(app.sessionManager.LoadAndSave, preventCSRF, app.authenticate, app.trackSession)
+	dynamic := alice.New(app.timeout(app.config.htmlTimeout)).Extend(session)
 
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home))
-	mux.Handle("GET /snippet/view/{id}", dynamic.ThenFunc(app.snippetView))
+	mux.Handle("GET /snippet/view/{id}", dynamic.Append(viewLimit).ThenFunc(app.snippetView))
+	mux.Handle("GET /leaderboard", dynamic.ThenFunc(app.leaderboard))
+	mux.Handle("GET /discover", dynamic.ThenFunc(app.discover))
+	mux.Handle("GET /api/v1/docs", dynamic.ThenFunc(app.apiDocs))
+	mux.Handle("GET /consent", dynamic.ThenFunc(app.consent))
+	mux.Handle("POST /consent", dynamic.ThenFunc(app.consentPost))
+	mux.Handle("GET /snippet/view/{id}/copy-text", dynamic.ThenFunc(app.snippetCopyText))
+	mux.Handle("GET /snippet/view/{id}/similar", dynamic.ThenFunc(app.snippetSimilar))
+	mux.Handle("GET /snippet/shared/{payload}", dynamic.Append(viewLimit).ThenFunc(app.snippetShared))
+	mux.Handle("GET /bundle/{token}", dynamic.Append(viewLimit).ThenFunc(app.bundleView))
 
 	// user routes
 	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
@@ -23,11 +75,45 @@ func (app *application) routes() http.Handler {
 	mux.Handle("POST /user/login", dynamic.ThenFunc(app.userLoginPost))
 
 	protected := dynamic.Append(app.requireAuthentication)
-	mux.Handle("GET /snippet/create", protected.ThenFunc(app.snippetCreate))
-	mux.Handle("POST /snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	mux.Handle("GET /snippet/create", protected.Append(createLimit).ThenFunc(app.snippetCreate))
+	mux.Handle("POST /snippet/create", protected.Append(createLimit).ThenFunc(app.snippetCreatePost))
+	mux.Handle("POST /snippet/draft", protected.ThenFunc(app.snippetDraftPost))
+	mux.Handle("POST /snippet/duplicate/{id}", protected.Append(createLimit).ThenFunc(app.snippetDuplicatePost))
+	mux.Handle("POST /snippet/rename/{id}", protected.ThenFunc(app.snippetRenamePost))
+	mux.Handle("POST /snippet/{id}/{action}", protected.ThenFunc(app.snippetActionPost))
+	mux.Handle("POST /snippet/pin/{id}", protected.ThenFunc(app.snippetPinPost))
+	mux.Handle("POST /snippet/{id}/versions/{versionID}/restore", protected.ThenFunc(app.snippetVersionRestorePost))
+	mux.Handle("POST /snippet/archive/{id}", protected.ThenFunc(app.snippetArchivePost))
+	mux.Handle("POST /snippet/unarchive/{id}", protected.ThenFunc(app.snippetUnarchivePost))
+	mux.Handle("POST /snippet/unpin/{id}", protected.ThenFunc(app.snippetUnpinPost))
+	mux.Handle("GET /snippet/share/{id}", protected.ThenFunc(app.snippetShare))
+	mux.Handle("POST /snippet/share/{id}", protected.ThenFunc(app.snippetSharePost))
+	mux.Handle("POST /snippet/share/{id}/revoke", protected.ThenFunc(app.snippetShareRevokePost))
+	mux.Handle("GET /bundle/create", protected.ThenFunc(app.bundleCreate))
+	mux.Handle("POST /bundle/create", protected.ThenFunc(app.bundleCreatePost))
+	mux.Handle("GET /user/snippets", protected.ThenFunc(app.userSnippets))
+	mux.Handle("GET /user/archive", protected.ThenFunc(app.userArchive))
 	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPost))
+	mux.Handle("GET /account/sessions", protected.ThenFunc(app.accountSessions))
+	mux.Handle("POST /account/sessions/revoke/{token}", protected.Append(app.blockImpersonation).ThenFunc(app.accountSessionRevokePost))
+	mux.Handle("POST /account/sessions/revoke-others", protected.Append(app.blockImpersonation).ThenFunc(app.accountSessionsRevokeOthersPost))
+	mux.Handle("POST /admin/impersonate/stop", protected.ThenFunc(app.adminImpersonateStopPost))
+
+	// The export is streamed, so it has its own chain without the timeout.
+	// Handlers on it must call extendWriteDeadline before writing.
+	streaming := session.Append(app.requireAuthentication)
+	mux.Handle("GET /user/snippets/export", streaming.ThenFunc(app.userSnippetsExport))
+
+	admin := protected.Append(app.requireAdmin)
 
-	standard := alice.New(app.recoverPanic, app.logRequest, commonHeaders)
+	mux.Handle("GET /admin", admin.ThenFunc(app.adminDashboard))
+	mux.Handle("GET /debug/vars", admin.Then(expvar.Handler()))
+	mux.Handle("GET /debug/config", admin.ThenFunc(app.debugConfig))
+	mux.Handle("GET /admin/users", admin.ThenFunc(app.adminUsers))
+	mux.Handle("GET /admin/expiring", admin.ThenFunc(app.adminExpiring))
+	mux.Handle("POST /admin/snippets/{id}/feature", admin.ThenFunc(app.adminSnippetFeaturePost))
+	mux.Handle("POST /admin/snippets/{id}/unfeature", admin.ThenFunc(app.adminSnippetUnfeaturePost))
+	mux.Handle("POST /admin/impersonate/{userID}", admin.ThenFunc(app.adminImpersonatePost))
 
-	return standard.Then(mux)
+	return mux
 }
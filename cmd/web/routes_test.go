@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRoutesRegistered documents the core routes by checking the pattern
+// each request is dispatched to.
+func TestRoutesRegistered(t *testing.T) {
+	mux := newTestApp(t).mux()
+
+	tests := []struct {
+		method  string
+		target  string
+		pattern string
+	}{
+		{http.MethodGet, "/", "GET /{$}"},
+		{http.MethodGet, "/snippet/view/1", "GET /snippet/view/{id}"},
+		{http.MethodGet, "/snippet/create", "GET /snippet/create"},
+		{http.MethodPost, "/snippet/create", "POST /snippet/create"},
+		{http.MethodPost, "/snippet/1/language", "POST /snippet/{id}/{action}"},
+		{http.MethodPost, "/snippet/pin/1", "POST /snippet/pin/{id}"},
+		{http.MethodPost, "/snippet/pin/language", "POST /snippet/pin/{id}"},
+		{http.MethodGet, "/user/login", "GET /user/login"},
+		{http.MethodPost, "/user/login", "POST /user/login"},
+		{http.MethodGet, "/user/signup", "GET /user/signup"},
+		{http.MethodPost, "/user/signup", "POST /user/signup"},
+		{http.MethodPost, "/user/logout", "POST /user/logout"},
+		{http.MethodGet, "/static/css/main.css", "GET /static/"},
+		{http.MethodGet, "/ping", "GET /ping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+
+			_, pattern := mux.Handler(r)
+			if pattern != tt.pattern {
+				t.Errorf("pattern = %q; want %q", pattern, tt.pattern)
+			}
+		})
+	}
+}
+
+// TestRoutesMethodGating checks that a known path requested with the wrong
+// method is refused with 405 and an Allow header, while an unknown path is
+// 404.
+func TestRoutesMethodGating(t *testing.T) {
+	routes := newTestApp(t).routes()
+
+	tests := []struct {
+		method string
+		target string
+		status int
+		allow  string
+	}{
+		{http.MethodPost, "/", http.StatusMethodNotAllowed, "GET, HEAD"},
+		// POST /snippet/{id}/{action} matches the path too, though it
+		// serves nothing but the language action.
+		{http.MethodDelete, "/snippet/view/1", http.StatusMethodNotAllowed, "GET, HEAD, POST"},
+		{http.MethodDelete, "/snippet/view/1/similar", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{http.MethodPut, "/snippet/create", http.StatusMethodNotAllowed, "GET, HEAD, POST"},
+		{http.MethodGet, "/user/logout", http.StatusMethodNotAllowed, "POST"},
+		{http.MethodGet, "/snippet/create", http.StatusSeeOther, ""},
+		{http.MethodGet, "/no/such/route", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			routes.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.target, nil))
+
+			assertStatus(t, rr, tt.status)
+			assertHeader(t, rr, "Allow", tt.allow)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"snippet.robertgleason.ca/internal/clock"
+	"snippet.robertgleason.ca/internal/models"
+	"snippet.robertgleason.ca/internal/spamfilter"
+)
+
+// errSkipped is returned by a check that could not run because a check it
+// depends on failed.
+var errSkipped = errors.New("skipped")
+
+// check is one step of -selfcheck. run returns a short detail for the summary
+// on success.
+type check struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+type checkResult struct {
+	name     string
+	detail   string
+	err      error
+	duration time.Duration
+}
+
+// selfChecks returns the -selfcheck steps in order. The database check opens
+// the connection that the migrations and sessions checks use; they are
+// skipped if it could not be opened. The connection is left for the process
+// exit to close.
+func selfChecks(cfg *config) []check {
+	var db *sql.DB
+
+	return []check{
+		{"config", func(ctx context.Context) (string, error) {
+			err := cfg.validate()
+			if err != nil {
+				return "", err
+			}
+			if cfg.baseURL == "" {
+				return "no -base-url", nil
+			}
+			return cfg.baseURL, nil
+		}},
+		{"database", func(ctx context.Context) (string, error) {
+			dsn, err := cfg.dsnWithPassword()
+			if err != nil {
+				return "", err
+			}
+			conn, err := openDB(ctx, dsn, nil)
+			if err != nil {
+				return "", err
+			}
+			db = conn
+			return "connected", nil
+		}},
+		{"migrations", func(ctx context.Context) (string, error) {
+			if db == nil {
+				return "", errSkipped
+			}
+			pending, err := models.PendingMigrations(ctx, db)
+			if err != nil {
+				return "", err
+			}
+			if len(pending) > 0 {
+				return "", fmt.Errorf("%d pending; run cmd/migrate", len(pending))
+			}
+			return "up to date", nil
+		}},
+		{"templates", func(ctx context.Context) (string, error) {
+			_, templateCache, err := loadTemplates(clock.Real{})
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d pages", len(templateCache)), nil
+		}},
+		{"openapi", func(ctx context.Context) (string, error) {
+			doc, err := buildOpenAPI()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d paths", len(doc.Paths)), nil
+		}},
+		{"spam rules", func(ctx context.Context) (string, error) {
+			if cfg.spamRules == "" {
+				return "not configured", nil
+			}
+			f, err := spamfilter.Load(cfg.spamRules)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d rules", f.Rules()), nil
+		}},
+		{"sessions", func(ctx context.Context) (string, error) {
+			if cfg.sessionStore == "memory" {
+				return "memory store", nil
+			}
+			if db == nil {
+				return "", errSkipped
+			}
+			err := checkSessionTable(ctx, db, false)
+			if err != nil {
+				return "", err
+			}
+			return "sessions table present", nil
+		}},
+	}
+}
+
+// runChecks runs checks in order, allowing each at most timeout. A check that
+// overruns is reported as failed and left running in the background, so a
+// hung dependency cannot stall the run.
+func runChecks(ctx context.Context, checks []check, timeout time.Duration) []checkResult {
+	results := make([]checkResult, len(checks))
+
+	for i, c := range checks {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+
+		type outcome struct {
+			detail string
+			err    error
+		}
+		done := make(chan outcome, 1)
+		go func() {
+			detail, err := c.run(ctx)
+			done <- outcome{detail, err}
+		}()
+
+		var o outcome
+		select {
+		case o = <-done:
+		case <-ctx.Done():
+			o.err = fmt.Errorf("timed out after %s", timeout)
+		}
+		cancel()
+
+		results[i] = checkResult{name: c.name, detail: o.detail, err: o.err, duration: time.Since(start)}
+	}
+	return results
+}
+
+// writeCheckResults writes results to w as a table followed by a list of the
+// failures, and reports whether every check passed. Skipped checks count as
+// failures.
+func writeCheckResults(w io.Writer, results []checkResult) bool {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDURATION\tDETAIL")
+
+	var failed []checkResult
+	for _, r := range results {
+		status, detail := "ok", r.detail
+		switch {
+		case errors.Is(r.err, errSkipped):
+			status, detail = "skipped", "depends on a failed check"
+			failed = append(failed, r)
+		case r.err != nil:
+			status, detail = "FAIL", r.err.Error()
+			failed = append(failed, r)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.name, status, r.duration.Round(time.Millisecond), detail)
+	}
+	tw.Flush()
+
+	if len(failed) == 0 {
+		fmt.Fprintln(w, "\nall checks passed")
+		return true
+	}
+
+	fmt.Fprintf(w, "\n%d of %d checks did not pass:\n", len(failed), len(results))
+	for _, r := range failed {
+		fmt.Fprintf(w, "  %s: %v\n", r.name, r.err)
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"snippet.robertgleason.ca/internal/models"
+)
+
+func TestRunChecks(t *testing.T) {
+	checks := []check{
+		{"passes", func(ctx context.Context) (string, error) { return "fine", nil }},
+		{"fails", func(ctx context.Context) (string, error) { return "", errors.New("broken") }},
+		{"hangs", func(ctx context.Context) (string, error) { select {} }},
+		{"skipped", func(ctx context.Context) (string, error) { return "", errSkipped }},
+	}
+
+	results := runChecks(context.Background(), checks, 20*time.Millisecond)
+
+	var out bytes.Buffer
+	if writeCheckResults(&out, results) {
+		t.Error("writeCheckResults reported success")
+	}
+
+	// Compare with the table padding collapsed to single spaces.
+	got := strings.Join(strings.Fields(out.String()), " ")
+	for _, want := range []string{
+		"passes ok",
+		"fails FAIL",
+		"hangs FAIL",
+		"timed out after 20ms",
+		"skipped skipped",
+		"3 of 4 checks did not pass",
+		"fails: broken",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := config{secretScan: "warn", sessionStore: "mysql", contentStore: "db", contentExternal: 256 << 10, contentLimits: contentLimits{Soft: 64 << 10, Hard: 1 << 20}}
+
+	tests := []struct {
+		name   string
+		modify func(*config)
+		want   string
+	}{
+		{"valid", func(cfg *config) {}, ""},
+		{"base url", func(cfg *config) { cfg.baseURL = "ftp://example.com" }, "invalid -base-url"},
+		{"secret scan", func(cfg *config) { cfg.secretScan = "maybe" }, "invalid -secret-scan"},
+		{"content limit", func(cfg *config) { cfg.contentLimits.Hard = -1 }, "content limits cannot be negative"},
+		{"session store", func(cfg *config) { cfg.sessionStore = "redis" }, "invalid -session-store"},
+		{"content store", func(cfg *config) { cfg.contentStore = "s3" }, "invalid -content-store"},
+		{"external threshold", func(cfg *config) { cfg.contentExternal = models.ContentColumnBytes }, "-content-external-threshold must be between"},
+		{"unlimited content in the database", func(cfg *config) { cfg.contentLimits.Hard = 0 }, "-content-hard-limit must be between"},
+		{"content over the column", func(cfg *config) { cfg.contentLimits.Hard = 32 << 20 }, "-content-hard-limit must be between"},
+		{"unlimited content in files", func(cfg *config) { cfg.contentStore, cfg.contentLimits.Hard = "fs", 0 }, ""},
+		{"multipart memory", func(cfg *config) { cfg.maxMultipartMemory = -1 }, "-max-multipart-memory cannot be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+
+			err := cfg.validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v; want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
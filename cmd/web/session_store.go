@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-sql-driver/mysql"
+)
+
+// sessionTableDDL creates the table used by the MySQL session store. It
+// matches internal/models/migrations/0001_initial.sql.
+var sessionTableDDL = []string{
+	`CREATE TABLE sessions (
+    token CHAR(43) PRIMARY KEY,
+    data BLOB NOT NULL,
+    expiry TIMESTAMP(6) NOT NULL
+)`,
+	`CREATE INDEX sessions_expiry_idx ON sessions (expiry)`,
+}
+
+// checkSessionTable verifies that the sessions table exists, creating it
+// when create is set.
+func checkSessionTable(ctx context.Context, db *sql.DB, create bool) error {
+	_, err := db.ExecContext(ctx, `SELECT 1 FROM sessions LIMIT 1`)
+	if err == nil {
+		return nil
+	}
+
+	var mySQLError *mysql.MySQLError
+	if !errors.As(err, &mySQLError) || mySQLError.Number != 1146 {
+		return fmt.Errorf("session store: %w", err)
+	}
+
+	if !create {
+		return errors.New("session store: sessions table does not exist; run cmd/migrate or start with -create-session-table")
+	}
+
+	for _, stmt := range sessionTableDDL {
+		_, err = db.ExecContext(ctx, stmt)
+		if err != nil {
+			return fmt.Errorf("session store: creating sessions table: %w", err)
+		}
+	}
+	return nil
+}
+
+// deleteExpiredSessions removes expired sessions from the MySQL session
+// store. The session-cleanup worker runs it in place of scs's own cleanup
+// goroutine, so that the cleanup is tracked by the health registry.
+func deleteExpiredSessions(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM sessions WHERE expiry < UTC_TIMESTAMP(6)`)
+	return err
+}
+
+// degradingStore wraps a session store so that a failure to load a session
+// is logged and treated as there being no session. Read-only pages then
+// render as for a signed-out visitor instead of failing outright. Saving a
+// session still fails, and is reported by sessionErrorFunc.
+type degradingStore struct {
+	scs.Store
+	logger *slog.Logger
+}
+
+func (s *degradingStore) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+func (s *degradingStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	var (
+		b     []byte
+		found bool
+		err   error
+	)
+	if cs, ok := s.Store.(scs.CtxStore); ok {
+		b, found, err = cs.FindCtx(ctx, token)
+	} else {
+		b, found, err = s.Store.Find(token)
+	}
+
+	if err != nil {
+		s.logger.Warn("session store unavailable; continuing with an empty session", "error", err.Error())
+		return nil, false, nil
+	}
+	return b, found, nil
+}
+
+func (s *degradingStore) Commit(token string, b []byte, expiry time.Time) error {
+	return s.Store.Commit(token, b, expiry)
+}
+
+func (s *degradingStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	if cs, ok := s.Store.(scs.CtxStore); ok {
+		return cs.CommitCtx(ctx, token, b, expiry)
+	}
+	return s.Store.Commit(token, b, expiry)
+}
+
+func (s *degradingStore) DeleteCtx(ctx context.Context, token string) error {
+	if cs, ok := s.Store.(scs.CtxStore); ok {
+		return cs.DeleteCtx(ctx, token)
+	}
+	return s.Store.Delete(token)
+}
+
+// sessionErrorFunc is the scs ErrorFunc. It is reached when a session that
+// a handler changed cannot be saved.
+func (app *application) sessionErrorFunc(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Error("session store unavailable", "error", err.Error(), "method", r.Method, "url", r.URL.RequestURI())
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+// stubDB is a database/sql connector that answers with canned results, so
+// that the real models.SnippetModel can run in handler tests without MySQL.
+// exec and query, when set, decide the result of each statement; otherwise
+// statements succeed and queries return no rows. Every Exec is recorded.
+type stubDB struct {
+	exec  func(query string, args []driver.NamedValue) (driver.Result, error)
+	query func(query string, args []driver.NamedValue) (columns []string, rows [][]driver.Value, err error)
+
+	mu    sync.Mutex
+	execs []stubExec
+}
+
+type stubExec struct {
+	query string
+	args  []any
+}
+
+// open returns a *sql.DB backed by db.
+func (db *stubDB) open() *sql.DB {
+	return sql.OpenDB(db)
+}
+
+// executed returns the statements run with Exec, in order.
+func (db *stubDB) executed() []stubExec {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]stubExec(nil), db.execs...)
+}
+
+func (db *stubDB) Connect(context.Context) (driver.Conn, error) { return stubConn{db}, nil }
+func (db *stubDB) Driver() driver.Driver                        { return nil }
+
+type stubConn struct{ db *stubDB }
+
+var (
+	_ driver.ExecerContext  = stubConn{}
+	_ driver.QueryerContext = stubConn{}
+)
+
+func (stubConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("stubDB: prepared statements are not supported")
+}
+func (stubConn) Close() error { return nil }
+func (stubConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("stubDB: transactions are not supported")
+}
+
+func (c stubConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	c.db.mu.Lock()
+	c.db.execs = append(c.db.execs, stubExec{query: query, args: values})
+	c.db.mu.Unlock()
+
+	if c.db.exec == nil {
+		return driver.RowsAffected(1), nil
+	}
+	return c.db.exec(query, args)
+}
+
+func (c stubConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.db.query == nil {
+		return &stubRows{}, nil
+	}
+	columns, rows, err := c.db.query(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &stubRows{columns: columns, rows: rows}, nil
+}
+
+type stubRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *stubRows) Columns() []string { return r.columns }
+func (r *stubRows) Close() error      { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// insertResult is the driver.Result of an INSERT that created row id.
+type insertResult int64
+
+func (id insertResult) LastInsertId() (int64, error) { return int64(id), nil }
+func (insertResult) RowsAffected() (int64, error)    { return 1, nil }
@@ -1,56 +1,542 @@
 package main
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
 	"html/template"
 	"io/fs"
+	"maps"
+	"math"
+	"net/url"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template/parse"
 	"time"
 
+	"snippet.robertgleason.ca/internal/assets"
+	"snippet.robertgleason.ca/internal/clock"
 	"snippet.robertgleason.ca/internal/models"
 	"snippet.robertgleason.ca/ui"
 )
 
 type templateData struct {
-	CurrentYear     int
-	Snippet         models.Snippet
-	Snippets        []models.Snippet
-	Form            any
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string
+	CurrentYear        int
+	Snippet            models.Snippet
+	Snippets           []*models.Snippet
+	RecentlyViewed     []*models.Snippet
+	FeaturedSnippets   []*models.Snippet
+	Form               any
+	FormValues         url.Values
+	Flash              string
+	Notice             string
+	IsAuthenticated    bool
+	AuthenticatedUser  models.User
+	CSRFToken          string
+	Theme              string
+	FormToken          string
+	UserTZ             string
+	Meta               pageMeta
+	Filters            models.SnippetFilters
+	Pagination         pagination
+	Leaderboard        []models.UserSnippetCount
+	Discover           []discoverSection
+	Languages          []models.LanguageCount
+	Consent            consentPreferences
+	LanguageChart      barChart
+	Storage            storageStats
+	ExpiringWithin     time.Duration
+	Users              []*models.User
+	RateLimitWarning   string
+	Impersonating      string
+	UserSessions       []models.UserSession
+	CurrentSessionID   string
+	AnalyticsSrc       string
+	IsOwner            bool
+	SupportedLanguages []string
+	Versions           []models.SnippetVersion
+	Shares             []shareLink
+	SharedUntil        time.Time
+	Bundle             models.Bundle
+	BundleMembers      []bundleMember
+	ContentLimits      contentLimits
+	APIDoc             *openAPIDocument
 }
 
-func newTemplateCache() (map[string]*template.Template, error) {
-	cache := map[string]*template.Template{}
+// FormValue returns the value to show in the form input called name. After
+// a failed submission it is the submitted value, so what the user typed
+// survives the re-render even for fields that Form does not have. Otherwise
+// it is the Form field tagged form:"name", such as a default or a restored
+// draft, or "" if there is none.
+func (d templateData) FormValue(name string) string {
+	if values, ok := d.FormValues[name]; ok && len(values) > 0 {
+		return values[0]
+	}
+	return formFieldValue(d.Form, name)
+}
+
+// formFieldValue formats the field of the form struct tagged form:"name".
+func formFieldValue(form any, name string) string {
+	v := reflect.ValueOf(form)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	for i := range v.NumField() {
+		tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("form"), ",")
+		if tag != name {
+			continue
+		}
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			return f.String()
+		case reflect.Bool:
+			if f.Bool() {
+				return "true"
+			}
+			return ""
+		default:
+			return fmt.Sprint(f.Interface())
+		}
+	}
+	return ""
+}
+
+// contentLimits are the snippet content sizes, in bytes, configured by
+// -content-soft-limit and -content-hard-limit. Zero means no limit.
+type contentLimits struct {
+	Soft int `json:"content_soft_limit_bytes" doc:"Content size in bytes above which the snippet page collapses the content; 0 for no limit."`
+	Hard int `json:"content_hard_limit_bytes" doc:"Maximum content size in bytes; 0 for no limit."`
+}
+
+// Collapsed reports whether content is over the soft limit, so that the view
+// page hides it behind an expansion.
+func (l contentLimits) Collapsed(content string) bool {
+	return l.Soft > 0 && len(content) > l.Soft
+}
+
+// shareLink is an outstanding share link as listed to the snippet's owner.
+type shareLink struct {
+	URL     string
+	Created time.Time
+	Expires time.Time
+}
+
+// pagination describes the position of a page within a listing and builds
+// links to neighbouring pages that preserve the current query parameters.
+type pagination struct {
+	Page       int
+	TotalPages int
+	Total      int
+	query      url.Values
+}
+
+func newPagination(page, pageSize, total int, query url.Values) pagination {
+	totalPages := (total + pageSize - 1) / pageSize
+	return pagination{Page: page, TotalPages: totalPages, Total: total, query: query}
+}
+
+func (p pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p pagination) HasNext() bool {
+	return p.Page < p.TotalPages
+}
+
+func (p pagination) PrevURL() string {
+	return p.URL(p.Page - 1)
+}
+
+func (p pagination) NextURL() string {
+	return p.URL(p.Page + 1)
+}
+
+// URL returns a relative URL for the given page number.
+func (p pagination) URL(page int) string {
+	query := maps.Clone(p.query)
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("page", strconv.Itoa(page))
+	return "?" + query.Encode()
+}
+
+// paginationWindow is how many pages either side of the current one
+// paginationRange links to.
+const paginationWindow = 2
+
+// paginationRange returns the page numbers to link to from page out of
+// totalPages: the first and last pages and those within paginationWindow of
+// page, in order, with a 0 wherever pages are skipped. A single page is
+// never skipped, since its number takes no more room than the gap.
+func paginationRange(page, totalPages int) []int {
+	var pages []int
+	for n := 1; n <= totalPages; n++ {
+		if n != 1 && n != totalPages && (n < page-paginationWindow || n > page+paginationWindow) {
+			continue
+		}
+		if len(pages) > 0 {
+			switch last := pages[len(pages)-1]; {
+			case n == last+2:
+				pages = append(pages, last+1)
+			case n > last+2:
+				pages = append(pages, 0)
+			}
+		}
+		pages = append(pages, n)
+	}
+	return pages
+}
+
+// pageMeta holds the Open Graph and Twitter card metadata rendered in the
+// page head. Extra holds any other <meta property> tags, by property name;
+// app.setMeta fills in both.
+type pageMeta struct {
+	Title       string
+	Description string
+	URL         string
+	Type        string
+	TwitterCard string
+	Extra       map[string]string
+}
+
+// storageStats sizes up the snippets table for the admin dashboard.
+type storageStats struct {
+	Expired      int
+	ContentBytes int
+}
+
+// barChart is a horizontal bar chart laid out for rendering as inline SVG,
+// so no JavaScript is needed to draw it.
+type barChart struct {
+	Bars   []bar
+	Height int
+}
+
+type bar struct {
+	Label string
+	Count int
+	Y     int
+	Width int // percent of the widest bar
+}
+
+const barHeight = 24
+
+// newBarChart lays out one bar per entry in counts, largest first. An empty
+// key is labelled "(none)".
+func newBarChart(counts map[string]int) barChart {
+	labels := slices.Collect(maps.Keys(counts))
+	slices.SortFunc(labels, func(a, b string) int {
+		if c := cmp.Compare(counts[b], counts[a]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+
+	var chart barChart
+	if len(labels) == 0 {
+		return chart
+	}
+
+	largest := counts[labels[0]]
+
+	for i, label := range labels {
+		b := bar{
+			Label: label,
+			Count: counts[label],
+			Y:     i * barHeight,
+		}
+		if b.Label == "" {
+			b.Label = "(none)"
+		}
+		if largest > 0 {
+			b.Width = max(1, b.Count*100/largest)
+		}
+		chart.Bars = append(chart.Bars, b)
+	}
+	chart.Height = len(labels) * barHeight
+
+	return chart
+}
+
+func newTemplateCache(manifest *assets.Manifest, clk clock.Clock) (map[string]*template.Template, error) {
+	return parseTemplates(ui.Files, manifest, clk)
+}
+
+// mustTemplateCache is newTemplateCache for startup, where a template that
+// does not parse is a bug in the binary rather than a condition to handle. It
+// panics with the parse error, so the failure and the offending template
+// cannot be missed in a log.
+func mustTemplateCache(manifest *assets.Manifest, clk clock.Clock) map[string]*template.Template {
+	return mustParseTemplates(ui.Files, manifest, clk)
+}
+
+func mustParseTemplates(fsys fs.FS, manifest *assets.Manifest, clk clock.Clock) map[string]*template.Template {
+	cache, err := parseTemplates(fsys, manifest, clk)
+	if err != nil {
+		panic(fmt.Sprintf("parsing templates: %v", err))
+	}
+	return cache
+}
 
-	pages, err := fs.Glob(ui.Files, "html/pages/*.tmpl")
+// parseTemplates builds a template set for every page in fsys, which must be
+// laid out like the ui directory. In -dev mode it is called on each render
+// with the on-disk ui directory so template edits show up without a restart.
+//
+// The layout and partials are parsed once and cloned for each page, and pages
+// are parsed concurrently. Every page that fails is reported in the returned
+// error, not just the first.
+func parseTemplates(fsys fs.FS, manifest *assets.Manifest, clk clock.Clock) (map[string]*template.Template, error) {
+	funcs := maps.Clone(functions)
+	funcs["asset"] = manifest.Path
+	funcs["relativeDate"] = func(t time.Time) string { return relativeDate(t, clk.Now()) }
+	funcs["expiresIn"] = func(t time.Time) string { return expiresIn(t, clk.Now()) }
+	funcs["expiresAfter"] = func(days int) time.Time { return snippetCreateForm{Expires: days}.ExpiresTime(clk.Now()) }
+
+	layout, err := template.New("base").Funcs(funcs).ParseFS(fsys, "html/base.tmpl", "html/partials/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := fs.Glob(fsys, "html/pages/*.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
-	for _, page := range pages {
-		name := filepath.Base(page)
+	var (
+		cache = make(map[string]*template.Template, len(pages))
+		errs  = make([]error, len(pages))
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, runtime.GOMAXPROCS(0))
+	)
 
-		patterns := []string{
-			"html/base.tmpl",
-			"html/partials/*.tmpl",
-			page,
+	for i, page := range pages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			name := filepath.Base(page)
+
+			ts, err := parsePage(fsys, layout, page, manifest)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", name, err)
+				return
+			}
+
+			mu.Lock()
+			cache[name] = ts
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	// errs is indexed by page, so the joined error lists failures in a
+	// stable order.
+	err = errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+func parsePage(fsys fs.FS, layout *template.Template, page string, manifest *assets.Manifest) (*template.Template, error) {
+	ts, err := layout.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	ts, err = ts.ParseFS(fsys, page)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateAssets(ts, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts, nil
+}
+
+// validateAssets checks that every {{asset "name"}} call with a literal
+// argument in ts refers to a file in the manifest, so that a missing asset
+// fails at startup rather than when the page is first rendered.
+func validateAssets(ts *template.Template, manifest *assets.Manifest) error {
+	for _, t := range ts.Templates() {
+		if t.Tree == nil {
+			continue
 		}
-		ts, err := template.New(name).Funcs(functions).ParseFS(ui.Files, patterns...)
+
+		var err error
+		walkTemplate(t.Tree.Root, func(cmd *parse.CommandNode) {
+			if err != nil || len(cmd.Args) != 2 {
+				return
+			}
+			ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+			if !ok || ident.Ident != "asset" {
+				return
+			}
+			arg, ok := cmd.Args[1].(*parse.StringNode)
+			if ok && !manifest.Has(arg.Text) {
+				err = fmt.Errorf("template %s: asset %q does not exist", t.Name(), arg.Text)
+			}
+		})
 		if err != nil {
-			return nil, err
+			return err
 		}
-
-		cache[name] = ts
 	}
+	return nil
+}
 
-	return cache, nil
+// walkTemplate calls fn for every command in the parse tree rooted at node.
+func walkTemplate(node parse.Node, fn func(*parse.CommandNode)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplate(child, fn)
+		}
+	case *parse.ActionNode:
+		walkTemplate(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkTemplate(cmd, fn)
+		}
+	case *parse.CommandNode:
+		fn(n)
+		for _, arg := range n.Args {
+			walkTemplate(arg, fn)
+		}
+	case *parse.IfNode:
+		walkTemplate(n.Pipe, fn)
+		walkTemplate(n.List, fn)
+		walkTemplate(n.ElseList, fn)
+	case *parse.RangeNode:
+		walkTemplate(n.Pipe, fn)
+		walkTemplate(n.List, fn)
+		walkTemplate(n.ElseList, fn)
+	case *parse.WithNode:
+		walkTemplate(n.Pipe, fn)
+		walkTemplate(n.List, fn)
+		walkTemplate(n.ElseList, fn)
+	case *parse.TemplateNode:
+		walkTemplate(n.Pipe, fn)
+	}
 }
 
 func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+// humanDateInTZ formats t in the named IANA time zone, falling back to UTC
+// when tz is empty or unknown.
+func humanDateInTZ(t time.Time, tz string) string {
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "" {
+		loc = time.UTC
+	}
+	return humanDate(t.In(loc))
+}
+
+// inc returns n+1, for turning zero-based indexes into ranks.
+func inc(n int) int {
+	return n + 1
+}
+
+// relativeDate describes t relative to now, e.g. "3 hours ago" or "in 2
+// days". It is registered as a closure over the application clock.
+func relativeDate(t, now time.Time) string {
+	if !t.After(now) {
+		return timeAgo(now.Sub(t))
+	}
+
+	d := t.Sub(now)
+	switch {
+	case d < time.Minute:
+		return "in less than a minute"
+	case d < time.Hour:
+		return "in " + pluralize(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return "in " + pluralize(int(d/time.Hour), "hour")
+	default:
+		return "in " + pluralize(int(d/(24*time.Hour)), "day")
+	}
+}
+
+// expiresIn describes how long remains before t in whole days, rounding
+// down, so that a snippet with under a day left "expires in 0 days".
+func expiresIn(t, now time.Time) string {
+	if !t.After(now) {
+		return "expired"
+	}
+	return "expires in " + pluralize(int(t.Sub(now)/(24*time.Hour)), "day")
+}
+
+// humanBytes formats a size in bytes as e.g. "512 bytes", "64 KB" or
+// "1.5 MB", using 1024-byte units.
+func humanBytes(n int) string {
+	unit, size := "", float64(n)
+	switch {
+	case n < 1<<10:
+		return pluralize(n, "byte")
+	case n < 1<<20:
+		unit, size = "KB", size/(1<<10)
+	default:
+		unit, size = "MB", size/(1<<20)
+	}
+	return strings.TrimSuffix(strconv.FormatFloat(size, 'f', 1, 64), ".0") + " " + unit
+}
+
+// humanFileSize formats a size in bytes the way a file listing does, as e.g.
+// "512 B", "1.0 KB" or "3.4 MB", using 1024-byte units and one decimal place
+// above bytes. It is used for a snippet's own size, so that the view page
+// shows it one way; humanBytes is for limits and totals.
+func humanFileSize(n int64) string {
+	if n < 1<<10 {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+
+	units := []string{"KB", "MB", "GB", "TB"}
+	size, i := float64(n)/(1<<10), 0
+	// Move up a unit when rounding would show 1024.0 of this one.
+	for math.Round(size*10)/10 >= 1<<10 && i < len(units)-1 {
+		size, i = size/(1<<10), i+1
+	}
+	return strconv.FormatFloat(size, 'f', 1, 64) + " " + units[i]
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return strconv.Itoa(n) + " " + unit + "s"
+}
+
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":       humanDate,
+	"humanDateTZ":     humanDateInTZ,
+	"inc":             inc,
+	"humanBytes":      humanBytes,
+	"humanFileSize":   humanFileSize,
+	"pluralize":       pluralize,
+	"paginationRange": paginationRange,
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"snippet.robertgleason.ca/internal/assets"
+	"snippet.robertgleason.ca/internal/clock"
+)
+
+func TestHumanFileSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		bytes int64
+		want  string
+	}{
+		{"zero", 0, "0 B"},
+		{"one byte", 1, "1 B"},
+		{"just under a kilobyte", 1023, "1023 B"},
+		{"one kilobyte", 1024, "1.0 KB"},
+		{"fractional kilobytes", 1536, "1.5 KB"},
+		{"one megabyte", 1 << 20, "1.0 MB"},
+		{"rounds up to the next unit", 1<<20 - 1, "1.0 MB"},
+		{"gigabytes", 5 << 30, "5.0 GB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := humanFileSize(tt.bytes); got != tt.want {
+				t.Errorf("humanFileSize(%d) = %q; want %q", tt.bytes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentYear(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{"last second of the year", time.Date(2030, 12, 31, 23, 59, 59, 0, time.UTC), "in 2030."},
+		{"first second of the year", time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC), "in 2031."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.clock = clock.Fixed(tt.now)
+
+			rr := app.testGet(t, "/")
+
+			assertStatus(t, rr, http.StatusOK)
+			assertBody(t, rr, tt.want)
+		})
+	}
+}
+
+func TestHumanDateInTZ(t *testing.T) {
+	tests := []struct {
+		name string
+		t    time.Time
+		tz   string
+		want string
+	}{
+		{"New York in summer", time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), "America/New_York", "01 Jun 2025 at 08:00"},
+		{"New York before the clocks go forward", time.Date(2025, 3, 9, 6, 59, 0, 0, time.UTC), "America/New_York", "09 Mar 2025 at 01:59"},
+		{"New York after the clocks go forward", time.Date(2025, 3, 9, 7, 0, 0, 0, time.UTC), "America/New_York", "09 Mar 2025 at 03:00"},
+		{"Paris before the clocks go back", time.Date(2025, 10, 26, 0, 59, 0, 0, time.UTC), "Europe/Paris", "26 Oct 2025 at 02:59"},
+		{"Paris after the clocks go back", time.Date(2025, 10, 26, 1, 0, 0, 0, time.UTC), "Europe/Paris", "26 Oct 2025 at 02:00"},
+		{"Tokyo on the next day", time.Date(2025, 6, 1, 16, 30, 0, 0, time.UTC), "Asia/Tokyo", "02 Jun 2025 at 01:30"},
+		{"empty zone", time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), "", "01 Jun 2025 at 12:00"},
+		{"unknown zone", time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), "Mars/Olympus_Mons", "01 Jun 2025 at 12:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := humanDateInTZ(tt.t, tt.tz); got != tt.want {
+				t.Errorf("humanDateInTZ(%v, %q) = %q; want %q", tt.t, tt.tz, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDateFuncsAtExpiry(t *testing.T) {
+	expires := time.Date(2025, 6, 8, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{"a day and a second before", expires.Add(-24*time.Hour - time.Second), "expires in 1 day|in 1 day"},
+		{"exactly a day before", expires.Add(-24 * time.Hour), "expires in 1 day|in 1 day"},
+		{"a day less a second before", expires.Add(-24*time.Hour + time.Second), "expires in 0 days|in 23 hours"},
+		{"a second before", expires.Add(-time.Second), "expires in 0 days|in less than a minute"},
+		{"at the instant", expires, "expired|less than a minute ago"},
+		{"a second after", expires.Add(time.Second), "expired|less than a minute ago"},
+	}
+
+	fsys := fstest.MapFS{
+		"html/base.tmpl":         {Data: []byte(`{{define "base"}}{{template "main" .}}{{end}}`)},
+		"html/partials/nav.tmpl": {Data: []byte(`{{define "nav"}}{{end}}`)},
+		"html/pages/dates.tmpl":  {Data: []byte(`{{define "main"}}{{expiresIn .}}|{{relativeDate .}}{{end}}`)},
+	}
+	manifest, err := assets.NewManifest(fstest.MapFS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The template functions read the clock they were parsed with.
+			cache, err := parseTemplates(fsys, manifest, clock.Fixed(tt.now))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out strings.Builder
+			if err := cache["dates.tmpl"].ExecuteTemplate(&out, "base", expires); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("rendered %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
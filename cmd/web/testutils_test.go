@@ -0,0 +1,230 @@
+package main
+
+import (
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/go-playground/form/v4"
+	"golang.org/x/net/html"
+
+	"snippet.robertgleason.ca/internal/assets"
+	"snippet.robertgleason.ca/internal/cache"
+	"snippet.robertgleason.ca/internal/clock"
+	"snippet.robertgleason.ca/internal/health"
+	"snippet.robertgleason.ca/internal/models/mock"
+	"snippet.robertgleason.ca/internal/validator"
+	"snippet.robertgleason.ca/ui"
+)
+
+// newTestApp returns an application backed by the in-memory mock
+// models, with the real templates and an in-memory session store. Log output
+// is discarded.
+func newTestApp(t testing.TB) *application {
+	t.Helper()
+
+	staticFiles, err := fs.Sub(ui.Files, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := assets.NewManifest(staticFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clk := clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	templateCache := mustTemplateCache(manifest, clk)
+
+	registerSessionTypes()
+	sessionManager := scs.New()
+	sessionManager.Store = memstore.New()
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Cookie.Secure = true
+
+	openAPI, err := buildOpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+
+	return &application{
+		config: config{
+			htmlTimeout:        5 * time.Second,
+			maxContentChars:    10000,
+			maxControlRatio:    validator.DefaultControlRatio,
+			secretScan:         "warn",
+			languages:          defaultLanguages(),
+			discoverLanguages:  []string{"go", "python", "sql"},
+			maxMultipartMemory: 10 << 20,
+		},
+		logger:         logger,
+		httpLogger:     logger,
+		dbLogger:       logger,
+		clock:          clk,
+		health:         health.NewRegistryWithClock(clk),
+		snippets:       &mock.MockSnippetModel{Clock: clk},
+		users:          &mock.MockUserModel{},
+		userSessions:   &mock.MockUserSessionModel{Clock: clk},
+		assets:         manifest,
+		templateCache:  templateCache,
+		formDecoder:    form.NewDecoder(),
+		sessionManager: sessionManager,
+		openAPI:        openAPI,
+		latestCache:    cache.New[string, latestSnippets](latestTTL, clk),
+	}
+}
+
+// testGet sends a GET request for target through the application's routes and
+// returns the recorded response.
+func (app *application) testGet(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+	return rr
+}
+
+// testClient sends requests through the application's routes, keeping the
+// cookies it is given between requests as a browser would.
+type testClient struct {
+	t       *testing.T
+	handler http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func (app *application) newTestClient(t *testing.T) *testClient {
+	return &testClient{t: t, handler: app.routes(), cookies: make(map[string]*http.Cookie)}
+}
+
+func (c *testClient) do(r *http.Request) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	for _, cookie := range c.cookies {
+		r.AddCookie(cookie)
+	}
+
+	rr := httptest.NewRecorder()
+	c.handler.ServeHTTP(rr, r)
+
+	for _, cookie := range rr.Result().Cookies() {
+		c.cookies[cookie.Name] = cookie
+	}
+	return rr
+}
+
+func (c *testClient) get(target string) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	return c.do(httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+// postForm submits form to target as a same-origin form post, which is what
+// the CSRF check expects of a browser.
+func (c *testClient) postForm(target string, form url.Values) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Sec-Fetch-Site", "same-origin")
+	return c.do(r)
+}
+
+// postJSON sends body to target as the page scripts do, with the CSRF token
+// in the X-CSRF-Token header.
+func (c *testClient) postJSON(target, csrfToken, body string) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-CSRF-Token", csrfToken)
+	r.Header.Set("Sec-Fetch-Site", "same-origin")
+	return c.do(r)
+}
+
+// formTokens returns the csrf_token and form_token hidden input values of the
+// page at target, ready to be submitted with a form.
+func (c *testClient) formTokens(target string) url.Values {
+	c.t.Helper()
+
+	rr := c.get(target)
+	assertStatus(c.t, rr, http.StatusOK)
+
+	doc, err := html.Parse(rr.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	tokens := url.Values{}
+	for _, input := range findElements(doc, "input") {
+		var name, value string
+		for _, attr := range input.Attr {
+			switch attr.Key {
+			case "name":
+				name = attr.Val
+			case "value":
+				value = attr.Val
+			}
+		}
+		if (name == "csrf_token" || name == "form_token") && !tokens.Has(name) {
+			tokens.Set(name, value)
+		}
+	}
+	return tokens
+}
+
+// login signs in as the mock user model's AuthenticateID, which is set to 1 if
+// it is unset.
+func (c *testClient) login(app *application) {
+	c.t.Helper()
+
+	users := app.users.(*mock.MockUserModel)
+	if users.AuthenticateID == 0 {
+		users.AuthenticateID = 1
+	}
+	users.ExistsResult = true
+
+	form := c.formTokens("/user/login")
+	form.Set("email", "alice@example.com")
+	form.Set("password", "pa55word")
+
+	rr := c.postForm("/user/login", form)
+	assertStatus(c.t, rr, http.StatusSeeOther)
+}
+
+// assertStatus fails the test if the response status is not want.
+func assertStatus(t *testing.T, rr *httptest.ResponseRecorder, want int) {
+	t.Helper()
+
+	if rr.Code != want {
+		t.Errorf("status = %d; want %d", rr.Code, want)
+	}
+}
+
+// assertBody fails the test if the response body does not contain want.
+func assertBody(t *testing.T, rr *httptest.ResponseRecorder, want string) {
+	t.Helper()
+
+	if !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("body does not contain %q", want)
+	}
+}
+
+// assertHeader fails the test if the response header name is not want. An
+// empty want asserts that the header is absent.
+func assertHeader(t *testing.T, rr *httptest.ResponseRecorder, name, want string) {
+	t.Helper()
+
+	if got := rr.Header().Get(name); got != want {
+		t.Errorf("%s = %q; want %q", name, got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"snippet.robertgleason.ca/internal/models"
+)
+
+// sessionCleanupInterval is how often expired sessions are deleted from the
+// MySQL session store. It matches the interval scs's own cleanup uses.
+const sessionCleanupInterval = 5 * time.Minute
+
+// worker is a task run every interval in the background for the life of the
+// server. Each run that succeeds is a heartbeat in app.health, so /ping
+// reports the server as degraded once a worker has failed, or stopped, for
+// three intervals.
+type worker struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+// newWorkers returns the background workers for cfg. Sessions are only
+// cleaned up by the server when they are kept in MySQL, and snippets are
+// only vacuumed when -vacuum-interval is set.
+func (app *application) newWorkers(cfg config, db *sql.DB, snippets *models.SnippetModel) []worker {
+	workers := []worker{
+		{name: "cache-refresh", interval: latestTTL / 2, run: app.refreshLatest},
+	}
+
+	if cfg.sessionStore == "mysql" {
+		workers = append(workers, worker{name: "session-cleanup", interval: sessionCleanupInterval, run: func(ctx context.Context) error {
+			return deleteExpiredSessions(ctx, db)
+		}})
+	}
+
+	if cfg.vacuumInterval > 0 {
+		workers = append(workers, worker{name: "vacuum", interval: cfg.vacuumInterval, run: func(ctx context.Context) error {
+			count, err := snippets.Vacuum(ctx, false)
+			if err == nil && count > 0 {
+				app.logger.Info("vacuum complete", "deleted", count)
+			}
+			return err
+		}})
+	}
+
+	return workers
+}
+
+// startWorkers runs each of app.workers in its own goroutine until ctx is
+// done.
+func (app *application) startWorkers(ctx context.Context) {
+	for _, w := range app.workers {
+		go app.runWorker(ctx, w)
+	}
+}
+
+// runWorker registers w with app.health and runs it every w.interval,
+// beating after each successful run, until ctx is done. Failures are
+// logged and leave the heartbeat to go stale.
+func (app *application) runWorker(ctx context.Context, w worker) {
+	app.health.Register(w.name, w.interval)
+	defer app.health.Deregister(w.name)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := w.run(ctx)
+		if err != nil {
+			app.logger.Error("background worker failed", "worker", w.name, "error", err.Error())
+			continue
+		}
+		app.health.Beat(w.name)
+	}
+}
+
+// refreshLatest reloads the home page's default listing into latestCache,
+// so that visits rarely find it expired.
+func (app *application) refreshLatest(ctx context.Context) error {
+	filters := models.SnippetFilters{Sort: models.SortCreatedDesc, Page: 1, PageSize: homePageSize}
+
+	snippets, total, err := app.snippets.List(ctx, filters)
+	if err != nil {
+		return err
+	}
+	app.latestCache.Set(latestKey, latestSnippets{snippets: snippets, total: total})
+	return nil
+}
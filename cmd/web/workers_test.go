@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"snippet.robertgleason.ca/internal/clock"
+)
+
+// runTestWorker runs w until it has run n times, then stops it and waits for
+// it to return.
+func runTestWorker(t *testing.T, app *application, w worker, n int) {
+	t.Helper()
+
+	ran := make(chan struct{})
+	run := w.run
+	w.run = func(ctx context.Context) error {
+		err := run(ctx)
+		select {
+		case ran <- struct{}{}:
+		case <-ctx.Done():
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		app.runWorker(ctx, w)
+		close(done)
+	}()
+
+	for range n {
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("worker %s did not run", w.name)
+		}
+	}
+	cancel()
+	<-done
+}
+
+func TestRunWorker(t *testing.T) {
+	app := newTestApp(t)
+	clk := app.clock.(*clock.Fake)
+
+	runs := 0
+	w := worker{name: "counter", interval: time.Millisecond, run: func(ctx context.Context) error {
+		runs++
+		// Each run happens a minute later, long past the interval, so only
+		// the beat after a run keeps the worker fresh.
+		clk.Advance(time.Minute)
+		if _, ok := app.health.Snapshot()["counter"]; !ok {
+			t.Error("worker is not registered while it runs")
+		}
+		return nil
+	}}
+
+	runTestWorker(t, app, w, 3)
+
+	if runs < 3 {
+		t.Errorf("runs = %d; want at least 3", runs)
+	}
+	if _, ok := app.health.Snapshot()["counter"]; ok {
+		t.Error("worker is still registered after it stopped")
+	}
+}
+
+func TestRunWorkerFailing(t *testing.T) {
+	app := newTestApp(t)
+	clk := app.clock.(*clock.Fake)
+
+	stale := make(chan []string, 1)
+	runs := 0
+	w := worker{name: "broken", interval: time.Millisecond, run: func(ctx context.Context) error {
+		runs++
+		clk.Advance(time.Minute)
+		if runs == 2 {
+			stale <- app.health.Stale()
+		}
+		return errors.New("database unavailable")
+	}}
+
+	runTestWorker(t, app, w, 2)
+
+	if got := <-stale; !slices.Equal(got, []string{"broken"}) {
+		t.Errorf("Stale() = %v; want a failing worker reported", got)
+	}
+}
+
+func TestRefreshLatest(t *testing.T) {
+	app := newTestApp(t)
+
+	_, err := app.snippets.Insert(t.Context(), "An old silent pond", "A frog jumps in.", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.refreshLatest(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, ok := app.latestCache.Get(latestKey)
+	if !ok || latest.total != 1 || latest.snippets[0].Title != "An old silent pond" {
+		t.Errorf("latestCache = %+v, %t; want the new snippet", latest, ok)
+	}
+}
+
+func TestNewWorkers(t *testing.T) {
+	app := newTestApp(t)
+
+	names := func(cfg config) []string {
+		var names []string
+		for _, w := range app.newWorkers(cfg, nil, nil) {
+			names = append(names, w.name)
+		}
+		return names
+	}
+
+	if got := names(config{sessionStore: "memory"}); !slices.Equal(got, []string{"cache-refresh"}) {
+		t.Errorf("workers = %v; want only cache-refresh", got)
+	}
+	if got := names(config{sessionStore: "mysql", vacuumInterval: time.Hour}); !slices.Equal(got, []string{"cache-refresh", "session-cleanup", "vacuum"}) {
+		t.Errorf("workers = %v; want all three", got)
+	}
+}
@@ -0,0 +1,104 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	hashLength = 8
+
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	logicalCacheControl   = "public, max-age=300"
+)
+
+// Manifest maps the logical names of static files (e.g. "css/main.css") to
+// content-addressed names (e.g. "css/main.1a2b3c4d.css") so that browsers can
+// cache them forever and still pick up changes after a deploy.
+type Manifest struct {
+	fsys    fs.FS
+	hashed  map[string]string
+	logical map[string]string
+}
+
+// NewManifest walks fsys and hashes every regular file in it.
+func NewManifest(fsys fs.FS) (*Manifest, error) {
+	m := &Manifest{
+		fsys:    fsys,
+		hashed:  make(map[string]string),
+		logical: make(map[string]string),
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		hashedName := HashedName(name, data)
+		m.hashed[name] = hashedName
+		m.logical[hashedName] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// HashedName inserts the first eight hex characters of the SHA-256 of data
+// before the file extension of name.
+func HashedName(name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])[:hashLength]
+
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// Path returns the URL path of the hashed version of the named asset.
+func (m *Manifest) Path(name string) (string, error) {
+	hashedName, ok := m.hashed[name]
+	if !ok {
+		return "", fmt.Errorf("assets: %q not found in manifest", name)
+	}
+	return "/static/" + hashedName, nil
+}
+
+// Has reports whether the named asset exists.
+func (m *Manifest) Has(name string) bool {
+	_, ok := m.hashed[name]
+	return ok
+}
+
+// ServeHTTP serves assets by their hashed name with a long-lived immutable
+// cache policy, and by their logical name with a short one for backwards
+// compatibility. Anything else, including hashed names from a previous
+// deploy, is a 404. It expects the /static/ prefix to have been stripped.
+func (m *Manifest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path
+
+	if logicalName, ok := m.logical[name]; ok {
+		w.Header().Set("Cache-Control", immutableCacheControl)
+		http.ServeFileFS(w, r, m.fsys, logicalName)
+		return
+	}
+
+	if _, ok := m.hashed[name]; ok {
+		w.Header().Set("Cache-Control", logicalCacheControl)
+		http.ServeFileFS(w, r, m.fsys, name)
+		return
+	}
+
+	http.NotFound(w, r)
+}
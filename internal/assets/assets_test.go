@@ -0,0 +1,111 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestManifest(t *testing.T, files map[string]string) *Manifest {
+	t.Helper()
+
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	m, err := NewManifest(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestHashedName(t *testing.T) {
+	sum := sha256.Sum256([]byte("body{}"))
+	hash := hex.EncodeToString(sum[:])[:8]
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"css/main.css", "css/main." + hash + ".css"},
+		{"js/vendor.min.js", "js/vendor.min." + hash + ".js"},
+		{"LICENSE", "LICENSE." + hash},
+	}
+	for _, tt := range tests {
+		if got := HashedName(tt.name, []byte("body{}")); got != tt.want {
+			t.Errorf("HashedName(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if HashedName("css/main.css", []byte("body{}")) == HashedName("css/main.css", []byte("body{ }")) {
+		t.Error("HashedName is the same for different content")
+	}
+}
+
+func TestAssetFunc(t *testing.T) {
+	m := newTestManifest(t, map[string]string{"css/main.css": "body{}"})
+	want, _ := m.Path("css/main.css")
+
+	ts := template.Must(template.New("page").Funcs(template.FuncMap{"asset": m.Path}).Parse(
+		`<link rel="stylesheet" href="{{asset "css/main.css"}}">`))
+	var out strings.Builder
+	if err := ts.Execute(&out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != `<link rel="stylesheet" href="`+want+`">` {
+		t.Errorf("rendered %q", got)
+	}
+	if !strings.HasPrefix(want, "/static/css/main.") || want == "/static/css/main.css" {
+		t.Errorf("Path = %q; want a hashed name under /static/", want)
+	}
+
+	ts = template.Must(template.New("page").Funcs(template.FuncMap{"asset": m.Path}).Parse(`{{asset "css/missing.css"}}`))
+	if err := ts.Execute(&out, nil); err == nil {
+		t.Error("rendering a missing asset succeeded; want an error")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	m := newTestManifest(t, map[string]string{"css/main.css": "body{}"})
+	hashed := HashedName("css/main.css", []byte("body{}"))
+	stale := HashedName("css/main.css", []byte("body{color:red}"))
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantCache    string
+		wantContains string
+	}{
+		{"hashed name", hashed, http.StatusOK, immutableCacheControl, "body{}"},
+		{"logical name", "css/main.css", http.StatusOK, logicalCacheControl, "body{}"},
+		{"hashed name from an earlier deploy", stale, http.StatusNotFound, "", ""},
+		{"unknown file", "css/other.css", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/static/"+tt.path, nil)
+			r.URL.Path = tt.path // as after http.StripPrefix
+
+			m.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status %d; want %d", rr.Code, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("Cache-Control %q; want %q", got, tt.wantCache)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantContains) {
+				t.Errorf("body %q; want it to contain %q", rr.Body.String(), tt.wantContains)
+			}
+		})
+	}
+}
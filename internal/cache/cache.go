@@ -0,0 +1,57 @@
+// Package cache provides a small in-memory cache whose entries expire a
+// fixed time after they are stored.
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"snippet.robertgleason.ca/internal/clock"
+)
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// TTLCache holds values for ttl after each is Set. Expired entries are
+// removed when they are next looked up. It is safe for concurrent use.
+type TTLCache[K comparable, V any] struct {
+	ttl   time.Duration
+	clock clock.Clock
+	m     sync.Map // K -> *entry[V]
+}
+
+// New returns an empty TTLCache. A nil clk uses the real time.
+func New[K comparable, V any](ttl time.Duration, clk clock.Clock) *TTLCache[K, V] {
+	return &TTLCache[K, V]{ttl: ttl, clock: clock.OrReal(clk)}
+}
+
+// Get returns the value stored under key and true, or the zero value and
+// false if there is none or it has expired.
+func (c *TTLCache[K, V]) Get(key K) (V, bool) {
+	v, ok := c.m.Load(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	e := v.(*entry[V])
+	if !c.clock.Now().Before(e.expires) {
+		// Only remove the entry read above, not one Set since.
+		c.m.CompareAndDelete(key, v)
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key, replacing any earlier value.
+func (c *TTLCache[K, V]) Set(key K, value V) {
+	c.m.Store(key, &entry[V]{value: value, expires: c.clock.Now().Add(c.ttl)})
+}
+
+// Delete removes the value stored under key, if any.
+func (c *TTLCache[K, V]) Delete(key K) {
+	c.m.Delete(key)
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"snippet.robertgleason.ca/internal/clock"
+)
+
+func TestTTLCache(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	c := New[string, []int](30*time.Second, clk)
+
+	if _, ok := c.Get("latest"); ok {
+		t.Fatal("Get on an empty cache found a value")
+	}
+
+	c.Set("latest", []int{1, 2})
+	clk.Advance(29 * time.Second)
+	if got, ok := c.Get("latest"); !ok || len(got) != 2 {
+		t.Errorf("Get before the TTL = %v, %t; want [1 2], true", got, ok)
+	}
+
+	clk.Advance(time.Second)
+	if got, ok := c.Get("latest"); ok {
+		t.Errorf("Get at the TTL = %v, true; want a miss", got)
+	}
+
+	c.Set("latest", []int{3})
+	c.Delete("latest")
+	if _, ok := c.Get("latest"); ok {
+		t.Error("Get after Delete found a value")
+	}
+}
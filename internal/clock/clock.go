@@ -0,0 +1,69 @@
+// Package clock provides the source of the current time, so that code which
+// depends on "now" can be run against a fixed time in tests.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the production Clock backed by time.Now.
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Fixed is a Clock that is always at the same time, for tests that never
+// need the time to move.
+type Fixed time.Time
+
+func (c Fixed) Now() time.Time {
+	return time.Time(c)
+}
+
+// Fake is a Clock that only moves when told to. It is safe for concurrent
+// use.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake returns a Fake clock frozen at now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to now.
+func (c *Fake) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d.
+func (c *Fake) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// OrReal returns c, or Real if c is nil, for types whose zero value should
+// use the real time.
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real{}
+	}
+	return c
+}
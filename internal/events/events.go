@@ -0,0 +1,156 @@
+// Package events emits business events, such as a snippet being created or a
+// login failing, as structured log entries. Every entry carries an "event"
+// attribute naming it, and each event has a fixed set of attribute names and
+// types so that alerts built on them keep working.
+package events
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Key is the attribute that names the event in every entry.
+const Key = "event"
+
+// Event names.
+const (
+	NameSnippetCreated        = "snippet_created"
+	NameSnippetDeleted        = "snippet_deleted"
+	NameUserSignedUp          = "user_signed_up"
+	NameLoginFailed           = "login_failed"
+	NameQuotaExceeded         = "quota_exceeded"
+	NameWebhookDeliveryFailed = "webhook_delivery_failed"
+	NameSpamFiltered          = "spam_filtered"
+)
+
+// OwnerType says who owns a snippet.
+type OwnerType string
+
+const (
+	OwnerUser      OwnerType = "user"
+	OwnerAnonymous OwnerType = "anonymous"
+)
+
+// LoginFailure says why a login attempt failed.
+type LoginFailure string
+
+const (
+	LoginInvalidInput       LoginFailure = "invalid_input"
+	LoginInvalidCredentials LoginFailure = "invalid_credentials"
+)
+
+func emit(ctx context.Context, logger *slog.Logger, level slog.Level, name string, attrs ...slog.Attr) {
+	logger.LogAttrs(ctx, level, name, append([]slog.Attr{slog.String(Key, name)}, attrs...)...)
+}
+
+// SnippetCreated records a new snippet of size bytes that expires after
+// expiresDays days.
+func SnippetCreated(ctx context.Context, logger *slog.Logger, id, size, expiresDays int, owner OwnerType) {
+	emit(ctx, logger, slog.LevelInfo, NameSnippetCreated,
+		slog.Int("snippet_id", id),
+		slog.Int("size_bytes", size),
+		slog.Int("expires_days", expiresDays),
+		slog.String("owner_type", string(owner)),
+	)
+}
+
+// SnippetDeleted records the removal of a snippet for reason, such as
+// "expired" or "owner".
+func SnippetDeleted(ctx context.Context, logger *slog.Logger, id int, reason string) {
+	emit(ctx, logger, slog.LevelInfo, NameSnippetDeleted,
+		slog.Int("snippet_id", id),
+		slog.String("reason", reason),
+	)
+}
+
+// UserSignedUp records a new account.
+func UserSignedUp(ctx context.Context, logger *slog.Logger) {
+	emit(ctx, logger, slog.LevelInfo, NameUserSignedUp)
+}
+
+// LoginFailed records a failed login from client, an opaque identifier for
+// the remote address such as models.IPOwnerKey.
+func LoginFailed(ctx context.Context, logger *slog.Logger, reason LoginFailure, client string) {
+	emit(ctx, logger, slog.LevelWarn, NameLoginFailed,
+		slog.String("reason", string(reason)),
+		slog.String("client", client),
+	)
+}
+
+// QuotaExceeded records that owner, a quota owner key, was refused a snippet
+// after creating count of its limit.
+func QuotaExceeded(ctx context.Context, logger *slog.Logger, owner string, limit, count int) {
+	emit(ctx, logger, slog.LevelWarn, NameQuotaExceeded,
+		slog.String("owner", owner),
+		slog.Int("limit", limit),
+		slog.Int("count", count),
+	)
+}
+
+// WebhookDeliveryFailed records a webhook delivery to url that failed after
+// attempts tries and took elapsed in total.
+func WebhookDeliveryFailed(ctx context.Context, logger *slog.Logger, url string, attempts int, elapsed time.Duration, err error) {
+	emit(ctx, logger, slog.LevelWarn, NameWebhookDeliveryFailed,
+		slog.String("url", url),
+		slog.Int("attempts", attempts),
+		slog.Duration("elapsed", elapsed),
+		slog.String("error", err.Error()),
+	)
+}
+
+// OnlyEvents returns a handler that passes entries carrying the Key attribute
+// to next and discards the rest, so events can be written to their own output.
+func OnlyEvents(next slog.Handler) slog.Handler {
+	return &filter{next: next}
+}
+
+type filter struct {
+	next slog.Handler
+	// event is set once Key has been added with WithAttrs, after which
+	// every entry is an event.
+	event bool
+}
+
+func (f *filter) Enabled(ctx context.Context, level slog.Level) bool {
+	return f.next.Enabled(ctx, level)
+}
+
+func (f *filter) Handle(ctx context.Context, r slog.Record) error {
+	event := f.event
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == Key {
+			event = true
+		}
+		return !event
+	})
+	if !event {
+		return nil
+	}
+	return f.next.Handle(ctx, r)
+}
+
+func (f *filter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	event := f.event
+	for _, a := range attrs {
+		if a.Key == Key {
+			event = true
+		}
+	}
+	return &filter{next: f.next.WithAttrs(attrs), event: event}
+}
+
+func (f *filter) WithGroup(name string) slog.Handler {
+	return &filter{next: f.next.WithGroup(name), event: f.event}
+}
+
+// SpamFiltered records that the spam filter took action on a snippet because
+// it matched rule. id is 0 when the snippet was rejected and never saved.
+func SpamFiltered(ctx context.Context, logger *slog.Logger, id int, action, rule, detail string) {
+	emit(ctx, logger, slog.LevelWarn, NameSpamFiltered,
+		slog.Int("snippet_id", id),
+		slog.String("action", action),
+		slog.String("rule", rule),
+		slog.String("detail", detail),
+	)
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// recorder is a slog.Handler that keeps every record it is given.
+type recorder struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recorder) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recorder) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *recorder) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recorder) WithGroup(string) slog.Handler      { return h }
+
+// attrs returns the attributes of r by key.
+func attrs(r slog.Record) map[string]slog.Value {
+	m := map[string]slog.Value{}
+	r.Attrs(func(a slog.Attr) bool {
+		m[a.Key] = a.Value
+		return true
+	})
+	return m
+}
+
+func TestEvents(t *testing.T) {
+	tests := []struct {
+		name  string
+		emit  func(context.Context, *slog.Logger)
+		level slog.Level
+		event string
+		want  map[string]slog.Value
+	}{
+		{
+			name: "snippet created",
+			emit: func(ctx context.Context, logger *slog.Logger) {
+				SnippetCreated(ctx, logger, 42, 1024, 7, OwnerAnonymous)
+			},
+			level: slog.LevelInfo,
+			event: NameSnippetCreated,
+			want: map[string]slog.Value{
+				"snippet_id":   slog.IntValue(42),
+				"size_bytes":   slog.IntValue(1024),
+				"expires_days": slog.IntValue(7),
+				"owner_type":   slog.StringValue("anonymous"),
+			},
+		},
+		{
+			name: "login failed",
+			emit: func(ctx context.Context, logger *slog.Logger) {
+				LoginFailed(ctx, logger, LoginInvalidCredentials, "ip:abc123")
+			},
+			level: slog.LevelWarn,
+			event: NameLoginFailed,
+			want: map[string]slog.Value{
+				"reason": slog.StringValue("invalid_credentials"),
+				"client": slog.StringValue("ip:abc123"),
+			},
+		},
+		{
+			name: "spam filtered",
+			emit: func(ctx context.Context, logger *slog.Logger) {
+				SpamFiltered(ctx, logger, 0, "reject", "words", "free money")
+			},
+			level: slog.LevelWarn,
+			event: NameSpamFiltered,
+			want: map[string]slog.Value{
+				"snippet_id": slog.IntValue(0),
+				"action":     slog.StringValue("reject"),
+				"rule":       slog.StringValue("words"),
+				"detail":     slog.StringValue("free money"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &recorder{}
+			tt.emit(context.Background(), slog.New(h))
+
+			if len(h.records) != 1 {
+				t.Fatalf("%d entries; want 1", len(h.records))
+			}
+			r := h.records[0]
+			if r.Message != tt.event || r.Level != tt.level {
+				t.Errorf("entry %q at %s; want %q at %s", r.Message, r.Level, tt.event, tt.level)
+			}
+
+			got := attrs(r)
+			want := map[string]slog.Value{Key: slog.StringValue(tt.event)}
+			for k, v := range tt.want {
+				want[k] = v
+			}
+			if len(got) != len(want) {
+				t.Errorf("attributes %v; want %v", got, want)
+			}
+			for k, v := range want {
+				// Equal compares kinds too, so an int logged as a string fails.
+				if !got[k].Equal(v) {
+					t.Errorf("%s = %v (%s); want %v (%s)", k, got[k], got[k].Kind(), v, v.Kind())
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookDeliveryFailed(t *testing.T) {
+	h := &recorder{}
+	WebhookDeliveryFailed(context.Background(), slog.New(h), "https://example.com/hook", 3, 0, errors.New("timeout"))
+
+	got := attrs(h.records[0])
+	if got[Key].String() != NameWebhookDeliveryFailed || got["error"].String() != "timeout" || got["elapsed"].Kind() != slog.KindDuration {
+		t.Errorf("attributes %v", got)
+	}
+}
+
+func TestOnlyEvents(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(OnlyEvents(slog.NewJSONHandler(&buf, nil)))
+
+	logger.Info("request", "path", "/")
+	SnippetCreated(context.Background(), logger, 1, 10, 1, OwnerUser)
+	logger.With(Key, "custom").Info("custom event")
+	logger.With("component", "web").Info("not an event")
+
+	var got []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry map[string]any
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, entry["msg"].(string))
+	}
+	want := []string{NameSnippetCreated, "custom event"}
+	if !slices.Equal(got, want) {
+		t.Errorf("logged %q; want only the events %q", got, want)
+	}
+}
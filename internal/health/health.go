@@ -0,0 +1,116 @@
+package health
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"snippet.robertgleason.ca/internal/clock"
+)
+
+// staleFactor is the number of missed intervals after which a component is
+// considered stale.
+const staleFactor = 3
+
+type component struct {
+	interval time.Duration
+	lastBeat time.Time
+}
+
+// Status is a point-in-time view of a registered component.
+type Status struct {
+	Interval time.Duration `json:"interval"`
+	LastBeat time.Time     `json:"last_beat"`
+	Stale    bool          `json:"stale"`
+}
+
+// Registry tracks heartbeats from long-running components such as background
+// workers. It is safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	components map[string]*component
+	clock      clock.Clock
+}
+
+func NewRegistry() *Registry {
+	return NewRegistryWithClock(clock.Real{})
+}
+
+// NewRegistryWithClock returns a Registry that reads the time from clk, so
+// that staleness can be tested without waiting.
+func NewRegistryWithClock(clk clock.Clock) *Registry {
+	return &Registry{components: make(map[string]*component), clock: clk}
+}
+
+// Register adds a component that is expected to call Beat at least once per
+// interval. Registering counts as the first heartbeat.
+func (r *Registry) Register(name string, interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.components[name] = &component{interval: interval, lastBeat: r.clock.Now()}
+}
+
+// Deregister removes a component, typically on clean shutdown, so that it is
+// no longer reported as stale.
+func (r *Registry) Deregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.components, name)
+}
+
+// Beat records a heartbeat for the named component. Beats for components
+// that have not been registered are ignored.
+func (r *Registry) Beat(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.components[name]; ok {
+		c.lastBeat = r.clock.Now()
+	}
+}
+
+// Stale returns the sorted names of components whose last heartbeat is older
+// than three times their declared interval.
+func (r *Registry) Stale() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+	now := r.clock.Now()
+	for name, c := range r.components {
+		if isStale(c, now) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Snapshot returns the status of every registered component.
+func (r *Registry) Snapshot() map[string]Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.clock.Now()
+	snapshot := make(map[string]Status, len(r.components))
+	for name, c := range r.components {
+		snapshot[name] = Status{
+			Interval: c.interval,
+			LastBeat: c.lastBeat,
+			Stale:    isStale(c, now),
+		}
+	}
+	return snapshot
+}
+
+func isStale(c *component, now time.Time) bool {
+	return now.Sub(c.lastBeat) > staleFactor*c.interval
+}
+
+// Default is the registry used by the package-level helpers.
+var Default = NewRegistry()
+
+func Register(name string, interval time.Duration) { Default.Register(name, interval) }
+
+func Deregister(name string) { Default.Deregister(name) }
+
+func Beat(name string) { Default.Beat(name) }
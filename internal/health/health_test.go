@@ -0,0 +1,85 @@
+package health
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"snippet.robertgleason.ca/internal/clock"
+)
+
+func TestRegistryStale(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	r := NewRegistryWithClock(clk)
+
+	r.Register("sweeper", time.Minute)
+	r.Register("refresher", 10*time.Second)
+
+	if stale := r.Stale(); len(stale) != 0 {
+		t.Fatalf("Stale() = %v just after registering; want none", stale)
+	}
+
+	// A component is stale only once more than three intervals have passed.
+	clk.Advance(30 * time.Second)
+	if stale := r.Stale(); len(stale) != 0 {
+		t.Errorf("Stale() = %v at three intervals; want none", stale)
+	}
+	clk.Advance(time.Nanosecond)
+	if stale := r.Stale(); !slices.Equal(stale, []string{"refresher"}) {
+		t.Errorf("Stale() = %v; want [refresher]", stale)
+	}
+
+	r.Beat("refresher")
+	if stale := r.Stale(); len(stale) != 0 {
+		t.Errorf("Stale() = %v after a beat; want none", stale)
+	}
+
+	clk.Advance(4 * time.Minute)
+	if stale := r.Stale(); !slices.Equal(stale, []string{"refresher", "sweeper"}) {
+		t.Errorf("Stale() = %v; want both, sorted", stale)
+	}
+
+	r.Deregister("sweeper")
+	if stale := r.Stale(); !slices.Equal(stale, []string{"refresher"}) {
+		t.Errorf("Stale() = %v after deregistering sweeper; want [refresher]", stale)
+	}
+}
+
+func TestRegistryBeatUnregistered(t *testing.T) {
+	r := NewRegistryWithClock(clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)))
+
+	r.Beat("ghost")
+	if snapshot := r.Snapshot(); len(snapshot) != 0 {
+		t.Errorf("Snapshot() = %v; want a beat without Register ignored", snapshot)
+	}
+}
+
+func TestRegistrySnapshot(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	r := NewRegistryWithClock(clk)
+
+	r.Register("sweeper", time.Minute)
+	clk.Advance(2 * time.Minute)
+	r.Register("refresher", time.Second)
+	clk.Advance(2 * time.Minute)
+
+	want := map[string]Status{
+		"sweeper":   {Interval: time.Minute, LastBeat: start, Stale: true},
+		"refresher": {Interval: time.Second, LastBeat: start.Add(2 * time.Minute), Stale: true},
+	}
+	got := r.Snapshot()
+	if len(got) != len(want) {
+		t.Fatalf("Snapshot() = %v; want %v", got, want)
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("Snapshot()[%q] = %+v; want %+v", name, got[name], status)
+		}
+	}
+
+	r.Beat("sweeper")
+	if status := r.Snapshot()["sweeper"]; status.Stale || !status.LastBeat.Equal(start.Add(4*time.Minute)) {
+		t.Errorf("sweeper after a beat = %+v; want fresh at the current time", status)
+	}
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Bundle is a set of snippets handed out under one link. SnippetIDs are in
+// the order they were added. Members are not looked up with the bundle, so
+// that a member which has since expired or been removed can be shown as
+// unavailable rather than hiding the whole bundle.
+type Bundle struct {
+	ID         int
+	Token      string
+	UserID     int
+	Title      string
+	Created    time.Time
+	Expires    time.Time
+	SnippetIDs []int
+}
+
+// CreateBundle stores a bundle of the snippets with the given IDs under a
+// new random token. The bundle expires with the first of its snippets, or at
+// expires if that is sooner and not zero. An ID that is not an unexpired
+// snippet is reported as a NotFoundError. ids must not be empty.
+func (m *SnippetModel) CreateBundle(ctx context.Context, userID int, title string, ids []int, expires time.Time) (Bundle, error) {
+	defer m.observe("snippets.CreateBundle", time.Now())
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Bundle{}, wrapLogged(m.Logger, "snippets.CreateBundle", err)
+	}
+	defer tx.Rollback()
+
+	b := Bundle{Token: rand.Text(), UserID: userID, Title: title, SnippetIDs: ids}
+
+	err = tx.QueryRowContext(ctx, `SELECT UTC_TIMESTAMP()`).Scan(&b.Created)
+	if err != nil {
+		return Bundle{}, wrapLogged(m.Logger, "snippets.CreateBundle", err)
+	}
+
+	// Lock the members so that none is removed before the bundle is stored.
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	stmt := `SELECT id, expires FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND archived = FALSE AND id IN (?` + strings.Repeat(", ?", max(len(ids)-1, 0)) + `)
+	FOR UPDATE`
+
+	rows, err := tx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return Bundle{}, wrapLogged(m.Logger, "snippets.CreateBundle", err)
+	}
+	defer rows.Close()
+
+	found := make(map[int]bool, len(ids))
+	if !expires.IsZero() {
+		b.Expires = expires.UTC().Truncate(time.Second)
+	}
+	for rows.Next() {
+		var id int
+		var memberExpires time.Time
+		err = rows.Scan(&id, &memberExpires)
+		if err != nil {
+			return Bundle{}, wrapLogged(m.Logger, "snippets.CreateBundle", err)
+		}
+		found[id] = true
+		if b.Expires.IsZero() || memberExpires.Before(b.Expires) {
+			b.Expires = memberExpires
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return Bundle{}, wrapLogged(m.Logger, "snippets.CreateBundle", err)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if !found[id] {
+			return Bundle{}, &NotFoundError{Entity: "snippet", ID: id}
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO bundles (token, user_id, title, created, expires) VALUES (?, ?, ?, ?, ?)`,
+		b.Token, b.UserID, b.Title, b.Created, b.Expires)
+	if err != nil {
+		return Bundle{}, wrapLogged(m.Logger, "snippets.CreateBundle", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Bundle{}, wrapLogged(m.Logger, "snippets.CreateBundle", err)
+	}
+	b.ID = int(id)
+
+	for i, snippetID := range ids {
+		_, err = tx.ExecContext(ctx, `INSERT INTO bundle_snippets (bundle_id, position, snippet_id) VALUES (?, ?, ?)`,
+			b.ID, i, snippetID)
+		if err != nil {
+			return Bundle{}, wrapLogged(m.Logger, "snippets.CreateBundle", err)
+		}
+	}
+
+	return b, wrapLogged(m.Logger, "snippets.CreateBundle", tx.Commit())
+}
+
+// GetBundle returns the unexpired bundle with the given token, or
+// ErrNoRecord.
+func (m *SnippetModel) GetBundle(ctx context.Context, token string) (Bundle, error) {
+	defer m.observe("snippets.GetBundle", time.Now())
+
+	b := Bundle{Token: token}
+
+	stmt := `SELECT id, user_id, title, created, expires FROM bundles
+	WHERE token = ? AND expires > UTC_TIMESTAMP()`
+
+	err := m.DB.QueryRowContext(ctx, stmt, token).Scan(&b.ID, &b.UserID, &b.Title, &b.Created, &b.Expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Bundle{}, ErrNoRecord
+		}
+		return Bundle{}, wrapLogged(m.Logger, "snippets.GetBundle", err)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT snippet_id FROM bundle_snippets WHERE bundle_id = ? ORDER BY position`, b.ID)
+	if err != nil {
+		return Bundle{}, wrapLogged(m.Logger, "snippets.GetBundle", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return Bundle{}, wrapLogged(m.Logger, "snippets.GetBundle", err)
+		}
+		b.SnippetIDs = append(b.SnippetIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		return Bundle{}, wrapLogged(m.Logger, "snippets.GetBundle", err)
+	}
+
+	return b, nil
+}
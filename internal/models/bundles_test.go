@@ -0,0 +1,68 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSnippetModelBundles(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	email := fmt.Sprintf("bundles-%d@example.com", time.Now().UnixNano())
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Bundler', ?, '', UTC_TIMESTAMP())`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := result.LastInsertId()
+	t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE id = ?`, userID) })
+
+	var ids []int
+	for _, expires := range []int{7, 1, 30} {
+		id, err := m.Insert(t.Context(), "Bundled", "A haiku.", expires, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+		ids = append(ids, id)
+	}
+
+	b, err := m.CreateBundle(t.Context(), int(userID), "Workshop", ids, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Expires.Sub(b.Created).Round(time.Hour); got != 24*time.Hour {
+		t.Errorf("bundle lasts %s; want the shortest member's 24h", got)
+	}
+
+	got, err := m.GetBundle(t.Context(), b.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != b.ID || got.Title != "Workshop" || !slices.Equal(got.SnippetIDs, ids) {
+		t.Errorf("GetBundle = %+v; want %+v", got, b)
+	}
+
+	soon := time.Now().Add(time.Hour)
+	b, err = m.CreateBundle(t.Context(), int(userID), "Short", ids[:1], soon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Expires.Equal(soon.UTC().Truncate(time.Second)) {
+		t.Errorf("bundle expires %s; want the explicit %s", b.Expires, soon)
+	}
+
+	_, err = m.CreateBundle(t.Context(), int(userID), "Missing", []int{ids[0], -1}, time.Time{})
+	var nf *NotFoundError
+	if !errors.As(err, &nf) || nf.ID != -1 {
+		t.Errorf("CreateBundle with a missing snippet: err = %v; want NotFoundError for -1", err)
+	}
+
+	_, err = m.GetBundle(t.Context(), "no-such-token")
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("GetBundle(unknown) err = %v; want ErrNoRecord", err)
+	}
+}
@@ -0,0 +1,221 @@
+// Package cached wraps a models.SnippetModelInterface to cut the database
+// round trips caused by repeated lookups of the same snippet ID.
+package cached
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"snippet.robertgleason.ca/internal/models"
+)
+
+// SnippetModel deduplicates concurrent Get calls for the same ID, so they
+// share a single query, and remembers IDs recently confirmed missing so that
+// repeated probes for them are answered without a query. Every other method
+// is passed straight through to the wrapped model.
+type SnippetModel struct {
+	models.SnippetModelInterface
+
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	calls   map[int]*call
+	missing map[int]time.Time // ID -> when the entry expires
+	epoch   uint64            // incremented by every Insert
+
+	queries      expvar.Int
+	shared       expvar.Int
+	negativeHits expvar.Int
+	evictions    expvar.Int
+}
+
+var _ models.SnippetModelInterface = (*SnippetModel)(nil)
+
+// call is a Get in progress. Callers that arrive while it runs wait for done
+// to be closed and receive the same result.
+type call struct {
+	done    chan struct{}
+	snippet models.Snippet
+	err     error
+}
+
+// NewSnippetModel wraps next. Up to size missing IDs are remembered for ttl;
+// a size or ttl of zero disables the negative cache but keeps the
+// deduplication.
+func NewSnippetModel(next models.SnippetModelInterface, size int, ttl time.Duration) *SnippetModel {
+	return &SnippetModel{
+		SnippetModelInterface: next,
+		size:                  size,
+		ttl:                   ttl,
+		now:                   time.Now,
+		calls:                 map[int]*call{},
+		missing:               map[int]time.Time{},
+	}
+}
+
+// Insert stores the snippet and forgets any earlier miss for its ID, which
+// matters because IDs are sequential and so can be probed before they exist.
+func (m *SnippetModel) Insert(ctx context.Context, title string, content string, expires int, userID int) (int, error) {
+	id, err := m.SnippetModelInterface.Insert(ctx, title, content, expires, userID)
+
+	m.mu.Lock()
+	m.epoch++
+	if err == nil {
+		delete(m.missing, id)
+	}
+	m.mu.Unlock()
+
+	return id, err
+}
+
+// GetOrCreate forgets any earlier miss for the ID it returns, as Insert does.
+func (m *SnippetModel) GetOrCreate(ctx context.Context, title, content string, expires, userID int) (int, bool, error) {
+	id, created, err := m.SnippetModelInterface.GetOrCreate(ctx, title, content, expires, userID)
+
+	m.mu.Lock()
+	m.epoch++
+	if err == nil {
+		delete(m.missing, id)
+	}
+	m.mu.Unlock()
+
+	return id, created, err
+}
+
+// Duplicate forgets any earlier miss for the new snippet's ID, as Insert
+// does.
+func (m *SnippetModel) Duplicate(ctx context.Context, id, userID int) (int, error) {
+	newID, err := m.SnippetModelInterface.Duplicate(ctx, id, userID)
+
+	m.mu.Lock()
+	m.epoch++
+	if err == nil {
+		delete(m.missing, newID)
+	}
+	m.mu.Unlock()
+
+	return newID, err
+}
+
+// Unarchive forgets any earlier miss for the snippet, which Get could not
+// see while it was archived.
+func (m *SnippetModel) Unarchive(ctx context.Context, id, userID int) error {
+	err := m.SnippetModelInterface.Unarchive(ctx, id, userID)
+
+	m.mu.Lock()
+	m.epoch++
+	if err == nil {
+		delete(m.missing, id)
+	}
+	m.mu.Unlock()
+
+	return err
+}
+
+// Get runs the query with the context of the caller that started it. A caller
+// that is waiting for it stops waiting when its own ctx is done, and queries
+// again itself if the shared query was cancelled.
+func (m *SnippetModel) Get(ctx context.Context, id int) (models.Snippet, error) {
+	m.mu.Lock()
+
+	if expires, ok := m.missing[id]; ok {
+		if m.now().Before(expires) {
+			m.mu.Unlock()
+			m.negativeHits.Add(1)
+			return models.Snippet{}, &models.NotFoundError{Entity: "snippet", ID: id}
+		}
+		delete(m.missing, id)
+	}
+
+	if c, ok := m.calls[id]; ok {
+		m.mu.Unlock()
+		m.shared.Add(1)
+
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return models.Snippet{}, ctx.Err()
+		}
+
+		if (errors.Is(c.err, context.Canceled) || errors.Is(c.err, context.DeadlineExceeded)) && ctx.Err() == nil {
+			m.queries.Add(1)
+			return m.SnippetModelInterface.Get(ctx, id)
+		}
+		return c.snippet, c.err
+	}
+
+	c := &call{done: make(chan struct{})}
+	m.calls[id] = c
+	epoch := m.epoch
+	m.mu.Unlock()
+
+	m.queries.Add(1)
+	c.snippet, c.err = m.SnippetModelInterface.Get(ctx, id)
+
+	m.mu.Lock()
+	delete(m.calls, id)
+	// A snippet inserted while the query ran may be the one that was
+	// missing, so only remember the miss if nothing was inserted meanwhile.
+	if errors.Is(c.err, models.ErrNoRecord) && epoch == m.epoch {
+		m.rememberMissing(id)
+	}
+	m.mu.Unlock()
+
+	close(c.done)
+
+	return c.snippet, c.err
+}
+
+// rememberMissing adds id to the negative cache, evicting the entry closest
+// to expiry if it is full. m.mu must be held.
+func (m *SnippetModel) rememberMissing(id int) {
+	if m.size <= 0 || m.ttl <= 0 {
+		return
+	}
+
+	now := m.now()
+
+	if len(m.missing) >= m.size {
+		for missingID, expires := range m.missing {
+			if !now.Before(expires) {
+				delete(m.missing, missingID)
+			}
+		}
+	}
+
+	for len(m.missing) >= m.size {
+		var (
+			oldestID int
+			oldest   time.Time
+		)
+		for missingID, expires := range m.missing {
+			if oldest.IsZero() || expires.Before(oldest) {
+				oldestID, oldest = missingID, expires
+			}
+		}
+		delete(m.missing, oldestID)
+		m.evictions.Add(1)
+	}
+
+	m.missing[id] = now.Add(m.ttl)
+}
+
+// Metrics returns the cache counters, for publishing with expvar.
+func (m *SnippetModel) Metrics() map[string]int64 {
+	m.mu.Lock()
+	size := len(m.missing)
+	m.mu.Unlock()
+
+	return map[string]int64{
+		"queries":       m.queries.Value(),
+		"shared":        m.shared.Value(),
+		"negative_hits": m.negativeHits.Value(),
+		"evictions":     m.evictions.Value(),
+		"missing_ids":   int64(size),
+	}
+}
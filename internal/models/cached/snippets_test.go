@@ -0,0 +1,143 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"snippet.robertgleason.ca/internal/models"
+)
+
+// stubModel serves snippets 1 to 10 and reports every other ID as missing.
+// Get blocks until release is closed, if it is set.
+type stubModel struct {
+	models.SnippetModelInterface
+
+	release chan struct{}
+	queries atomic.Int64
+	lastID  atomic.Int64
+}
+
+func (s *stubModel) Get(ctx context.Context, id int) (models.Snippet, error) {
+	s.queries.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	if id < 1 || id > 10 {
+		return models.Snippet{}, &models.NotFoundError{Entity: "snippet", ID: id}
+	}
+	return models.Snippet{ID: id}, nil
+}
+
+func (s *stubModel) Insert(ctx context.Context, title, content string, expires, userID int) (int, error) {
+	return int(s.lastID.Add(1)), nil
+}
+
+func TestGetSharesQuery(t *testing.T) {
+	const callers = 10
+
+	stub := &stubModel{release: make(chan struct{})}
+	m := NewSnippetModel(stub, 10, time.Minute)
+
+	var wg sync.WaitGroup
+	results := make([]models.Snippet, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Go(func() {
+			results[i], errs[i] = m.Get(context.Background(), 1)
+		})
+	}
+
+	// Hold the query until every other caller is waiting on it.
+	deadline := time.Now().Add(5 * time.Second)
+	for m.shared.Value() < callers-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d callers waiting on the query; want %d", m.shared.Value(), callers-1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(stub.release)
+	wg.Wait()
+
+	if got := stub.queries.Load(); got != 1 {
+		t.Errorf("%d queries; want 1", got)
+	}
+	for i := range callers {
+		if errs[i] != nil || results[i].ID != 1 {
+			t.Errorf("caller %d got %+v, %v; want snippet 1", i, results[i], errs[i])
+		}
+	}
+}
+
+func TestGetRemembersMissing(t *testing.T) {
+	stub := &stubModel{}
+	m := NewSnippetModel(stub, 10, time.Minute)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	for range 3 {
+		_, err := m.Get(context.Background(), 11)
+		if !errors.Is(err, models.ErrNoRecord) {
+			t.Fatalf("Get(11) error = %v; want ErrNoRecord", err)
+		}
+	}
+	if got := stub.queries.Load(); got != 1 {
+		t.Errorf("%d queries for a missing ID; want 1", got)
+	}
+
+	now = now.Add(time.Minute)
+	m.Get(context.Background(), 11)
+	if got := stub.queries.Load(); got != 2 {
+		t.Errorf("%d queries after the miss expired; want 2", got)
+	}
+
+	// Inserting the missing ID forgets the miss.
+	stub.lastID.Store(10)
+	if _, err := m.Insert(context.Background(), "title", "content", 7, 0); err != nil {
+		t.Fatal(err)
+	}
+	m.Get(context.Background(), 11)
+	if got := stub.queries.Load(); got != 3 {
+		t.Errorf("%d queries after inserting the ID; want 3", got)
+	}
+}
+
+// TestConcurrentAccess mixes Get, Insert and Metrics calls across
+// goroutines, for go test -race to check the locking.
+func TestConcurrentAccess(t *testing.T) {
+	stub := &stubModel{}
+	m := NewSnippetModel(stub, 4, time.Minute)
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Go(func() {
+			for i := range 200 {
+				switch i % 10 {
+				case 0:
+					if _, err := m.Insert(context.Background(), "title", "content", 7, 0); err != nil {
+						t.Error(err)
+					}
+				case 1:
+					m.Metrics()
+				default:
+					id := (g+i)%20 + 1
+					s, err := m.Get(context.Background(), id)
+					switch {
+					case id <= 10 && (err != nil || s.ID != id):
+						t.Errorf("Get(%d) = %+v, %v; want the snippet", id, s, err)
+					case id > 10 && !errors.Is(err, models.ErrNoRecord):
+						t.Errorf("Get(%d) error = %v; want ErrNoRecord", id, err)
+					}
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	if size := m.Metrics()["missing_ids"]; size > 4 {
+		t.Errorf("%d missing IDs remembered; want at most 4", size)
+	}
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ContentStore holds snippet content outside the snippets.content column.
+// SnippetModel writes content larger than its ExternalThreshold to the store
+// and reads it back transparently.
+type ContentStore interface {
+	Put(ctx context.Context, id int, r io.Reader) error
+	Get(ctx context.Context, id int) (io.ReadCloser, error)
+	Delete(ctx context.Context, id int) error
+}
+
+// ContentLister is implemented by stores that can enumerate the IDs they
+// hold, which is required to sweep orphaned content.
+type ContentLister interface {
+	IDs(ctx context.Context) ([]int, error)
+}
+
+// ContentColumnBytes is the most the snippets.content column, a MEDIUMTEXT,
+// holds. Content stored in the database, whether inline or through
+// DBContentStore, must fit in it.
+const ContentColumnBytes = 1<<24 - 1
+
+// DBContentStore is the default ContentStore. It keeps content in the
+// snippets.content column, so it never holds orphans.
+type DBContentStore struct {
+	DB *sql.DB
+}
+
+func (s *DBContentStore) Put(ctx context.Context, id int, r io.Reader) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.ExecContext(ctx, `UPDATE snippets SET content = ? WHERE id = ?`, content, id)
+	return err
+}
+
+func (s *DBContentStore) Get(ctx context.Context, id int) (io.ReadCloser, error) {
+	var content string
+	err := s.DB.QueryRowContext(ctx, `SELECT content FROM snippets WHERE id = ?`, id).Scan(&content)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError{Entity: "snippet content", ID: id}
+		}
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (s *DBContentStore) Delete(ctx context.Context, id int) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE snippets SET content = '' WHERE id = ?`, id)
+	return err
+}
@@ -1,9 +1,198 @@
 package models
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
 
 var (
 	ErrNoRecord           = errors.New("models: no matching records found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials provided")
 	ErrDuplicateEmail     = errors.New("models: duplicate email provided")
+	ErrDuplicateTitle     = errors.New("models: duplicate snippet title for user")
+	ErrDuplicateContent   = errors.New("models: duplicate snippet content for user")
+	ErrConstraint         = errors.New("models: constraint violation")
+	ErrInvalidDateRange   = errors.New("models: invalid date range")
+	ErrInvalidInput       = errors.New("models: invalid input")
 )
+
+// NotFoundError reports that no record of Entity exists with the given ID.
+// It matches ErrNoRecord with errors.Is.
+type NotFoundError struct {
+	Entity string
+	ID     int
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %d not found", e.Entity, e.ID)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNoRecord
+}
+
+func (e *NotFoundError) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("entity", e.Entity), slog.Int("id", e.ID)}
+}
+
+// DuplicateError reports a unique key violation on Column. Err holds the
+// sentinel callers match against, such as ErrDuplicateEmail.
+type DuplicateError struct {
+	Entity string
+	Column string
+	Err    error
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("duplicate %s %s", e.Entity, e.Column)
+}
+
+func (e *DuplicateError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DuplicateError) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("entity", e.Entity), slog.String("column", e.Column)}
+}
+
+// ConstraintError reports any other integrity constraint violation (NOT NULL,
+// foreign key or CHECK) on Column. It matches ErrConstraint with errors.Is and
+// unwraps to the underlying driver error.
+type ConstraintError struct {
+	Entity string
+	Column string
+	Err    error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s %s violates a constraint: %v", e.Entity, e.Column, e.Err)
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	return target == ErrConstraint
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConstraintError) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("entity", e.Entity), slog.String("column", e.Column)}
+}
+
+// InvalidInputError reports an argument a model method rejected before
+// touching the database, with a Message fit to show the user next to Field.
+// It matches ErrInvalidInput with errors.Is.
+type InvalidInputError struct {
+	Entity  string
+	Field   string
+	Message string
+}
+
+func (e *InvalidInputError) Error() string {
+	return fmt.Sprintf("invalid %s %s: %s", e.Entity, e.Field, e.Message)
+}
+
+func (e *InvalidInputError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+func (e *InvalidInputError) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("entity", e.Entity), slog.String("field", e.Field)}
+}
+
+// constraintError converts MySQL NOT NULL (1048), foreign key (1452) and
+// CHECK (3819) violations into a ConstraintError for entity, and a duplicate
+// snippet title or content for its user (1062 on snippets_uc_user_title or
+// snippets_uc_user_content_hash) into a DuplicateError matching
+// ErrDuplicateTitle or ErrDuplicateContent. Other errors are returned
+// unchanged.
+func constraintError(entity string, err error) error {
+	var mySQLError *mysql.MySQLError
+	if !errors.As(err, &mySQLError) {
+		return err
+	}
+
+	switch mySQLError.Number {
+	case 1062:
+		if strings.Contains(mySQLError.Message, "snippets_uc_user_title") {
+			return &DuplicateError{Entity: entity, Column: "title", Err: ErrDuplicateTitle}
+		}
+		if strings.Contains(mySQLError.Message, "snippets_uc_user_content_hash") {
+			return &DuplicateError{Entity: entity, Column: "content", Err: ErrDuplicateContent}
+		}
+	case 1048, 1452, 3819:
+		return &ConstraintError{Entity: entity, Column: quotedName(mySQLError.Message), Err: err}
+	}
+	return err
+}
+
+// isDeadlock reports whether err is a MySQL deadlock (1213), after which the
+// transaction has been rolled back and can be retried.
+func isDeadlock(err error) bool {
+	var mySQLError *mysql.MySQLError
+	return errors.As(err, &mySQLError) && mySQLError.Number == 1213
+}
+
+// wrap annotates err with the model operation that failed, such as
+// "snippets.Get: ...", so that database errors can be traced to their source
+// while remaining matchable with errors.Is and errors.As. The sentinels and
+// typed errors above are already descriptive and are returned unchanged, as
+// is nil.
+func wrap(op string, err error) error {
+	if expected(err) {
+		return err
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// expected reports whether err is nil, one of the errors above or a
+// cancellation, which describe an outcome callers handle rather than a
+// failure.
+func expected(err error) bool {
+	switch err.(type) {
+	case nil, *NotFoundError, *DuplicateError, *ConstraintError, *InvalidInputError:
+		return true
+	}
+
+	switch err {
+	case ErrNoRecord, ErrInvalidCredentials, ErrDuplicateEmail, ErrDuplicateTitle, ErrDuplicateContent, ErrConstraint, ErrInvalidDateRange, ErrInvalidInput:
+		return true
+	}
+
+	// A cancelled request, usually a client that went away, is not a database
+	// failure. A deadline that expires is, so it is still logged.
+	return errors.Is(err, context.Canceled)
+}
+
+// wrapLogged is wrap that also logs unexpected errors to logger, if it is
+// not nil, so that database failures appear in the db log stream with the
+// operation that caused them.
+func wrapLogged(logger *slog.Logger, op string, err error) error {
+	if logger != nil && !expected(err) {
+		logger.Error("database operation failed", "op", op, "error", err.Error())
+	}
+	return wrap(op, err)
+}
+
+// quotedName returns the first back- or single-quoted identifier in a MySQL
+// error message, which is the offending column or constraint.
+func quotedName(msg string) string {
+	for _, quote := range []string{"`", "'"} {
+		start := strings.Index(msg, quote)
+		if start == -1 {
+			continue
+		}
+		end := strings.Index(msg[start+1:], quote)
+		if end == -1 {
+			continue
+		}
+		return msg[start+1 : start+1+end]
+	}
+	return ""
+}
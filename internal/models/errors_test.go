@@ -0,0 +1,144 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var sentinels = []error{
+	ErrNoRecord,
+	ErrInvalidCredentials,
+	ErrDuplicateEmail,
+	ErrDuplicateTitle,
+	ErrDuplicateContent,
+	ErrConstraint,
+	ErrInvalidDateRange,
+	ErrInvalidInput,
+}
+
+// matches returns the sentinels err matches with errors.Is.
+func matches(err error) []error {
+	var got []error
+	for _, sentinel := range sentinels {
+		if errors.Is(err, sentinel) {
+			got = append(got, sentinel)
+		}
+	}
+	return got
+}
+
+func TestTypedErrorsIs(t *testing.T) {
+	driverErr := &mysql.MySQLError{Number: 1048, Message: "Column 'title' cannot be null"}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"not found", &NotFoundError{Entity: "snippet", ID: 1}, ErrNoRecord},
+		{"invalid input", &InvalidInputError{Entity: "snippet", Field: "title", Message: "too long"}, ErrInvalidInput},
+		{"duplicate title", &DuplicateError{Entity: "snippet", Column: "title", Err: ErrDuplicateTitle}, ErrDuplicateTitle},
+		{"duplicate email", &DuplicateError{Entity: "user", Column: "email", Err: ErrDuplicateEmail}, ErrDuplicateEmail},
+		{"constraint", &ConstraintError{Entity: "snippet", Column: "title", Err: driverErr}, ErrConstraint},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each error matches its own sentinel and no other, wrapped or
+			// not.
+			for _, err := range []error{tt.err, fmt.Errorf("handler: %w", wrap("snippets.Get", tt.err))} {
+				got := matches(err)
+				if len(got) != 1 || got[0] != tt.want {
+					t.Errorf("%v matches %v; want only %v", err, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTypedErrorsAs(t *testing.T) {
+	err := fmt.Errorf("loading snippet: %w", wrap("snippets.Get", &NotFoundError{Entity: "snippet", ID: 7}))
+
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) || notFound.Entity != "snippet" || notFound.ID != 7 {
+		t.Errorf("errors.As(%v) = %+v; want snippet 7", err, notFound)
+	}
+	var invalid *InvalidInputError
+	if errors.As(err, &invalid) {
+		t.Errorf("errors.As(%v) found an InvalidInputError", err)
+	}
+
+	err = fmt.Errorf("creating snippet: %w", &InvalidInputError{Entity: "snippet", Field: "expires", Message: "must be 1, 7 or 365"})
+	if !errors.As(err, &invalid) || invalid.Field != "expires" || invalid.Message != "must be 1, 7 or 365" {
+		t.Errorf("errors.As(%v) = %+v; want the expires field", err, invalid)
+	}
+
+	// A ConstraintError keeps the driver error it was made from.
+	driverErr := &mysql.MySQLError{Number: 1048, Message: "Column 'title' cannot be null"}
+	err = wrap("snippets.Insert", constraintError("snippet", driverErr))
+	var constraint *ConstraintError
+	if !errors.As(err, &constraint) || constraint.Column != "title" {
+		t.Errorf("errors.As(%v) = %+v; want a ConstraintError", err, constraint)
+	}
+	var gotDriverErr *mysql.MySQLError
+	if !errors.As(err, &gotDriverErr) || gotDriverErr.Number != 1048 {
+		t.Errorf("errors.As(%v) = %+v; want the driver error", err, gotDriverErr)
+	}
+}
+
+func TestConstraintErrorDuplicates(t *testing.T) {
+	tests := []struct {
+		message string
+		want    error
+	}{
+		{"Duplicate entry '1-Title' for key 'snippets.snippets_uc_user_title'", ErrDuplicateTitle},
+		{"Duplicate entry '1-abc' for key 'snippets.snippets_uc_user_content_hash'", ErrDuplicateContent},
+	}
+
+	for _, tt := range tests {
+		err := constraintError("snippet", &mysql.MySQLError{Number: 1062, Message: tt.message})
+		var duplicate *DuplicateError
+		if !errors.As(err, &duplicate) || !errors.Is(err, tt.want) {
+			t.Errorf("constraintError(%q) = %v; want a DuplicateError matching %v", tt.message, err, tt.want)
+		}
+	}
+
+	// Other duplicate keys are left to the caller.
+	driverErr := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@example.com' for key 'users.users_uc_email'"}
+	if err := constraintError("user", driverErr); err != driverErr {
+		t.Errorf("constraintError() = %v; want the driver error unchanged", err)
+	}
+}
+
+func TestWrapLogged(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	// Expected errors are returned unchanged and not logged.
+	for _, err := range append(sentinels, &NotFoundError{Entity: "snippet", ID: 1}, context.Canceled, nil) {
+		if got := wrapLogged(logger, "snippets.Get", err); got != err {
+			t.Errorf("wrapLogged(%v) = %v; want it unchanged", err, got)
+		}
+	}
+	if logs.Len() != 0 {
+		t.Errorf("expected errors were logged: %s", logs.String())
+	}
+
+	// Anything else is annotated with the operation and logged, and still
+	// matches the original.
+	failure := errors.New("connection refused")
+	err := wrapLogged(logger, "snippets.Get", failure)
+	if !errors.Is(err, failure) || err.Error() != "snippets.Get: connection refused" {
+		t.Errorf("wrapLogged() = %v; want the failure annotated with the operation", err)
+	}
+	if !strings.Contains(logs.String(), "op=snippets.Get") {
+		t.Errorf("log %q does not name the operation", logs.String())
+	}
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ExportedSnippet is one line of a FullExport.
+type ExportedSnippet struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Language string    `json:"language"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Expires  time.Time `json:"expires"`
+	Pinned   bool      `json:"pinned"`
+	Unlisted bool      `json:"unlisted"`
+}
+
+// FullExport returns the user's unexpired snippets, oldest first, as
+// newline-delimited JSON objects. Rows are read from a cursor and written to
+// the returned reader as they are consumed, so an export of any size is
+// never held in memory. Cancelling ctx, or closing the reader before the end,
+// stops the export; a failure part way through is returned by Read.
+func (m *SnippetModel) FullExport(ctx context.Context, userID int) (io.ReadCloser, error) {
+	defer m.observe("snippets.FullExport", time.Now())
+
+	stmt := `SELECT id, title, content, language, created, updated, expires, pinned, content_external, unlisted
+	FROM snippets
+	WHERE user_id = ? AND expires > UTC_TIMESTAMP() AND archived = FALSE
+	ORDER BY created ASC, id ASC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.FullExport", err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer rows.Close()
+
+		// A write blocks until the reader takes it, so a cancelled export
+		// whose reader has gone away must also be unblocked here.
+		stop := context.AfterFunc(ctx, func() {
+			pw.CloseWithError(ctx.Err())
+		})
+		defer stop()
+
+		pw.CloseWithError(m.writeExport(ctx, rows, pw))
+	}()
+	return pr, nil
+}
+
+// writeExport encodes each row as a line of w. Externally stored content is
+// read one snippet at a time.
+func (m *SnippetModel) writeExport(ctx context.Context, rows *sql.Rows, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		var s ExportedSnippet
+		var external bool
+		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Language, &s.Created, &s.Updated, &s.Expires, &s.Pinned, &external, &s.Unlisted)
+		if err != nil {
+			return wrapLogged(m.Logger, "snippets.FullExport", err)
+		}
+
+		if external {
+			s.Content, err = m.readExternal(ctx, s.ID)
+			if err != nil {
+				return wrapLogged(m.Logger, "snippets.FullExport", err)
+			}
+		}
+
+		err = enc.Encode(s)
+		if err != nil {
+			// The reader has been closed, or ctx cancelled.
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return wrapLogged(m.Logger, "snippets.FullExport", err)
+	}
+	return nil
+}
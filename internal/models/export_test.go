@@ -0,0 +1,111 @@
+package models
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSnippetModelFullExport(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	email := fmt.Sprintf("exporter-%d@example.com", time.Now().UnixNano())
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Exporter', ?, '', UTC_TIMESTAMP())`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, _ := result.LastInsertId()
+	userID := int(uid)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM snippets WHERE user_id = ?`, userID)
+		db.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	})
+
+	const n = 1000
+	inputs := make([]SnippetInput, n)
+	for i := range inputs {
+		inputs[i] = SnippetInput{Title: fmt.Sprintf("Snippet %d", i), Content: fmt.Sprintf("Haiku %d.", i), Expires: 7}
+	}
+	_, err = m.BatchInsert(t.Context(), inputs, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := m.FullExport(t.Context(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer export.Close()
+
+	dec := json.NewDecoder(export)
+	count := 0
+	for {
+		var s ExportedSnippet
+		err := dec.Decode(&s)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Title != fmt.Sprintf("Snippet %d", count) || s.Content != fmt.Sprintf("Haiku %d.", count) {
+			t.Fatalf("snippet %d = %+v", count, s)
+		}
+		count++
+	}
+	if count != n {
+		t.Errorf("exported %d snippets; want %d", count, n)
+	}
+}
+
+func TestSnippetModelFullExportCancel(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	email := fmt.Sprintf("exporter-%d@example.com", time.Now().UnixNano())
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Exporter', ?, '', UTC_TIMESTAMP())`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, _ := result.LastInsertId()
+	userID := int(uid)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM snippets WHERE user_id = ?`, userID)
+		db.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	})
+
+	inputs := make([]SnippetInput, 100)
+	for i := range inputs {
+		inputs[i] = SnippetInput{Title: fmt.Sprintf("Snippet %d", i), Content: fmt.Sprintf("Haiku %d.", i), Expires: 7}
+	}
+	_, err = m.BatchInsert(t.Context(), inputs, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	export, err := m.FullExport(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer export.Close()
+
+	// Take one line, then cancel; the rest of the export is abandoned and
+	// the reader reports why.
+	r := bufio.NewReader(export)
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	_, err = io.Copy(io.Discard, r)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("read after cancel: err = %v; want context.Canceled", err)
+	}
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"snippet.robertgleason.ca/internal/validator"
+)
+
+// importBatchSize is the number of valid records ImportNDJSON hands to
+// BatchInsert at a time.
+const importBatchSize = 100
+
+// MaxTitleChars is the longest snippet title accepted, in characters.
+const MaxTitleChars = 100
+
+// DefaultExpiryDays is the expiry, in days, offered by default for a new
+// snippet and given to a duplicated one.
+const DefaultExpiryDays = 365
+
+// SnippetInput is a snippet as supplied by a client, before it is stored.
+type SnippetInput struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Expires int    `json:"expires"`
+}
+
+// Check records any problems with in against v. It is the same validation
+// the create snippet form applies; maxContentChars <= 0 means no limit.
+func (in SnippetInput) Check(v *validator.Validator, maxContentChars int, maxControlRatio float64) {
+	v.CheckField(validator.NotBlank(in.Title), "title", "This field cannot be blank")
+	v.CheckField(validator.MaxChars(in.Title, MaxTitleChars), "title", fmt.Sprintf("This field cannot be more than %d characters long", MaxTitleChars))
+	v.CheckField(validator.NotBlank(in.Content), "content", "This field cannot be blank")
+	v.CheckField(validator.PlausiblyTextWithin(in.Content, maxControlRatio), "content", "Content appears to be binary — use a file attachment instead")
+	if maxContentChars > 0 {
+		v.CheckField(validator.MaxChars(in.Content, maxContentChars), "content", fmt.Sprintf("This field cannot be more than %d characters long", maxContentChars))
+	}
+	v.CheckField(validator.PermittedValues(in.Expires, 1, 7, 365), "expires", "This field must be one of the following values: 1, 7, or 365")
+}
+
+// LineError is a problem with a single record of an NDJSON import.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// BatchInsert stores inputs for userID in a single transaction and returns
+// the number inserted. The inputs are not validated.
+func (m *SnippetModel) BatchInsert(ctx context.Context, inputs []SnippetInput, userID int) (int, error) {
+	defer m.observe("snippets.BatchInsert", time.Now())
+
+	stmt := `INSERT INTO snippets (title, content, content_hash, created, updated, expires, user_id, owner_key, content_external)
+    VALUES(?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), NULLIF(?, 0), ?, ?)`
+
+	var ownerKey string
+	if userID != 0 {
+		ownerKey = UserOwnerKey(userID)
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, wrapLogged(m.Logger, "snippets.BatchInsert", err)
+	}
+	defer tx.Rollback()
+
+	external := map[int]string{}
+
+	for _, in := range inputs {
+		isExternal := m.storesExternally(in.Content)
+
+		columnContent := in.Content
+		if isExternal {
+			columnContent = ""
+		}
+
+		result, err := tx.ExecContext(ctx, stmt, in.Title, columnContent, hashContent(in.Content), in.Expires, userID, ownerKey, isExternal)
+		if err != nil {
+			return 0, wrapLogged(m.Logger, "snippets.BatchInsert", constraintError("snippet", err))
+		}
+
+		if isExternal {
+			id, err := result.LastInsertId()
+			if err != nil {
+				return 0, wrapLogged(m.Logger, "snippets.BatchInsert", err)
+			}
+			external[int(id)] = in.Content
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, wrapLogged(m.Logger, "snippets.BatchInsert", err)
+	}
+
+	// External content can only be written once the rows have IDs. If any
+	// write fails, remove the snippets that have no content.
+	ids := make([]int, 0, len(external))
+	for id := range external {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for i, id := range ids {
+		err = m.Store.Put(ctx, id, strings.NewReader(external[id]))
+		if err != nil {
+			for _, id := range ids[i:] {
+				m.DB.ExecContext(ctx, `DELETE FROM snippets WHERE id = ?`, id)
+			}
+			return len(inputs) - len(ids[i:]), wrapLogged(m.Logger, "snippets.BatchInsert", err)
+		}
+	}
+
+	return len(inputs), nil
+}
+
+// ImportNDJSON reads newline-delimited JSON SnippetInput records from r,
+// validates them, and inserts the valid ones for userID in batches. It
+// returns the number imported, a LineError for every invalid record, and a
+// non-nil error only when reading or inserting fails.
+func (m *SnippetModel) ImportNDJSON(ctx context.Context, r io.Reader, userID int) (int, []error, error) {
+	var (
+		imported   int
+		lineErrs   []error
+		batch      []SnippetInput
+		reader     = bufio.NewReader(r)
+		lineNumber int
+	)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := m.BatchInsert(ctx, batch, userID)
+		imported += n
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return imported, lineErrs, wrapLogged(m.Logger, "snippets.ImportNDJSON", readErr)
+		}
+
+		if len(line) > 0 {
+			lineNumber++
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var in SnippetInput
+
+			err := json.Unmarshal(line, &in)
+			if err != nil {
+				lineErrs = append(lineErrs, &LineError{Line: lineNumber, Err: err})
+			} else {
+				var v validator.Validator
+				in.Check(&v, 0, validator.DefaultControlRatio)
+
+				if v.Valid() {
+					batch = append(batch, in)
+				} else {
+					lineErrs = append(lineErrs, &LineError{Line: lineNumber, Err: validationError(v)})
+				}
+			}
+
+			if len(batch) == importBatchSize {
+				err := flush()
+				if err != nil {
+					return imported, lineErrs, err
+				}
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+	}
+
+	err := flush()
+	if err != nil {
+		return imported, lineErrs, err
+	}
+
+	return imported, lineErrs, nil
+}
+
+// validationError flattens the field errors in v into a single error, in a
+// stable order.
+func validationError(v validator.Validator) error {
+	keys := make([]string, 0, len(v.FieldErrors))
+	for key := range v.FieldErrors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+": "+v.FieldErrors[key])
+	}
+
+	return errors.New(strings.Join(parts, "; "))
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// SnippetModelInterface describes the snippet operations used by the web
+// application, so handlers can work against either the MySQL-backed
+// SnippetModel or a test double.
+type SnippetModelInterface interface {
+	Insert(ctx context.Context, title string, content string, expires int, userID int) (int, error)
+	GetOrCreate(ctx context.Context, title, content string, expires, userID int) (int, bool, error)
+	Update(ctx context.Context, id int, title, content string) error
+	Duplicate(ctx context.Context, id, userID int) (int, error)
+	Rename(ctx context.Context, id, userID int, newTitle string) error
+	SetLanguage(ctx context.Context, id, userID int, language string) error
+	Archive(ctx context.Context, id, userID int) error
+	Unarchive(ctx context.Context, id, userID int) error
+	ListArchived(ctx context.Context, userID, page, pageSize int) ([]*Snippet, int, error)
+	GetPublicByUser(ctx context.Context, userID, page, pageSize int) ([]*Snippet, int, error)
+	Pin(ctx context.Context, id, userID int) error
+	Unpin(ctx context.Context, id, userID int) error
+	SetFeatured(ctx context.Context, id int, featured bool) error
+	ListFeatured(ctx context.Context) ([]*Snippet, error)
+	RecordSpamDecision(ctx context.Context, id int, action, rule string, unlisted bool) error
+	Get(ctx context.Context, id int) (Snippet, error)
+	OpenContent(ctx context.Context, id int) (io.ReadCloser, error)
+	List(ctx context.Context, filters SnippetFilters) ([]*Snippet, int, error)
+	CountCreatedSince(ctx context.Context, ownerKey string, since time.Time) (int, error)
+	TopContributors(ctx context.Context, limit int) ([]UserSnippetCount, error)
+	CountByLanguage(ctx context.Context) (map[string]int, error)
+	CountExpired(ctx context.Context) (int, error)
+	MostRecentByLanguage(ctx context.Context, languages []string, limit int) (map[string][]*Snippet, error)
+	StorageSizeBytes(ctx context.Context) (int64, error)
+	LanguageCounts(ctx context.Context) ([]LanguageCount, error)
+	ListExpiringSoon(ctx context.Context, within time.Duration) ([]*Snippet, error)
+	Similar(ctx context.Context, id int, limit int) ([]*Snippet, error)
+	LatestByUser(ctx context.Context, userID int, language string, limit int) ([]SnippetSummary, error)
+	FullExport(ctx context.Context, userID int) (io.ReadCloser, error)
+	ShareGeneration(ctx context.Context, id int) (int, error)
+	GetVersion(ctx context.Context, snippetID, versionID int) (SnippetVersion, error)
+	ListVersions(ctx context.Context, snippetID int) ([]SnippetVersion, error)
+	CreateShare(ctx context.Context, id int, expires time.Time) (SnippetShare, error)
+	ListShares(ctx context.Context, id int) ([]SnippetShare, error)
+	RevokeShares(ctx context.Context, id int) error
+	CreateBundle(ctx context.Context, userID int, title string, ids []int, expires time.Time) (Bundle, error)
+	GetBundle(ctx context.Context, token string) (Bundle, error)
+	RecordView(ctx context.Context, userID, snippetID int) error
+	RecentlyViewed(ctx context.Context, userID, limit int) ([]*Snippet, error)
+}
+
+// UserModelInterface describes the user operations used by the web
+// application.
+type UserModelInterface interface {
+	Insert(name, email, password string) error
+	Authenticate(email, password string) (int, error)
+	Exists(id int) (bool, error)
+	Get(id int) (User, error)
+	ListActive(ctx context.Context, page, pageSize int) ([]*User, int, error)
+	UpdateProfile(id int, name, email string) error
+	UpdatePassword(id int, currentPassword, newPassword string) error
+}
+
+// UserSessionModelInterface describes the session tracking operations used
+// by the web application.
+type UserSessionModelInterface interface {
+	Touch(ctx context.Context, token string, userID int, userAgent, ip string) error
+	ListForUser(ctx context.Context, userID int) ([]UserSession, error)
+	Revoke(ctx context.Context, userID int, id string) (string, error)
+	RevokeOthers(ctx context.Context, userID int, keepToken string) ([]string, error)
+	Delete(ctx context.Context, token string) error
+}
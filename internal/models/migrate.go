@@ -0,0 +1,114 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Migration is one schema change. Migrations is generated from the files in
+// internal/models/migrations by go generate.
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+}
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied DATETIME NOT NULL
+)`
+
+// PendingMigrations returns the migrations in Migrations that have not been
+// recorded in the schema_migrations table, oldest first.
+func PendingMigrations(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	_, err := db.ExecContext(ctx, createMigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range Migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending, nil
+}
+
+// Migrate applies every pending migration in order and returns those it
+// applied. MySQL commits DDL implicitly, so a failure part way through a
+// migration leaves it partly applied and unrecorded.
+func Migrate(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	pending, err := PendingMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+
+	for _, m := range pending {
+		for _, stmt := range m.Statements {
+			_, err = db.ExecContext(ctx, stmt)
+			if err != nil {
+				return applied, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+
+		err = recordMigration(ctx, db, m)
+		if err != nil {
+			return applied, err
+		}
+
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+// Baseline records every migration up to and including version as applied
+// without running it, for databases set up by hand from the SQL files.
+func Baseline(ctx context.Context, db *sql.DB, version int) error {
+	pending, err := PendingMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pending {
+		if m.Version > version {
+			break
+		}
+
+		err = recordMigration(ctx, db, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func recordMigration(ctx context.Context, db *sql.DB, m Migration) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, UTC_TIMESTAMP())`, m.Version, m.Name)
+	return err
+}
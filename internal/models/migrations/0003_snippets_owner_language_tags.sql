@@ -0,0 +1,16 @@
+ALTER TABLE snippets
+    ADD COLUMN user_id INTEGER NULL,
+    ADD COLUMN language VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN views INTEGER NOT NULL DEFAULT 0,
+    ADD CONSTRAINT fk_snippets_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX idx_snippets_user_created ON snippets (user_id, created);
+
+CREATE TABLE snippet_tags (
+    snippet_id INTEGER NOT NULL,
+    tag VARCHAR(50) NOT NULL,
+    PRIMARY KEY (snippet_id, tag),
+    CONSTRAINT fk_snippet_tags_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_tags_tag ON snippet_tags (tag);
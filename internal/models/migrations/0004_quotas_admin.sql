@@ -0,0 +1,5 @@
+ALTER TABLE snippets ADD COLUMN owner_key VARCHAR(80) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_snippets_owner_key_created ON snippets (owner_key, created);
+
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE snippets ADD COLUMN content_external BOOLEAN NOT NULL DEFAULT FALSE;
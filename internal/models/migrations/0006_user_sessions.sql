@@ -0,0 +1,12 @@
+CREATE TABLE user_sessions (
+    id CHAR(64) NOT NULL PRIMARY KEY,
+    token CHAR(43) NOT NULL,
+    user_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL,
+    user_agent VARCHAR(100) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    CONSTRAINT fk_user_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_sessions_user ON user_sessions (user_id, last_seen);
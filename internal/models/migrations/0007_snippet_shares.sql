@@ -0,0 +1,12 @@
+ALTER TABLE snippets ADD COLUMN share_generation INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE snippet_shares (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    generation INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT fk_snippet_shares_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_shares_snippet ON snippet_shares (snippet_id, generation, expires);
@@ -0,0 +1,5 @@
+ALTER TABLE snippets
+    ADD COLUMN unlisted BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN spam_action VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN spam_rule VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX idx_snippets_spam_action ON snippets (spam_action);
@@ -0,0 +1,20 @@
+CREATE TABLE bundles (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    token VARCHAR(32) NOT NULL,
+    user_id INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT bundles_uc_token UNIQUE (token),
+    CONSTRAINT fk_bundles_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- snippet_id has no foreign key: a member that is deleted stays in the
+-- bundle and is shown as unavailable.
+CREATE TABLE bundle_snippets (
+    bundle_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    PRIMARY KEY (bundle_id, position),
+    CONSTRAINT fk_bundle_snippets_bundle FOREIGN KEY (bundle_id) REFERENCES bundles (id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+CREATE TABLE views_log (
+    user_id INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    viewed_at DATETIME NOT NULL,
+    PRIMARY KEY (user_id, snippet_id),
+    CONSTRAINT fk_views_log_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_views_log_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_views_log_user_viewed ON views_log (user_id, viewed_at);
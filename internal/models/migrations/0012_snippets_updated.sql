@@ -0,0 +1,3 @@
+ALTER TABLE snippets ADD COLUMN updated DATETIME NULL;
+UPDATE snippets SET updated = created;
+ALTER TABLE snippets MODIFY COLUMN updated DATETIME NOT NULL;
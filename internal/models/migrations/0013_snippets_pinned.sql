@@ -0,0 +1 @@
+ALTER TABLE snippets ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
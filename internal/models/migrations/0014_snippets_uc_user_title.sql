@@ -0,0 +1,13 @@
+-- Rename existing duplicates, all but the oldest of each, by appending the
+-- snippet ID so that the constraint can be added. Anonymous snippets have a
+-- NULL user_id and are not constrained.
+UPDATE snippets s
+JOIN (
+    SELECT user_id, title, MIN(id) AS keep_id FROM snippets
+    WHERE user_id IS NOT NULL
+    GROUP BY user_id, title
+    HAVING COUNT(*) > 1
+) d ON s.user_id = d.user_id AND s.title = d.title AND s.id <> d.keep_id
+SET s.title = CONCAT(LEFT(s.title, 100 - CHAR_LENGTH(CONCAT(' #', s.id))), ' #', s.id);
+
+ALTER TABLE snippets ADD CONSTRAINT snippets_uc_user_title UNIQUE (user_id, title);
@@ -0,0 +1,20 @@
+-- content_hash is the hex SHA-256 of the content. Content held in the
+-- ContentStore is not in the row, so existing external snippets are left
+-- without a hash; new ones are hashed by the application.
+ALTER TABLE snippets ADD COLUMN content_hash CHAR(64) NULL;
+
+UPDATE snippets SET content_hash = SHA2(content, 256) WHERE content_external = FALSE;
+
+-- Clear the hash of existing duplicates, all but the oldest of each, so that
+-- the constraint can be added. Anonymous snippets have a NULL user_id and
+-- are not constrained.
+UPDATE snippets s
+JOIN (
+    SELECT user_id, content_hash, MIN(id) AS keep_id FROM snippets
+    WHERE user_id IS NOT NULL AND content_hash IS NOT NULL
+    GROUP BY user_id, content_hash
+    HAVING COUNT(*) > 1
+) d ON s.user_id = d.user_id AND s.content_hash = d.content_hash AND s.id <> d.keep_id
+SET s.content_hash = NULL;
+
+ALTER TABLE snippets ADD CONSTRAINT snippets_uc_user_content_hash UNIQUE (user_id, content_hash);
@@ -0,0 +1 @@
+ALTER TABLE snippets ADD COLUMN featured BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+-- Archived snippets are kept for their owner, out of every listing, until
+-- they are unarchived. archived_at is NULL unless archived is set.
+ALTER TABLE snippets
+    ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN archived_at DATETIME NULL;
@@ -0,0 +1,13 @@
+-- Each row is a title and content a snippet had before an Update replaced
+-- them; created is when it was replaced. Content is always held here, even
+-- for snippets whose current content is in the ContentStore.
+CREATE TABLE snippet_versions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT fk_snippet_versions_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_versions_snippet ON snippet_versions (snippet_id, created);
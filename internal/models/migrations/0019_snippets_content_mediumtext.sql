@@ -0,0 +1,3 @@
+-- TEXT holds at most 64 KB, below -content-hard-limit and the point at which
+-- content moves to the ContentStore. MEDIUMTEXT holds up to 16 MB.
+ALTER TABLE snippets MODIFY content MEDIUMTEXT NOT NULL;
@@ -0,0 +1,110 @@
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"snippet.robertgleason.ca/internal/clock"
+	"snippet.robertgleason.ca/internal/models"
+)
+
+var _ models.UserSessionModelInterface = (*MockUserSessionModel)(nil)
+
+// MockUserSessionModel is an in-memory implementation of
+// models.UserSessionModelInterface, keyed by session token. Clock, if set,
+// replaces the real time for Created and LastSeen.
+type MockUserSessionModel struct {
+	Err   error
+	Clock clock.Clock
+
+	mu       sync.Mutex
+	sessions map[string]models.UserSession
+}
+
+func (m *MockUserSessionModel) Touch(ctx context.Context, token string, userID int, userAgent, ip string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions == nil {
+		m.sessions = make(map[string]models.UserSession)
+	}
+
+	now := clock.OrReal(m.Clock).Now().UTC()
+
+	s, ok := m.sessions[token]
+	if !ok {
+		s = models.UserSession{ID: models.SessionID(token), UserID: userID, Created: now}
+	}
+	s.LastSeen, s.UserAgent, s.IP = now, userAgent, ip
+	m.sessions[token] = s
+
+	return nil
+}
+
+func (m *MockUserSessionModel) ListForUser(ctx context.Context, userID int) ([]models.UserSession, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []models.UserSession
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *MockUserSessionModel) Revoke(ctx context.Context, userID int, id string) (string, error) {
+	if m.Err != nil {
+		return "", m.Err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, s := range m.sessions {
+		if s.ID == id && s.UserID == userID {
+			delete(m.sessions, token)
+			return token, nil
+		}
+	}
+	return "", models.ErrNoRecord
+}
+
+func (m *MockUserSessionModel) RevokeOthers(ctx context.Context, userID int, keepToken string) ([]string, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tokens []string
+	for token, s := range m.sessions {
+		if s.UserID == userID && token != keepToken {
+			delete(m.sessions, token)
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *MockUserSessionModel) Delete(ctx context.Context, token string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, token)
+	return nil
+}
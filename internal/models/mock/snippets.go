@@ -0,0 +1,884 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"snippet.robertgleason.ca/internal/clock"
+	"snippet.robertgleason.ca/internal/models"
+)
+
+var mockSnippet = models.Snippet{
+	ID:      1,
+	Title:   "An old silent pond",
+	Content: "An old silent pond...",
+	Created: time.Now(),
+	Updated: time.Now(),
+	Expires: time.Now(),
+}
+
+// MockSnippetModel is an in-memory implementation of
+// models.SnippetModelInterface. Snippets holds the records it serves,
+// Contributors the leaderboard, and Err, when set, is returned from every
+// method. Clock, if set, replaces the real time for creation and expiry.
+type MockSnippetModel struct {
+	Snippets     []models.Snippet
+	Contributors []models.UserSnippetCount
+	Err          error
+	Clock        clock.Clock
+
+	shares      []models.SnippetShare
+	versions    []models.SnippetVersion
+	generations map[int]int
+	bundles     []models.Bundle
+	views       []snippetView
+}
+
+// snippetView is an entry in the mock's views log, which is kept most
+// recent first.
+type snippetView struct {
+	userID, snippetID int
+}
+
+var _ models.SnippetModelInterface = (*MockSnippetModel)(nil)
+
+// NewSnippetModel returns a MockSnippetModel seeded with a single snippet.
+func NewSnippetModel() *MockSnippetModel {
+	return &MockSnippetModel{Snippets: []models.Snippet{mockSnippet}}
+}
+
+func (m *MockSnippetModel) Insert(ctx context.Context, title string, content string, expires int, userID int) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	if m.titleTaken(title, userID, 0) {
+		return 0, &models.DuplicateError{Entity: "snippet", Column: "title", Err: models.ErrDuplicateTitle}
+	}
+	if m.contentTaken(content, userID, 0) {
+		return 0, &models.DuplicateError{Entity: "snippet", Column: "content", Err: models.ErrDuplicateContent}
+	}
+
+	now := clock.OrReal(m.Clock).Now().UTC()
+
+	s := models.Snippet{
+		ID:      len(m.Snippets) + 1,
+		Title:   title,
+		Content: content,
+		Created: now,
+		Updated: now,
+		Expires: now.AddDate(0, 0, expires),
+		UserID:  userID,
+	}
+	m.Snippets = append(m.Snippets, s)
+	return s.ID, nil
+}
+
+// GetOrCreate returns the user's unexpired snippet with the same title and
+// content, or inserts one.
+func (m *MockSnippetModel) GetOrCreate(ctx context.Context, title, content string, expires, userID int) (int, bool, error) {
+	if m.Err != nil {
+		return 0, false, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+	for _, s := range m.Snippets {
+		if s.Title == title && s.Content == content && s.UserID == userID && s.Expires.After(now) {
+			return s.ID, false, nil
+		}
+	}
+
+	id, err := m.Insert(ctx, title, content, expires, userID)
+	return id, err == nil, err
+}
+
+// titleTaken reports whether a snippet other than the one with ID except
+// has title and belongs to userID, as the snippets_uc_user_title constraint
+// checks. Like the database's collation, it ignores case.
+func (m *MockSnippetModel) titleTaken(title string, userID, except int) bool {
+	if userID == 0 {
+		return false
+	}
+	for _, s := range m.Snippets {
+		if s.ID != except && s.UserID == userID && strings.EqualFold(s.Title, title) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentTaken reports whether a snippet other than the one with ID except
+// has content and belongs to userID, as the snippets_uc_user_content_hash
+// constraint checks.
+func (m *MockSnippetModel) contentTaken(content string, userID, except int) bool {
+	if userID == 0 {
+		return false
+	}
+	hash := models.Snippet{Content: content}.HashContent()
+	for _, s := range m.Snippets {
+		if s.ID != except && s.UserID == userID && s.HashContent() == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MockSnippetModel) Update(ctx context.Context, id int, title, content string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	for i := range m.Snippets {
+		if m.Snippets[i].ID == id {
+			if m.titleTaken(title, m.Snippets[i].UserID, id) {
+				return &models.DuplicateError{Entity: "snippet", Column: "title", Err: models.ErrDuplicateTitle}
+			}
+			if m.contentTaken(content, m.Snippets[i].UserID, id) {
+				return &models.DuplicateError{Entity: "snippet", Column: "content", Err: models.ErrDuplicateContent}
+			}
+			now := clock.OrReal(m.Clock).Now().UTC()
+			if m.Snippets[i].Title != title || m.Snippets[i].Content != content {
+				m.versions = append(m.versions, models.SnippetVersion{
+					ID:        len(m.versions) + 1,
+					SnippetID: id,
+					Title:     m.Snippets[i].Title,
+					Content:   m.Snippets[i].Content,
+					Created:   now,
+				})
+			}
+			m.Snippets[i].Title = title
+			m.Snippets[i].Content = content
+			m.Snippets[i].Updated = now
+			return nil
+		}
+	}
+	return &models.NotFoundError{Entity: "snippet", ID: id}
+}
+
+func (m *MockSnippetModel) GetVersion(ctx context.Context, snippetID, versionID int) (models.SnippetVersion, error) {
+	if m.Err != nil {
+		return models.SnippetVersion{}, m.Err
+	}
+
+	for _, v := range m.versions {
+		if v.ID == versionID && v.SnippetID == snippetID {
+			return v, nil
+		}
+	}
+	return models.SnippetVersion{}, &models.NotFoundError{Entity: "snippet version", ID: versionID}
+}
+
+// ListVersions returns the snippet's versions, newest first, without their
+// content.
+func (m *MockSnippetModel) ListVersions(ctx context.Context, snippetID int) ([]models.SnippetVersion, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	var versions []models.SnippetVersion
+	for i := len(m.versions) - 1; i >= 0; i-- {
+		if v := m.versions[i]; v.SnippetID == snippetID {
+			v.Content = ""
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// Duplicate copies the snippet with the given ID. The user's own snippets
+// are copied whatever their state, another user's only while they are
+// live, listed and not archived.
+func (m *MockSnippetModel) Duplicate(ctx context.Context, id, userID int) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+	for _, s := range m.Snippets {
+		if s.ID == id {
+			if s.UserID != userID && (s.Archived || s.Unlisted || !s.Expires.After(now)) {
+				break
+			}
+			newID, err := m.Insert(ctx, models.CopyTitle(s.Title), s.Content, models.DefaultExpiryDays, userID)
+			if err != nil {
+				return 0, err
+			}
+			m.Snippets[len(m.Snippets)-1].Language = s.Language
+			m.Snippets[len(m.Snippets)-1].Unlisted = s.Unlisted
+			return newID, nil
+		}
+	}
+	return 0, &models.NotFoundError{Entity: "snippet", ID: id}
+}
+
+func (m *MockSnippetModel) Rename(ctx context.Context, id, userID int, newTitle string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+	for i := range m.Snippets {
+		if m.Snippets[i].ID == id && m.Snippets[i].UserID == userID && !m.Snippets[i].Archived && m.Snippets[i].Expires.After(now) {
+			if m.titleTaken(newTitle, userID, id) {
+				return &models.DuplicateError{Entity: "snippet", Column: "title", Err: models.ErrDuplicateTitle}
+			}
+			m.Snippets[i].Title = newTitle
+			m.Snippets[i].Updated = clock.OrReal(m.Clock).Now().UTC()
+			return nil
+		}
+	}
+	return &models.NotFoundError{Entity: "snippet", ID: id}
+}
+
+func (m *MockSnippetModel) SetLanguage(ctx context.Context, id, userID int, language string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+	for i := range m.Snippets {
+		if m.Snippets[i].ID == id && m.Snippets[i].UserID == userID && !m.Snippets[i].Archived && m.Snippets[i].Expires.After(now) {
+			m.Snippets[i].Language = language
+			return nil
+		}
+	}
+	return &models.NotFoundError{Entity: "snippet", ID: id}
+}
+
+func (m *MockSnippetModel) Archive(ctx context.Context, id, userID int) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	for i := range m.Snippets {
+		if m.Snippets[i].ID == id && m.Snippets[i].UserID == userID && !m.Snippets[i].Archived {
+			m.Snippets[i].Archived = true
+			m.Snippets[i].ArchivedAt = clock.OrReal(m.Clock).Now().UTC()
+			return nil
+		}
+	}
+	return &models.NotFoundError{Entity: "snippet", ID: id}
+}
+
+func (m *MockSnippetModel) Unarchive(ctx context.Context, id, userID int) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	for i := range m.Snippets {
+		if m.Snippets[i].ID == id && m.Snippets[i].UserID == userID && m.Snippets[i].Archived {
+			m.Snippets[i].Archived = false
+			m.Snippets[i].ArchivedAt = time.Time{}
+			return nil
+		}
+	}
+	return &models.NotFoundError{Entity: "snippet", ID: id}
+}
+
+// ListArchived returns a page of the user's archived Snippets, most recently
+// archived first.
+func (m *MockSnippetModel) ListArchived(ctx context.Context, userID, page, pageSize int) ([]*models.Snippet, int, error) {
+	if m.Err != nil {
+		return nil, 0, m.Err
+	}
+
+	var archived []*models.Snippet
+	for i := len(m.Snippets) - 1; i >= 0; i-- {
+		s := m.Snippets[i]
+		if s.UserID == userID && s.Archived {
+			archived = append(archived, &s)
+		}
+	}
+	slices.SortStableFunc(archived, func(a, b *models.Snippet) int {
+		return b.ArchivedAt.Compare(a.ArchivedAt)
+	})
+
+	start := min((max(page, 1)-1)*pageSize, len(archived))
+	end := min(start+pageSize, len(archived))
+	return archived[start:end], len(archived), nil
+}
+
+// GetPublicByUser returns a page of the user's unexpired Snippets that are
+// neither unlisted nor archived, newest first.
+func (m *MockSnippetModel) GetPublicByUser(ctx context.Context, userID, page, pageSize int) ([]*models.Snippet, int, error) {
+	if m.Err != nil {
+		return nil, 0, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	var public []*models.Snippet
+	for i := len(m.Snippets) - 1; i >= 0; i-- {
+		s := m.Snippets[i]
+		if s.UserID == userID && !s.Unlisted && !s.Archived && s.Expires.After(now) {
+			public = append(public, &s)
+		}
+	}
+
+	start := min((max(page, 1)-1)*pageSize, len(public))
+	end := min(start+pageSize, len(public))
+	return public[start:end], len(public), nil
+}
+
+func (m *MockSnippetModel) Pin(ctx context.Context, id, userID int) error {
+	return m.setPinned(id, userID, true)
+}
+
+func (m *MockSnippetModel) Unpin(ctx context.Context, id, userID int) error {
+	return m.setPinned(id, userID, false)
+}
+
+func (m *MockSnippetModel) setPinned(id, userID int, pinned bool) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	for i := range m.Snippets {
+		if m.Snippets[i].ID == id && m.Snippets[i].UserID == userID {
+			m.Snippets[i].Pinned = pinned
+			return nil
+		}
+	}
+	return &models.NotFoundError{Entity: "snippet", ID: id}
+}
+
+func (m *MockSnippetModel) SetFeatured(ctx context.Context, id int, featured bool) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	for i := range m.Snippets {
+		if m.Snippets[i].ID == id {
+			m.Snippets[i].Featured = featured
+			return nil
+		}
+	}
+	return &models.NotFoundError{Entity: "snippet", ID: id}
+}
+
+// ListFeatured returns the unexpired, listed, featured Snippets, newest
+// first.
+func (m *MockSnippetModel) ListFeatured(ctx context.Context) ([]*models.Snippet, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	var featured []*models.Snippet
+	for i := len(m.Snippets) - 1; i >= 0 && len(featured) < models.FeaturedLimit; i-- {
+		s := m.Snippets[i]
+		if s.Featured && !s.Unlisted && s.Expires.After(now) {
+			featured = append(featured, &s)
+		}
+	}
+	return featured, nil
+}
+
+func (m *MockSnippetModel) RecordSpamDecision(ctx context.Context, id int, action, rule string, unlisted bool) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	for i := range m.Snippets {
+		if m.Snippets[i].ID == id {
+			m.Snippets[i].SpamAction = action
+			m.Snippets[i].SpamRule = rule
+			m.Snippets[i].Unlisted = unlisted
+			return nil
+		}
+	}
+	return &models.NotFoundError{Entity: "snippet", ID: id}
+}
+
+func (m *MockSnippetModel) Get(ctx context.Context, id int) (models.Snippet, error) {
+	if m.Err != nil {
+		return models.Snippet{}, m.Err
+	}
+
+	for _, s := range m.Snippets {
+		if s.ID == id && !s.Archived {
+			return s, nil
+		}
+	}
+	return models.Snippet{}, &models.NotFoundError{Entity: "snippet", ID: id}
+}
+
+func (m *MockSnippetModel) OpenContent(ctx context.Context, id int) (io.ReadCloser, error) {
+	s, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(s.Content)), nil
+}
+
+// List returns the matching snippets in the requested order. Tag filters are
+// ignored.
+func (m *MockSnippetModel) List(ctx context.Context, filters models.SnippetFilters) ([]*models.Snippet, int, error) {
+	if m.Err != nil {
+		return nil, 0, m.Err
+	}
+
+	var matched []*models.Snippet
+	for i := len(m.Snippets) - 1; i >= 0; i-- {
+		s := m.Snippets[i]
+		if s.Archived {
+			continue
+		}
+		if filters.UserID != 0 && s.UserID != filters.UserID {
+			continue
+		}
+		if filters.UserID == 0 && s.Unlisted {
+			continue
+		}
+		if filters.Language != "" && s.Language != filters.Language {
+			continue
+		}
+		if filters.Query != "" && !strings.Contains(s.Title, filters.Query) && !strings.Contains(s.Content, filters.Query) {
+			continue
+		}
+		matched = append(matched, &s)
+	}
+
+	// matched is newest first; the other orders are applied to it.
+	switch filters.Sort {
+	case models.SortCreatedAsc:
+		slices.Reverse(matched)
+	case models.SortTitleAsc:
+		slices.SortStableFunc(matched, func(a, b *models.Snippet) int {
+			return strings.Compare(a.Title, b.Title)
+		})
+	case models.SortViewsDesc:
+		slices.SortStableFunc(matched, func(a, b *models.Snippet) int {
+			return b.Views - a.Views
+		})
+	}
+
+	if filters.UserID != 0 {
+		slices.SortStableFunc(matched, pinnedFirst)
+	}
+
+	pageSize := filters.PageSize
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	start := 0
+	if filters.Page > 1 {
+		start = min((filters.Page-1)*pageSize, len(matched))
+	}
+	end := min(start+pageSize, len(matched))
+
+	return matched[start:end], len(matched), nil
+}
+
+func (m *MockSnippetModel) CountCreatedSince(ctx context.Context, ownerKey string, since time.Time) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+
+	var count int
+	for _, s := range m.Snippets {
+		if s.UserID != 0 && models.UserOwnerKey(s.UserID) == ownerKey && !s.Created.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// TopContributors returns Contributors, truncated to limit.
+func (m *MockSnippetModel) TopContributors(ctx context.Context, limit int) ([]models.UserSnippetCount, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return m.Contributors[:min(limit, len(m.Contributors))], nil
+}
+
+// CountByLanguage counts the unexpired Snippets by language.
+func (m *MockSnippetModel) CountByLanguage(ctx context.Context) (map[string]int, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	counts := map[string]int{}
+	for _, s := range m.Snippets {
+		if s.Expires.After(clock.OrReal(m.Clock).Now()) {
+			counts[s.Language]++
+		}
+	}
+	return counts, nil
+}
+
+// MostRecentByLanguage returns up to limit of the newest unexpired, listed
+// Snippets in each of languages.
+func (m *MockSnippetModel) MostRecentByLanguage(ctx context.Context, languages []string, limit int) (map[string][]*models.Snippet, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	recent := make(map[string][]*models.Snippet)
+	for i := len(m.Snippets) - 1; i >= 0; i-- {
+		s := m.Snippets[i]
+		if !slices.Contains(languages, s.Language) || len(recent[s.Language]) >= limit {
+			continue
+		}
+		if s.Unlisted || s.Archived || !s.Expires.After(now) {
+			continue
+		}
+		recent[s.Language] = append(recent[s.Language], &s)
+	}
+	return recent, nil
+}
+
+// CountExpired counts the expired Snippets.
+func (m *MockSnippetModel) CountExpired(ctx context.Context) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	count := 0
+	for _, s := range m.Snippets {
+		if s.Expires.Before(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// StorageSizeBytes adds up the content length of the unexpired Snippets.
+func (m *MockSnippetModel) StorageSizeBytes(ctx context.Context) (int64, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	var size int64
+	for _, s := range m.Snippets {
+		if s.Expires.After(now) {
+			size += int64(len(s.Content))
+		}
+	}
+	return size, nil
+}
+
+// LanguageCounts counts the unexpired, listed Snippets by language, most
+// common first.
+func (m *MockSnippetModel) LanguageCounts(ctx context.Context) ([]models.LanguageCount, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	byLanguage := map[string]int{}
+	for _, s := range m.Snippets {
+		if s.Language != "" && !s.Unlisted && s.Expires.After(now) {
+			byLanguage[s.Language]++
+		}
+	}
+
+	var counts []models.LanguageCount
+	for language, count := range byLanguage {
+		counts = append(counts, models.LanguageCount{Language: language, Count: count})
+	}
+	slices.SortFunc(counts, func(a, b models.LanguageCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Language, b.Language)
+	})
+	return counts, nil
+}
+
+// ListExpiringSoon returns the Snippets expiring within the given duration,
+// soonest first.
+func (m *MockSnippetModel) ListExpiringSoon(ctx context.Context, within time.Duration) ([]*models.Snippet, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	var expiring []*models.Snippet
+	for _, s := range m.Snippets {
+		if s.Expires.After(now) && !s.Expires.After(now.Add(within)) {
+			expiring = append(expiring, &s)
+		}
+	}
+	slices.SortFunc(expiring, func(a, b *models.Snippet) int {
+		return a.Expires.Compare(b.Expires)
+	})
+	return expiring, nil
+}
+
+// Similar returns the unexpired, listed Snippets sharing the most words with
+// the title and content of the one with the given ID, ignoring case. Those
+// sharing none are left out.
+func (m *MockSnippetModel) Similar(ctx context.Context, id int, limit int) ([]*models.Snippet, error) {
+	source, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	words := func(s models.Snippet) map[string]bool {
+		set := map[string]bool{}
+		for _, w := range strings.Fields(strings.ToLower(s.Title + " " + s.Content)) {
+			set[w] = true
+		}
+		return set
+	}
+	want := words(source)
+	now := clock.OrReal(m.Clock).Now()
+
+	shared := map[int]int{}
+	var matched []*models.Snippet
+	for i := len(m.Snippets) - 1; i >= 0; i-- {
+		s := m.Snippets[i]
+		if s.ID == id || s.Unlisted || !s.Expires.After(now) {
+			continue
+		}
+		for w := range words(s) {
+			if want[w] {
+				shared[s.ID]++
+			}
+		}
+		if shared[s.ID] > 0 {
+			matched = append(matched, &s)
+		}
+	}
+	slices.SortStableFunc(matched, func(a, b *models.Snippet) int {
+		return shared[b.ID] - shared[a.ID]
+	})
+	return matched[:min(len(matched), limit)], nil
+}
+
+// LatestByUser summarises the user's unexpired Snippets, newest first.
+func (m *MockSnippetModel) LatestByUser(ctx context.Context, userID int, language string, limit int) ([]models.SnippetSummary, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	var matched []*models.Snippet
+	for i := len(m.Snippets) - 1; i >= 0; i-- {
+		s := m.Snippets[i]
+		if s.UserID != userID || s.Unlisted || !s.Expires.After(now) || (language != "" && s.Language != language) {
+			continue
+		}
+		matched = append(matched, &s)
+	}
+	slices.SortStableFunc(matched, pinnedFirst)
+
+	var summaries []models.SnippetSummary
+	for _, s := range matched[:min(len(matched), limit)] {
+		excerpt := []rune(s.Content)
+		summaries = append(summaries, models.SnippetSummary{
+			ID:       s.ID,
+			Title:    s.Title,
+			Created:  s.Created,
+			Updated:  s.Updated,
+			Language: s.Language,
+			Excerpt:  string(excerpt[:min(len(excerpt), models.SummaryExcerptChars)]),
+		})
+	}
+	return summaries, nil
+}
+
+// FullExport writes the user's unexpired Snippets, in the order they are
+// held, as newline-delimited JSON. The export is built in memory.
+func (m *MockSnippetModel) FullExport(ctx context.Context, userID int) (io.ReadCloser, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, s := range m.Snippets {
+		if s.UserID != userID || !s.Expires.After(now) {
+			continue
+		}
+		err := enc.Encode(models.ExportedSnippet{
+			ID:       s.ID,
+			Title:    s.Title,
+			Content:  s.Content,
+			Language: s.Language,
+			Created:  s.Created,
+			Updated:  s.Updated,
+			Expires:  s.Expires,
+			Pinned:   s.Pinned,
+			Unlisted: s.Unlisted,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(&buf), nil
+}
+
+// pinnedFirst orders pinned snippets before the rest, for use with a stable
+// sort.
+func pinnedFirst(a, b *models.Snippet) int {
+	switch {
+	case a.Pinned == b.Pinned:
+		return 0
+	case a.Pinned:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func (m *MockSnippetModel) ShareGeneration(ctx context.Context, id int) (int, error) {
+	if _, err := m.Get(ctx, id); err != nil {
+		return 0, err
+	}
+	return m.generations[id], nil
+}
+
+func (m *MockSnippetModel) CreateShare(ctx context.Context, id int, expires time.Time) (models.SnippetShare, error) {
+	generation, err := m.ShareGeneration(ctx, id)
+	if err != nil {
+		return models.SnippetShare{}, err
+	}
+
+	share := models.SnippetShare{
+		SnippetID:  id,
+		Generation: generation,
+		Created:    clock.OrReal(m.Clock).Now().UTC().Truncate(time.Second),
+		Expires:    expires.UTC().Truncate(time.Second),
+	}
+	m.shares = append(m.shares, share)
+	return share, nil
+}
+
+// ListShares returns the unexpired shares at the snippet's current
+// generation, soonest to expire first.
+func (m *MockSnippetModel) ListShares(ctx context.Context, id int) ([]models.SnippetShare, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	var shares []models.SnippetShare
+	for _, sh := range m.shares {
+		if sh.SnippetID == id && sh.Generation == m.generations[id] && sh.Expires.After(now) {
+			shares = append(shares, sh)
+		}
+	}
+	slices.SortStableFunc(shares, func(a, b models.SnippetShare) int {
+		return a.Expires.Compare(b.Expires)
+	})
+	return shares, nil
+}
+
+func (m *MockSnippetModel) RevokeShares(ctx context.Context, id int) error {
+	if _, err := m.Get(ctx, id); err != nil {
+		return err
+	}
+
+	if m.generations == nil {
+		m.generations = map[int]int{}
+	}
+	m.generations[id]++
+	m.shares = slices.DeleteFunc(m.shares, func(sh models.SnippetShare) bool {
+		return sh.SnippetID == id
+	})
+	return nil
+}
+
+// CreateBundle stores the bundle in memory with a token derived from its ID.
+// It expires with the first of its snippets, or at expires if that is sooner.
+func (m *MockSnippetModel) CreateBundle(ctx context.Context, userID int, title string, ids []int, expires time.Time) (models.Bundle, error) {
+	if m.Err != nil {
+		return models.Bundle{}, m.Err
+	}
+
+	b := models.Bundle{
+		ID:         len(m.bundles) + 1,
+		UserID:     userID,
+		Title:      title,
+		Created:    clock.OrReal(m.Clock).Now().UTC().Truncate(time.Second),
+		SnippetIDs: slices.Clone(ids),
+	}
+	b.Token = fmt.Sprintf("BUNDLE%d", b.ID)
+	if !expires.IsZero() {
+		b.Expires = expires.UTC().Truncate(time.Second)
+	}
+
+	for _, id := range ids {
+		s, err := m.Get(ctx, id)
+		if err != nil {
+			return models.Bundle{}, err
+		}
+		if b.Expires.IsZero() || s.Expires.Before(b.Expires) {
+			b.Expires = s.Expires
+		}
+	}
+
+	m.bundles = append(m.bundles, b)
+	return b, nil
+}
+
+func (m *MockSnippetModel) GetBundle(ctx context.Context, token string) (models.Bundle, error) {
+	if m.Err != nil {
+		return models.Bundle{}, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+	for _, b := range m.bundles {
+		if b.Token == token && b.Expires.After(now) {
+			return b, nil
+		}
+	}
+	return models.Bundle{}, models.ErrNoRecord
+}
+
+// RecordView moves the user's entry for the snippet to the front of the
+// views log.
+func (m *MockSnippetModel) RecordView(ctx context.Context, userID, snippetID int) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	m.views = slices.DeleteFunc(m.views, func(v snippetView) bool {
+		return v.userID == userID && v.snippetID == snippetID
+	})
+	m.views = slices.Insert(m.views, 0, snippetView{userID, snippetID})
+	return nil
+}
+
+func (m *MockSnippetModel) RecentlyViewed(ctx context.Context, userID, limit int) ([]*models.Snippet, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	now := clock.OrReal(m.Clock).Now()
+
+	var snippets []*models.Snippet
+	for _, v := range m.views {
+		if len(snippets) == limit {
+			break
+		}
+		if v.userID != userID {
+			continue
+		}
+		s, err := m.Get(ctx, v.snippetID)
+		if err == nil && s.Expires.After(now) {
+			snippets = append(snippets, &s)
+		}
+	}
+	return snippets, nil
+}
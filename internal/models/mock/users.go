@@ -0,0 +1,95 @@
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"snippet.robertgleason.ca/internal/models"
+)
+
+var _ models.UserModelInterface = (*MockUserModel)(nil)
+
+// MockUserModel is a configurable implementation of
+// models.UserModelInterface. Each method returns the values held in the
+// corresponding fields and records how many times it was called. ListActive
+// pages through Users.
+type MockUserModel struct {
+	InsertErr error
+
+	AuthenticateID  int
+	AuthenticateErr error
+
+	ExistsResult bool
+	ExistsErr    error
+
+	User   models.User
+	GetErr error
+
+	Users         []*models.User
+	ListActiveErr error
+
+	UpdateProfileErr  error
+	UpdatePasswordErr error
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (m *MockUserModel) record(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.calls == nil {
+		m.calls = make(map[string]int)
+	}
+	m.calls[method]++
+}
+
+// Calls returns the number of times the named method has been called.
+func (m *MockUserModel) Calls(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[method]
+}
+
+func (m *MockUserModel) Insert(name, email, password string) error {
+	m.record("Insert")
+	return m.InsertErr
+}
+
+func (m *MockUserModel) Authenticate(email, password string) (int, error) {
+	m.record("Authenticate")
+	return m.AuthenticateID, m.AuthenticateErr
+}
+
+func (m *MockUserModel) Exists(id int) (bool, error) {
+	m.record("Exists")
+	return m.ExistsResult, m.ExistsErr
+}
+
+func (m *MockUserModel) Get(id int) (models.User, error) {
+	m.record("Get")
+	return m.User, m.GetErr
+}
+
+func (m *MockUserModel) UpdateProfile(id int, name, email string) error {
+	m.record("UpdateProfile")
+	return m.UpdateProfileErr
+}
+
+func (m *MockUserModel) UpdatePassword(id int, currentPassword, newPassword string) error {
+	m.record("UpdatePassword")
+	return m.UpdatePasswordErr
+}
+
+func (m *MockUserModel) ListActive(ctx context.Context, page, pageSize int) ([]*models.User, int, error) {
+	m.record("ListActive")
+	if m.ListActiveErr != nil {
+		return nil, 0, m.ListActiveErr
+	}
+
+	page = max(page, 1)
+	pageSize = min(max(pageSize, 1), models.MaxUserPageSize)
+	start := min((page-1)*pageSize, len(m.Users))
+	end := min(start+pageSize, len(m.Users))
+	return m.Users[start:end], len(m.Users), nil
+}
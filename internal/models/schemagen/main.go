@@ -0,0 +1,153 @@
+// Command schemagen turns the SQL migration files into Go source, so that the
+// schema is compiled into the binaries that apply it. It is run by go
+// generate in internal/models.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFile matches migration file names such as 0003_snippets_tags.sql.
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+func main() {
+	dir := flag.String("dir", "migrations", "directory of NNNN_name.sql migration files")
+	out := flag.String("out", "schema.go", "file to write")
+	pkg := flag.String("package", "models", "package name of the generated file")
+	flag.Parse()
+
+	migrations, err := readMigrations(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := generate(*pkg, *dir, migrations)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = os.WriteFile(*out, src, 0o644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readMigrations(dir string) ([]migration, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+
+	for _, path := range paths {
+		m := migrationFile.FindStringSubmatch(filepath.Base(path))
+		if m == nil {
+			return nil, fmt.Errorf("%s: name must be NNNN_name.sql", path)
+		}
+
+		version, _ := strconv.Atoi(m[1])
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		statements := splitStatements(string(src))
+		if len(statements) == 0 {
+			return nil, fmt.Errorf("%s: no statements", path)
+		}
+
+		migrations = append(migrations, migration{version: version, name: m[2], statements: statements})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// splitStatements splits src on semicolons that end a line, dropping "--"
+// comment lines. The migrations are plain DDL, so there is no need to handle
+// semicolons inside string literals.
+func splitStatements(src string) []string {
+	var (
+		statements []string
+		current    []string
+	)
+
+	for _, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		if strings.HasSuffix(trimmed, ";") {
+			current = append(current, strings.TrimSuffix(strings.TrimRight(line, " \t\r"), ";"))
+			statements = append(statements, strings.Join(current, "\n"))
+			current = nil
+			continue
+		}
+
+		current = append(current, strings.TrimRight(line, " \t\r"))
+	}
+
+	if len(current) > 0 {
+		statements = append(statements, strings.Join(current, "\n"))
+	}
+
+	return statements
+}
+
+func generate(pkg, dir string, migrations []migration) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by schemagen from %s; DO NOT EDIT.\n\n", filepath.ToSlash(dir))
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "// Migrations is every schema migration, oldest first.\n")
+	fmt.Fprintf(&buf, "var Migrations = []Migration{\n")
+
+	for _, m := range migrations {
+		fmt.Fprintf(&buf, "{\nVersion: %d,\nName: %q,\nStatements: []string{\n", m.version, m.name)
+		for _, stmt := range m.statements {
+			fmt.Fprintf(&buf, "%s,\n", quote(stmt))
+		}
+		fmt.Fprintf(&buf, "},\n},\n")
+	}
+
+	fmt.Fprintf(&buf, "}\n")
+
+	return format.Source(buf.Bytes())
+}
+
+// quote returns stmt as a raw string literal when possible, which keeps the
+// generated SQL readable.
+func quote(stmt string) string {
+	if strings.Contains(stmt, "`") {
+		return strconv.Quote(stmt)
+	}
+	return "`" + stmt + "`"
+}
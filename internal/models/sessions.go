@@ -0,0 +1,143 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// UserSession describes one signed-in device. ID identifies the session
+// publicly; the session token itself is never shown, so it cannot leak
+// through page source or URLs.
+type UserSession struct {
+	ID        string
+	UserID    int
+	Created   time.Time
+	LastSeen  time.Time
+	UserAgent string
+	IP        string
+}
+
+// SessionID returns the public ID of the session with the given token.
+func SessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// UserSessionModel tracks the sessions of signed-in users alongside the
+// session data itself, which lives in the sessions table.
+type UserSessionModel struct {
+	DB     *sql.DB
+	Logger *slog.Logger // optional; receives unexpected database errors
+}
+
+// Touch records that the session with token was used by userID, creating
+// its row on first use.
+func (m *UserSessionModel) Touch(ctx context.Context, token string, userID int, userAgent, ip string) error {
+	stmt := `INSERT INTO user_sessions (id, token, user_id, created, last_seen, user_agent, ip)
+    VALUES(?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?, ?)
+    ON DUPLICATE KEY UPDATE last_seen = UTC_TIMESTAMP(), user_agent = VALUES(user_agent), ip = VALUES(ip)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, SessionID(token), token, userID, userAgent, ip)
+	return wrapLogged(m.Logger, "sessions.Touch", err)
+}
+
+// ListForUser returns the user's unexpired sessions, most recently used
+// first.
+func (m *UserSessionModel) ListForUser(ctx context.Context, userID int) ([]UserSession, error) {
+	stmt := `SELECT us.id, us.user_id, us.created, us.last_seen, us.user_agent, us.ip
+    FROM user_sessions us
+    JOIN sessions s ON s.token = us.token
+    WHERE us.user_id = ? AND s.expiry > UTC_TIMESTAMP(6)
+    ORDER BY us.last_seen DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "sessions.ListForUser", err)
+	}
+	defer rows.Close()
+
+	var sessions []UserSession
+
+	for rows.Next() {
+		var s UserSession
+		err = rows.Scan(&s.ID, &s.UserID, &s.Created, &s.LastSeen, &s.UserAgent, &s.IP)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "sessions.ListForUser", err)
+		}
+		sessions = append(sessions, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "sessions.ListForUser", err)
+	}
+
+	return sessions, nil
+}
+
+// Revoke removes the user's session with the given public ID and returns its
+// token, so the caller can destroy the session data. It returns ErrNoRecord
+// if the user has no such session.
+func (m *UserSessionModel) Revoke(ctx context.Context, userID int, id string) (string, error) {
+	var token string
+
+	err := m.DB.QueryRowContext(ctx, `SELECT token FROM user_sessions WHERE id = ? AND user_id = ?`, id, userID).Scan(&token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", wrapLogged(m.Logger, "sessions.Revoke", err)
+	}
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM user_sessions WHERE id = ?`, id)
+	if err != nil {
+		return "", wrapLogged(m.Logger, "sessions.Revoke", err)
+	}
+
+	return token, nil
+}
+
+// RevokeOthers removes every session of the user except the one with
+// keepToken and returns the removed tokens.
+func (m *UserSessionModel) RevokeOthers(ctx context.Context, userID int, keepToken string) ([]string, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "sessions.RevokeOthers", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT token FROM user_sessions WHERE user_id = ? AND id <> ? FOR UPDATE`, userID, SessionID(keepToken))
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "sessions.RevokeOthers", err)
+	}
+
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err = rows.Scan(&token); err != nil {
+			rows.Close()
+			return nil, wrapLogged(m.Logger, "sessions.RevokeOthers", err)
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "sessions.RevokeOthers", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = ? AND id <> ?`, userID, SessionID(keepToken))
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "sessions.RevokeOthers", err)
+	}
+
+	return tokens, wrapLogged(m.Logger, "sessions.RevokeOthers", tx.Commit())
+}
+
+// Delete removes the row for the session with token, if there is one.
+func (m *UserSessionModel) Delete(ctx context.Context, token string) error {
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM user_sessions WHERE id = ?`, SessionID(token))
+	return wrapLogged(m.Logger, "sessions.Delete", err)
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SnippetShare is a temporary share link issued for a snippet. The link
+// itself is signed rather than stored; Generation is the snippet's share
+// generation when it was issued, and the link stops working once the
+// generation moves on.
+type SnippetShare struct {
+	SnippetID  int
+	Generation int
+	Created    time.Time
+	Expires    time.Time
+}
+
+// ShareGeneration returns the current share generation of the snippet.
+func (m *SnippetModel) ShareGeneration(ctx context.Context, id int) (int, error) {
+	defer m.observe("snippets.ShareGeneration", time.Now())
+
+	var generation int
+
+	err := m.DB.QueryRowContext(ctx, `SELECT share_generation FROM snippets WHERE id = ?`, id).Scan(&generation)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, &NotFoundError{Entity: "snippet", ID: id}
+		}
+		return 0, wrapLogged(m.Logger, "snippets.ShareGeneration", err)
+	}
+	return generation, nil
+}
+
+// CreateShare records a share link for the snippet that expires at expires,
+// at the snippet's current share generation.
+func (m *SnippetModel) CreateShare(ctx context.Context, id int, expires time.Time) (SnippetShare, error) {
+	defer m.observe("snippets.CreateShare", time.Now())
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return SnippetShare{}, wrapLogged(m.Logger, "snippets.CreateShare", err)
+	}
+	defer tx.Rollback()
+
+	share := SnippetShare{SnippetID: id, Expires: expires.UTC().Truncate(time.Second)}
+
+	err = tx.QueryRowContext(ctx, `SELECT share_generation, UTC_TIMESTAMP() FROM snippets WHERE id = ? FOR UPDATE`, id).Scan(&share.Generation, &share.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SnippetShare{}, &NotFoundError{Entity: "snippet", ID: id}
+		}
+		return SnippetShare{}, wrapLogged(m.Logger, "snippets.CreateShare", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO snippet_shares (snippet_id, generation, created, expires) VALUES (?, ?, ?, ?)`,
+		share.SnippetID, share.Generation, share.Created, share.Expires)
+	if err != nil {
+		return SnippetShare{}, wrapLogged(m.Logger, "snippets.CreateShare", err)
+	}
+
+	return share, wrapLogged(m.Logger, "snippets.CreateShare", tx.Commit())
+}
+
+// ListShares returns the snippet's unexpired, unrevoked share links, soonest
+// to expire first.
+func (m *SnippetModel) ListShares(ctx context.Context, id int) ([]SnippetShare, error) {
+	defer m.observe("snippets.ListShares", time.Now())
+
+	stmt := `SELECT sh.snippet_id, sh.generation, sh.created, sh.expires FROM snippet_shares sh
+	JOIN snippets s ON s.id = sh.snippet_id AND s.share_generation = sh.generation
+	WHERE sh.snippet_id = ? AND sh.expires > UTC_TIMESTAMP()
+	ORDER BY sh.expires ASC, sh.id ASC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, id)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.ListShares", err)
+	}
+	defer rows.Close()
+
+	var shares []SnippetShare
+
+	for rows.Next() {
+		var sh SnippetShare
+		err = rows.Scan(&sh.SnippetID, &sh.Generation, &sh.Created, &sh.Expires)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.ListShares", err)
+		}
+		shares = append(shares, sh)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.ListShares", err)
+	}
+
+	return shares, nil
+}
+
+// RevokeShares invalidates every share link issued for the snippet by moving
+// its share generation on, and forgets the issued links.
+func (m *SnippetModel) RevokeShares(ctx context.Context, id int) error {
+	defer m.observe("snippets.RevokeShares", time.Now())
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.RevokeShares", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE snippets SET share_generation = share_generation + 1 WHERE id = ?`, id)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.RevokeShares", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return &NotFoundError{Entity: "snippet", ID: id}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM snippet_shares WHERE snippet_id = ?`, id)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.RevokeShares", err)
+	}
+
+	return wrapLogged(m.Logger, "snippets.RevokeShares", tx.Commit())
+}
@@ -1,81 +1,1495 @@
 package models
 
+//go:generate go run ./schemagen -dir migrations -out schema.go
+
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID       int
+	Title    string
+	Content  string
+	Created  time.Time
+	Updated  time.Time
+	Expires  time.Time
+	UserID   int
+	Language string
+	Views    int
+
+	// Pinned snippets come first in their owner's listings.
+	Pinned bool
+
+	// Featured snippets are picked by an admin for the home page.
+	Featured bool
+
+	// ContentExternal is true when the content lives in the model's
+	// ContentStore rather than the content column.
+	ContentExternal bool
+
+	// Unlisted snippets are left out of public listings and search. SpamAction
+	// and SpamRule record the spam filter decision that applied, if any.
+	Unlisted   bool
+	SpamAction string
+	SpamRule   string
+
+	// Archived snippets are kept for their owner but left out of every
+	// lookup and listing other than ListArchived. ArchivedAt is zero unless
+	// the snippet is archived.
+	Archived   bool
+	ArchivedAt time.Time
+}
+
+// WordCount returns the number of whitespace-separated words in the content.
+// It has a value receiver so that templates, which are given snippets by
+// value, can call it.
+func (s Snippet) WordCount() int {
+	return len(strings.Fields(s.Content))
+}
+
+// Size returns the length of the content in bytes.
+func (s Snippet) Size() int64 {
+	return int64(len(s.Content))
+}
+
+// HashContent returns the hex-encoded SHA-256 hash of the content, as
+// stored in the content_hash column. A user cannot have two snippets with
+// the same hash.
+func (s Snippet) HashContent() string {
+	return hashContent(s.Content)
+}
+
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// LineCount returns the number of lines in the content, counting a trailing
+// newline as starting a final empty line. Empty content has no lines.
+func (s Snippet) LineCount() int {
+	if s.Content == "" {
+		return 0
+	}
+	return strings.Count(s.Content, "\n") + 1
+}
+
+// editedAfter is how long after creation a change must come to count as an
+// edit, so that a snippet saved twice in quick succession is not shown as
+// updated.
+const editedAfter = time.Minute
+
+// Edited reports whether the snippet was updated more than a minute after
+// it was created.
+func (s Snippet) Edited() bool {
+	return s.Updated.Sub(s.Created) > editedAfter
+}
+
+// LogValue implements slog.LogValuer, so that a snippet passed to a logger is
+// written as a group of its identifying fields rather than its content. The
+// value receiver makes both Snippet and *Snippet LogValuers.
+func (s Snippet) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("id", s.ID),
+		slog.String("title", s.Title),
+		slog.Int("user_id", s.UserID),
+		slog.Time("created", s.Created),
+		slog.Time("expires", s.Expires),
+	)
+}
+
+// snippetColumns is the column list scanned by scanSnippet. Snippets created
+// before ownership was tracked have a NULL user_id, reported as 0.
+const snippetColumns = `id, title, content, created, updated, expires, COALESCE(user_id, 0), language, views, pinned, featured, content_external, unlisted, spam_action, spam_rule, archived, archived_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSnippet(row rowScanner, s *Snippet) error {
+	var archivedAt sql.NullTime
+	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Updated, &s.Expires, &s.UserID, &s.Language, &s.Views, &s.Pinned, &s.Featured, &s.ContentExternal, &s.Unlisted, &s.SpamAction, &s.SpamRule, &s.Archived, &archivedAt)
+	s.ArchivedAt = archivedAt.Time
+	return err
+}
+
+// Permitted values for SnippetFilters.Sort.
+const (
+	SortCreatedDesc = "created_desc"
+	SortCreatedAsc  = "created_asc"
+	SortTitleAsc    = "title_asc"
+	SortViewsDesc   = "views_desc"
+)
+
+var SnippetSortValues = []string{SortCreatedDesc, SortCreatedAsc, SortTitleAsc, SortViewsDesc}
+
+var snippetSortClauses = map[string]string{
+	SortCreatedDesc: "created DESC, id DESC",
+	SortCreatedAsc:  "created ASC, id ASC",
+	SortTitleAsc:    "title ASC, id ASC",
+	SortViewsDesc:   "views DESC, id DESC",
 }
 
+// SnippetFilters narrows and orders snippet listings. Zero values mean "no
+// filter"; Page is 1-based.
+type SnippetFilters struct {
+	UserID   int
+	Language string
+	Tag      string
+	Query    string
+	Sort     string
+	Page     int
+	PageSize int
+}
+
+func (f SnippetFilters) limit() int {
+	if f.PageSize <= 0 {
+		return 20
+	}
+	return f.PageSize
+}
+
+func (f SnippetFilters) offset() int {
+	if f.Page <= 1 {
+		return 0
+	}
+	return (f.Page - 1) * f.limit()
+}
+
+// UserOwnerKey returns the quota owner key for a registered user.
+func UserOwnerKey(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// IPOwnerKey returns the quota owner key for an anonymous client. The IP
+// address is hashed so that it is not stored in the clear.
+func IPOwnerKey(ip string) string {
+	sum := sha256.Sum256([]byte(ip))
+	return "ip:" + hex.EncodeToString(sum[:16])
+}
+
+// UserSnippetCount is a leaderboard row: a user and how many unexpired
+// snippets they own.
+type UserSnippetCount struct {
+	UserID int
+	Name   string
+	Count  int
+}
+
+// LanguageCount is the number of snippets in a language.
+type LanguageCount struct {
+	Language string
+	Count    int
+}
+
+// SnippetModel stores snippets in MySQL. Content longer than
+// ExternalThreshold bytes is written to Store instead of the content column;
+// a zero threshold or nil Store keeps all content in the column. Unexpected
+// database errors are logged to Logger when it is set, and operations taking
+// longer than SlowQueryThreshold are reported to OnSlowQuery when it is set.
 type SnippetModel struct {
-	DB *sql.DB
+	DB                 *sql.DB
+	Store              ContentStore
+	ExternalThreshold  int
+	Logger             *slog.Logger
+	SlowQueryThreshold time.Duration
+	OnSlowQuery        func(op string, dur time.Duration)
 }
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-    VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+// observe reports op to OnSlowQuery if it has run for longer than
+// SlowQueryThreshold. Methods defer it with their start time.
+func (m *SnippetModel) observe(op string, start time.Time) {
+	if m.OnSlowQuery == nil {
+		return
+	}
+	if dur := time.Since(start); dur > m.SlowQueryThreshold {
+		m.OnSlowQuery(op, dur)
+	}
+}
+
+func (m *SnippetModel) storesExternally(content string) bool {
+	return m.Store != nil && m.ExternalThreshold > 0 && len(content) > m.ExternalThreshold
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// validateSnippet checks the fields of a new snippet that MySQL would
+// otherwise reject, or store without complaint, returning an
+// InvalidInputError for the first one that is wrong.
+func validateSnippet(title, content string, expires int) error {
+	switch {
+	case strings.TrimSpace(title) == "":
+		return &InvalidInputError{Entity: "snippet", Field: "title", Message: "title must not be empty"}
+	case strings.TrimSpace(content) == "":
+		return &InvalidInputError{Entity: "snippet", Field: "content", Message: "content must not be empty"}
+	case expires <= 0:
+		return &InvalidInputError{Entity: "snippet", Field: "expires", Message: "expires must be positive"}
+	}
+	return nil
+}
+
+// insertRow inserts the snippet row through db. Content that belongs in the
+// ContentStore is left out of the row, and external reports whether the
+// caller must still write it there. Invalid fields are rejected with an
+// InvalidInputError before the insert is attempted.
+func (m *SnippetModel) insertRow(ctx context.Context, db execer, title, content string, expires, userID int) (id int64, external bool, err error) {
+	stmt := `INSERT INTO snippets (title, content, content_hash, created, updated, expires, user_id, owner_key, content_external)
+    VALUES(?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), NULLIF(?, 0), ?, ?)`
+
+	err = validateSnippet(title, content, expires)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var ownerKey string
+	if userID != 0 {
+		ownerKey = UserOwnerKey(userID)
+	}
+
+	external = m.storesExternally(content)
+
+	columnContent := content
+	if external {
+		columnContent = ""
+	}
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	result, err := db.ExecContext(ctx, stmt, title, columnContent, hashContent(content), expires, userID, ownerKey, external)
 	if err != nil {
-		return 0, err
+		return 0, false, constraintError("snippet", err)
 	}
 
-	id, err := result.LastInsertId()
+	id, err = result.LastInsertId()
+	return id, external, err
+}
+
+func (m *SnippetModel) Insert(ctx context.Context, title string, content string, expires int, userID int) (int, error) {
+	defer m.observe("snippets.Insert", time.Now())
+
+	id, external, err := m.insertRow(ctx, m.DB, title, content, expires, userID)
 	if err != nil {
-		return 0, err
+		return 0, wrapLogged(m.Logger, "snippets.Insert", err)
+	}
+
+	if external {
+		err = m.Store.Put(ctx, int(id), strings.NewReader(content))
+		if err != nil {
+			// Remove the row even if ctx was cancelled.
+			m.DB.ExecContext(context.WithoutCancel(ctx), `DELETE FROM snippets WHERE id = ?`, id)
+			return 0, wrapLogged(m.Logger, "snippets.Insert", err)
+		}
 	}
+
 	return int(id), nil
 }
 
-func (m SnippetModel) Get(id int) (Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-    WHERE expires > UTC_TIMESTAMP() AND id = ?`
+// GetOrCreate returns the ID of the user's unexpired snippet with exactly
+// this title and content, or inserts one if there is none, so that a client
+// retrying a create does not make a duplicate. created reports whether the
+// snippet was inserted. The lookup locks the rows it reads, so concurrent
+// identical calls create a single snippet. Content large enough for the
+// ContentStore is not compared, and always creates a new snippet.
+func (m *SnippetModel) GetOrCreate(ctx context.Context, title, content string, expires, userID int) (id int, created bool, err error) {
+	if m.storesExternally(content) {
+		id, err = m.Insert(ctx, title, content, expires, userID)
+		return id, err == nil, err
+	}
+
+	defer m.observe("snippets.GetOrCreate", time.Now())
+
+	id, created, err = m.getOrCreate(ctx, title, content, expires, userID)
+	// Two calls that both find nothing can deadlock on their inserts. MySQL
+	// rolls one back; by the time it runs again the other's row is there.
+	if isDeadlock(err) {
+		id, created, err = m.getOrCreate(ctx, title, content, expires, userID)
+	}
+	if err != nil {
+		return 0, false, wrapLogged(m.Logger, "snippets.GetOrCreate", err)
+	}
+	return id, created, nil
+}
+
+func (m *SnippetModel) getOrCreate(ctx context.Context, title, content string, expires, userID int) (int, bool, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT id FROM snippets
+	WHERE title = ? AND content_hash = ? AND user_id <=> NULLIF(?, 0) AND content_external = FALSE AND expires > UTC_TIMESTAMP() AND archived = FALSE
+	ORDER BY id LIMIT 1
+	FOR UPDATE`
+
+	var id int64
+	err = tx.QueryRowContext(ctx, stmt, title, hashContent(content), userID).Scan(&id)
+	if err == nil {
+		return int(id), false, tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+
+	id, _, err = m.insertRow(ctx, tx, title, content, expires, userID)
+	if err != nil {
+		return 0, false, err
+	}
+	return int(id), true, tx.Commit()
+}
+
+// Update replaces the title and content of an unexpired snippet and sets
+// its updated time. The old title and content are kept as a SnippetVersion.
+// Content is moved into or out of the ContentStore as its new size requires.
+// Content the owner already has in another snippet is reported as
+// ErrDuplicateContent.
+func (m *SnippetModel) Update(ctx context.Context, id int, title, content string) error {
+	defer m.observe("snippets.Update", time.Now())
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.Update", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		oldTitle, oldContent string
+		wasExternal          bool
+	)
+
+	err = tx.QueryRowContext(ctx, `SELECT title, content, content_external FROM snippets WHERE id = ? AND expires > UTC_TIMESTAMP() AND archived = FALSE FOR UPDATE`, id).
+		Scan(&oldTitle, &oldContent, &wasExternal)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &NotFoundError{Entity: "snippet", ID: id}
+		}
+		return wrapLogged(m.Logger, "snippets.Update", err)
+	}
+
+	// Saved before the store is written, as that would replace old external
+	// content.
+	err = m.saveVersion(ctx, tx, id, oldTitle, oldContent, wasExternal, title, content)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.Update", err)
+	}
+
+	external := m.storesExternally(content)
+
+	columnContent := content
+	if external {
+		columnContent = ""
+		// Written before the row so that a failure leaves the old content
+		// in place.
+		err = m.Store.Put(ctx, id, strings.NewReader(content))
+		if err != nil {
+			return wrapLogged(m.Logger, "snippets.Update", err)
+		}
+	}
+
+	stmt := `UPDATE snippets SET title = ?, content = ?, content_hash = ?, content_external = ?, updated = UTC_TIMESTAMP() WHERE id = ?`
+
+	_, err = tx.ExecContext(ctx, stmt, title, columnContent, hashContent(content), external, id)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.Update", constraintError("snippet", err))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.Update", err)
+	}
+
+	// Content that moved back into the row is no longer needed in the
+	// store; SweepOrphans removes it if this fails.
+	if wasExternal && !external {
+		m.Store.Delete(ctx, id)
+	}
+	return nil
+}
+
+// CopyTitle returns the title of a duplicate of a snippet titled title:
+// "Copy of " and the title, cut to MaxTitleChars characters.
+func CopyTitle(title string) string {
+	title = "Copy of " + title
+	if utf8.RuneCountInString(title) <= MaxTitleChars {
+		return title
+	}
+	return string([]rune(title)[:MaxTitleChars])
+}
 
-	row := m.DB.QueryRow(stmt, id)
+// Duplicate copies the snippet with the given ID to a new snippet owned by
+// userID that expires in DefaultExpiryDays. A user may copy any of their
+// own snippets, even an expired or archived one, but another user's only
+// if it is live, listed and not archived; anything else is a
+// NotFoundError. The copy has the title from CopyTitle and the same content
+// and language, and the copy of an unlisted snippet is unlisted too. It
+// returns the new snippet's ID, or ErrDuplicateTitle or ErrDuplicateContent
+// if the user already has a snippet with the copy's title or content, as
+// they do when copying one of their own.
+func (m *SnippetModel) Duplicate(ctx context.Context, id, userID int) (int, error) {
+	defer m.observe("snippets.Duplicate", time.Now())
 
 	var s Snippet
 
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	stmt := `SELECT title, content, language, content_external, unlisted FROM snippets
+	WHERE id = ? AND (user_id = ? OR (archived = FALSE AND unlisted = FALSE AND expires > UTC_TIMESTAMP()))`
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, userID).
+		Scan(&s.Title, &s.Content, &s.Language, &s.ContentExternal, &s.Unlisted)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return Snippet{}, ErrNoRecord
-		} else {
-			return Snippet{}, err
+			return 0, &NotFoundError{Entity: "snippet", ID: id}
 		}
+		return 0, wrapLogged(m.Logger, "snippets.Duplicate", err)
 	}
-	return s, nil
+
+	if s.ContentExternal {
+		s.Content, err = m.readExternal(ctx, id)
+		if err != nil {
+			return 0, wrapLogged(m.Logger, "snippets.Duplicate", err)
+		}
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, wrapLogged(m.Logger, "snippets.Duplicate", err)
+	}
+	defer tx.Rollback()
+
+	newID, external, err := m.insertRow(ctx, tx, CopyTitle(s.Title), s.Content, DefaultExpiryDays, userID)
+	if err != nil {
+		return 0, wrapLogged(m.Logger, "snippets.Duplicate", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE snippets SET language = ?, unlisted = ? WHERE id = ?`, s.Language, s.Unlisted, newID)
+	if err != nil {
+		return 0, wrapLogged(m.Logger, "snippets.Duplicate", err)
+	}
+
+	// As in Insert, external content is written once the row exists; here
+	// the row is only committed after it.
+	if external {
+		err = m.Store.Put(ctx, int(newID), strings.NewReader(s.Content))
+		if err != nil {
+			return 0, wrapLogged(m.Logger, "snippets.Duplicate", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, wrapLogged(m.Logger, "snippets.Duplicate", err)
+	}
+	return int(newID), nil
+}
+
+// Rename sets the title of the user's live snippet and its updated time. A
+// snippet that does not belong to the user, or is expired or archived, is
+// reported as a NotFoundError, and a title the user already has as
+// ErrDuplicateTitle.
+func (m *SnippetModel) Rename(ctx context.Context, id, userID int, newTitle string) error {
+	defer m.observe("snippets.Rename", time.Now())
+
+	stmt := `UPDATE snippets SET title = ?, updated = UTC_TIMESTAMP()
+	WHERE id = ? AND user_id = ? AND expires > UTC_TIMESTAMP() AND archived = FALSE`
+
+	result, err := m.DB.ExecContext(ctx, stmt, newTitle, id, userID)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.Rename", constraintError("snippet", err))
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return wrapLogged(m.Logger, "snippets.Rename", err)
+	}
+
+	// As in setPinned, no rows changed either because the snippet is not
+	// the user's live snippet or because nothing changed, here within the
+	// same second.
+	stmt = `SELECT EXISTS(SELECT 1 FROM snippets
+	WHERE id = ? AND user_id = ? AND expires > UTC_TIMESTAMP() AND archived = FALSE)`
+
+	var exists bool
+	err = m.DB.QueryRowContext(ctx, stmt, id, userID).Scan(&exists)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.Rename", err)
+	}
+	if !exists {
+		return &NotFoundError{Entity: "snippet", ID: id}
+	}
+	return nil
+}
+
+// SetLanguage sets the language of the user's live snippet. A snippet that
+// does not belong to the user, or is expired or archived, is reported as a
+// NotFoundError. The language is not checked here; the caller validates it
+// against the configured list.
+func (m *SnippetModel) SetLanguage(ctx context.Context, id, userID int, language string) error {
+	defer m.observe("snippets.SetLanguage", time.Now())
+
+	stmt := `UPDATE snippets SET language = ?
+	WHERE id = ? AND user_id = ? AND expires > UTC_TIMESTAMP() AND archived = FALSE`
+
+	result, err := m.DB.ExecContext(ctx, stmt, language, id, userID)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.SetLanguage", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return wrapLogged(m.Logger, "snippets.SetLanguage", err)
+	}
+
+	// No rows changed either because the snippet is not the user's live
+	// snippet or because it already had this language.
+	stmt = `SELECT EXISTS(SELECT 1 FROM snippets
+	WHERE id = ? AND user_id = ? AND expires > UTC_TIMESTAMP() AND archived = FALSE)`
+
+	var exists bool
+	err = m.DB.QueryRowContext(ctx, stmt, id, userID).Scan(&exists)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.SetLanguage", err)
+	}
+	if !exists {
+		return &NotFoundError{Entity: "snippet", ID: id}
+	}
+	return nil
+}
+
+// Pin marks the user's snippet as pinned, so that it comes first in their
+// listings. A snippet that does not belong to the user is reported as a
+// NotFoundError.
+func (m *SnippetModel) Pin(ctx context.Context, id, userID int) error {
+	defer m.observe("snippets.Pin", time.Now())
+
+	return wrapLogged(m.Logger, "snippets.Pin", m.setPinned(ctx, id, userID, true))
+}
+
+// Unpin reverses Pin.
+func (m *SnippetModel) Unpin(ctx context.Context, id, userID int) error {
+	defer m.observe("snippets.Unpin", time.Now())
+
+	return wrapLogged(m.Logger, "snippets.Unpin", m.setPinned(ctx, id, userID, false))
+}
+
+func (m *SnippetModel) setPinned(ctx context.Context, id, userID int, pinned bool) error {
+	result, err := m.DB.ExecContext(ctx, `UPDATE snippets SET pinned = ? WHERE id = ? AND user_id = ?`, pinned, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	// No rows changed either because the snippet is not the user's or
+	// because it was already in the requested state.
+	var exists bool
+	err = m.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM snippets WHERE id = ? AND user_id = ?)`, id, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return &NotFoundError{Entity: "snippet", ID: id}
+	}
+	return nil
+}
+
+// Archive moves the user's unexpired snippet to their archive, where it is
+// kept, whatever its expiry, until Unarchive. A snippet that does not belong
+// to the user, or is not live, is reported as a NotFoundError.
+func (m *SnippetModel) Archive(ctx context.Context, id, userID int) error {
+	defer m.observe("snippets.Archive", time.Now())
+
+	stmt := `UPDATE snippets SET archived = TRUE, archived_at = UTC_TIMESTAMP()
+	WHERE id = ? AND user_id = ? AND expires > UTC_TIMESTAMP() AND archived = FALSE`
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.Archive", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return wrapLogged(m.Logger, "snippets.Archive", err)
+	}
+	return &NotFoundError{Entity: "snippet", ID: id}
+}
+
+// Unarchive returns the user's archived snippet to the site. It is live
+// again unless it expired while archived. A snippet that does not belong to
+// the user, or is not archived, is reported as a NotFoundError.
+func (m *SnippetModel) Unarchive(ctx context.Context, id, userID int) error {
+	defer m.observe("snippets.Unarchive", time.Now())
+
+	stmt := `UPDATE snippets SET archived = FALSE, archived_at = NULL
+	WHERE id = ? AND user_id = ? AND archived = TRUE`
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.Unarchive", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return wrapLogged(m.Logger, "snippets.Unarchive", err)
+	}
+	return &NotFoundError{Entity: "snippet", ID: id}
 }
 
-func (m SnippetModel) Latest() ([]Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+// ListArchived returns one page of the user's archived snippets, most
+// recently archived first, along with the total number archived. Expired
+// snippets are included, as archiving keeps them, and externally stored
+// content is read in.
+func (m *SnippetModel) ListArchived(ctx context.Context, userID, page, pageSize int) ([]*Snippet, int, error) {
+	defer m.observe("snippets.ListArchived", time.Now())
 
-	rows, err := m.DB.Query(stmt)
+	paging := SnippetFilters{Page: page, PageSize: pageSize}
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets WHERE user_id = ? AND archived = TRUE`, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, wrapLogged(m.Logger, "snippets.ListArchived", err)
+	}
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE user_id = ? AND archived = TRUE
+	ORDER BY archived_at DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID, paging.limit(), paging.offset())
 	if err != nil {
-		return nil, err
+		return nil, 0, wrapLogged(m.Logger, "snippets.ListArchived", err)
 	}
 	defer rows.Close()
 
-	var snippets []Snippet
+	var snippets []*Snippet
 
 	for rows.Next() {
-		var s Snippet
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		s := &Snippet{}
+		err = scanSnippet(rows, s)
 		if err != nil {
-			return nil, err
+			return nil, 0, wrapLogged(m.Logger, "snippets.ListArchived", err)
 		}
 		snippets = append(snippets, s)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, wrapLogged(m.Logger, "snippets.ListArchived", err)
 	}
 
-	return snippets, nil
+	// Archived snippets cannot be viewed, so the page shows their content.
+	for _, s := range snippets {
+		if s.ContentExternal {
+			s.Content, err = m.readExternal(ctx, s.ID)
+			if err != nil {
+				return nil, 0, wrapLogged(m.Logger, "snippets.ListArchived", err)
+			}
+		}
+	}
+
+	return snippets, total, nil
+}
+
+// GetPublicByUser returns one page of the user's snippets that anyone may
+// see, newest first, along with the total number of them, for a public
+// profile page. Unlike List filtered by user, which serves the user's own
+// listing, it always leaves out unlisted, archived and expired snippets, so
+// it cannot show a visitor something only the owner should see.
+func (m *SnippetModel) GetPublicByUser(ctx context.Context, userID, page, pageSize int) ([]*Snippet, int, error) {
+	defer m.observe("snippets.GetPublicByUser", time.Now())
+
+	paging := SnippetFilters{Page: page, PageSize: pageSize}
+	where := ` WHERE user_id = ? AND unlisted = FALSE AND archived = FALSE AND expires > UTC_TIMESTAMP()`
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets`+where, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, wrapLogged(m.Logger, "snippets.GetPublicByUser", err)
+	}
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets` + where + `
+	ORDER BY created DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID, paging.limit(), paging.offset())
+	if err != nil {
+		return nil, 0, wrapLogged(m.Logger, "snippets.GetPublicByUser", err)
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = scanSnippet(rows, s)
+		if err != nil {
+			return nil, 0, wrapLogged(m.Logger, "snippets.GetPublicByUser", err)
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, wrapLogged(m.Logger, "snippets.GetPublicByUser", err)
+	}
+
+	return snippets, total, nil
+}
+
+// SetFeatured sets whether the snippet is featured on the home page.
+func (m *SnippetModel) SetFeatured(ctx context.Context, id int, featured bool) error {
+	defer m.observe("snippets.SetFeatured", time.Now())
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE snippets SET featured = ? WHERE id = ?`, featured, id)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.SetFeatured", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return wrapLogged(m.Logger, "snippets.SetFeatured", err)
+	}
+
+	// As in setPinned, no rows changed either because there is no such
+	// snippet or because it was already in the requested state.
+	var exists bool
+	err = m.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM snippets WHERE id = ?)`, id).Scan(&exists)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.SetFeatured", err)
+	}
+	if !exists {
+		return &NotFoundError{Entity: "snippet", ID: id}
+	}
+	return nil
+}
+
+// FeaturedLimit is the most snippets ListFeatured returns.
+const FeaturedLimit = 10
+
+// ListFeatured returns up to FeaturedLimit unexpired, listed, featured
+// snippets, newest first.
+func (m *SnippetModel) ListFeatured(ctx context.Context) ([]*Snippet, error) {
+	defer m.observe("snippets.ListFeatured", time.Now())
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE featured = TRUE AND expires > UTC_TIMESTAMP() AND archived = FALSE AND unlisted = FALSE
+	ORDER BY created DESC, id DESC
+	LIMIT ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, FeaturedLimit)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.ListFeatured", err)
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = scanSnippet(rows, s)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.ListFeatured", err)
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.ListFeatured", err)
+	}
+
+	return snippets, nil
+}
+
+// RecordSpamDecision stores the spam filter's action and matched rule on the
+// snippet for moderators, and sets whether it is unlisted.
+func (m *SnippetModel) RecordSpamDecision(ctx context.Context, id int, action, rule string, unlisted bool) error {
+	defer m.observe("snippets.RecordSpamDecision", time.Now())
+
+	stmt := `UPDATE snippets SET spam_action = ?, spam_rule = ?, unlisted = ? WHERE id = ?`
+
+	result, err := m.DB.ExecContext(ctx, stmt, action, rule, unlisted, id)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.RecordSpamDecision", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return &NotFoundError{Entity: "snippet", ID: id}
+	}
+	return nil
+}
+
+func (m SnippetModel) Get(ctx context.Context, id int) (Snippet, error) {
+	defer m.observe("snippets.Get", time.Now())
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND archived = FALSE AND id = ?`
+
+	row := m.DB.QueryRowContext(ctx, stmt, id)
+
+	var s Snippet
+
+	err := scanSnippet(row, &s)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Snippet{}, &NotFoundError{Entity: "snippet", ID: id}
+		} else {
+			return Snippet{}, wrapLogged(m.Logger, "snippets.Get", err)
+		}
+	}
+
+	if s.ContentExternal {
+		s.Content, err = m.readExternal(ctx, id)
+		if err != nil {
+			return Snippet{}, wrapLogged(m.Logger, "snippets.Get", err)
+		}
+	}
+	return s, nil
+}
+
+func (m *SnippetModel) readExternal(ctx context.Context, id int) (string, error) {
+	rc, err := m.Store.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// OpenContent returns a reader over the content of an unexpired snippet,
+// streaming it from the ContentStore when it is held externally.
+func (m *SnippetModel) OpenContent(ctx context.Context, id int) (io.ReadCloser, error) {
+	defer m.observe("snippets.OpenContent", time.Now())
+
+	stmt := `SELECT content, content_external FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND archived = FALSE AND id = ?`
+
+	var content string
+	var external bool
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&content, &external)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError{Entity: "snippet", ID: id}
+		}
+		return nil, wrapLogged(m.Logger, "snippets.OpenContent", err)
+	}
+
+	if external {
+		return m.Store.Get(ctx, id)
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+// Delete removes a snippet and any externally stored content.
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	defer m.observe("snippets.Delete", time.Now())
+
+	var external bool
+
+	err := m.DB.QueryRowContext(ctx, `SELECT content_external FROM snippets WHERE id = ?`, id).Scan(&external)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &NotFoundError{Entity: "snippet", ID: id}
+		}
+		return wrapLogged(m.Logger, "snippets.Delete", err)
+	}
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM snippets WHERE id = ?`, id)
+	if err != nil {
+		return wrapLogged(m.Logger, "snippets.Delete", err)
+	}
+
+	if external {
+		return m.Store.Delete(ctx, id)
+	}
+	return nil
+}
+
+// SweepOrphans reconciles the ContentStore with the database. It deletes
+// stored content whose snippet no longer exists or has expired, unless the
+// snippet is archived, and returns as missing the IDs of snippets flagged as
+// external whose content is not in the store. It requires a Store
+// implementing ContentLister.
+func (m *SnippetModel) SweepOrphans(ctx context.Context) (removed int, missing []int, err error) {
+	defer m.observe("snippets.SweepOrphans", time.Now())
+
+	lister, ok := m.Store.(ContentLister)
+	if !ok {
+		return 0, nil, errors.New("models: content store cannot list its contents")
+	}
+
+	stored, err := lister.IDs(ctx)
+	if err != nil {
+		return 0, nil, wrapLogged(m.Logger, "snippets.SweepOrphans", err)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT id FROM snippets
+	WHERE content_external = TRUE AND (expires > UTC_TIMESTAMP() OR archived = TRUE)`)
+	if err != nil {
+		return 0, nil, wrapLogged(m.Logger, "snippets.SweepOrphans", err)
+	}
+	defer rows.Close()
+
+	live := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return 0, nil, wrapLogged(m.Logger, "snippets.SweepOrphans", err)
+		}
+		live[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return 0, nil, wrapLogged(m.Logger, "snippets.SweepOrphans", err)
+	}
+
+	for _, id := range stored {
+		if live[id] {
+			delete(live, id)
+			continue
+		}
+		err = m.Store.Delete(ctx, id)
+		if err != nil {
+			return removed, nil, wrapLogged(m.Logger, "snippets.SweepOrphans", err)
+		}
+		removed++
+	}
+
+	for id := range live {
+		missing = append(missing, id)
+	}
+	slices.Sort(missing)
+
+	return removed, missing, nil
+}
+
+// List returns one page of the unexpired snippets matching filters, along
+// with the total number of matching snippets. Unlisted snippets are only
+// included when filtering by user, and then the user's pinned snippets come
+// first.
+func (m *SnippetModel) List(ctx context.Context, filters SnippetFilters) ([]*Snippet, int, error) {
+	defer m.observe("snippets.List", time.Now())
+
+	var where strings.Builder
+	var args []any
+
+	where.WriteString(` WHERE expires > UTC_TIMESTAMP() AND archived = FALSE`)
+
+	// A user's own listing includes their unlisted snippets, so that shadow
+	// filtering is not apparent to them.
+	if filters.UserID != 0 {
+		where.WriteString(` AND user_id = ?`)
+		args = append(args, filters.UserID)
+	} else {
+		where.WriteString(` AND unlisted = FALSE`)
+	}
+
+	if filters.Language != "" {
+		where.WriteString(` AND language = ?`)
+		args = append(args, filters.Language)
+	}
+	if filters.Tag != "" {
+		where.WriteString(` AND id IN (SELECT snippet_id FROM snippet_tags WHERE tag = ?)`)
+		args = append(args, filters.Tag)
+	}
+	if filters.Query != "" {
+		where.WriteString(` AND (title LIKE ? OR content LIKE ?)`)
+		pattern := "%" + escapeLike(filters.Query) + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets`+where.String(), args...).Scan(&total)
+	if err != nil {
+		return nil, 0, wrapLogged(m.Logger, "snippets.List", err)
+	}
+
+	orderBy, ok := snippetSortClauses[filters.Sort]
+	if !ok {
+		orderBy = snippetSortClauses[SortCreatedDesc]
+	}
+	if filters.UserID != 0 {
+		orderBy = "pinned DESC, " + orderBy
+	}
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets` + where.String() +
+		` ORDER BY ` + orderBy + ` LIMIT ? OFFSET ?`
+	args = append(args, filters.limit(), filters.offset())
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, 0, wrapLogged(m.Logger, "snippets.List", err)
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = scanSnippet(rows, s)
+		if err != nil {
+			return nil, 0, wrapLogged(m.Logger, "snippets.List", err)
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, wrapLogged(m.Logger, "snippets.List", err)
+	}
+
+	return snippets, total, nil
+}
+
+// Search returns up to limit unexpired, listed snippets whose title or
+// content matches query, most relevant first. It uses the FULLTEXT index in
+// natural language mode, so content held in the ContentStore is not searched.
+func (m *SnippetModel) Search(ctx context.Context, query string, limit int) ([]*Snippet, error) {
+	defer m.observe("snippets.Search", time.Now())
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE MATCH(title, content) AGAINST(? IN NATURAL LANGUAGE MODE) AND expires > UTC_TIMESTAMP() AND archived = FALSE AND unlisted = FALSE
+	ORDER BY MATCH(title, content) AGAINST(? IN NATURAL LANGUAGE MODE) DESC, id DESC
+	LIMIT ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, query, query, limit)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.Search", err)
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = scanSnippet(rows, s)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.Search", err)
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.Search", err)
+	}
+
+	return snippets, nil
+}
+
+// similarQueryChars is how much of a snippet's title and content Similar
+// searches with, to bound the cost of the full-text query for long snippets.
+const similarQueryChars = 1000
+
+// Similar returns up to limit unexpired, listed snippets whose title or
+// content is most like that of the unexpired snippet with the given ID, which
+// is left out. Like Search it uses the FULLTEXT index in natural language
+// mode, so content held in the ContentStore is neither searched with nor
+// matched.
+func (m *SnippetModel) Similar(ctx context.Context, id int, limit int) ([]*Snippet, error) {
+	defer m.observe("snippets.Similar", time.Now())
+
+	// AGAINST only takes a constant, not a subquery, so the snippet's text is
+	// read first and passed in.
+	var title, content string
+	err := m.DB.QueryRowContext(ctx, `SELECT title, content FROM snippets WHERE id = ? AND expires > UTC_TIMESTAMP() AND archived = FALSE`, id).Scan(&title, &content)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError{Entity: "snippet", ID: id}
+		}
+		return nil, wrapLogged(m.Logger, "snippets.Similar", err)
+	}
+
+	query := []rune(title + "\n" + content)
+	query = query[:min(len(query), similarQueryChars)]
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE MATCH(title, content) AGAINST(? IN NATURAL LANGUAGE MODE) AND id <> ? AND expires > UTC_TIMESTAMP() AND archived = FALSE AND unlisted = FALSE
+	ORDER BY MATCH(title, content) AGAINST(? IN NATURAL LANGUAGE MODE) DESC, id DESC
+	LIMIT ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, string(query), id, string(query), limit)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.Similar", err)
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = scanSnippet(rows, s)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.Similar", err)
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.Similar", err)
+	}
+
+	return snippets, nil
+}
+
+// ListExpiringSoon returns the unexpired snippets that will expire within the
+// given duration, soonest first.
+func (m *SnippetModel) ListExpiringSoon(ctx context.Context, within time.Duration) ([]*Snippet, error) {
+	defer m.observe("snippets.ListExpiringSoon", time.Now())
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE expires BETWEEN UTC_TIMESTAMP() AND UTC_TIMESTAMP() + INTERVAL ? SECOND AND archived = FALSE
+	ORDER BY expires ASC, id ASC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, int64(within/time.Second))
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.ListExpiringSoon", err)
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = scanSnippet(rows, s)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.ListExpiringSoon", err)
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.ListExpiringSoon", err)
+	}
+
+	return snippets, nil
+}
+
+// GetCreatedBetween returns one page of the snippets created in the half-open
+// interval [from, to), oldest first, along with the total number in the
+// interval. Expired snippets are included. It returns ErrInvalidDateRange
+// unless from is before to.
+func (m *SnippetModel) GetCreatedBetween(ctx context.Context, from, to time.Time, page, pageSize int) ([]*Snippet, int, error) {
+	defer m.observe("snippets.GetCreatedBetween", time.Now())
+
+	if !from.Before(to) {
+		return nil, 0, ErrInvalidDateRange
+	}
+
+	paging := SnippetFilters{Page: page, PageSize: pageSize}
+	from, to = from.UTC(), to.UTC()
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets WHERE created >= ? AND created < ?`, from, to).Scan(&total)
+	if err != nil {
+		return nil, 0, wrapLogged(m.Logger, "snippets.GetCreatedBetween", err)
+	}
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE created >= ? AND created < ?
+	ORDER BY created ASC, id ASC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, from, to, paging.limit(), paging.offset())
+	if err != nil {
+		return nil, 0, wrapLogged(m.Logger, "snippets.GetCreatedBetween", err)
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = scanSnippet(rows, s)
+		if err != nil {
+			return nil, 0, wrapLogged(m.Logger, "snippets.GetCreatedBetween", err)
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, wrapLogged(m.Logger, "snippets.GetCreatedBetween", err)
+	}
+
+	return snippets, total, nil
+}
+
+// CountCreatedSince returns how many snippets the given owner key has created
+// at or after since, including snippets that have since expired.
+func (m *SnippetModel) CountCreatedSince(ctx context.Context, ownerKey string, since time.Time) (int, error) {
+	defer m.observe("snippets.CountCreatedSince", time.Now())
+
+	stmt := `SELECT COUNT(*) FROM snippets WHERE owner_key = ? AND created >= ?`
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, stmt, ownerKey, since.UTC()).Scan(&count)
+	return count, wrapLogged(m.Logger, "snippets.CountCreatedSince", err)
+}
+
+// Vacuum removes snippets whose content is identical to that of a newer
+// snippet by the same user, keeping the newest of each group, and returns
+// how many were (or, when dryRun is true, would be) deleted. Anonymous
+// snippets are treated as one user's. Content is compared by the indexed
+// content_hash column, so snippets without a hash are never removed, and
+// externally stored content is not considered.
+func (m *SnippetModel) Vacuum(ctx context.Context, dryRun bool) (int, error) {
+	defer m.observe("snippets.Vacuum", time.Now())
+
+	if dryRun {
+		stmt := `SELECT COUNT(*) FROM snippets s WHERE s.content_external = FALSE AND EXISTS (
+		SELECT 1 FROM snippets n
+		WHERE n.user_id <=> s.user_id AND n.content_hash = s.content_hash
+		AND n.content_external = FALSE
+		AND (n.created > s.created OR (n.created = s.created AND n.id > s.id)))`
+
+		var count int
+		err := m.DB.QueryRowContext(ctx, stmt).Scan(&count)
+		return count, wrapLogged(m.Logger, "snippets.Vacuum", err)
+	}
+
+	stmt := `DELETE s FROM snippets s
+	JOIN snippets n ON n.user_id <=> s.user_id AND n.content_hash = s.content_hash
+	AND (n.created > s.created OR (n.created = s.created AND n.id > s.id))
+	WHERE s.content_external = FALSE AND n.content_external = FALSE`
+
+	result, err := m.DB.ExecContext(ctx, stmt)
+	if err != nil {
+		return 0, wrapLogged(m.Logger, "snippets.Vacuum", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, wrapLogged(m.Logger, "snippets.Vacuum", err)
+	}
+	return int(count), nil
+}
+
+// SnippetSummary is a snippet without its content, for public listings. The
+// Excerpt holds at most SummaryExcerptChars characters from the start of the
+// content and is empty for content held in the ContentStore.
+type SnippetSummary struct {
+	ID       int
+	Title    string
+	Created  time.Time
+	Updated  time.Time
+	Language string
+	Excerpt  string
+}
+
+// SummaryExcerptChars is the number of content characters selected for
+// SnippetSummary.Excerpt.
+const SummaryExcerptChars = 200
+
+// LatestByUser returns up to limit of the user's unexpired, listed
+// snippets, pinned first and then newest first, in language if it is not
+// empty. Only the start of each snippet's content is read from the
+// database. An unknown user has no snippets.
+func (m *SnippetModel) LatestByUser(ctx context.Context, userID int, language string, limit int) ([]SnippetSummary, error) {
+	defer m.observe("snippets.LatestByUser", time.Now())
+
+	stmt := `SELECT id, title, created, updated, language, LEFT(content, ?) FROM snippets
+	WHERE user_id = ? AND expires > UTC_TIMESTAMP() AND archived = FALSE AND unlisted = FALSE AND (? = '' OR language = ?)
+	ORDER BY pinned DESC, created DESC, id DESC
+	LIMIT ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, SummaryExcerptChars, userID, language, language, limit)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.LatestByUser", err)
+	}
+	defer rows.Close()
+
+	var summaries []SnippetSummary
+
+	for rows.Next() {
+		var s SnippetSummary
+		err = rows.Scan(&s.ID, &s.Title, &s.Created, &s.Updated, &s.Language, &s.Excerpt)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.LatestByUser", err)
+		}
+		summaries = append(summaries, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.LatestByUser", err)
+	}
+
+	return summaries, nil
+}
+
+// TopContributors returns up to limit users ordered by how many unexpired
+// snippets they own, most first.
+func (m *SnippetModel) TopContributors(ctx context.Context, limit int) ([]UserSnippetCount, error) {
+	defer m.observe("snippets.TopContributors", time.Now())
+
+	stmt := `SELECT u.id, u.name, COUNT(*) AS snippet_count FROM snippets s
+	JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.archived = FALSE
+	GROUP BY u.id, u.name
+	ORDER BY snippet_count DESC, u.id ASC
+	LIMIT ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, limit)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.TopContributors", err)
+	}
+	defer rows.Close()
+
+	var counts []UserSnippetCount
+
+	for rows.Next() {
+		var c UserSnippetCount
+		err = rows.Scan(&c.UserID, &c.Name, &c.Count)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.TopContributors", err)
+		}
+		counts = append(counts, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.TopContributors", err)
+	}
+
+	return counts, nil
+}
+
+// MostRecentByLanguage returns up to limit of the newest unexpired, listed
+// snippets in each of languages, newest first, keyed by language. Languages
+// without any snippets are left out of the map. All the languages are
+// fetched in one UNION ALL query.
+func (m *SnippetModel) MostRecentByLanguage(ctx context.Context, languages []string, limit int) (map[string][]*Snippet, error) {
+	defer m.observe("snippets.MostRecentByLanguage", time.Now())
+
+	recent := make(map[string][]*Snippet)
+	if len(languages) == 0 || limit <= 0 {
+		return recent, nil
+	}
+
+	// Each SELECT is parenthesised so that it can have its own ORDER BY and
+	// LIMIT.
+	selects := make([]string, len(languages))
+	args := make([]any, 0, 2*len(languages))
+	for i, language := range languages {
+		selects[i] = `(SELECT ` + snippetColumns + ` FROM snippets
+		WHERE language = ? AND expires > UTC_TIMESTAMP() AND archived = FALSE AND unlisted = FALSE
+		ORDER BY created DESC, id DESC LIMIT ?)`
+		args = append(args, language, limit)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, strings.Join(selects, " UNION ALL "), args...)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.MostRecentByLanguage", err)
+	}
+	defer rows.Close()
+
+	// UNION ALL does not promise to keep each SELECT's order, so the rows
+	// are put back in order below.
+	for rows.Next() {
+		s := &Snippet{}
+		err = scanSnippet(rows, s)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.MostRecentByLanguage", err)
+		}
+		recent[s.Language] = append(recent[s.Language], s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.MostRecentByLanguage", err)
+	}
+
+	for _, snippets := range recent {
+		slices.SortFunc(snippets, func(a, b *Snippet) int {
+			if c := b.Created.Compare(a.Created); c != 0 {
+				return c
+			}
+			return b.ID - a.ID
+		})
+	}
+
+	return recent, nil
+}
+
+// CountExpired returns the number of expired snippets still waiting to be
+// purged.
+func (m *SnippetModel) CountExpired(ctx context.Context) (int, error) {
+	defer m.observe("snippets.CountExpired", time.Now())
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets WHERE expires < UTC_TIMESTAMP() AND archived = FALSE`).Scan(&count)
+	if err != nil {
+		return 0, wrapLogged(m.Logger, "snippets.CountExpired", err)
+	}
+	return count, nil
+}
+
+// StorageSizeBytes returns the total size in bytes of the content of the
+// unexpired snippets. Content held in the ContentStore is not in the
+// content column, so it is not counted.
+func (m *SnippetModel) StorageSizeBytes(ctx context.Context) (int64, error) {
+	defer m.observe("snippets.StorageSizeBytes", time.Now())
+
+	var size int64
+	err := m.DB.QueryRowContext(ctx, `SELECT COALESCE(SUM(LENGTH(content)), 0) FROM snippets WHERE expires > UTC_TIMESTAMP() AND archived = FALSE`).Scan(&size)
+	if err != nil {
+		return 0, wrapLogged(m.Logger, "snippets.StorageSizeBytes", err)
+	}
+	return size, nil
+}
+
+// CountByLanguage returns the number of unexpired snippets for each
+// language. Snippets without a language are counted under "".
+func (m *SnippetModel) CountByLanguage(ctx context.Context) (map[string]int, error) {
+	defer m.observe("snippets.CountByLanguage", time.Now())
+
+	stmt := `SELECT language, COUNT(*) FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND archived = FALSE
+	GROUP BY language`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.CountByLanguage", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+
+	for rows.Next() {
+		var (
+			language string
+			count    int
+		)
+		err = rows.Scan(&language, &count)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.CountByLanguage", err)
+		}
+		counts[language] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.CountByLanguage", err)
+	}
+
+	return counts, nil
+}
+
+// LanguageCounts returns the number of unexpired, listed snippets in each
+// language, most common first. Snippets without a language are left out.
+func (m *SnippetModel) LanguageCounts(ctx context.Context) ([]LanguageCount, error) {
+	defer m.observe("snippets.LanguageCounts", time.Now())
+
+	stmt := `SELECT language, COUNT(*) FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND archived = FALSE AND unlisted = FALSE AND language <> ''
+	GROUP BY language
+	ORDER BY COUNT(*) DESC, language ASC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.LanguageCounts", err)
+	}
+	defer rows.Close()
+
+	var counts []LanguageCount
+
+	for rows.Next() {
+		var c LanguageCount
+		err = rows.Scan(&c.Language, &c.Count)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.LanguageCounts", err)
+		}
+		counts = append(counts, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.LanguageCounts", err)
+	}
+
+	return counts, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
 }
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSnippetModelDuplicate(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	var users [2]int
+	for i := range users {
+		email := fmt.Sprintf("duplicate-%d-%d@example.com", i, time.Now().UnixNano())
+		result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Copier', ?, '', UTC_TIMESTAMP())`, email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE id = ?`, id) })
+		users[i] = int(id)
+	}
+	owner, other := users[0], users[1]
+
+	insert := func(title, set string) int {
+		t.Helper()
+		id, err := m.Insert(t.Context(), title, title+" haiku.", 1, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+		if set != "" {
+			_, err = db.Exec(`UPDATE snippets SET `+set+` WHERE id = ?`, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return id
+	}
+
+	// The owner can still duplicate their own expired, unlisted snippet. Its
+	// content hash is cleared so that the copy does not clash with it.
+	id := insert("Original", `language = 'go', unlisted = TRUE, expires = UTC_TIMESTAMP() - INTERVAL 1 DAY`)
+	_, err := db.Exec(`UPDATE snippets SET content_hash = NULL WHERE id = ?`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyID, err := m.Duplicate(t.Context(), id, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, copyID) })
+
+	if copyID == id {
+		t.Fatalf("Duplicate returned the original ID %d", id)
+	}
+
+	s, err := m.Get(t.Context(), copyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "Copy of Original" || s.Content != "Original haiku." || s.Language != "go" || !s.Unlisted {
+		t.Errorf("copy = %+v", s)
+	}
+	if want := s.Created.AddDate(0, 0, DefaultExpiryDays); !s.Expires.Equal(want) {
+		t.Errorf("copy expires %s; want %s", s.Expires, want)
+	}
+
+	// Another user can copy a live, listed snippet.
+	listed := insert("Listed", "")
+	copyID, err = m.Duplicate(t.Context(), listed, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, copyID) })
+
+	// But not one they could not view.
+	for name, set := range map[string]string{
+		"Archived": `archived = TRUE, archived_at = UTC_TIMESTAMP()`,
+		"Unlisted": `unlisted = TRUE`,
+		"Expired":  `expires = UTC_TIMESTAMP() - INTERVAL 1 DAY`,
+	} {
+		id := insert(name, set)
+		for _, userID := range []int{other, 0} {
+			_, err = m.Duplicate(t.Context(), id, userID)
+			if !errors.Is(err, ErrNoRecord) {
+				t.Errorf("Duplicate of another user's %s snippet by %d: err = %v; want ErrNoRecord", name, userID, err)
+			}
+		}
+	}
+
+	_, err = m.Duplicate(t.Context(), 1<<30, 0)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Duplicate of a missing snippet: err = %v; want ErrNoRecord", err)
+	}
+}
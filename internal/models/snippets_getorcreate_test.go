@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnippetModelGetOrCreate(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	// A unique title keeps reruns against the same database independent.
+	title := fmt.Sprintf("Retried create %d", time.Now().UnixNano())
+	t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE title = ?`, title) })
+
+	id, created, err := m.GetOrCreate(t.Context(), title, "A haiku.", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Error("first call did not create a snippet")
+	}
+
+	again, created, err := m.GetOrCreate(t.Context(), title, "A haiku.", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || again != id {
+		t.Errorf("second call = (%d, %t); want (%d, false)", again, created, id)
+	}
+
+	other, created, err := m.GetOrCreate(t.Context(), title, "A different haiku.", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || other == id {
+		t.Errorf("different content = (%d, %t); want a new snippet", other, created)
+	}
+}
+
+func TestSnippetModelGetOrCreateConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	title := fmt.Sprintf("Concurrent create %d", time.Now().UnixNano())
+	t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE title = ?`, title) })
+
+	const callers = 8
+
+	var (
+		wg      sync.WaitGroup
+		ids     [callers]int
+		created [callers]bool
+		errs    [callers]error
+	)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids[i], created[i], errs[i] = m.GetOrCreate(t.Context(), title, "A haiku.", 7, 0)
+		}()
+	}
+	wg.Wait()
+
+	var creates int
+	for i := range callers {
+		if errs[i] != nil {
+			t.Fatalf("call %d: %v", i, errs[i])
+		}
+		if ids[i] != ids[0] {
+			t.Errorf("call %d returned snippet %d; want %d", i, ids[i], ids[0])
+		}
+		if created[i] {
+			creates++
+		}
+	}
+	if creates != 1 {
+		t.Errorf("%d calls created a snippet; want 1", creates)
+	}
+}
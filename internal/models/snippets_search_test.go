@@ -0,0 +1,180 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// newTestDB opens the MySQL database named by TEST_DSN and applies any
+// pending migrations. The test is skipped when TEST_DSN is not set. The
+// database should be a disposable one: tests insert rows into it.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DSN not set; skipping MySQL integration test")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = Migrate(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSnippetModelSearch(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	insert := func(title, content string) int {
+		t.Helper()
+
+		id, err := m.Insert(t.Context(), title, content, 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+		return id
+	}
+
+	best := insert("Golang snippet", "A golang snippet: the golang way to write a snippet is a short golang snippet.")
+	weak := insert("Shopping list", "Eggs, milk, bread and a book about golang.")
+	unrelated := insert("An old silent pond", "A frog jumps into the pond, splash! Silence again.")
+
+	results, err := m.Search(t.Context(), "golang snippet", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) == 0 {
+		t.Fatal("Search returned no snippets")
+	}
+	if results[0].ID != best {
+		t.Errorf("first result is snippet %d; want %d", results[0].ID, best)
+	}
+
+	var foundWeak bool
+	for _, s := range results {
+		switch s.ID {
+		case weak:
+			foundWeak = true
+		case unrelated:
+			t.Errorf("unrelated snippet %d was returned", unrelated)
+		}
+	}
+	if !foundWeak {
+		t.Errorf("snippet %d, which mentions golang, was not returned", weak)
+	}
+}
+
+func TestSnippetModelSimilar(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	insert := func(title, content string) int {
+		t.Helper()
+
+		id, err := m.Insert(t.Context(), title, content, 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+		return id
+	}
+
+	source := insert("Goroutine leak", "A goroutine blocked on a channel send leaks when nobody receives from the channel.")
+	related := insert("Channel patterns", "Closing a channel wakes every goroutine waiting to receive from the channel.")
+	unrelated := insert("An old silent pond", "A frog jumps into the pond, splash! Silence again.")
+
+	results, err := m.Similar(t.Context(), source, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) == 0 || results[0].ID != related {
+		t.Fatalf("Similar = %v; want snippet %d first", results, related)
+	}
+	for _, s := range results {
+		if s.ID == source {
+			t.Errorf("Similar returned the snippet itself")
+		}
+		if s.ID == unrelated {
+			t.Errorf("unrelated snippet %d was returned", unrelated)
+		}
+	}
+
+	_, err = m.Similar(t.Context(), 1<<30, 5)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Similar of a missing snippet: err = %v; want ErrNoRecord", err)
+	}
+}
+
+func TestSnippetModelMostRecentByLanguage(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	// Languages of their own, so that other snippets in the database do not
+	// show up.
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	first, second := "lang-a-"+suffix, "lang-b-"+suffix
+
+	insert := func(title, language string, age time.Duration) int {
+		t.Helper()
+
+		id, err := m.Insert(t.Context(), title+" "+suffix, title+" content "+suffix, 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+
+		_, err = db.Exec(`UPDATE snippets SET language = ?, created = created - INTERVAL ? SECOND WHERE id = ?`, language, int(age/time.Second), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	oldest := insert("Oldest", first, 3*time.Hour)
+	middle := insert("Middle", first, 2*time.Hour)
+	newest := insert("Newest", first, time.Hour)
+	other := insert("Other", second, time.Hour)
+
+	recent, err := m.MostRecentByLanguage(t.Context(), []string{first, second, "lang-none-" + suffix}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	for _, s := range recent[first] {
+		ids = append(ids, s.ID)
+	}
+	if !slices.Equal(ids, []int{newest, middle}) {
+		t.Errorf("%s = %v; want %v, not %d", first, ids, []int{newest, middle}, oldest)
+	}
+	if len(recent[second]) != 1 || recent[second][0].ID != other {
+		t.Errorf("%s = %v; want snippet %d", second, recent[second], other)
+	}
+	if _, ok := recent["lang-none-"+suffix]; ok || len(recent) != 2 {
+		t.Errorf("MostRecentByLanguage returned %d languages; want 2", len(recent))
+	}
+
+	recent, err = m.MostRecentByLanguage(t.Context(), nil, 2)
+	if err != nil || len(recent) != 0 {
+		t.Errorf("no languages: %v, %v; want an empty map", recent, err)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build seed
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// InsertWithID stores a snippet under the given ID instead of the next
+// auto-increment value, for seeding and data migration scripts that need to
+// keep existing IDs. The snippet expires the given number of days after
+// created. It is only compiled with the seed build tag, so it is never part
+// of the web application.
+func (m *SnippetModel) InsertWithID(ctx context.Context, id int, title, content string, expires int, created time.Time) error {
+	defer m.observe("snippets.InsertWithID", time.Now())
+
+	if id < 1 {
+		return fmt.Errorf("snippets.InsertWithID: invalid id %d", id)
+	}
+
+	stmt := `INSERT INTO snippets (id, title, content, content_hash, created, updated, expires)
+    VALUES(?, ?, ?, ?, ?, ?, DATE_ADD(?, INTERVAL ? DAY))`
+
+	created = created.UTC()
+
+	_, err := m.DB.ExecContext(ctx, stmt, id, title, content, hashContent(content), created, created, created, expires)
+	return wrapLogged(m.Logger, "snippets.InsertWithID", constraintError("snippet", err))
+}
@@ -0,0 +1,51 @@
+//go:build seed
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestSnippetModelInsertWithID(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	// An ID far above any the auto-increment will reach during the tests.
+	id := 900_000_000 + int(time.Now().UnixNano()%1_000_000)
+	created := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	title := fmt.Sprintf("Seeded %d", id)
+
+	err := m.InsertWithID(t.Context(), id, title, "A seeded haiku.", 7, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+
+	s, err := m.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ID != id || s.Title != title || !s.Created.Equal(created) || !s.Expires.Equal(created.AddDate(0, 0, 7)) {
+		t.Errorf("Get(%d) = %+v; want the seeded snippet created at %v", id, s, created)
+	}
+
+	// A second snippet with the same ID is refused.
+	err = m.InsertWithID(t.Context(), id, "Another title", "Other content.", 7, created)
+	var mySQLError *mysql.MySQLError
+	if !errors.As(err, &mySQLError) || mySQLError.Number != 1062 {
+		t.Errorf("InsertWithID with a taken ID error = %v; want a duplicate key error", err)
+	}
+	if errors.Is(err, ErrDuplicateTitle) || errors.Is(err, ErrDuplicateContent) {
+		t.Errorf("InsertWithID with a taken ID error = %v; want it not to match the title or content sentinels", err)
+	}
+
+	err = m.InsertWithID(t.Context(), 0, "Zero", "Zero content.", 7, created)
+	if err == nil {
+		t.Error("InsertWithID(0) succeeded; want an error")
+	}
+}
@@ -0,0 +1,642 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestSnippetCounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		words   int
+		lines   int
+	}{
+		{"empty", "", 0, 0},
+		{"single word", "haiku", 1, 1},
+		{"multiple lines", "An old silent pond\nA frog jumps into the pond\nsplash! Silence again.", 13, 3},
+		{"only whitespace", " \t\n  \n", 0, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Snippet{Content: tt.content}
+
+			if got := s.WordCount(); got != tt.words {
+				t.Errorf("WordCount() = %d; want %d", got, tt.words)
+			}
+			if got := s.LineCount(); got != tt.lines {
+				t.Errorf("LineCount() = %d; want %d", got, tt.lines)
+			}
+		})
+	}
+}
+
+func TestSnippetEdited(t *testing.T) {
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		updated time.Time
+		want    bool
+	}{
+		{"never updated", created, false},
+		{"updated within a minute", created.Add(time.Minute), false},
+		{"updated later", created.Add(time.Minute + time.Second), true},
+	}
+
+	for _, tt := range tests {
+		s := Snippet{Created: created, Updated: tt.updated}
+		if got := s.Edited(); got != tt.want {
+			t.Errorf("%s: Edited() = %t; want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSnippetHashContent(t *testing.T) {
+	a := Snippet{Content: "An old silent pond"}
+	b := Snippet{ID: 2, Title: "Another title", Content: "An old silent pond"}
+
+	hash := a.HashContent()
+	if len(hash) != 64 || strings.Trim(hash, "0123456789abcdef") != "" {
+		t.Fatalf("HashContent() = %q; want 64 lowercase hex digits", hash)
+	}
+	if again := a.HashContent(); again != hash {
+		t.Errorf("HashContent() = %q, then %q", hash, again)
+	}
+	if got := b.HashContent(); got != hash {
+		t.Errorf("HashContent() of the same content = %q; want %q", got, hash)
+	}
+	if got := (Snippet{Content: "An old silent pond."}).HashContent(); got == hash {
+		t.Errorf("HashContent() of different content = %q, the same hash", got)
+	}
+	// The hash of empty content is the well-known SHA-256 of nothing.
+	if got := (Snippet{}).HashContent(); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("HashContent() of empty content = %q", got)
+	}
+}
+
+func TestCopyTitle(t *testing.T) {
+	if got := CopyTitle("Hello"); got != "Copy of Hello" {
+		t.Errorf("CopyTitle(Hello) = %q", got)
+	}
+
+	long := strings.Repeat("é", MaxTitleChars)
+	got := CopyTitle(long)
+	if n := utf8.RuneCountInString(got); n != MaxTitleChars {
+		t.Errorf("CopyTitle of a %d character title has %d characters; want %d", MaxTitleChars, n, MaxTitleChars)
+	}
+	if !strings.HasPrefix(got, "Copy of é") || !utf8.ValidString(got) {
+		t.Errorf("CopyTitle = %q", got)
+	}
+}
+
+func TestConstraintErrorDuplicate(t *testing.T) {
+	err := constraintError("snippet", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1-Hello' for key 'snippets.snippets_uc_user_title'"})
+	if !errors.Is(err, ErrDuplicateTitle) {
+		t.Errorf("constraintError = %v; want ErrDuplicateTitle", err)
+	}
+
+	err = constraintError("snippet", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1-e3b0c442' for key 'snippets.snippets_uc_user_content_hash'"})
+	if !errors.Is(err, ErrDuplicateContent) {
+		t.Errorf("constraintError = %v; want ErrDuplicateContent", err)
+	}
+
+	// Other duplicate keys are left alone.
+	other := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'abc' for key 'bundles.bundles_uc_token'"}
+	if err := constraintError("bundle", other); err != other {
+		t.Errorf("constraintError = %v; want the driver error", err)
+	}
+}
+
+func TestSnippetModelInsertInvalid(t *testing.T) {
+	// Invalid input is rejected before the database is used, so the model
+	// needs no connection.
+	m := &SnippetModel{}
+
+	tests := []struct {
+		name    string
+		title   string
+		content string
+		expires int
+		field   string
+	}{
+		{"blank title", "  ", "content", 7, "title"},
+		{"empty content", "Title", "", 7, "content"},
+		{"zero expiry", "Title", "content", 0, "expires"},
+		{"negative expiry", "Title", "content", -1, "expires"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Insert(t.Context(), tt.title, tt.content, tt.expires, 1)
+			if !errors.Is(err, ErrInvalidInput) {
+				t.Fatalf("Insert = %v; want ErrInvalidInput", err)
+			}
+			var invalid *InvalidInputError
+			if !errors.As(err, &invalid) || invalid.Field != tt.field {
+				t.Errorf("Insert = %#v; want an InvalidInputError for %s", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestSnippetModelInsertDuplicateTitle(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	email := fmt.Sprintf("titles-%d@example.com", time.Now().UnixNano())
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Titles', ?, '', UTC_TIMESTAMP())`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	userID := int(id)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM snippets WHERE user_id = ?`, userID)
+		db.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	})
+
+	_, err = m.Insert(t.Context(), "Same title", "A haiku.", 7, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Insert(t.Context(), "Same title", "Another haiku.", 7, userID)
+	if !errors.Is(err, ErrDuplicateTitle) {
+		t.Errorf("second Insert: err = %v; want ErrDuplicateTitle", err)
+	}
+
+	_, err = m.Insert(t.Context(), "Another title", "A haiku.", 7, userID)
+	if !errors.Is(err, ErrDuplicateContent) {
+		t.Errorf("Insert of the same content: err = %v; want ErrDuplicateContent", err)
+	}
+
+	// Anonymous snippets are not constrained.
+	for range 2 {
+		id, err := m.Insert(t.Context(), "Same title", "A haiku.", 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+	}
+}
+
+func TestSnippetLogValue(t *testing.T) {
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := &Snippet{
+		ID:      7,
+		Title:   "An old silent pond",
+		Content: "not logged",
+		UserID:  3,
+		Created: created,
+		Expires: created.AddDate(0, 0, 7),
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	logger.Info("snippet created", "snippet", s)
+
+	var entry struct {
+		Snippet map[string]any `json:"snippet"`
+	}
+	err := json.Unmarshal(buf.Bytes(), &entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"id":      float64(7),
+		"title":   "An old silent pond",
+		"user_id": float64(3),
+		"created": "2025-06-01T12:00:00Z",
+		"expires": "2025-06-08T12:00:00Z",
+	}
+	if !maps.Equal(entry.Snippet, want) {
+		t.Errorf("snippet = %v; want %v", entry.Snippet, want)
+	}
+}
+
+func TestSnippetModelCancelledContext(t *testing.T) {
+	// Nothing listens on port 1: a query that got as far as connecting
+	// would fail with a network error instead.
+	db, err := sql.Open("mysql", "web:pass@tcp(127.0.0.1:1)/snippetbox?parseTime=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var logs bytes.Buffer
+	m := &SnippetModel{DB: db, Logger: slog.New(slog.NewTextHandler(&logs, nil))}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	calls := map[string]func() error{
+		"Insert": func() error {
+			_, err := m.Insert(ctx, "Title", "Content", 7, 0)
+			return err
+		},
+		"Get": func() error {
+			_, err := m.Get(ctx, 1)
+			return err
+		},
+		"Update": func() error {
+			return m.Update(ctx, 1, "Title", "Content")
+		},
+		"Pin": func() error {
+			return m.Pin(ctx, 1, 1)
+		},
+		"GetOrCreate": func() error {
+			_, _, err := m.GetOrCreate(ctx, "Title", "Content", 7, 0)
+			return err
+		},
+		"CountCreatedSince": func() error {
+			_, err := m.CountCreatedSince(ctx, UserOwnerKey(1), time.Now())
+			return err
+		},
+		"List": func() error {
+			_, _, err := m.List(ctx, SnippetFilters{})
+			return err
+		},
+		"LatestByUser": func() error {
+			_, err := m.LatestByUser(ctx, 1, "", 5)
+			return err
+		},
+		"RecentlyViewed": func() error {
+			_, err := m.RecentlyViewed(ctx, 1, 5)
+			return err
+		},
+		"GetBundle": func() error {
+			_, err := m.GetBundle(ctx, "token")
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			err := call()
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("error = %v; want context.Canceled", err)
+			}
+		})
+	}
+
+	if logs.Len() > 0 {
+		t.Errorf("cancellations were logged as failures:\n%s", logs.String())
+	}
+}
+
+func TestSnippetModelVacuum(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	email := fmt.Sprintf("vacuum-%d@example.com", time.Now().UnixNano())
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Vacuum', ?, '', UTC_TIMESTAMP())`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, _ := result.LastInsertId()
+	userID := int(uid)
+
+	content := fmt.Sprintf("A repeated haiku %d.", time.Now().UnixNano())
+
+	// A user cannot have two snippets with the same content, so the
+	// duplicates are anonymous.
+	var anonymous []int
+	for i := range 3 {
+		id, err := m.Insert(t.Context(), fmt.Sprintf("Copy %d", i), content, 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		anonymous = append(anonymous, id)
+	}
+	other, err := m.Insert(t.Context(), "Mine", content, 7, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM snippets WHERE content_hash = ?`, hashContent(content))
+		db.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	})
+
+	exists := func(id int) bool {
+		t.Helper()
+
+		var n int
+		err := db.QueryRow(`SELECT COUNT(*) FROM snippets WHERE id = ?`, id).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n == 1
+	}
+
+	count, err := m.Vacuum(t.Context(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count < 2 {
+		t.Errorf("dry run count = %d; want at least the 2 older copies", count)
+	}
+	if !exists(anonymous[0]) {
+		t.Fatal("dry run deleted a snippet")
+	}
+
+	_, err = m.Vacuum(t.Context(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range anonymous {
+		if want := i == len(anonymous)-1; exists(id) != want {
+			t.Errorf("copy %d exists = %t; want %t", i, !want, want)
+		}
+	}
+	if !exists(other) {
+		t.Error("another user's snippet with the same content was deleted")
+	}
+}
+
+func TestSnippetModelInsertOver64KB(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	// One byte more than a TEXT column holds, and below -content-hard-limit.
+	content := fmt.Sprintf("%d\n", time.Now().UnixNano()) + strings.Repeat("x", 64<<10)
+
+	id, err := m.Insert(t.Context(), "Large haiku", content, 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+
+	s, err := m.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Content != content {
+		t.Errorf("Get content is %d bytes; want the %d inserted", len(s.Content), len(content))
+	}
+}
+
+func TestSnippetModelGetPublicByUser(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	email := fmt.Sprintf("profile-%d@example.com", time.Now().UnixNano())
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Profile', ?, '', UTC_TIMESTAMP())`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, _ := result.LastInsertId()
+	userID := int(uid)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM snippets WHERE user_id = ?`, userID)
+		db.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	})
+
+	public, err := m.Insert(t.Context(), "Public haiku", "Anyone may read this.", 7, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := m.Insert(t.Context(), "Private haiku", "Only the owner may read this.", 7, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.RecordSpamDecision(t.Context(), private, "shadow", "test", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippets, total, err := m.GetPublicByUser(t.Context(), userID, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(snippets) != 1 || snippets[0].ID != public {
+		t.Errorf("GetPublicByUser = %d snippets of %d; want only snippet %d", len(snippets), total, public)
+	}
+
+	// The owner's own listing still has both.
+	_, total, err = m.List(t.Context(), SnippetFilters{UserID: userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 {
+		t.Errorf("List total = %d; want 2", total)
+	}
+}
+
+func TestSnippetModelListFeatured(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	id, err := m.Insert(t.Context(), "Featured haiku", fmt.Sprintf("Picked for the home page %d.", time.Now().UnixNano()), 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+
+	listed := func() bool {
+		t.Helper()
+
+		featured, err := m.ListFeatured(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range featured {
+			if s.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	if listed() {
+		t.Fatal("a new snippet is featured")
+	}
+
+	err = m.SetFeatured(t.Context(), id, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !listed() {
+		t.Error("featured snippet is not listed")
+	}
+
+	err = m.SetFeatured(t.Context(), id, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listed() {
+		t.Error("unfeatured snippet is still listed")
+	}
+
+	err = m.SetFeatured(t.Context(), 1<<30, true)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("SetFeatured of a missing snippet: err = %v; want ErrNoRecord", err)
+	}
+}
+
+func TestSnippetModelStorageStats(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	expiredBefore, err := m.CountExpired(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizeBefore, err := m.StorageSizeBytes(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := fmt.Sprintf("%d %s", time.Now().UnixNano(), strings.Repeat("é", 100))
+	id, err := m.Insert(t.Context(), "Storage stats", content, 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+
+	// LENGTH counts bytes, not characters.
+	size, err := m.StorageSizeBytes(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sizeBefore + int64(len(content)); size != want {
+		t.Errorf("StorageSizeBytes = %d; want %d", size, want)
+	}
+
+	_, err = db.Exec(`UPDATE snippets SET expires = UTC_TIMESTAMP() - INTERVAL 1 DAY WHERE id = ?`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := m.CountExpired(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != expiredBefore+1 {
+		t.Errorf("CountExpired = %d; want %d", expired, expiredBefore+1)
+	}
+	size, err = m.StorageSizeBytes(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != sizeBefore {
+		t.Errorf("StorageSizeBytes after expiry = %d; want %d", size, sizeBefore)
+	}
+}
+
+func TestSnippetModelCountByLanguage(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	// The languages are unique to this run, so that snippets left by other
+	// tests do not change the counts.
+	suffix := time.Now().UnixNano() % 1e9
+	languages := []string{fmt.Sprintf("go-%d", suffix), fmt.Sprintf("sql-%d", suffix), fmt.Sprintf("lua-%d", suffix)}
+
+	insert := func(language string) int {
+		t.Helper()
+
+		id, err := m.Insert(t.Context(), fmt.Sprintf("Counted %d", time.Now().UnixNano()), fmt.Sprintf("Counted content %d", time.Now().UnixNano()), 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+
+		_, err = db.Exec(`UPDATE snippets SET language = ? WHERE id = ?`, language, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	for range 3 {
+		insert(languages[0])
+	}
+	for range 2 {
+		insert(languages[1])
+	}
+	insert(languages[2])
+
+	// Expired and archived snippets are not counted.
+	expired := insert(languages[0])
+	if _, err := db.Exec(`UPDATE snippets SET expires = UTC_TIMESTAMP() - INTERVAL 1 DAY WHERE id = ?`, expired); err != nil {
+		t.Fatal(err)
+	}
+	archived := insert(languages[1])
+	if _, err := db.Exec(`UPDATE snippets SET archived = TRUE WHERE id = ?`, archived); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := m.CountByLanguage(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []int{3, 2, 1} {
+		if got := counts[languages[i]]; got != want {
+			t.Errorf("counts[%q] = %d; want %d", languages[i], got, want)
+		}
+	}
+}
+
+func TestSnippetModelGetCreatedBetween(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	// An hour long ago that only this run uses.
+	from := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(time.Now().UnixNano()%1e6) * time.Hour)
+	to := from.Add(time.Hour)
+
+	ids := map[string]int{}
+	for name, created := range map[string]time.Time{
+		"just before":    from.Add(-time.Second),
+		"from":           from,
+		"just before to": to.Add(-time.Second),
+		"to":             to,
+	} {
+		id, err := m.Insert(t.Context(), fmt.Sprintf("Between %s %d", name, time.Now().UnixNano()), fmt.Sprintf("Between %s %d", name, time.Now().UnixNano()), 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+
+		_, err = db.Exec(`UPDATE snippets SET created = ? WHERE id = ?`, created, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = id
+	}
+
+	snippets, total, err := m.GetCreatedBetween(t.Context(), from, to, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// from is included and to is not.
+	if total != 2 || len(snippets) != 2 {
+		t.Fatalf("got %d snippets of %d; want 2 of 2", len(snippets), total)
+	}
+	if snippets[0].ID != ids["from"] || snippets[1].ID != ids["just before to"] {
+		t.Errorf("got snippets %d and %d; want %d and %d", snippets[0].ID, snippets[1].ID, ids["from"], ids["just before to"])
+	}
+
+	_, _, err = m.GetCreatedBetween(t.Context(), from, from, 1, 10)
+	if !errors.Is(err, ErrInvalidDateRange) {
+		t.Errorf("empty range error = %v; want ErrInvalidDateRange", err)
+	}
+}
@@ -0,0 +1,304 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSnippetModelUpdate(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	id, err := m.Insert(t.Context(), "Before", "A haiku.", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+
+	s, err := m.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Updated.Equal(s.Created) {
+		t.Errorf("new snippet updated %s; want its created time %s", s.Updated, s.Created)
+	}
+
+	// Backdate the snippet so that the edit is more than a minute later.
+	_, err = db.Exec(`UPDATE snippets SET created = created - INTERVAL 1 DAY, updated = updated - INTERVAL 1 DAY WHERE id = ?`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Update(t.Context(), id, "After", "A longer haiku.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = m.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "After" || s.Content != "A longer haiku." || !s.Edited() {
+		t.Errorf("after Update: %q, %q, edited %t; want the new title and content, edited", s.Title, s.Content, s.Edited())
+	}
+
+	err = m.Update(t.Context(), -1, "Nope", "Nope")
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Update(-1) err = %v; want ErrNoRecord", err)
+	}
+}
+
+func TestSnippetModelRename(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	email := fmt.Sprintf("renamer-%d@example.com", time.Now().UnixNano())
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Renamer', ?, '', UTC_TIMESTAMP())`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, _ := result.LastInsertId()
+	userID := int(uid)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM snippets WHERE user_id = ?`, userID)
+		db.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	})
+
+	id, err := m.Insert(t.Context(), "Before", "A haiku.", 7, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Insert(t.Context(), "Taken", "Another haiku.", 7, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Rename(t.Context(), id, userID, "After")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "After" {
+		t.Errorf("title = %q; want After", s.Title)
+	}
+
+	// Renaming to the current title changes nothing but is not an error.
+	err = m.Rename(t.Context(), id, userID, "After")
+	if err != nil {
+		t.Errorf("rename to the same title: %v", err)
+	}
+
+	err = m.Rename(t.Context(), id, userID, "Taken")
+	if !errors.Is(err, ErrDuplicateTitle) {
+		t.Errorf("rename to a taken title: err = %v; want ErrDuplicateTitle", err)
+	}
+
+	err = m.Rename(t.Context(), id, userID+1, "Stolen")
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("rename by another user: err = %v; want ErrNoRecord", err)
+	}
+
+	// Only a live snippet can be renamed.
+	for name, set := range map[string]string{
+		"archived": `archived = TRUE, archived_at = UTC_TIMESTAMP()`,
+		"expired":  `expires = UTC_TIMESTAMP() - INTERVAL 1 DAY`,
+	} {
+		_, err = db.Exec(`UPDATE snippets SET archived = FALSE, archived_at = NULL, expires = UTC_TIMESTAMP() + INTERVAL 1 DAY, `+set+` WHERE id = ?`, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.Rename(t.Context(), id, userID, "Renamed "+name)
+		if !errors.Is(err, ErrNoRecord) {
+			t.Errorf("rename of an %s snippet: err = %v; want ErrNoRecord", name, err)
+		}
+	}
+}
+
+func TestSnippetModelSetLanguage(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	email := fmt.Sprintf("linguist-%d@example.com", time.Now().UnixNano())
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Linguist', ?, '', UTC_TIMESTAMP())`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, _ := result.LastInsertId()
+	userID := int(uid)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM snippets WHERE user_id = ?`, userID)
+		db.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	})
+
+	id, err := m.Insert(t.Context(), "Hello", `fmt.Println("hello")`, 7, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.SetLanguage(t.Context(), id, userID, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Language != "go" {
+		t.Errorf("language = %q; want go", s.Language)
+	}
+
+	// Setting the current language changes nothing but is not an error.
+	err = m.SetLanguage(t.Context(), id, userID, "go")
+	if err != nil {
+		t.Errorf("set to the same language: %v", err)
+	}
+
+	err = m.SetLanguage(t.Context(), id, userID+1, "python")
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("set by another user: err = %v; want ErrNoRecord", err)
+	}
+
+	// Only a live snippet can be changed.
+	for name, set := range map[string]string{
+		"archived": `archived = TRUE, archived_at = UTC_TIMESTAMP()`,
+		"expired":  `expires = UTC_TIMESTAMP() - INTERVAL 1 DAY`,
+	} {
+		_, err = db.Exec(`UPDATE snippets SET archived = FALSE, archived_at = NULL, expires = UTC_TIMESTAMP() + INTERVAL 1 DAY, `+set+` WHERE id = ?`, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.SetLanguage(t.Context(), id, userID, "python")
+		if !errors.Is(err, ErrNoRecord) {
+			t.Errorf("set on an %s snippet: err = %v; want ErrNoRecord", name, err)
+		}
+	}
+}
+
+func TestSnippetModelArchive(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	email := fmt.Sprintf("archivist-%d@example.com", time.Now().UnixNano())
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Archivist', ?, '', UTC_TIMESTAMP())`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, _ := result.LastInsertId()
+	userID := int(uid)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM snippets WHERE user_id = ?`, userID)
+		db.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	})
+
+	id, err := m.Insert(t.Context(), "Keep me", "An archived haiku.", 7, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Archive(t.Context(), id, userID+1)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("archive by another user: err = %v; want ErrNoRecord", err)
+	}
+
+	err = m.Archive(t.Context(), id, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Get(t.Context(), id)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Get of an archived snippet: err = %v; want ErrNoRecord", err)
+	}
+	_, total, err := m.List(t.Context(), SnippetFilters{UserID: userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 0 {
+		t.Errorf("List total = %d; want the archived snippet left out", total)
+	}
+
+	// Archived snippets are kept past their expiry.
+	_, err = db.Exec(`UPDATE snippets SET expires = UTC_TIMESTAMP() - INTERVAL 1 DAY WHERE id = ?`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archived, total, err := m.ListArchived(t.Context(), userID, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(archived) != 1 || archived[0].ID != id || !archived[0].Archived || archived[0].ArchivedAt.IsZero() {
+		t.Fatalf("ListArchived = %v, %d; want snippet %d archived", archived, total, id)
+	}
+	if archived[0].Content != "An archived haiku." {
+		t.Errorf("content = %q", archived[0].Content)
+	}
+
+	err = m.Unarchive(t.Context(), id, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Unarchive(t.Context(), id, userID)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("unarchive of a snippet that is not archived: err = %v; want ErrNoRecord", err)
+	}
+	_, total, err = m.ListArchived(t.Context(), userID, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 0 {
+		t.Errorf("ListArchived total after Unarchive = %d; want 0", total)
+	}
+}
+
+func TestSnippetModelVersions(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	id, err := m.Insert(t.Context(), "Version one", fmt.Sprintf("The first draft %d.", time.Now().UnixNano()), 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+
+	original, err := m.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Update(t.Context(), id, "Version two", "The second draft.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An update that changes nothing saves no version.
+	err = m.Update(t.Context(), id, "Version two", "The second draft.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := m.ListVersions(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Title != "Version one" || versions[0].Content != "" {
+		t.Fatalf("ListVersions = %+v; want the first version without its content", versions)
+	}
+
+	v, err := m.GetVersion(t.Context(), id, versions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Title != original.Title || v.Content != original.Content {
+		t.Errorf("GetVersion = %q, %q; want %q, %q", v.Title, v.Content, original.Title, original.Content)
+	}
+
+	_, err = m.GetVersion(t.Context(), id+1, versions[0].ID)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("GetVersion of another snippet: err = %v; want ErrNoRecord", err)
+	}
+}
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -16,16 +18,19 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Timezone       string
+	IsAdmin        bool
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Logger *slog.Logger // optional; receives unexpected database errors
 }
 
 func (m *UserModel) Insert(name, email, password string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
-		return err
+		return wrapLogged(m.Logger, "users.Insert", err)
 	}
 	stmt := `INSERT INTO users (name, email, hashed_password, created)
     VALUES(?, ?, ?, UTC_TIMESTAMP())`
@@ -35,10 +40,10 @@ func (m *UserModel) Insert(name, email, password string) error {
 		var mySQLError *mysql.MySQLError
 		if errors.As(err, &mySQLError) {
 			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
+				return &DuplicateError{Entity: "user", Column: "email", Err: ErrDuplicateEmail}
 			}
 		}
-		return err
+		return wrapLogged(m.Logger, "users.Insert", constraintError("user", err))
 	}
 	return nil
 }
@@ -53,7 +58,7 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
 		} else {
-			return 0, err
+			return 0, wrapLogged(m.Logger, "users.Authenticate", err)
 		}
 	}
 
@@ -62,7 +67,7 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
 			return 0, ErrInvalidCredentials
 		}
-		return 0, err
+		return 0, wrapLogged(m.Logger, "users.Authenticate", err)
 	}
 
 	return id, nil
@@ -72,5 +77,110 @@ func (m *UserModel) Exists(id int) (bool, error) {
 	var exists bool
 	stmt := `SELECT EXISTS(SELECT true FROM users WHERE id = ?)`
 	err := m.DB.QueryRow(stmt, id).Scan(&exists)
-	return exists, err
+	return exists, wrapLogged(m.Logger, "users.Exists", err)
+}
+
+func (m *UserModel) Get(id int) (User, error) {
+	var user User
+	stmt := `SELECT id, name, email, created, timezone, is_admin FROM users WHERE id = ?`
+
+	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.Timezone, &user.IsAdmin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, &NotFoundError{Entity: "user", ID: id}
+		} else {
+			return User{}, wrapLogged(m.Logger, "users.Get", err)
+		}
+	}
+	return user, nil
+}
+
+// MaxUserPageSize is the most users ListActive returns at once.
+const MaxUserPageSize = 100
+
+// ListActive returns a page of registered users, newest first, and the total
+// number of users. Accounts cannot be deactivated, so every user is active.
+// page is counted from 1; a page below 1 is taken as the first, and pageSize
+// is capped at MaxUserPageSize.
+func (m *UserModel) ListActive(ctx context.Context, page, pageSize int) ([]*User, int, error) {
+	page = max(page, 1)
+	pageSize = min(max(pageSize, 1), MaxUserPageSize)
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&total)
+	if err != nil {
+		return nil, 0, wrapLogged(m.Logger, "users.ListActive", err)
+	}
+
+	stmt := `SELECT id, name, email, created, timezone, is_admin FROM users
+	ORDER BY created DESC, id DESC
+	LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, wrapLogged(m.Logger, "users.ListActive", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+
+	for rows.Next() {
+		u := &User{}
+		err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Timezone, &u.IsAdmin)
+		if err != nil {
+			return nil, 0, wrapLogged(m.Logger, "users.ListActive", err)
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, wrapLogged(m.Logger, "users.ListActive", err)
+	}
+
+	return users, total, nil
+}
+
+func (m *UserModel) UpdateProfile(id int, name, email string) error {
+	stmt := `UPDATE users SET name = ?, email = ? WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, name, email, id)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
+				return &DuplicateError{Entity: "user", Column: "email", Err: ErrDuplicateEmail}
+			}
+		}
+		return wrapLogged(m.Logger, "users.UpdateProfile", constraintError("user", err))
+	}
+	return nil
+}
+
+func (m *UserModel) UpdatePassword(id int, currentPassword, newPassword string) error {
+	var currentHashedPassword []byte
+	stmt := `SELECT hashed_password FROM users WHERE id = ?`
+
+	err := m.DB.QueryRow(stmt, id).Scan(&currentHashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &NotFoundError{Entity: "user", ID: id}
+		}
+		return wrapLogged(m.Logger, "users.UpdatePassword", err)
+	}
+
+	err = bcrypt.CompareHashAndPassword(currentHashedPassword, []byte(currentPassword))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return wrapLogged(m.Logger, "users.UpdatePassword", err)
+	}
+
+	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	if err != nil {
+		return wrapLogged(m.Logger, "users.UpdatePassword", err)
+	}
+
+	stmt = `UPDATE users SET hashed_password = ? WHERE id = ?`
+	_, err = m.DB.Exec(stmt, newHashedPassword, id)
+	return wrapLogged(m.Logger, "users.UpdatePassword", err)
 }
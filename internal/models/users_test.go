@@ -0,0 +1,51 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUserModelListActive(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db}
+
+	var ids []int
+	for i := range 3 {
+		email := fmt.Sprintf("lister-%d-%d@example.com", time.Now().UnixNano(), i)
+		result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Lister', ?, '', UTC_TIMESTAMP())`, email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		ids = append(ids, int(id))
+		t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE id = ?`, id) })
+	}
+
+	users, total, err := m.ListActive(t.Context(), 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total < 3 {
+		t.Errorf("total = %d; want at least 3", total)
+	}
+	if len(users) != 2 || users[0].ID != ids[2] || users[1].ID != ids[1] {
+		t.Fatalf("page 1 = %v; want users %d and %d", users, ids[2], ids[1])
+	}
+
+	users, _, err = m.ListActive(t.Context(), 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) == 0 || users[0].ID != ids[0] {
+		t.Errorf("page 2 = %v; want user %d first", users, ids[0])
+	}
+
+	users, _, err = m.ListActive(t.Context(), 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) > MaxUserPageSize {
+		t.Errorf("ListActive returned %d users; want at most %d", len(users), MaxUserPageSize)
+	}
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SnippetVersion is a title and content a snippet had before Update
+// replaced them. Created is when it was replaced.
+type SnippetVersion struct {
+	ID        int
+	SnippetID int
+	Title     string
+	Content   string
+	Created   time.Time
+}
+
+// GetVersion returns the version of the snippet with the given ID. A
+// version of another snippet is reported as a NotFoundError, as is a
+// missing one.
+func (m *SnippetModel) GetVersion(ctx context.Context, snippetID, versionID int) (SnippetVersion, error) {
+	defer m.observe("snippets.GetVersion", time.Now())
+
+	stmt := `SELECT id, snippet_id, title, content, created FROM snippet_versions
+	WHERE id = ? AND snippet_id = ?`
+
+	var v SnippetVersion
+
+	err := m.DB.QueryRowContext(ctx, stmt, versionID, snippetID).Scan(&v.ID, &v.SnippetID, &v.Title, &v.Content, &v.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SnippetVersion{}, &NotFoundError{Entity: "snippet version", ID: versionID}
+		}
+		return SnippetVersion{}, wrapLogged(m.Logger, "snippets.GetVersion", err)
+	}
+	return v, nil
+}
+
+// ListVersions returns the snippet's earlier versions, newest first, without
+// their content.
+func (m *SnippetModel) ListVersions(ctx context.Context, snippetID int) ([]SnippetVersion, error) {
+	defer m.observe("snippets.ListVersions", time.Now())
+
+	stmt := `SELECT id, snippet_id, title, created FROM snippet_versions
+	WHERE snippet_id = ?
+	ORDER BY created DESC, id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, snippetID)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.ListVersions", err)
+	}
+	defer rows.Close()
+
+	var versions []SnippetVersion
+
+	for rows.Next() {
+		var v SnippetVersion
+		err = rows.Scan(&v.ID, &v.SnippetID, &v.Title, &v.Created)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.ListVersions", err)
+		}
+		versions = append(versions, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.ListVersions", err)
+	}
+
+	return versions, nil
+}
+
+// saveVersion records the snippet's current title and content as a version,
+// within Update's transaction, unless they are unchanged.
+func (m *SnippetModel) saveVersion(ctx context.Context, tx *sql.Tx, id int, title, content string, wasExternal bool, newTitle, newContent string) error {
+	if wasExternal {
+		var err error
+		content, err = m.readExternal(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if title == newTitle && content == newContent {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO snippet_versions (snippet_id, title, content, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`, id, title, content)
+	return err
+}
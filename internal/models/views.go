@@ -0,0 +1,55 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// RecordView notes that the user viewed the snippet now. Each user has one
+// entry per snippet, so viewing a snippet again moves it to the front of
+// RecentlyViewed.
+func (m *SnippetModel) RecordView(ctx context.Context, userID, snippetID int) error {
+	defer m.observe("snippets.RecordView", time.Now())
+
+	stmt := `INSERT INTO views_log (user_id, snippet_id, viewed_at) VALUES (?, ?, UTC_TIMESTAMP())
+    ON DUPLICATE KEY UPDATE viewed_at = UTC_TIMESTAMP()`
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, snippetID)
+	return wrapLogged(m.Logger, "snippets.RecordView", constraintError("snippet view", err))
+}
+
+// RecentlyViewed returns up to limit unexpired snippets the user has viewed,
+// most recently viewed first.
+func (m *SnippetModel) RecentlyViewed(ctx context.Context, userID, limit int) ([]*Snippet, error) {
+	defer m.observe("snippets.RecentlyViewed", time.Now())
+
+	// The log is joined as a derived table so that its user_id does not
+	// clash with the snippet's in snippetColumns.
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	JOIN (SELECT snippet_id, viewed_at FROM views_log WHERE user_id = ?) v ON v.snippet_id = snippets.id
+	WHERE expires > UTC_TIMESTAMP() AND archived = FALSE
+	ORDER BY v.viewed_at DESC, snippets.id DESC
+	LIMIT ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID, limit)
+	if err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.RecentlyViewed", err)
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = scanSnippet(rows, s)
+		if err != nil {
+			return nil, wrapLogged(m.Logger, "snippets.RecentlyViewed", err)
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapLogged(m.Logger, "snippets.RecentlyViewed", err)
+	}
+
+	return snippets, nil
+}
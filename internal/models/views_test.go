@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSnippetModelRecentlyViewed(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	email := fmt.Sprintf("viewer-%d@example.com", time.Now().UnixNano())
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Viewer', ?, '', UTC_TIMESTAMP())`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	userID := int(id)
+	t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE id = ?`, userID) })
+
+	var ids []int
+	for range 3 {
+		id, err := m.Insert(t.Context(), "Viewed", "A haiku.", 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM snippets WHERE id = ?`, id) })
+		ids = append(ids, id)
+	}
+
+	// viewed_at has second precision, so backdate earlier views to order
+	// them.
+	for i, id := range ids {
+		err = m.RecordView(t.Context(), userID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Exec(`UPDATE views_log SET viewed_at = viewed_at - INTERVAL ? MINUTE WHERE user_id = ? AND snippet_id = ?`, len(ids)-i, userID, id)
+	}
+	// Viewing the first snippet again brings it to the front.
+	err = m.RecordView(t.Context(), userID, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.RecentlyViewed(t.Context(), userID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != ids[0] || got[1].ID != ids[2] {
+		t.Errorf("RecentlyViewed = %v; want snippets %d and %d", got, ids[0], ids[2])
+	}
+}
@@ -0,0 +1,332 @@
+// Package querylog wraps a database/sql driver connector so that every
+// statement is logged with its duration, row count and arguments. Arguments
+// bound to sensitive columns, and very large arguments, are redacted.
+//
+// The wrapper is only installed when query logging is wanted; without it the
+// application talks to the driver directly and pays nothing.
+package querylog
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Options configures the logging.
+type Options struct {
+	Logger *slog.Logger
+
+	// Redact lists column name fragments, such as "password", whose
+	// arguments are never logged. A column matches if its name contains a
+	// fragment, ignoring case. Nil means DefaultRedact.
+	Redact []string
+
+	// MaxArgBytes is the largest string or []byte argument logged in full;
+	// longer ones are replaced by their size. Zero means DefaultMaxArgBytes.
+	MaxArgBytes int
+}
+
+// DefaultRedact covers password hashes, session and share tokens, secrets,
+// and the session data blob.
+var DefaultRedact = []string{"password", "token", "secret", "data"}
+
+// DefaultMaxArgBytes keeps snippet content and similar blobs out of the log.
+const DefaultMaxArgBytes = 256
+
+// Wrap returns a connector whose connections log every statement.
+func Wrap(c driver.Connector, opts Options) driver.Connector {
+	if opts.Redact == nil {
+		opts.Redact = DefaultRedact
+	}
+	if opts.MaxArgBytes == 0 {
+		opts.MaxArgBytes = DefaultMaxArgBytes
+	}
+	return &connector{next: c, opts: opts}
+}
+
+type connector struct {
+	next driver.Connector
+	opts Options
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	next, err := c.next.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{next: next, opts: &c.opts}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.next.Driver()
+}
+
+// log records one statement. rows is the number of rows affected or
+// returned, or -1 if unknown.
+func (o *Options) log(ctx context.Context, query string, args []driver.NamedValue, start time.Time, rows int64, err error) {
+	attrs := []slog.Attr{
+		slog.String("sql", query),
+		slog.Duration("duration", time.Since(start)),
+		slog.Any("args", redactArgs(query, args, o.Redact, o.MaxArgBytes)),
+	}
+	if rows >= 0 {
+		attrs = append(attrs, slog.Int64("rows", rows))
+	}
+
+	level := slog.LevelInfo
+	if err != nil && err != driver.ErrSkip && err != io.EOF {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	o.Logger.LogAttrs(ctx, level, "query", attrs...)
+}
+
+// conn wraps a driver connection. The optional interfaces it implements are
+// delegated when the wrapped connection supports them and otherwise return
+// driver.ErrSkip, so that database/sql falls back as it would without the
+// wrapper.
+type conn struct {
+	next driver.Conn
+	opts *Options
+}
+
+var (
+	_ driver.ConnPrepareContext = (*conn)(nil)
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.Pinger             = (*conn)(nil)
+	_ driver.SessionResetter    = (*conn)(nil)
+	_ driver.Validator          = (*conn)(nil)
+	_ driver.NamedValueChecker  = (*conn)(nil)
+)
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		s   driver.Stmt
+		err error
+	)
+	if p, ok := c.next.(driver.ConnPrepareContext); ok {
+		s, err = p.PrepareContext(ctx, query)
+	} else {
+		s, err = c.next.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{next: s, query: query, opts: c.opts}, nil
+}
+
+func (c *conn) Close() error {
+	return c.next.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.next.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.next.Begin()
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.next.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	r, err := q.QueryContext(ctx, query, args)
+	if err != nil {
+		if err != driver.ErrSkip {
+			c.opts.log(ctx, query, args, start, -1, err)
+		}
+		return nil, err
+	}
+	return &rows{next: r, ctx: ctx, query: query, args: args, start: start, opts: c.opts}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.next.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	result, err := e.ExecContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	c.opts.log(ctx, query, args, start, rowsAffected(result), err)
+	return result, err
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.next.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.next.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.next.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.next.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// stmt wraps a prepared statement, remembering its query for the log.
+type stmt struct {
+	next  driver.Stmt
+	query string
+	opts  *Options
+}
+
+var (
+	_ driver.StmtExecContext   = (*stmt)(nil)
+	_ driver.StmtQueryContext  = (*stmt)(nil)
+	_ driver.NamedValueChecker = (*stmt)(nil)
+)
+
+func (s *stmt) Close() error {
+	return s.next.Close()
+}
+
+func (s *stmt) NumInput() int {
+	return s.next.NumInput()
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+
+	var (
+		result driver.Result
+		err    error
+	)
+	if e, ok := s.next.(driver.StmtExecContext); ok {
+		result, err = e.ExecContext(ctx, args)
+	} else {
+		result, err = s.next.Exec(values(args))
+	}
+
+	s.opts.log(ctx, s.query, args, start, rowsAffected(result), err)
+	return result, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+
+	var (
+		r   driver.Rows
+		err error
+	)
+	if q, ok := s.next.(driver.StmtQueryContext); ok {
+		r, err = q.QueryContext(ctx, args)
+	} else {
+		r, err = s.next.Query(values(args))
+	}
+	if err != nil {
+		s.opts.log(ctx, s.query, args, start, -1, err)
+		return nil, err
+	}
+	return &rows{next: r, ctx: ctx, query: s.query, args: args, start: start, opts: s.opts}, nil
+}
+
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.next.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// rows counts the rows read and logs the query when it is closed, so that
+// the duration covers reading the results.
+type rows struct {
+	next  driver.Rows
+	ctx   context.Context
+	query string
+	args  []driver.NamedValue
+	start time.Time
+	opts  *Options
+	n     int64
+	err   error
+}
+
+func (r *rows) Columns() []string {
+	return r.next.Columns()
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	err := r.next.Next(dest)
+	if err == nil {
+		r.n++
+	} else if err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *rows) Close() error {
+	err := r.next.Close()
+	r.opts.log(r.ctx, r.query, r.args, r.start, r.n, r.err)
+	return err
+}
+
+func rowsAffected(result driver.Result) int64 {
+	if result == nil {
+		return -1
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	vs := make([]driver.Value, len(args))
+	for i, nv := range args {
+		vs[i] = nv.Value
+	}
+	return vs
+}
@@ -0,0 +1,198 @@
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactArgs(t *testing.T) {
+	long := strings.Repeat("x", DefaultMaxArgBytes+1)
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		query string
+		args  []any
+		want  []string
+	}{
+		{
+			name:  "insert with password hash",
+			query: "INSERT INTO users (name, email, hashed_password, created)\n    VALUES(?, ?, ?, UTC_TIMESTAMP())",
+			args:  []any{"Alice", "alice@example.com", []byte("$2a$12$hash")},
+			want:  []string{"Alice", "alice@example.com", "[REDACTED]"},
+		},
+		{
+			name:  "update password",
+			query: "UPDATE users SET hashed_password = ? WHERE id = ?",
+			args:  []any{[]byte("$2a$12$hash"), int64(7)},
+			want:  []string{"[REDACTED]", "7"},
+		},
+		{
+			name:  "session lookup by token",
+			query: "SELECT data FROM sessions WHERE token = ? AND UTC_TIMESTAMP(6) < expiry",
+			args:  []any{"abc123"},
+			want:  []string{"[REDACTED]"},
+		},
+		{
+			name:  "session upsert",
+			query: "INSERT INTO sessions (token, data, expiry) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE data = VALUES(data), expiry = VALUES(expiry)",
+			args:  []any{"abc123", []byte("gob"), created},
+			want:  []string{"[REDACTED]", "[REDACTED]", "2025-06-01T12:00:00Z"},
+		},
+		{
+			name:  "values items with expressions",
+			query: "INSERT INTO snippets (title, content, created, expires, user_id) VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), NULLIF(?, 0))",
+			args:  []any{"Title", long, int64(7), nil},
+			want:  []string{"Title", "[257 bytes]", "7", "NULL"},
+		},
+		{
+			name:  "qualified and backquoted columns",
+			query: "SELECT 1 FROM user_sessions s WHERE s.`token` = ? AND s.user_id <> ?",
+			args:  []any{"abc123", int64(3)},
+			want:  []string{"[REDACTED]", "3"},
+		},
+		{
+			name:  "placeholder in a string literal is not a placeholder",
+			query: "SELECT id FROM snippets WHERE title = 'password = ?' AND id = ?",
+			args:  []any{int64(1)},
+			want:  []string{"1"},
+		},
+		{
+			name:  "unknown column keeps short values and drops long ones",
+			query: "SELECT id FROM snippets WHERE MATCH(title, content) AGAINST (?)",
+			args:  []any{"needle", long},
+			want:  []string{"needle", "[257 bytes]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := make([]driver.NamedValue, len(tt.args))
+			for i, v := range tt.args {
+				args[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+			}
+
+			got := redactArgs(tt.query, args, DefaultRedact, DefaultMaxArgBytes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactArgs = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapLogsStatements(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	db := sql.OpenDB(Wrap(fakeConnector{}, Options{Logger: logger}))
+	defer db.Close()
+
+	_, err := db.ExecContext(context.Background(), "UPDATE users SET hashed_password = ? WHERE id = ?", "secret-hash", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.QueryContext(context.Background(), "SELECT id FROM users WHERE email = ?", "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	stmt, err := db.Prepare("SELECT id FROM sessions WHERE token = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt.QueryRow("tok").Scan(new(int))
+	stmt.Close()
+
+	if strings.Contains(buf.String(), "secret-hash") || strings.Contains(buf.String(), `"tok"`) {
+		t.Errorf("log contains a redacted value:\n%s", buf.String())
+	}
+
+	type entry struct {
+		SQL  string   `json:"sql"`
+		Args []string `json:"args"`
+		Rows *int64   `json:"rows"`
+	}
+
+	var entries []entry
+	dec := json.NewDecoder(&buf)
+	for {
+		var e entry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("logged %d entries; want 3", len(entries))
+	}
+	if got := entries[0].Args; !reflect.DeepEqual(got, []string{"[REDACTED]", "7"}) {
+		t.Errorf("exec args = %q", got)
+	}
+	if e := entries[0]; e.Rows == nil || *e.Rows != 1 {
+		t.Errorf("exec rows = %v; want 1", e.Rows)
+	}
+	if e := entries[1]; e.Rows == nil || *e.Rows != 2 {
+		t.Errorf("query rows = %v; want 2", e.Rows)
+	}
+	if got := entries[2].Args; !reflect.DeepEqual(got, []string{"[REDACTED]"}) {
+		t.Errorf("prepared statement args = %q", got)
+	}
+}
+
+// fakeConnector is a driver whose statements succeed, affect one row and
+// return two.
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+func (fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error                               { return nil }
+func (fakeStmt) NumInput() int                              { return -1 }
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (fakeStmt) Query([]driver.Value) (driver.Rows, error)  { return &fakeRows{}, nil }
+
+type fakeRows struct{ n int }
+
+func (*fakeRows) Columns() []string { return []string{"id"} }
+func (*fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.n == 2 {
+		return io.EOF
+	}
+	r.n++
+	dest[0] = int64(r.n)
+	return nil
+}
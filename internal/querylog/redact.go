@@ -0,0 +1,194 @@
+package querylog
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// redactArgs returns args formatted for the log. An argument is replaced by
+// "[REDACTED]" when the column it is bound to matches redact, and by its size
+// when it is a string or []byte longer than maxBytes.
+func redactArgs(query string, args []driver.NamedValue, redact []string, maxBytes int) []string {
+	columns := argColumns(query)
+
+	out := make([]string, len(args))
+	for i, arg := range args {
+		var column string
+		if i < len(columns) {
+			column = columns[i]
+		}
+		out[i] = formatArg(column, arg.Value, redact, maxBytes)
+	}
+	return out
+}
+
+func formatArg(column string, v driver.Value, redact []string, maxBytes int) string {
+	lower := strings.ToLower(column)
+	for _, fragment := range redact {
+		if fragment != "" && strings.Contains(lower, strings.ToLower(fragment)) {
+			return "[REDACTED]"
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		if len(v) > maxBytes {
+			return fmt.Sprintf("[%d bytes]", len(v))
+		}
+		return v
+	case []byte:
+		if len(v) > maxBytes {
+			return fmt.Sprintf("[%d bytes]", len(v))
+		}
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// argColumns returns, for each ? placeholder in query in order, the column
+// it is bound to, or "" if that cannot be determined. It understands the
+// forms the models use: comparisons such as "col = ?" or "t.col LIKE ?", and
+// "INSERT INTO t (a, b) VALUES (?, f(?))", where each VALUES item is matched
+// to the column at the same position.
+func argColumns(query string) []string {
+	toks := tokenize(query)
+
+	var columns []string
+	insertColumns, valuesStart := insertLayout(toks)
+
+	for i, tok := range toks {
+		if tok != "?" {
+			continue
+		}
+
+		var column string
+		if valuesStart >= 0 && i > valuesStart {
+			if item := valuesItem(toks, valuesStart, i); item >= 0 && item < len(insertColumns) {
+				column = insertColumns[item]
+			}
+		}
+		if column == "" {
+			column = comparedColumn(toks, i)
+		}
+		columns = append(columns, column)
+	}
+
+	return columns
+}
+
+var comparisons = map[string]bool{"=": true, "<>": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true, "LIKE": true}
+
+// comparedColumn returns the column compared with the placeholder at toks[i].
+func comparedColumn(toks []string, i int) string {
+	if i < 2 || !comparisons[strings.ToUpper(toks[i-1])] {
+		return ""
+	}
+	return columnName(toks[i-2])
+}
+
+// insertLayout returns the column list of an INSERT or REPLACE statement and
+// the index of the "(" that opens its VALUES list, or -1 if query is not of
+// that form.
+func insertLayout(toks []string) ([]string, int) {
+	for i := 0; i+2 < len(toks); i++ {
+		if !strings.EqualFold(toks[i], "INTO") || toks[i+2] != "(" {
+			continue
+		}
+
+		var columns []string
+		j := i + 3
+		for ; j < len(toks) && toks[j] != ")"; j++ {
+			if toks[j] != "," {
+				columns = append(columns, columnName(toks[j]))
+			}
+		}
+		if j+2 < len(toks) && strings.EqualFold(toks[j+1], "VALUES") && toks[j+2] == "(" {
+			return columns, j + 2
+		}
+		return nil, -1
+	}
+	return nil, -1
+}
+
+// valuesItem returns which top-level item of the VALUES list opened at
+// toks[start] contains toks[i], or -1 if i is outside the list.
+func valuesItem(toks []string, start, i int) int {
+	depth, item := 0, 0
+	for j := start + 1; j < i; j++ {
+		switch toks[j] {
+		case "(":
+			depth++
+		case ")":
+			if depth == 0 {
+				return -1
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				item++
+			}
+		}
+	}
+	return item
+}
+
+// columnName strips any table qualifier and backquotes from an identifier.
+func columnName(ident string) string {
+	if i := strings.LastIndex(ident, "."); i >= 0 {
+		ident = ident[i+1:]
+	}
+	return strings.Trim(ident, "`")
+}
+
+// tokenize splits query into identifiers (with any "table." qualifier
+// attached), operators, punctuation and placeholders. String literals and
+// numbers become single tokens that match nothing.
+func tokenize(query string) []string {
+	var toks []string
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '\'' || c == '"':
+			j := i + 1
+			for j < len(query) && query[j] != c {
+				if query[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			toks = append(toks, "''")
+			i = j + 1
+		case c == '`' || c == '_' || isAlnum(c):
+			j := i
+			for j < len(query) && (query[j] == '`' || query[j] == '_' || query[j] == '.' || isAlnum(query[j])) {
+				j++
+			}
+			toks = append(toks, query[i:j])
+			i = j
+		case strings.HasPrefix(query[i:], "<=") || strings.HasPrefix(query[i:], ">=") ||
+			strings.HasPrefix(query[i:], "<>") || strings.HasPrefix(query[i:], "!="):
+			toks = append(toks, query[i:i+2])
+			i += 2
+		default:
+			toks = append(toks, query[i:i+1])
+			i++
+		}
+	}
+
+	return toks
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
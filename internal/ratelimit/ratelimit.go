@@ -0,0 +1,152 @@
+// Package ratelimit implements per-key token bucket rate limiting with a
+// soft threshold, so that clients can be warned before they are refused.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"snippet.robertgleason.ca/internal/clock"
+)
+
+// Policy configures a Limiter. Each key starts with Burst tokens and regains
+// one every Every. Once a key has Soft or fewer tokens left its requests are
+// still allowed but flagged with Warn; with none left they are refused.
+type Policy struct {
+	Burst int
+	Every time.Duration
+	Soft  int
+}
+
+// Result describes a key's bucket after a Take or Peek.
+type Result struct {
+	Allowed bool
+	Warn    bool
+	// Remaining is the number of whole tokens left.
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token, when Allowed is false.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter tracks a token bucket per key. It is safe for concurrent use.
+type Limiter struct {
+	policy Policy
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+// sweepEvery is how many Take calls pass between sweeps of full buckets.
+const sweepEvery = 1024
+
+// New returns a Limiter applying policy. A nil clk uses the real time.
+func New(policy Policy, clk clock.Clock) *Limiter {
+	return &Limiter{
+		policy:  policy,
+		clock:   clock.OrReal(clk),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Take spends a token for key if one is available.
+func (l *Limiter) Take(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+
+	l.takes++
+	if l.takes%sweepEvery == 0 {
+		l.sweep(now)
+	}
+
+	b := l.refill(key, now)
+
+	if b.tokens < 1 {
+		res := l.result(b)
+		res.RetryAfter = l.untilTokens(b, 1)
+		return res
+	}
+
+	b.tokens--
+	res := l.result(b)
+	res.Allowed = true
+	return res
+}
+
+// Peek reports the state of key's bucket without spending a token. A key
+// with no bucket is reported as full without one being created, so that
+// peeking cannot grow the map.
+func (l *Limiter) Peek(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.buckets[key]; !ok {
+		res := l.result(&bucket{tokens: float64(l.policy.Burst)})
+		res.Allowed = l.policy.Burst >= 1
+		return res
+	}
+
+	b := l.refill(key, l.clock.Now())
+	res := l.result(b)
+	res.Allowed = b.tokens >= 1
+	return res
+}
+
+// refill returns key's bucket topped up for the time since it was last used.
+// l.mu must be held.
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.policy.Burst), last: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	if l.policy.Every > 0 {
+		gained := float64(now.Sub(b.last)) / float64(l.policy.Every)
+		b.tokens = math.Min(float64(l.policy.Burst), b.tokens+gained)
+	}
+	b.last = now
+	return b
+}
+
+func (l *Limiter) result(b *bucket) Result {
+	remaining := int(b.tokens)
+	return Result{
+		Warn:      remaining <= l.policy.Soft,
+		Remaining: remaining,
+		Reset:     l.untilTokens(b, float64(l.policy.Burst)),
+	}
+}
+
+// untilTokens is how long until b holds n tokens.
+func (l *Limiter) untilTokens(b *bucket, n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration(math.Ceil((n - b.tokens) * float64(l.policy.Every)))
+}
+
+// sweep forgets buckets that have refilled completely, as they are
+// indistinguishable from new ones. l.mu must be held.
+func (l *Limiter) sweep(now time.Time) {
+	if l.policy.Every <= 0 {
+		return
+	}
+	for key, b := range l.buckets {
+		if b.tokens+float64(now.Sub(b.last))/float64(l.policy.Every) >= float64(l.policy.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
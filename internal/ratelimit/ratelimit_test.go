@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"snippet.robertgleason.ca/internal/clock"
+)
+
+func TestLimiterSoftHardAndRecovery(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	l := New(Policy{Burst: 5, Every: time.Minute, Soft: 2}, clk)
+
+	tests := []struct {
+		allowed   bool
+		warn      bool
+		remaining int
+	}{
+		{true, false, 4},
+		{true, false, 3},
+		{true, true, 2}, // the soft limit: allowed, with a warning
+		{true, true, 1},
+		{true, true, 0},
+		{false, true, 0}, // the hard limit
+	}
+	for i, tt := range tests {
+		res := l.Take("client")
+		if res.Allowed != tt.allowed || res.Warn != tt.warn || res.Remaining != tt.remaining {
+			t.Errorf("take %d = %+v; want allowed %t, warn %t, remaining %d", i+1, res, tt.allowed, tt.warn, tt.remaining)
+		}
+	}
+
+	res := l.Take("client")
+	if res.RetryAfter != time.Minute || res.Reset != 5*time.Minute {
+		t.Errorf("refused take = %+v; want a retry after 1m and a reset in 5m", res)
+	}
+
+	// Other keys have their own buckets.
+	if res := l.Take("other"); !res.Allowed || res.Remaining != 4 {
+		t.Errorf("take for another key = %+v; want allowed with 4 left", res)
+	}
+
+	// One token comes back each minute.
+	clk.Advance(time.Minute)
+	if res := l.Take("client"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("take after a minute = %+v; want allowed with 0 left", res)
+	}
+
+	clk.Advance(5 * time.Minute)
+	res = l.Peek("client")
+	if !res.Allowed || res.Warn || res.Remaining != 5 || res.Reset != 0 {
+		t.Errorf("peek after recovering = %+v; want a full bucket without a warning", res)
+	}
+}
+
+func TestLimiterPeekDoesNotSpend(t *testing.T) {
+	l := New(Policy{Burst: 1, Every: time.Minute}, clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)))
+
+	for range 3 {
+		if res := l.Peek("client"); !res.Allowed || res.Remaining != 1 {
+			t.Fatalf("Peek = %+v; want a full bucket", res)
+		}
+	}
+	if len(l.buckets) != 0 {
+		t.Errorf("Peek created %d buckets; want none", len(l.buckets))
+	}
+
+	if res := l.Take("client"); !res.Allowed {
+		t.Fatalf("Take = %+v; want allowed", res)
+	}
+	if res := l.Peek("client"); res.Allowed || res.Remaining != 0 {
+		t.Errorf("Peek after the last token = %+v; want refused", res)
+	}
+}
+
+func TestLimiterEvictsFullBuckets(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	l := New(Policy{Burst: 2, Every: time.Second}, clk)
+
+	// busy spends both of its tokens; every other key spends one.
+	l.Take("busy")
+	l.Take("busy")
+	for i := range sweepEvery - 3 {
+		l.Take(fmt.Sprintf("client-%d", i))
+	}
+	if len(l.buckets) != sweepEvery-2 {
+		t.Fatalf("%d buckets before the sweep; want %d", len(l.buckets), sweepEvery-2)
+	}
+
+	// A second later the one-token clients are full again, and busy is not.
+	clk.Advance(time.Second)
+	l.Take("trigger")
+
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("the sweep forgot a bucket that is still refilling")
+	}
+	if len(l.buckets) != 2 {
+		t.Errorf("%d buckets after the sweep; want busy and trigger", len(l.buckets))
+	}
+
+	// A forgotten key starts again with a full bucket.
+	if res := l.Take("client-0"); res.Remaining != 1 {
+		t.Errorf("take for a swept key = %+v; want 1 left of a new bucket", res)
+	}
+}
@@ -0,0 +1,114 @@
+// Package secrets looks for text that resembles credentials, so that people
+// can be warned before publishing keys and passwords in a snippet.
+package secrets
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Finding is a likely credential on a line of the scanned text.
+type Finding struct {
+	Rule string
+	Line int // 1-based
+}
+
+type rule struct {
+	name  string
+	match func(line string) bool
+}
+
+var (
+	awsAccessKey  = regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)
+	privateKeyPEM = regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY-----`)
+	// A URL with a password in its userinfo, e.g. postgres://app:hunter2@db/prod.
+	connString = regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.\-]*://[^\s:/@]+:[^\s/@]+@[^\s/@]+`)
+	// A credential-looking name assigned a token-like value.
+	assignment = regexp.MustCompile(`(?i)(?:secret|token|api[_\-]?key|access[_\-]?key|password|passwd)["']?\s*[:=]\s*["']?([A-Za-z0-9/+_\-.=]{12,})`)
+	// Candidate tokens for the entropy check. UUIDs and similar values are
+	// split on their hyphens and so fall under the minimum length.
+	tokenCandidate = regexp.MustCompile(`[A-Za-z0-9/+_=]{32,}`)
+	hexOnly        = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+)
+
+// highEntropyMin is the Shannon entropy, in bits per character, above which
+// a long base64-style token is reported. Typical random base64 secrets score
+// well above it; identifiers and words do not.
+const highEntropyMin = 4.5
+
+var rules = []rule{
+	{"AWS access key", awsAccessKey.MatchString},
+	{"private key", privateKeyPEM.MatchString},
+	{"connection string with password", connString.MatchString},
+	{"credential assignment", func(line string) bool {
+		for _, m := range assignment.FindAllStringSubmatch(line, -1) {
+			// Skip placeholders such as password=changeme or token=xxxxxxxx.
+			if entropy(m[1]) >= 3 {
+				return true
+			}
+		}
+		return false
+	}},
+	{"high-entropy token", func(line string) bool {
+		for _, tok := range tokenCandidate.FindAllString(line, -1) {
+			// Hex strings are usually hashes such as git SHAs; they are only
+			// reported when assigned to a credential-looking name above.
+			if hexOnly.MatchString(tok) {
+				continue
+			}
+			if entropy(tok) >= highEntropyMin {
+				return true
+			}
+		}
+		return false
+	}},
+}
+
+// Scan returns a Finding for each line of content that looks like it holds a
+// credential, in line order. A line is reported once, for the first rule it
+// matches.
+func Scan(content string) []Finding {
+	var findings []Finding
+
+	for i, line := range strings.Split(content, "\n") {
+		for _, r := range rules {
+			if r.match(line) {
+				findings = append(findings, Finding{Rule: r.name, Line: i + 1})
+				break
+			}
+		}
+	}
+
+	return findings
+}
+
+// Lines returns the line numbers of findings.
+func Lines(findings []Finding) []int {
+	lines := make([]int, len(findings))
+	for i, f := range findings {
+		lines[i] = f.Line
+	}
+	return lines
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,95 @@
+// Package sharelink signs and verifies expiring share links for snippets.
+//
+// A link payload has the form "{id}.{expires}.{signature}", where expires is
+// a Unix time and the signature is an HMAC-SHA256 over the ID, the expiry and
+// the snippet's share generation. The generation is not part of the payload:
+// the verifier supplies the current value, so incrementing it revokes every
+// link issued before.
+package sharelink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalid is returned for a payload that is malformed, tampered with,
+// revoked or expired. The cases are deliberately not distinguished.
+var ErrInvalid = errors.New("sharelink: invalid link")
+
+// Link is the signed part of a share link.
+type Link struct {
+	SnippetID int
+	Expires   time.Time
+}
+
+// Sign returns the payload for link at the given share generation.
+func Sign(secret []byte, link Link, generation int) string {
+	return message(link.SnippetID, link.Expires) + "." + signature(secret, link.SnippetID, link.Expires, generation)
+}
+
+// Parse splits payload into its link without verifying it, so that the
+// snippet's current generation can be looked up before calling Verify.
+func Parse(payload string) (Link, error) {
+	id, expires, _, err := split(payload)
+	if err != nil {
+		return Link{}, err
+	}
+	return Link{SnippetID: id, Expires: expires}, nil
+}
+
+// Verify checks payload against the snippet's current share generation and
+// the time now, returning the link if it is genuine and unexpired.
+func Verify(secret []byte, payload string, generation int, now time.Time) (Link, error) {
+	id, expires, sig, err := split(payload)
+	if err != nil {
+		return Link{}, err
+	}
+
+	want := signature(secret, id, expires, generation)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return Link{}, ErrInvalid
+	}
+
+	if !now.Before(expires) {
+		return Link{}, ErrInvalid
+	}
+
+	return Link{SnippetID: id, Expires: expires}, nil
+}
+
+func split(payload string) (id int, expires time.Time, sig string, err error) {
+	fields := strings.Split(payload, ".")
+	if len(fields) != 3 {
+		return 0, time.Time{}, "", ErrInvalid
+	}
+
+	// Only canonical decimal forms are accepted, so that each link has
+	// exactly one valid encoding.
+	id, err = strconv.Atoi(fields[0])
+	if err != nil || id < 1 || strconv.Itoa(id) != fields[0] {
+		return 0, time.Time{}, "", ErrInvalid
+	}
+
+	unix, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || strconv.FormatInt(unix, 10) != fields[1] {
+		return 0, time.Time{}, "", ErrInvalid
+	}
+
+	return id, time.Unix(unix, 0).UTC(), fields[2], nil
+}
+
+// message is the unsigned part of a payload.
+func message(id int, expires time.Time) string {
+	return strconv.Itoa(id) + "." + strconv.FormatInt(expires.Unix(), 10)
+}
+
+func signature(secret []byte, id int, expires time.Time, generation int) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(message(id, expires) + "." + strconv.Itoa(generation)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,87 @@
+package sharelink
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	secret = []byte("test secret")
+	now    = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	link   = Link{SnippetID: 42, Expires: now.Add(24 * time.Hour)}
+)
+
+func TestVerify(t *testing.T) {
+	payload := Sign(secret, link, 3)
+
+	got, err := Verify(secret, payload, 3, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SnippetID != link.SnippetID || !got.Expires.Equal(link.Expires) {
+		t.Errorf("Verify = %+v; want %+v", got, link)
+	}
+
+	parsed, err := Parse(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != got {
+		t.Errorf("Parse = %+v; want %+v", parsed, got)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	payload := Sign(secret, link, 3)
+	fields := strings.Split(payload, ".")
+
+	// replace returns payload with field i replaced by value.
+	replace := func(i int, value string) string {
+		f := append([]string(nil), fields...)
+		f[i] = value
+		return strings.Join(f, ".")
+	}
+
+	// flip changes the last character of s.
+	flip := func(s string) string {
+		last := s[len(s)-1]
+		if last == 'A' {
+			return s[:len(s)-1] + "B"
+		}
+		return s[:len(s)-1] + "A"
+	}
+
+	tests := []struct {
+		name       string
+		payload    string
+		secret     []byte
+		generation int
+		now        time.Time
+	}{
+		{"tampered id", replace(0, "43"), secret, 3, now},
+		{"non-canonical id", replace(0, "042"), secret, 3, now},
+		{"negative id", replace(0, "-42"), secret, 3, now},
+		{"tampered expiry", replace(1, "9999999999"), secret, 3, now},
+		{"non-canonical expiry", replace(1, "+"+fields[1]), secret, 3, now},
+		{"tampered signature", replace(2, flip(fields[2])), secret, 3, now},
+		{"empty signature", replace(2, ""), secret, 3, now},
+		{"truncated signature", replace(2, fields[2][:10]), secret, 3, now},
+		{"missing field", fields[0] + "." + fields[1], secret, 3, now},
+		{"extra field", payload + ".x", secret, 3, now},
+		{"wrong secret", payload, []byte("other secret"), 3, now},
+		{"revoked", payload, secret, 4, now},
+		{"expired", payload, secret, 3, link.Expires},
+		{"empty", "", secret, 3, now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Verify(tt.secret, tt.payload, tt.generation, tt.now)
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Verify(%q) error = %v; want ErrInvalid", tt.payload, err)
+			}
+		})
+	}
+}
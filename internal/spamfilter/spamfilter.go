@@ -0,0 +1,325 @@
+// Package spamfilter checks new snippets against rules read from a file, such
+// as a limit on the number of links in a title or a list of blocked domains.
+// Each rule has an action saying what happens to a snippet that breaks it.
+//
+// A rules file has one rule per line: the rule name, the action and a value.
+// Blank lines and lines starting with # are ignored.
+//
+//	# rule        action  value
+//	title-urls    reject  1
+//	content-urls  flag    20
+//	domains       shadow  blocked-domains.txt
+//	words         reject  blocked-words.txt
+//
+// title-urls and content-urls are the number of links allowed before the rule
+// matches. domains and words name a file, relative to the rules file, with one
+// entry per line. A blocked domain also matches its subdomains; a blocked word
+// matches whole words, ignoring case, in the title or content.
+package spamfilter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Action is what happens to a snippet that matches a rule. Actions are
+// ordered by severity, so the most severe of several matches wins.
+type Action int
+
+const (
+	// Allow accepts the snippet. It is the action when no rule matches.
+	Allow Action = iota
+	// Flag accepts the snippet and marks it for a moderator to review.
+	Flag
+	// Shadow accepts the snippet but leaves it out of public listings,
+	// without telling its creator.
+	Shadow
+	// Reject refuses the snippet with a validation error.
+	Reject
+)
+
+var actionNames = map[Action]string{
+	Allow:  "allow",
+	Flag:   "flag",
+	Shadow: "shadow",
+	Reject: "reject",
+}
+
+func (a Action) String() string {
+	return actionNames[a]
+}
+
+func parseAction(s string) (Action, error) {
+	for a, name := range actionNames {
+		if name == s && a != Allow {
+			return a, nil
+		}
+	}
+	return Allow, fmt.Errorf("unknown action %q (want flag, shadow or reject)", s)
+}
+
+// Decision is the outcome of checking a snippet.
+type Decision struct {
+	Action Action
+	Rule   string // the rule that matched, e.g. "title-urls"
+	Detail string // what matched, e.g. "more than 1 link"
+}
+
+// Matched reports whether any rule matched.
+func (d Decision) Matched() bool {
+	return d.Action != Allow
+}
+
+// urlPattern finds links written with a scheme or starting with "www.".
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'()]+`)
+
+type rule struct {
+	name   string
+	action Action
+	match  func(title, content string) (detail string, ok bool)
+}
+
+// Ruleset is a parsed set of rules. It is safe for concurrent use.
+type Ruleset struct {
+	rules []rule
+}
+
+// Check returns the decision for a snippet with title and content: the most
+// severe action of the rules it matches, or Allow.
+func (rs *Ruleset) Check(title, content string) Decision {
+	var d Decision
+	if rs == nil {
+		return d
+	}
+
+	for _, r := range rs.rules {
+		if r.action <= d.Action {
+			continue
+		}
+		if detail, ok := r.match(title, content); ok {
+			d = Decision{Action: r.action, Rule: r.name, Detail: detail}
+		}
+	}
+	return d
+}
+
+// ParseFile reads the rules file at path, along with any domain and word
+// lists it names.
+func ParseFile(path string) (*Ruleset, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &Ruleset{}
+	dir := filepath.Dir(path)
+
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		r, err := parseRule(line, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		rs.rules = append(rs.rules, r)
+	}
+
+	return rs, sc.Err()
+}
+
+func parseRule(line, dir string) (rule, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return rule{}, fmt.Errorf("want rule, action and value, got %q", line)
+	}
+	name, value := fields[0], fields[2]
+
+	action, err := parseAction(fields[1])
+	if err != nil {
+		return rule{}, err
+	}
+
+	r := rule{name: name, action: action}
+
+	switch name {
+	case "title-urls", "content-urls":
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return rule{}, fmt.Errorf("%s: limit must be a non-negative number, got %q", name, value)
+		}
+		fromTitle := name == "title-urls"
+		r.match = func(title, content string) (string, bool) {
+			text := content
+			if fromTitle {
+				text = title
+			}
+			// Only count as far as needed to exceed the limit.
+			n := len(urlPattern.FindAllStringIndex(text, limit+1))
+			if n <= limit {
+				return "", false
+			}
+			if limit == 1 {
+				return "more than 1 link", true
+			}
+			return fmt.Sprintf("more than %d links", limit), true
+		}
+
+	case "domains":
+		entries, err := readList(filepath.Join(dir, value))
+		if err != nil {
+			return rule{}, err
+		}
+		blocked := make(map[string]bool, len(entries))
+		for _, d := range entries {
+			blocked[strings.TrimSuffix(strings.ToLower(d), ".")] = true
+		}
+		r.match = func(title, content string) (string, bool) {
+			for _, text := range []string{title, content} {
+				for _, u := range urlPattern.FindAllString(text, -1) {
+					if d := blockedDomain(blocked, linkHost(u)); d != "" {
+						return d, true
+					}
+				}
+			}
+			return "", false
+		}
+
+	case "words":
+		entries, err := readList(filepath.Join(dir, value))
+		if err != nil {
+			return rule{}, err
+		}
+		if len(entries) == 0 {
+			r.match = func(string, string) (string, bool) { return "", false }
+			break
+		}
+		quoted := make([]string, len(entries))
+		for i, w := range entries {
+			quoted[i] = regexp.QuoteMeta(w)
+		}
+		words := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+		r.match = func(title, content string) (string, bool) {
+			for _, text := range []string{title, content} {
+				if w := words.FindString(text); w != "" {
+					return strings.ToLower(w), true
+				}
+			}
+			return "", false
+		}
+
+	default:
+		return rule{}, fmt.Errorf("unknown rule %q", name)
+	}
+
+	return r, nil
+}
+
+// readList returns the non-blank, non-comment lines of the file at path.
+func readList(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	return entries, nil
+}
+
+// linkHost returns the lower-cased host name of a link found by urlPattern.
+func linkHost(link string) string {
+	if i := strings.Index(link, "://"); i >= 0 {
+		link = link[i+3:]
+	}
+	if i := strings.IndexAny(link, "/?#"); i >= 0 {
+		link = link[:i]
+	}
+	if i := strings.LastIndexByte(link, '@'); i >= 0 {
+		link = link[i+1:]
+	}
+	if i := strings.IndexByte(link, ':'); i >= 0 {
+		link = link[:i]
+	}
+	return strings.TrimSuffix(strings.ToLower(link), ".")
+}
+
+// blockedDomain returns the entry in blocked that host is, or is a subdomain
+// of, or "" if there is none.
+func blockedDomain(blocked map[string]bool, host string) string {
+	for host != "" {
+		if blocked[host] {
+			return host
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return ""
+}
+
+// Filter holds the current rules from a rules file. Reload replaces them
+// without interrupting checks in progress. A nil *Filter allows everything.
+type Filter struct {
+	path  string
+	rules atomic.Pointer[Ruleset]
+}
+
+// Load returns a Filter with the rules from the file at path.
+func Load(path string) (*Filter, error) {
+	f := &Filter{path: path}
+	err := f.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Path returns the rules file the filter reads.
+func (f *Filter) Path() string {
+	return f.path
+}
+
+// Reload reads the rules file again. If it cannot be read or parsed, the
+// current rules stay in place and the error is returned.
+func (f *Filter) Reload() error {
+	rs, err := ParseFile(f.path)
+	if err != nil {
+		return err
+	}
+	f.rules.Store(rs)
+	return nil
+}
+
+// Rules returns the number of rules currently loaded.
+func (f *Filter) Rules() int {
+	if f == nil {
+		return 0
+	}
+	return len(f.rules.Load().rules)
+}
+
+// Check returns the decision for a snippet under the current rules.
+func (f *Filter) Check(title, content string) Decision {
+	if f == nil {
+		return Decision{}
+	}
+	return f.rules.Load().Check(title, content)
+}
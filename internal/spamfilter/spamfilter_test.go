@@ -0,0 +1,189 @@
+package spamfilter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRules writes a rules file and any list files to a new directory and
+// returns the rules file's path.
+func writeRules(t *testing.T, rules string, lists map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range lists {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+	path := filepath.Join(dir, "spam.rules")
+	writeFile(t, path, rules)
+	return path
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+const testRules = `
+# rule        action  value
+title-urls    reject  1
+content-urls  flag    3
+domains       shadow  domains.txt
+words         reject  words.txt
+`
+
+var testLists = map[string]string{
+	"domains.txt": "# spam hosts\ncheap-pills.example\nCasino.example.\n",
+	"words.txt":   "viagra\nfree money\n",
+}
+
+func TestCheck(t *testing.T) {
+	f, err := Load(writeRules(t, testRules, testLists))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		title   string
+		content string
+		want    Decision
+	}{
+		{
+			name:    "clean",
+			title:   "Reading a file in Go",
+			content: "See https://go.dev/doc for more.",
+			want:    Decision{},
+		},
+		{
+			name:  "one link in title",
+			title: "Notes from https://go.dev",
+			want:  Decision{},
+		},
+		{
+			name:  "links in title",
+			title: "https://a.example https://b.example www.c.example",
+			want:  Decision{Action: Reject, Rule: "title-urls", Detail: "more than 1 link"},
+		},
+		{
+			name:    "links in content",
+			content: "http://a.example\nhttp://b.example\nhttp://c.example\nhttp://d.example",
+			want:    Decision{Action: Flag, Rule: "content-urls", Detail: "more than 3 links"},
+		},
+		{
+			name:    "blocked domain",
+			content: "Deals at https://shop.casino.example:8443/offer",
+			want:    Decision{Action: Shadow, Rule: "domains", Detail: "casino.example"},
+		},
+		{
+			name:    "lookalike domain",
+			content: "https://notcasino.example/",
+			want:    Decision{},
+		},
+		{
+			name:  "blocked word",
+			title: "Get FREE MONEY now",
+			want:  Decision{Action: Reject, Rule: "words", Detail: "free money"},
+		},
+		{
+			name:    "word inside another word",
+			content: "overviagrant",
+			want:    Decision{},
+		},
+		{
+			name:    "most severe action wins",
+			content: "www.cheap-pills.example viagra",
+			want:    Decision{Action: Reject, Rule: "words", Detail: "viagra"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := f.Check(tt.title, tt.content)
+			if got != tt.want {
+				t.Errorf("Check = %+v; want %+v", got, tt.want)
+			}
+			if got.Matched() != (tt.want.Action != Allow) {
+				t.Errorf("Matched = %t", got.Matched())
+			}
+		})
+	}
+}
+
+func TestNilFilterAllows(t *testing.T) {
+	var f *Filter
+	if got := f.Check("https://a https://b", "viagra"); got.Matched() {
+		t.Errorf("Check = %+v; want Allow", got)
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"unknown rule", "links reject 1", `unknown rule "links"`},
+		{"unknown action", "title-urls delete 1", `unknown action "delete"`},
+		{"allow is not an action", "title-urls allow 1", `unknown action "allow"`},
+		{"bad limit", "title-urls reject many", "non-negative number"},
+		{"missing value", "title-urls reject", "want rule, action and value"},
+		{"missing list", "domains shadow nope.txt", "nope.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFile(writeRules(t, tt.rules, nil))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseFile error = %v; want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeRules(t, "words flag words.txt\n", map[string]string{"words.txt": "spam\n"})
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Check("spam", ""); got.Action != Flag {
+		t.Fatalf("before reload: Check = %+v; want Flag", got)
+	}
+
+	// Changes to both the rules file and the lists it names are picked up.
+	writeFile(t, filepath.Join(filepath.Dir(path), "words.txt"), "eggs\n")
+	writeFile(t, path, "words reject words.txt\n")
+
+	err = f.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Check("spam", ""); got.Matched() {
+		t.Errorf("after reload: Check(spam) = %+v; want Allow", got)
+	}
+	if got := f.Check("eggs", ""); got.Action != Reject {
+		t.Errorf("after reload: Check(eggs) = %+v; want Reject", got)
+	}
+
+	// A broken file leaves the previous rules in place.
+	writeFile(t, path, "words reject missing.txt\n")
+
+	err = f.Reload()
+	if err == nil {
+		t.Fatal("Reload of a broken rules file succeeded")
+	}
+	if got := f.Check("eggs", ""); got.Action != Reject {
+		t.Errorf("after failed reload: Check(eggs) = %+v; want Reject", got)
+	}
+	if f.Rules() != 1 {
+		t.Errorf("Rules = %d; want 1", f.Rules())
+	}
+}
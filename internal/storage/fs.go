@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"snippet.robertgleason.ca/internal/models"
+)
+
+var (
+	_ models.ContentStore  = (*FSStore)(nil)
+	_ models.ContentLister = (*FSStore)(nil)
+)
+
+// FSStore keeps snippet content as files under Dir, sharded into 256
+// subdirectories by ID so that no single directory grows too large.
+type FSStore struct {
+	Dir string
+}
+
+func (s *FSStore) path(id int) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%02x", id%256), strconv.Itoa(id))
+}
+
+// Put writes the content for id, replacing any existing content atomically.
+func (s *FSStore) Put(ctx context.Context, id int, r io.Reader) error {
+	path := s.path(id)
+
+	err := os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FSStore) Get(ctx context.Context, id int) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &models.NotFoundError{Entity: "snippet content", ID: id}
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Delete removes the content for id. Deleting content that does not exist is
+// not an error.
+func (s *FSStore) Delete(ctx context.Context, id int) error {
+	err := os.Remove(s.path(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// IDs returns the ID of every snippet with content in the store.
+func (s *FSStore) IDs(ctx context.Context) ([]int, error) {
+	var ids []int
+
+	err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == s.Dir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		id, err := strconv.Atoi(d.Name())
+		if err != nil {
+			// Temporary files and anything else that isn't ours.
+			return nil
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
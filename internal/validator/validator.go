@@ -4,6 +4,7 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -56,3 +57,72 @@ func MinChars(value string, n int) bool {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// DefaultControlRatio is the proportion of control characters above which
+// PlausiblyText treats a value as binary.
+const DefaultControlRatio = 0.1
+
+// PlausiblyText reports whether value looks like text rather than binary data,
+// using DefaultControlRatio.
+func PlausiblyText(value string) bool {
+	return PlausiblyTextWithin(value, DefaultControlRatio)
+}
+
+// PlausiblyTextWithin reports whether value is valid UTF-8 and no more than
+// maxRatio of its characters are control characters other than tab, newline
+// and carriage return.
+func PlausiblyTextWithin(value string, maxRatio float64) bool {
+	if !utf8.ValidString(value) {
+		return false
+	}
+
+	var total, control int
+	for _, r := range value {
+		total++
+		if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+			control++
+		}
+	}
+	if total == 0 {
+		return true
+	}
+	return float64(control)/float64(total) <= maxRatio
+}
+
+// passwordStrengthLabels describes each PasswordStrength score.
+var passwordStrengthLabels = [...]string{"very weak", "weak", "fair", "good", "strong"}
+
+// PasswordStrength scores password from 0 to 4, one point for each of: at
+// least 12 characters, both upper and lower case letters, a digit, and a
+// character that is not a letter, digit or space. It also returns a label
+// for the score, from "very weak" to "strong".
+func PasswordStrength(password string) (int, string) {
+	var upper, lower, digit, special bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r) && !unicode.IsSpace(r):
+			special = true
+		}
+	}
+
+	score := 0
+	for _, ok := range []bool{utf8.RuneCountInString(password) >= 12, upper && lower, digit, special} {
+		if ok {
+			score++
+		}
+	}
+	return score, passwordStrengthLabels[score]
+}
+
+// PasswordStrong reports whether password scores at least 2 on
+// PasswordStrength.
+func PasswordStrong(password string) bool {
+	score, _ := PasswordStrength(password)
+	return score >= 2
+}
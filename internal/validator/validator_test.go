@@ -0,0 +1,161 @@
+package validator
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+// fuzzSeeds are corner-case inputs shared by the fuzz tests.
+var fuzzSeeds = []string{
+	"",
+	" ",
+	"   \t\n\r ",
+	"\u00a0\u2003\u3000", // non-breaking, em and ideographic spaces
+	"hello",
+	"  hello  ",
+	"héllo wörld",
+	"日本語のテキスト",
+	"👩‍💻🚀",
+	"\x00",
+	"a\x00b",
+	"\xff\xfe\xfd", // invalid UTF-8
+	"\xe6\x97",     // truncated multibyte sequence
+}
+
+func FuzzMaxChars(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		for _, n := range []int{-1, 0, 1, 5, 100} {
+			f.Add(s, n)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, s string, n int) {
+		got := MaxChars(s, n)
+
+		if count := len([]rune(s)); got != (count <= n) {
+			t.Errorf("MaxChars(%q, %d) = %t with %d runes", s, n, got, count)
+		}
+		if got && n < 0 {
+			t.Errorf("MaxChars(%q, %d) = true for a negative limit", s, n)
+		}
+		if got && !MaxChars(s, n+1) && n < math.MaxInt {
+			t.Errorf("MaxChars(%q, %d) = true but MaxChars(%q, %d) = false", s, n, s, n+1)
+		}
+	})
+}
+
+func FuzzMinChars(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		for _, n := range []int{-1, 0, 1, 5, 100} {
+			f.Add(s, n)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, s string, n int) {
+		got := MinChars(s, n)
+
+		if count := len([]rune(s)); got != (count >= n) {
+			t.Errorf("MinChars(%q, %d) = %t with %d runes", s, n, got, count)
+		}
+		if n <= 0 && !got {
+			t.Errorf("MinChars(%q, %d) = false for a non-positive minimum", s, n)
+		}
+		// Every string is either at most n-1 or at least n characters long.
+		if n > math.MinInt && got == MaxChars(s, n-1) {
+			t.Errorf("MinChars(%q, %d) and MaxChars(%q, %d) are both %t", s, n, s, n-1, got)
+		}
+	})
+}
+
+func FuzzNotBlank(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		got := NotBlank(s)
+
+		if s == "" && got {
+			t.Error("NotBlank(\"\") = true")
+		}
+		if padded := " \t" + s + "\n "; NotBlank(padded) != got {
+			t.Errorf("NotBlank(%q) = %t but NotBlank(%q) = %t", s, got, padded, !got)
+		}
+		if !got && utf8.ValidString(s) && strings.TrimFunc(s, unicode.IsSpace) != "" {
+			t.Errorf("NotBlank(%q) = false but it has non-space characters", s)
+		}
+		if got && strings.TrimFunc(s, unicode.IsSpace) == "" {
+			t.Errorf("NotBlank(%q) = true but it is all spaces", s)
+		}
+	})
+}
+
+func TestPasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		score    int
+		label    string
+	}{
+		{"", 0, "very weak"},
+		{"password", 0, "very weak"},
+		{"passwordpassword", 1, "weak"}, // length
+		{"Password", 1, "weak"},         // upper and lower
+		{"PASSWORD", 0, "very weak"},    // upper alone is not enough
+		{"pa55word", 1, "weak"},         // digit
+		{"pass word!", 1, "weak"},       // special; the space is not
+		{"Pa55word", 2, "fair"},         // upper and lower, digit
+		{"Pa55word!", 3, "good"},        // upper and lower, digit, special
+		{"Pa55word!long", 4, "strong"},  // all four
+		{"Ünïcödé-pässwörd", 3, "good"}, // length, upper and lower, special
+		{"日本語のパスワード12345", 2, "fair"},   // length, digit
+	}
+
+	for _, tt := range tests {
+		score, label := PasswordStrength(tt.password)
+		if score != tt.score || label != tt.label {
+			t.Errorf("PasswordStrength(%q) = %d, %q; want %d, %q", tt.password, score, label, tt.score, tt.label)
+		}
+		if got, want := PasswordStrong(tt.password), tt.score >= 2; got != want {
+			t.Errorf("PasswordStrong(%q) = %t; want %t", tt.password, got, want)
+		}
+	}
+}
+
+func TestPlausiblyText(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"empty", "", true},
+		{"code", "func main() {\n\tfmt.Println(\"hi\")\r\n}", true},
+		{"box drawing", "┌──────┐\n│ snip │\n└──────┘", true},
+		{"a few escape codes", "\x1b[1mbold\x1b[0m and plenty of plain text around it", true},
+		{"UTF-16LE with BOM", "\xff\xfeh\x00i\x00\n\x00", false},
+		{"UTF-16BE with BOM", "\xfe\xff\x00h\x00i\x00\n", false},
+		{"zip file", "PK\x03\x04\x14\x00\x00\x00\x08\x00\x21\x00", false},
+		{"NUL padded", "hello\x00\x00\x00\x00\x00", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PlausiblyText(tt.value); got != tt.want {
+				t.Errorf("PlausiblyText(%q) = %t; want %t", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlausiblyTextWithin(t *testing.T) {
+	// One control character in ten is exactly the ratio, and allowed.
+	value := "abcdefghi\x07"
+	if !PlausiblyTextWithin(value, 0.1) {
+		t.Errorf("PlausiblyTextWithin(%q, 0.1) = false at the ratio", value)
+	}
+	if PlausiblyTextWithin(value, 0.09) {
+		t.Errorf("PlausiblyTextWithin(%q, 0.09) = true above the ratio", value)
+	}
+}
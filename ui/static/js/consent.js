@@ -0,0 +1,31 @@
+// Cookie consent banner. Posts the visitor's choice to /consent, which stores
+// it in a cookie, then removes the banner.
+(function () {
+    var banner = document.querySelector('.consent-banner');
+    if (!banner) {
+        return;
+    }
+
+    var token = banner.getAttribute('data-csrf-token');
+    var buttons = banner.querySelectorAll('button[data-consent-analytics]');
+
+    Array.prototype.forEach.call(buttons, function (button) {
+        button.addEventListener('click', function () {
+            fetch('/consent', {
+                method: 'POST',
+                credentials: 'same-origin',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'X-CSRF-Token': token
+                },
+                body: JSON.stringify({
+                    analytics: button.getAttribute('data-consent-analytics') === 'true'
+                })
+            }).then(function (response) {
+                if (response.ok) {
+                    banner.parentNode.removeChild(banner);
+                }
+            });
+        });
+    });
+})();
@@ -0,0 +1,55 @@
+// Copy-to-clipboard buttons. Each button carries a data-copy-url pointing at
+// the snippet's plain-text endpoint; the text is fetched from the server so
+// the copy is exact regardless of how the page rendered it.
+(function () {
+    function fallbackCopy(text) {
+        var textarea = document.createElement('textarea');
+        textarea.value = text;
+        textarea.setAttribute('readonly', '');
+        textarea.style.position = 'absolute';
+        textarea.style.left = '-9999px';
+        document.body.appendChild(textarea);
+        textarea.select();
+        try {
+            return document.execCommand('copy');
+        } finally {
+            document.body.removeChild(textarea);
+        }
+    }
+
+    function copyText(text) {
+        if (navigator.clipboard && window.isSecureContext) {
+            return navigator.clipboard.writeText(text).catch(function () {
+                if (!fallbackCopy(text)) {
+                    throw new Error('copy failed');
+                }
+            });
+        }
+        return fallbackCopy(text) ? Promise.resolve() : Promise.reject(new Error('copy failed'));
+    }
+
+    var buttons = document.querySelectorAll('button[data-copy-url]');
+    Array.prototype.forEach.call(buttons, function (button) {
+        var label = button.textContent;
+        button.addEventListener('click', function () {
+            fetch(button.getAttribute('data-copy-url'), {credentials: 'same-origin'})
+                .then(function (response) {
+                    if (!response.ok) {
+                        throw new Error(response.statusText);
+                    }
+                    return response.text();
+                })
+                .then(copyText)
+                .then(function () {
+                    button.textContent = 'Copied!';
+                }, function () {
+                    button.textContent = 'Copy failed';
+                })
+                .then(function () {
+                    setTimeout(function () {
+                        button.textContent = label;
+                    }, 2000);
+                });
+        });
+    });
+})();
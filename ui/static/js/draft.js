@@ -0,0 +1,38 @@
+// Draft autosave for the create form. Every few seconds, if the title or
+// content has changed, the current values are posted to the form's
+// data-draft-url so they can be restored after an accidental tab close.
+(function () {
+    var form = document.querySelector('form[data-draft-url]');
+    if (!form) {
+        return;
+    }
+
+    var url = form.getAttribute('data-draft-url');
+    var token = form.querySelector('input[name="csrf_token"]').value;
+    var title = form.querySelector('[name="title"]');
+    var content = form.querySelector('[name="content"]');
+    var language = form.querySelector('[name="language"]');
+    var last = title.value + '\u0000' + content.value;
+
+    setInterval(function () {
+        var current = title.value + '\u0000' + content.value;
+        if (current === last) {
+            return;
+        }
+        last = current;
+
+        fetch(url, {
+            method: 'POST',
+            credentials: 'same-origin',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': token
+            },
+            body: JSON.stringify({
+                title: title.value,
+                content: content.value,
+                language: language ? language.value : ''
+            })
+        });
+    }, 5000);
+})();
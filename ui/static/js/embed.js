@@ -0,0 +1,50 @@
+// Embeds a snippet on another site. GET /snippet/view/{id}/embed.js serves
+// this function followed by a call with the snippet's details, so a single
+// <script> tag renders the snippet where it stands. The <pre> is part of the
+// host page and grows with its content, so unlike an iframe the embedding
+// site does not need to know its height. If the host page loads highlight.js
+// or Prism, the code is highlighted with it.
+(function (snippet) {
+    var script = document.currentScript;
+    if (!script) {
+        return;
+    }
+
+    var figure = document.createElement('figure');
+    figure.className = 'snipp-embed';
+
+    var pre = document.createElement('pre');
+    pre.setAttribute('data-snipp-id', snippet.id);
+    var code = document.createElement('code');
+    if (snippet.language) {
+        code.className = 'language-' + snippet.language;
+    }
+    code.textContent = 'Loading…';
+    pre.appendChild(code);
+    figure.appendChild(pre);
+
+    var caption = document.createElement('figcaption');
+    var link = document.createElement('a');
+    link.href = snippet.url;
+    link.textContent = snippet.title;
+    caption.appendChild(link);
+    figure.appendChild(caption);
+
+    script.insertAdjacentElement('afterend', figure);
+
+    fetch(snippet.content_url, {credentials: 'omit'}).then(function (response) {
+        if (!response.ok) {
+            throw new Error('Loading the snippet failed');
+        }
+        return response.text();
+    }).then(function (text) {
+        code.textContent = text;
+        if (window.hljs && window.hljs.highlightElement) {
+            window.hljs.highlightElement(code);
+        } else if (window.Prism && window.Prism.highlightElement) {
+            window.Prism.highlightElement(code);
+        }
+    }).catch(function () {
+        code.textContent = 'This snippet could not be loaded.';
+    });
+})
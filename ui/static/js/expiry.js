@@ -0,0 +1,15 @@
+// Live expiry preview for the create form. Each expires radio button carries
+// the date it would give in data-expires-on; choosing one shows that date.
+(function () {
+    var preview = document.getElementById('expires-preview');
+    if (!preview) {
+        return;
+    }
+
+    var radios = document.querySelectorAll('input[name="expires"][data-expires-on]');
+    for (var i = 0; i < radios.length; i++) {
+        radios[i].addEventListener('change', function (e) {
+            preview.textContent = 'This snippet will expire on ' + e.target.getAttribute('data-expires-on') + '.';
+        });
+    }
+})();
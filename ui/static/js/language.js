@@ -0,0 +1,41 @@
+// Language dropdown on the view page, shown only to the owner. Changing it
+// saves at once and switches the highlighting class on the code block.
+(function () {
+    var select = document.querySelector('select[data-language-url]');
+    if (!select) {
+        return;
+    }
+    var label = select.parentNode;
+    label.hidden = false;
+
+    var previous = select.value;
+    select.addEventListener('change', function () {
+        select.disabled = true;
+        fetch(select.getAttribute('data-language-url'), {
+            method: 'POST',
+            credentials: 'same-origin',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': select.getAttribute('data-csrf-token')
+            },
+            body: JSON.stringify({language: select.value})
+        }).then(function (response) {
+            return response.json().catch(function () {
+                return {};
+            }).then(function (body) {
+                if (!response.ok) {
+                    throw new Error((body.fields && body.fields.language) || 'Changing the language failed');
+                }
+                document.querySelectorAll('.snippet pre code').forEach(function (code) {
+                    code.className = body.language ? 'language-' + body.language : '';
+                });
+                previous = body.language;
+            });
+        }).catch(function (err) {
+            select.value = previous;
+            window.alert(err.message);
+        }).finally(function () {
+            select.disabled = false;
+        });
+    });
+})();
@@ -0,0 +1,33 @@
+// Pin toggle on the view page. The pin form works as a plain post; with
+// JavaScript it is sent with fetch instead and the button flips in place.
+(function () {
+    var form = document.querySelector('form.pin');
+    if (!form) {
+        return;
+    }
+
+    var button = form.querySelector('button');
+
+    form.addEventListener('submit', function (e) {
+        e.preventDefault();
+        button.disabled = true;
+
+        fetch(form.action, {
+            method: 'POST',
+            credentials: 'same-origin',
+            body: new URLSearchParams(new FormData(form))
+        }).then(function (response) {
+            if (!response.ok) {
+                throw new Error('pin failed');
+            }
+            var pinned = button.getAttribute('aria-pressed') !== 'true';
+            button.setAttribute('aria-pressed', String(pinned));
+            button.textContent = pinned ? '📌 Unpin' : '📌 Pin to my snippets';
+            form.action = form.getAttribute(pinned ? 'data-unpin-url' : 'data-pin-url');
+        }).catch(function () {
+            form.submit();
+        }).finally(function () {
+            button.disabled = false;
+        });
+    });
+})();
@@ -0,0 +1,44 @@
+// Inline rename on My Snippets. The rename buttons are hidden until this
+// script runs, since renaming needs fetch.
+(function () {
+    var table = document.querySelector('table.user-snippets');
+    if (!table) {
+        return;
+    }
+
+    table.querySelectorAll('button.rename').forEach(function (button) {
+        button.hidden = false;
+
+        button.addEventListener('click', function () {
+            var link = button.parentNode.querySelector('a');
+            var title = window.prompt('New title', link.textContent);
+            if (title === null || title === link.textContent) {
+                return;
+            }
+
+            button.disabled = true;
+            fetch(button.getAttribute('data-rename-url'), {
+                method: 'POST',
+                credentials: 'same-origin',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'X-CSRF-Token': table.getAttribute('data-csrf-token')
+                },
+                body: JSON.stringify({title: title})
+            }).then(function (response) {
+                return response.json().catch(function () {
+                    return {};
+                }).then(function (body) {
+                    if (!response.ok) {
+                        throw new Error((body.fields && body.fields.title) || 'Rename failed');
+                    }
+                    link.textContent = body.title;
+                });
+            }).catch(function (err) {
+                window.alert(err.message);
+            }).finally(function () {
+                button.disabled = false;
+            });
+        });
+    });
+})();
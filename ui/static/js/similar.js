@@ -0,0 +1,36 @@
+// Similar snippets sidebar on the view page. The list is loaded after the
+// page, and the sidebar stays hidden if there is nothing to show.
+(function () {
+    var aside = document.querySelector('aside.similar');
+    if (!aside) {
+        return;
+    }
+
+    fetch(aside.getAttribute('data-similar-url'), {
+        credentials: 'same-origin',
+        headers: {'Accept': 'application/json'}
+    }).then(function (response) {
+        if (!response.ok) {
+            throw new Error('similar snippets failed');
+        }
+        return response.json();
+    }).then(function (snippets) {
+        if (snippets.length === 0) {
+            return;
+        }
+        var list = aside.querySelector('ul');
+        snippets.forEach(function (s) {
+            var link = document.createElement('a');
+            link.href = s.url;
+            link.textContent = s.title;
+            link.title = s.excerpt;
+
+            var item = document.createElement('li');
+            item.appendChild(link);
+            list.appendChild(item);
+        });
+        aside.hidden = false;
+    }).catch(function () {
+        // The sidebar is an extra; leave it hidden.
+    });
+})();